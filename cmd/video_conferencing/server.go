@@ -11,10 +11,13 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/handlers"
@@ -44,6 +47,9 @@ import (
 
 const defaultPort = "8080"
 
+// shutdownTimeout bounds how long in-flight requests may take to finish after a shutdown signal
+const shutdownTimeout = 10 * time.Second
+
 func main() {
 	configDir := flag.String("config", ".", "Directory which contains the config.json")
 	if configDir != nil {
@@ -64,6 +70,52 @@ func main() {
 		Filename:              "app-builder-logs",
 	})
 
+	if err := utils.CheckTestMode(); err != nil {
+		logger.Fatal().Err(err).Msg("Refusing to start")
+		return
+	}
+
+	if err := utils.CheckEventWindow(); err != nil {
+		logger.Fatal().Err(err).Msg("Refusing to start")
+		return
+	}
+
+	if err := services.CheckAccountLinkingPolicy(); err != nil {
+		logger.Fatal().Err(err).Msg("Refusing to start")
+		return
+	}
+
+	if err := services.CheckChannelAutoClose(); err != nil {
+		logger.Fatal().Err(err).Msg("Refusing to start")
+		return
+	}
+
+	if err := services.CheckPurge(); err != nil {
+		logger.Fatal().Err(err).Msg("Refusing to start")
+		return
+	}
+
+	if err := services.CheckBreakGlass(); err != nil {
+		logger.Fatal().Err(err).Msg("Refusing to start")
+		return
+	}
+
+	if err := services.CheckLoginCheckOrder(); err != nil {
+		logger.Fatal().Err(err).Msg("Refusing to start")
+		return
+	}
+
+	// Recording is on by default, so deployments which never record are only warned about missing REST credentials
+	if viper.GetBool("ENABLE_RECORDING") && !utils.TestModeEnabled() {
+		if err := utils.CheckRESTCredentials(); err != nil {
+			logger.Warn().Err(err).Msg("Cloud recording will fail")
+		}
+	}
+
+	if utils.TestModeEnabled() {
+		logger.Warn().Str("user", viper.GetString("TEST_MODE_USER_EMAIL")).Msg("Test mode is enabled, external calls are faked and every login is the test user")
+	}
+
 	port := viper.GetString("PORT")
 
 	database, err := models.CreateDB(viper.GetString("DATABASE_URL"))
@@ -78,45 +130,99 @@ func main() {
 		migrations.RunMigration(configDir)
 	}
 
+	if viper.GetBool("ENABLE_CHANNEL_AUTO_CLOSE") {
+		services.StartChannelAutoClose(database, logger, time.Duration(viper.GetInt("CHANNEL_IDLE_CHECK_INTERVAL"))*time.Second, time.Duration(viper.GetInt("CHANNEL_IDLE_TIMEOUT"))*time.Second)
+	}
+
+	services.StartPurge(database, logger, time.Duration(viper.GetInt("AUDIT_PURGE_INTERVAL"))*time.Second)
+
+	shutdownTracing, err := utils.SetupTracing(viper.GetBool("ENABLE_TRACING"))
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Error initializing tracing")
+		return
+	}
+
 	router := mux.NewRouter()
 
 	config := generated.Config{
 		Resolvers: &graph.Resolver{
-			DB:     database,
-			Logger: logger,
+			DB:           database,
+			Logger:       logger,
+			TokenLimiter: utils.NewRateLimiter(viper.GetInt("TOKEN_RATE_LIMIT"), time.Duration(viper.GetInt("TOKEN_RATE_LIMIT_WINDOW"))*time.Second),
 		},
 	}
 
 	srv := handler.NewDefaultServer(generated.NewExecutableSchema(config))
+	srv.AroundResponses(graph.WarningsMiddleware)
+	auditForwarder, err := services.NewAuditForwarder(logger)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Error initializing audit sink")
+		return
+	}
+
 	requestHandler := services.ServiceRouter{
 		DB:     database,
 		Logger: logger,
+		Audit:  auditForwarder,
+	}
+
+	if !utils.TestModeEnabled() {
+		if err := requestHandler.CheckOAuthProviders(); err != nil {
+			logger.Fatal().Err(err).Msg("Refusing to start")
+			return
+		}
 	}
 
 	router.HandleFunc("/", playground.Handler("GraphQL playground", "/query"))
 	router.Handle("/query", srv)
 	router.HandleFunc("/oauth", http.HandlerFunc(requestHandler.OAuth))
 	router.HandleFunc("/pstn", http.HandlerFunc(requestHandler.PSTN))
+	router.HandleFunc("/oauth/authorize", http.HandlerFunc(requestHandler.Authorize))
+	router.HandleFunc("/oauth/native", http.HandlerFunc(requestHandler.NativeLogin))
+	router.HandleFunc("/oauth/nonce", http.HandlerFunc(requestHandler.Nonce))
+	router.HandleFunc("/oauth/retry", http.HandlerFunc(requestHandler.RetryMobileLogin))
+	router.HandleFunc("/oauth/token", http.HandlerFunc(requestHandler.ServiceTokenEndpoint))
+	router.HandleFunc("/oauth/preview", http.HandlerFunc(requestHandler.TokenPagePreview))
+
+	trustedProxies, err := middleware.ParseTrustedProxies(viper.GetStringSlice("TRUSTED_PROXIES"))
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Error parsing trusted proxies")
+		return
+	}
+
+	router.Use(middleware.RequestIDHandler(viper.GetBool("ADOPT_REQUEST_ID")))
+
+	router.Use(middleware.TracingHandler())
 
 	router.Use(hlog.AccessHandler(func(r *http.Request, status, size int, duration time.Duration) {
-		logger.Info().
+		event := logger.Info().
+			Str("request_id", middleware.GetRequestIDFromContext(r.Context())).
 			Str("method", r.Method).
-			Stringer("url", r.URL).
+			Str("ip", middleware.ClientIP(r, trustedProxies)).
+			Str("url", middleware.AccessLogURL(r.URL)).
 			Int("status", status).
 			Int("size", size).
-			Dur("duration", duration).
-			Msg("")
+			Dur("duration", duration)
+
+		if headers := middleware.AccessLogHeaders(r.Header); len(headers) > 0 {
+			event = event.Interface("headers", headers)
+		}
+
+		event.Msg("")
 	}))
 
 	logger.Info().Str("origin", viper.GetString("ALLOWED_ORIGIN")).Msg("")
 	router.Use(cors.New(cors.Options{
 		AllowedOrigins:   []string{viper.GetString("ALLOWED_ORIGIN")},
 		AllowCredentials: true,
-		AllowedHeaders:   []string{"authorization", "content-type"},
+		AllowedHeaders:   []string{"authorization", "content-type", "x-request-id", "traceparent"},
+		ExposedHeaders:   []string{middleware.RequestIDHeader, middleware.RotatedTokenHeader, "WWW-Authenticate"},
 		Debug:            false,
 	}).Handler)
 	router.Use(handlers.RecoveryHandler())
 
+	router.Use(middleware.RealIPHandler(trustedProxies))
+
 	router.Use(middleware.AuthHandler(database, logger))
 
 	if viper.GetBool("ENABLE_NEWRELIC_MONITORING") {
@@ -135,5 +241,46 @@ func main() {
 	}
 
 	logger.Debug().Str("PORT", port)
-	logger.Fatal().Err(http.ListenAndServe(":"+port, router))
+
+	server := &http.Server{Addr: ":" + port, Handler: router}
+	listen := server.ListenAndServe
+
+	// HTTPS is only served directly when a certificate is configured, deployments usually terminate TLS in front of us
+	certFile, keyFile := viper.GetString("TLS_CERT_FILE"), viper.GetString("TLS_KEY_FILE")
+	if certFile != "" && keyFile != "" {
+		tlsConfig, err := utils.TLSConfig()
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Invalid TLS configuration")
+			return
+		}
+
+		server.TLSConfig = tlsConfig
+		listen = func() error { return server.ListenAndServeTLS(certFile, keyFile) }
+	}
+
+	// logger.Fatal exits without running deferred calls, so the server is stopped on a signal and the remaining spans
+	// are flushed explicitly before exiting. listen returns as soon as the shutdown starts, so the requests still in
+	// flight are waited for through done before the spans are flushed and the database is closed.
+	stop := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		defer close(done)
+		<-stop
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			logger.Error().Err(err).Msg("Could not drain the requests in flight")
+		}
+	}()
+
+	err = listen()
+	if err != http.ErrServerClosed {
+		shutdownTracing(context.Background())
+		logger.Fatal().Err(err).Msg("Server stopped")
+	}
+
+	<-done
+	shutdownTracing(context.Background())
+	logger.Info().Msg("Server stopped")
 }
@@ -0,0 +1 @@
+ALTER TABLE channels ADD COLUMN IF NOT EXISTS creator_id INT REFERENCES users (id) ON DELETE SET NULL;
@@ -0,0 +1 @@
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP WITH TIME ZONE;
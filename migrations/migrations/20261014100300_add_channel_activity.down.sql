@@ -0,0 +1,2 @@
+ALTER TABLE channels DROP COLUMN IF EXISTS last_active_at;
+ALTER TABLE channels DROP COLUMN IF EXISTS closed_at;
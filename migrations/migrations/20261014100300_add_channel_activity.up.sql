@@ -0,0 +1,2 @@
+ALTER TABLE channels ADD COLUMN IF NOT EXISTS last_active_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE channels ADD COLUMN IF NOT EXISTS closed_at TIMESTAMP WITH TIME ZONE;
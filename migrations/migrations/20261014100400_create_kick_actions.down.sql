@@ -0,0 +1 @@
+DROP TABLE kick_actions;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS kick_actions (
+    id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    channel_id INT NOT NULL,
+    uid BIGINT NOT NULL,
+    user_id INT,
+    duration INT NOT NULL,
+    rule_id BIGINT,
+    error TEXT,
+    CONSTRAINT kick_actions_channel_fkey FOREIGN KEY (channel_id) REFERENCES channels (id) ON DELETE CASCADE,
+    CONSTRAINT kick_actions_user_fkey FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE SET NULL
+);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS users_provider_identifier_idx;
+ALTER TABLE users DROP COLUMN IF EXISTS email_verified;
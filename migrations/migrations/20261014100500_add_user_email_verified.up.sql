@@ -0,0 +1,3 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified BOOLEAN NOT NULL DEFAULT false;
+UPDATE users SET email_verified = true;
+CREATE UNIQUE INDEX IF NOT EXISTS users_provider_identifier_idx ON users (provider, identifier) WHERE identifier <> '';
@@ -0,0 +1,2 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS uid INTEGER;
+CREATE UNIQUE INDEX IF NOT EXISTS users_uid_idx ON users (uid);
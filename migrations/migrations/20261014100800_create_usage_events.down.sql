@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS channels_created_at_idx;
+DROP INDEX IF EXISTS users_created_at_idx;
+DROP INDEX IF EXISTS tokens_created_at_idx;
+DROP TABLE IF EXISTS usage_events;
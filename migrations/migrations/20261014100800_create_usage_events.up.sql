@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS usage_events (
+    id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    kind TEXT NOT NULL,
+    channel_id INT,
+    user_id INT,
+    CONSTRAINT usage_events_channel_fkey FOREIGN KEY (channel_id) REFERENCES channels (id) ON DELETE SET NULL,
+    CONSTRAINT usage_events_user_fkey FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE SET NULL
+);
+CREATE INDEX IF NOT EXISTS usage_events_kind_created_at_idx ON usage_events (kind, created_at);
+CREATE INDEX IF NOT EXISTS tokens_created_at_idx ON tokens (created_at);
+CREATE INDEX IF NOT EXISTS users_created_at_idx ON users (created_at);
+CREATE INDEX IF NOT EXISTS channels_created_at_idx ON channels (created_at);
@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS users_lower_email_idx ON users (lower(email));
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS channel_allow_list (
+    channel_id INT NOT NULL,
+    entry TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (channel_id, entry),
+    CONSTRAINT channel_allow_list_channel_fkey FOREIGN KEY (channel_id) REFERENCES channels (id) ON DELETE CASCADE
+);
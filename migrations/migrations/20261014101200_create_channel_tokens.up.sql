@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS channel_tokens (
+    id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    channel_id INT NOT NULL,
+    user_id INT,
+    uid BIGINT NOT NULL,
+    is_host BOOLEAN NOT NULL DEFAULT false,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    CONSTRAINT channel_tokens_channel_fkey FOREIGN KEY (channel_id) REFERENCES channels (id) ON DELETE CASCADE,
+    CONSTRAINT channel_tokens_user_fkey FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE SET NULL
+);
+CREATE INDEX IF NOT EXISTS channel_tokens_channel_expires_at_idx ON channel_tokens (channel_id, expires_at);
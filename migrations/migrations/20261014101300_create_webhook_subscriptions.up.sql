@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+    id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    url TEXT NOT NULL,
+    event_types TEXT NOT NULL DEFAULT '',
+    secret TEXT NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT true
+);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS service_clients (
+    id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    client_id TEXT NOT NULL UNIQUE,
+    secret_hash TEXT NOT NULL,
+    scopes TEXT NOT NULL DEFAULT ''
+);
+CREATE TABLE IF NOT EXISTS service_tokens (
+    token_id TEXT PRIMARY KEY,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    client_id INT NOT NULL,
+    scopes TEXT NOT NULL DEFAULT '',
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    CONSTRAINT service_tokens_client_fkey FOREIGN KEY (client_id) REFERENCES service_clients (id) ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+ALTER TABLE channels DROP COLUMN IF EXISTS scheduled_start;
+ALTER TABLE channels DROP COLUMN IF EXISTS scheduled_end;
@@ -0,0 +1 @@
+DROP TABLE allow_list_entries;
@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS allow_list_entries (
+    entry TEXT PRIMARY KEY,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
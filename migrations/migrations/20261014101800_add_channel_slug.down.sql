@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS channels_slug_idx;
+ALTER TABLE channels DROP COLUMN IF EXISTS slug;
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS tenant_settings (
+    tenant TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    key TEXT NOT NULL,
+    value TEXT NOT NULL,
+    PRIMARY KEY (tenant, key)
+);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS recording_files (
+    id INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    channel_id INT NOT NULL,
+    sid TEXT NOT NULL,
+    file_name TEXT NOT NULL,
+    CONSTRAINT recording_files_channel_fkey FOREIGN KEY (channel_id) REFERENCES channels (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS recording_files_channel_id_idx ON recording_files (channel_id);
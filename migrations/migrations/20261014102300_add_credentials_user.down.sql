@@ -0,0 +1 @@
+ALTER TABLE credentials DROP COLUMN IF EXISTS user_id;
@@ -0,0 +1 @@
+ALTER TABLE credentials ADD COLUMN IF NOT EXISTS user_id INT REFERENCES users (id) ON DELETE CASCADE;
@@ -0,0 +1 @@
+-- The backfilled expiries cannot be told apart from issued ones, so they are kept
@@ -0,0 +1 @@
+UPDATE tokens SET expires_at = COALESCE(created_at, CURRENT_TIMESTAMP) + INTERVAL '30 days' WHERE expires_at IS NULL;
@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS login_nonces (
+    nonce TEXT PRIMARY KEY,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
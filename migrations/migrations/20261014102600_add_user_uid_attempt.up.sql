@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS uid_attempt INTEGER NOT NULL DEFAULT 0;
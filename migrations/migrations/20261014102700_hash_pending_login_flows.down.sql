@@ -0,0 +1,2 @@
+DELETE FROM pending_logins;
+ALTER TABLE pending_logins RENAME COLUMN flow_hash TO flow_id;
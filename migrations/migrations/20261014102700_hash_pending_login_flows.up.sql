@@ -0,0 +1,3 @@
+-- Pending logins stored under a plain flow reference cannot be looked up by its hash, they expire within minutes anyway
+DELETE FROM pending_logins;
+ALTER TABLE pending_logins RENAME COLUMN flow_id TO flow_hash;
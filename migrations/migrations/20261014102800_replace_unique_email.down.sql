@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS users_email_idx;
+DROP INDEX IF EXISTS users_provider_verified_email_idx;
+ALTER TABLE users ADD CONSTRAINT unique_email unique (email);
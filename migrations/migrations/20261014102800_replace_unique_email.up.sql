@@ -0,0 +1,4 @@
+-- Emails stay unique among the verified users of each provider, users whose email is unverified may share it
+ALTER TABLE users DROP CONSTRAINT IF EXISTS unique_email;
+CREATE UNIQUE INDEX IF NOT EXISTS users_provider_verified_email_idx ON users (provider, lower(email)) WHERE email_verified;
+CREATE INDEX IF NOT EXISTS users_email_idx ON users (lower(email));
@@ -0,0 +1,52 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package graph
+
+import (
+	"context"
+
+	"github.com/samyak-jain/agora_backend/pkg/middleware"
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/samyak-jain/agora_backend/services"
+)
+
+// checkChannelAllowList makes sure the user may join a channel which restricts joins to its own allow list.
+// The allow list is layered on top of the global one, so it can only narrow down who joins. The creator of
+// the channel is always let in so that hosts cannot lock themselves out.
+func (r *Resolver) checkChannelAllowList(ctx context.Context, channel *models.Channel) error {
+	entries, err := services.GetChannelAllowList(r.DB, channel.ID)
+	if err != nil {
+		r.Logger.Error().Err(err).Int64("channel", channel.ID).Msg("Could not fetch channel allow list")
+		return errInternalServer
+	}
+
+	if len(entries) == 0 {
+		return nil
+	}
+
+	authUser, err := middleware.GetUserFromContext(ctx)
+	if err != nil {
+		r.Logger.Debug().Str("channel", channel.ChannelName).Msg("Channel allow list requires an authenticated user")
+		return errChannelNotAllowed()
+	}
+
+	if channel.CreatorID.Valid && channel.CreatorID.Int64 == authUser.ID {
+		return nil
+	}
+
+	// An unverified email could be anybody's, so it never matches a channel allow list
+	if !authUser.EmailVerified || !services.MatchesAllowList(entries, authUser.Email) {
+		r.Logger.Info().Str("channel", channel.ChannelName).Str("email", authUser.Email).Msg("Email is not on the channel allow list")
+		return errChannelNotAllowed()
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package graph
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/samyak-jain/agora_backend/pkg/middleware"
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/spf13/viper"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+func TestCheckChannelAllowList(t *testing.T) {
+	// Everybody passes the global allow list, the channel allow list narrows it down
+	viper.Set("ALLOW_LIST", []string{"*"})
+	defer viper.Set("ALLOW_LIST", nil)
+
+	creator := sql.NullInt64{Int64: 9, Valid: true}
+	tests := []struct {
+		name    string
+		entries []string
+		user    *models.UserAccount
+		wantErr bool
+	}{
+		{name: "no channel allow list", entries: nil, user: nil},
+		{name: "allowed globally but not on the channel", entries: []string{"*@partner.com"}, user: &models.UserAccount{ID: 1, Email: "user@example.com", EmailVerified: true}, wantErr: true},
+		{name: "on the channel allow list", entries: []string{"*@partner.com"}, user: &models.UserAccount{ID: 1, Email: "guest@partner.com", EmailVerified: true}},
+		{name: "email on the channel allow list", entries: []string{"guest@example.com"}, user: &models.UserAccount{ID: 1, Email: "guest@example.com", EmailVerified: true}},
+		{name: "unverified email", entries: []string{"*@partner.com"}, user: &models.UserAccount{ID: 1, Email: "guest@partner.com"}, wantErr: true},
+		{name: "signed out", entries: []string{"*@partner.com"}, user: nil, wantErr: true},
+		{name: "creator is always let in", entries: []string{"*@partner.com"}, user: &models.UserAccount{ID: 9, Email: "host@example.com", EmailVerified: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver, mock := testResolver(t)
+
+			rows := [][]interface{}{}
+			for _, entry := range tt.entries {
+				rows = append(rows, []interface{}{entry})
+			}
+			mock.ExpectQuery(`SELECT entry FROM channel_allow_list WHERE channel_id = \$1`).WithArgs(7).WillReturnRows([]string{"entry"}, rows...)
+
+			ctx := context.Background()
+			if tt.user != nil {
+				ctx = middleware.ContextWithUser(ctx, tt.user)
+			}
+
+			err := resolver.checkChannelAllowList(ctx, &models.Channel{ID: 7, ChannelName: "channel", CreatorID: creator})
+			if !tt.wantErr {
+				if err != nil {
+					t.Errorf("checkChannelAllowList() = %v, want the user to be let in", err)
+				}
+				return
+			}
+
+			var gqlErr *gqlerror.Error
+			if !errors.As(err, &gqlErr) || gqlErr.Extensions["code"] != "CHANNEL_NOT_ALLOWED" {
+				t.Errorf("checkChannelAllowList() = %#v, want CHANNEL_NOT_ALLOWED", err)
+			}
+		})
+	}
+}
+
+func TestGenerateTokenBundleChannelAllowList(t *testing.T) {
+	testTokenCredentials(t)
+
+	tests := []struct {
+		name    string
+		email   string
+		wantErr bool
+	}{
+		{name: "on the channel allow list", email: "guest@partner.com"},
+		{name: "not on the channel allow list", email: "user@example.com", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver, mock := testResolver(t)
+
+			mock.ExpectQuery(`FROM channels WHERE host_passphrase = \$1 OR viewer_passphrase = \$1`).WithArgs("private-viewer").WillReturnRows(channelColumnNames, channelRow(3, "private"))
+			mock.ExpectQuery(`FROM channel_allow_list WHERE channel_id = \$1`).WithArgs(3).WillReturnRows([]string{"entry"}, []interface{}{"*@partner.com"})
+			if !tt.wantErr {
+				mock.ExpectExec(`INSERT INTO usage_events`)
+				mock.ExpectExec(`INSERT INTO channel_tokens`)
+			}
+
+			ctx := middleware.ContextWithUser(context.Background(), &models.UserAccount{ID: 1, Email: tt.email, EmailVerified: true})
+			bundle, err := (&queryResolver{resolver}).GenerateTokenBundle(ctx, "private-viewer", nil, nil)
+			if (err != nil) != tt.wantErr || (bundle != nil) == tt.wantErr {
+				t.Errorf("GenerateTokenBundle() = %+v, %v, wantErr %v", bundle, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package graph
+
+import (
+	"context"
+	"errors"
+
+	"github.com/samyak-jain/agora_backend/pkg/middleware"
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/samyak-jain/agora_backend/services"
+)
+
+var errForbidden error = errors.New("Forbidden")
+
+// requireAdmin makes sure the request is authenticated as one of the users in ADMIN_LIST
+func (r *Resolver) requireAdmin(ctx context.Context) (*models.UserAccount, error) {
+	authUser, err := middleware.GetUserFromContext(ctx)
+	if err != nil {
+		r.Logger.Debug().Msg("Invalid Token")
+		return nil, errors.New("Invalid Token")
+	}
+
+	if !services.IsAdmin(authUser) {
+		r.Logger.Debug().Str("email", authUser.Email).Msg("User is not an admin")
+		return nil, errForbidden
+	}
+
+	return authUser, nil
+}
+
+// requireScope lets in service clients whose token was granted the scope, and admins
+func (r *Resolver) requireScope(ctx context.Context, scope string) error {
+	serviceToken, err := middleware.GetServiceTokenFromContext(ctx)
+	if err != nil {
+		_, err = r.requireAdmin(ctx)
+		return err
+	}
+
+	if !serviceToken.HasScope(scope) {
+		r.Logger.Debug().Int64("client", serviceToken.ClientID).Str("scope", scope).Msg("Service token lacks scope")
+		return errForbidden
+	}
+
+	return nil
+}
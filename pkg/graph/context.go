@@ -0,0 +1,39 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package graph
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/samyak-jain/agora_backend/pkg/middleware"
+)
+
+// tokenLimiterKey identifies the caller for the token rate limit.
+// Authenticated users are limited by their user ID, anonymous callers by their IP.
+func tokenLimiterKey(ctx context.Context) string {
+	authUser, err := middleware.GetUserFromContext(ctx)
+	if err == nil {
+		return "user:" + strconv.FormatInt(authUser.ID, 10)
+	}
+
+	return "ip:" + middleware.GetClientIPFromContext(ctx)
+}
+
+// uidUserKey identifies the authenticated user when deriving uids, or is empty for anonymous callers
+func uidUserKey(ctx context.Context) string {
+	authUser, err := middleware.GetUserFromContext(ctx)
+	if err != nil {
+		return ""
+	}
+
+	return strconv.FormatInt(authUser.ID, 10)
+}
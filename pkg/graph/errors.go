@@ -0,0 +1,101 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package graph
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/samyak-jain/agora_backend/utils"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// newStatusError creates a GraphQL error which carries an HTTP style status and a stable code in its extensions
+func newStatusError(status int, code string, message string) error {
+	return &gqlerror.Error{
+		Message: message,
+		Extensions: map[string]interface{}{
+			"code":   code,
+			"status": status,
+		},
+	}
+}
+
+func errTooManyRequests() error {
+	return newStatusError(http.StatusTooManyRequests, "TOO_MANY_REQUESTS", "Too many token requests, please try again later")
+}
+
+func errRecordingLimitReached() error {
+	return newStatusError(http.StatusTooManyRequests, "RECORDING_LIMIT_REACHED", "The maximum number of concurrent recordings has been reached, please try again later")
+}
+
+func errRecordingDisabled() error {
+	return newStatusError(http.StatusForbidden, "RECORDING_DISABLED", "Recording is disabled")
+}
+
+func errRecordingNotConfigured() error {
+	return newStatusError(http.StatusServiceUnavailable, "RECORDING_NOT_CONFIGURED", "Recording is not configured on this server")
+}
+
+func errChannelNotAllowed() error {
+	return newStatusError(http.StatusForbidden, "CHANNEL_NOT_ALLOWED", "You are not allowed to join this channel")
+}
+
+func errMeetingNotStarted() error {
+	return newStatusError(http.StatusForbidden, "MEETING_NOT_STARTED", "The meeting has not started yet")
+}
+
+func errEventEnded() error {
+	return newStatusError(http.StatusForbidden, "EVENT_ENDED", "The event has ended")
+}
+
+func errMeetingEnded() error {
+	return newStatusError(http.StatusForbidden, "MEETING_ENDED", "The meeting has ended")
+}
+
+func errChannelSlugTaken() error {
+	return newStatusError(http.StatusConflict, "CHANNEL_SLUG_TAKEN", "A channel with this name already exists")
+}
+
+func errChannelNameBlocked() error {
+	return newStatusError(http.StatusBadRequest, "CHANNEL_NAME_BLOCKED", "This channel name is not allowed, please choose another one")
+}
+
+func errConflict() error {
+	return newStatusError(http.StatusConflict, "CONFLICT", "The resource already exists")
+}
+
+// queryError hides the details of a failed query, telling apart unique constraint violations which the client caused
+func queryError(err error) error {
+	if utils.IsUniqueViolation(err) {
+		return errConflict()
+	}
+
+	return errInternalServer
+}
+
+// errMaintenance rejects token requests during maintenance with the maintenance message
+func errMaintenance(err error) error {
+	return newStatusError(http.StatusServiceUnavailable, "MAINTENANCE", err.Error())
+}
+
+func errServiceUnavailable() error {
+	return newStatusError(http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", utils.ErrCircuitOpen.Error())
+}
+
+// agoraError hides the details of a failed Agora call, telling apart an open circuit breaker so that clients can retry later
+func agoraError(err error) error {
+	if errors.Is(err, utils.ErrCircuitOpen) {
+		return errServiceUnavailable()
+	}
+
+	return errInternalServer
+}
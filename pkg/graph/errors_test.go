@@ -0,0 +1,51 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/samyak-jain/agora_backend/pkg/models/dbtest"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+func TestQueryError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantCode   string
+		wantStatus int
+	}{
+		{name: "unique violation", err: dbtest.UniqueViolation("channels_slug_key"), wantCode: "CONFLICT", wantStatus: http.StatusConflict},
+		{name: "wrapped unique violation", err: fmt.Errorf("insert failed: %w", dbtest.UniqueViolation("channels_slug_key")), wantCode: "CONFLICT", wantStatus: http.StatusConflict},
+		{name: "other error", err: errors.New("connection refused")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := queryError(tt.err)
+			if tt.wantCode == "" {
+				if err != errInternalServer {
+					t.Errorf("queryError(%v) = %v, want %v", tt.err, err, errInternalServer)
+				}
+				return
+			}
+
+			var gqlErr *gqlerror.Error
+			if !errors.As(err, &gqlErr) || gqlErr.Extensions["code"] != tt.wantCode || gqlErr.Extensions["status"] != tt.wantStatus {
+				t.Errorf("queryError(%v) = %#v, want code %s and status %d", tt.err, err, tt.wantCode, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package graph
+
+import (
+	"context"
+	"errors"
+
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/samyak-jain/agora_backend/utils"
+)
+
+// joinLinkPassphrase verifies the grant of a join link and returns the passphrase of the role it grants, which is
+// never shared with the recipient of the link
+func (r *queryResolver) joinLinkPassphrase(ctx context.Context, channel string, role string, expires int, signature string) (string, error) {
+	err := utils.VerifyJoinGrant(channel, role, int64(expires), signature)
+	if errors.Is(err, utils.ErrInvalidJoinLink) || errors.Is(err, utils.ErrJoinLinkExpired) {
+		r.Logger.Debug().Str("channel", channel).Err(err).Msg("Rejected join link")
+		return "", err
+	} else if err != nil {
+		r.Logger.Error().Err(err).Msg("Could not verify join link")
+		return "", errInternalServer
+	}
+
+	var channelData models.Channel
+	err = r.DB.GetContext(ctx, &channelData, "SELECT host_passphrase, viewer_passphrase FROM channels WHERE channel_name = $1", channel)
+	if err != nil {
+		r.Logger.Debug().Err(err).Str("channel", channel).Msg("Join link channel does not exist")
+		return "", utils.ErrInvalidJoinLink
+	}
+
+	if role == utils.HostJoinRole {
+		return channelData.HostPassphrase, nil
+	}
+
+	return channelData.ViewerPassphrase, nil
+}
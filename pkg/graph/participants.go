@@ -0,0 +1,63 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package graph
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/samyak-jain/agora_backend/pkg/middleware"
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/samyak-jain/agora_backend/services"
+	"github.com/samyak-jain/agora_backend/utils"
+)
+
+// recordChannelToken stores the RTC token issued to the main user for channelParticipants.
+// Failing to do so is logged but never fails the request.
+func (r *Resolver) recordChannelToken(ctx context.Context, channelID int64, uid int, host bool, ttl int) {
+	token := &models.ChannelToken{
+		ChannelID: channelID,
+		UID:       int64(uid),
+		IsHost:    host,
+		ExpiresAt: time.Now().Add(time.Duration(utils.GetTokenTTL(utils.RtcTokenEndpoint, ttl)) * time.Second),
+	}
+
+	authUser, err := middleware.GetUserFromContext(ctx)
+	if err == nil {
+		token.UserID = sql.NullInt64{Int64: authUser.ID, Valid: true}
+	}
+
+	err = services.RecordChannelToken(r.DB, token)
+	if err != nil {
+		r.Logger.Error().Err(err).Int64("channel", channelID).Int("uid", uid).Msg("Could not record channel token")
+	}
+}
+
+// markOnline fills in which participants are currently in the channel according to Agora.
+// Presence is left unknown when Agora cannot be asked.
+func (r *Resolver) markOnline(channel string, participants []*models.ChannelParticipant) {
+	uids, err := utils.GetChannelUIDs(channel)
+	if err != nil {
+		r.Logger.Warn().Err(err).Str("channel", channel).Msg("Could not fetch channel presence")
+		return
+	}
+
+	online := map[int64]bool{}
+	for _, uid := range uids {
+		online[uid] = true
+	}
+
+	for _, participant := range participants {
+		isOnline := online[participant.UID]
+		participant.Online = &isOnline
+	}
+}
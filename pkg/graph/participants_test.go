@@ -0,0 +1,84 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/samyak-jain/agora_backend/pkg/middleware"
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/spf13/viper"
+)
+
+func TestChannelParticipants(t *testing.T) {
+	viper.Set("ADMIN_LIST", []string{"admin@example.com"})
+	defer viper.Set("ADMIN_LIST", nil)
+
+	tests := []struct {
+		name       string
+		passphrase string
+		user       *models.UserAccount
+		wantErr    bool
+	}{
+		{name: "host", passphrase: "channel-host"},
+		{name: "admin with the viewer passphrase", passphrase: "channel-viewer", user: &models.UserAccount{ID: 1, Email: "admin@example.com", EmailVerified: true}},
+		{name: "viewer", passphrase: "channel-viewer", user: &models.UserAccount{ID: 2, Email: "user@example.com", EmailVerified: true}, wantErr: true},
+		{name: "signed out viewer", passphrase: "channel-viewer", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver, mock := testResolver(t)
+			testAgoraAPI(t, func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": map[string]interface{}{"channel_exist": true, "mode": 1, "users": []int64{1001}}})
+			})
+
+			mock.ExpectQuery(`SELECT id, channel_name, host_passphrase FROM channels WHERE host_passphrase = \$1 OR viewer_passphrase = \$1`).WithArgs(tt.passphrase).
+				WillReturnRows([]string{"id", "channel_name", "host_passphrase"}, []interface{}{7, "channel", "channel-host"})
+			if !tt.wantErr {
+				expiry := time.Now().Add(time.Hour)
+				mock.ExpectQuery(`FROM channel_tokens t LEFT JOIN users u ON u.id = t.user_id\s+WHERE t.channel_id = \$1 AND t.expires_at > CURRENT_TIMESTAMP`).WithArgs(7).
+					WillReturnRows([]string{"uid", "is_host", "expires_at", "user_name", "email"},
+						[]interface{}{1001, true, expiry, "Host", "host@example.com"},
+						[]interface{}{1002, false, expiry, nil, nil})
+			}
+
+			ctx := context.Background()
+			if tt.user != nil {
+				ctx = middleware.ContextWithUser(ctx, tt.user)
+			}
+
+			participants, err := (&queryResolver{resolver}).ChannelParticipants(ctx, tt.passphrase)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ChannelParticipants() = %+v, want an error", participants)
+				}
+				return
+			}
+
+			if err != nil || len(participants) != 2 {
+				t.Fatalf("ChannelParticipants() = %+v, %v, want 2 participants", participants, err)
+			}
+
+			host, guest := participants[0], participants[1]
+			if host.UID != 1001 || !host.IsHost || host.Email == nil || *host.Email != "host@example.com" || host.Online == nil || !*host.Online {
+				t.Errorf("host = %+v, want uid 1001 online", host)
+			}
+			if guest.UID != 1002 || guest.IsHost || guest.Email != nil || guest.Online == nil || *guest.Online {
+				t.Errorf("guest = %+v, want anonymous uid 1002 offline", guest)
+			}
+		})
+	}
+}
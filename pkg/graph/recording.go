@@ -0,0 +1,22 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package graph
+
+import "github.com/samyak-jain/agora_backend/services"
+
+// releaseRecordingSlot frees the slot reserved for a recording which failed to start.
+// Failing to do so is logged, the slot is freed anyway once RECORDING_SLOT_TTL passed.
+func (r *Resolver) releaseRecordingSlot(channelID int64) {
+	err := services.ReleaseRecordingSlot(r.DB, channelID)
+	if err != nil {
+		r.Logger.Error().Err(err).Int64("channel", channelID).Msg("Could not release recording slot")
+	}
+}
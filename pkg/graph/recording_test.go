@@ -0,0 +1,48 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package graph
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/samyak-jain/agora_backend/pkg/models/dbtest"
+	"github.com/spf13/viper"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+func TestStartRecordingLimitReached(t *testing.T) {
+	viper.Set("ENABLE_RECORDING", true)
+	viper.Set("MAX_CONCURRENT_RECORDINGS", 1)
+	defer viper.Set("ENABLE_RECORDING", false)
+	defer viper.Set("MAX_CONCURRENT_RECORDINGS", 0)
+
+	resolver, mock := testResolver(t)
+	testAgoraAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("got %s %s, want no recording to be acquired at the cap", r.Method, r.URL.Path)
+	})
+
+	mock.ExpectQuery(`FROM channels WHERE host_passphrase = \$1 OR viewer_passphrase = \$1`).WithArgs("channel-host").
+		WillReturnRows([]string{"id", "title", "channel_name", "channel_secret", "host_passphrase", "viewer_passphrase"}, []interface{}{7, "Title", "channel", "secret", "channel-host", "channel-viewer"})
+	mock.ExpectQuery(`SELECT users.tenant FROM channels`).WithArgs(7).WillReturnRows([]string{"tenant"}, []interface{}{nil})
+	mock.ExpectBegin()
+	mock.ExpectExec(`pg_advisory_xact_lock`)
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM channels`).WithArgs(dbtest.Any, nil, 7).WillReturnRows([]string{"count"}, []interface{}{1})
+	mock.ExpectRollback()
+
+	_, err := (&mutationResolver{resolver}).StartRecordingSession(context.Background(), "channel-host", nil)
+	var gqlErr *gqlerror.Error
+	if !errors.As(err, &gqlErr) || gqlErr.Extensions["code"] != "RECORDING_LIMIT_REACHED" || gqlErr.Extensions["status"] != http.StatusTooManyRequests {
+		t.Errorf("StartRecordingSession() = %#v, want RECORDING_LIMIT_REACHED with %d", err, http.StatusTooManyRequests)
+	}
+}
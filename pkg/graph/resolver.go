@@ -23,6 +23,7 @@ import (
 
 // Resolver is used for state management
 type Resolver struct {
-	DB     *models.Database
-	Logger *utils.Logger
+	DB           *models.Database
+	Logger       *utils.Logger
+	TokenLimiter *utils.RateLimiter
 }
@@ -0,0 +1,72 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package graph
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/samyak-jain/agora_backend/pkg/models/dbtest"
+	"github.com/samyak-jain/agora_backend/utils"
+	"github.com/spf13/viper"
+)
+
+// testResolver returns a resolver on a scripted database
+func testResolver(t *testing.T) (*Resolver, *dbtest.Mock) {
+	logger := zerolog.Nop()
+	db, mock := dbtest.New(t)
+	return &Resolver{DB: db, Logger: &utils.Logger{Logger: &logger}}, mock
+}
+
+// testAgoraAPI points the Agora RESTful API at handler, with the given customer credentials, for the duration of the test
+func testAgoraAPI(t *testing.T, handler http.HandlerFunc) {
+	server := httptest.NewServer(handler)
+	agoraAPIURL := utils.AgoraAPIURL
+	utils.AgoraAPIURL = server.URL
+	viper.Set("APP_ID", "app-id")
+	viper.Set("CUSTOMER_ID", "customer-id")
+	viper.Set("CUSTOMER_CERTIFICATE", "customer-secret")
+
+	t.Cleanup(func() {
+		server.Close()
+		utils.AgoraAPIURL = agoraAPIURL
+		viper.Set("APP_ID", "")
+		viper.Set("CUSTOMER_ID", "")
+		viper.Set("CUSTOMER_CERTIFICATE", "")
+	})
+}
+
+var channelColumnNames = []string{"id", "title", "channel_name", "channel_secret", "host_passphrase", "viewer_passphrase", "creator_id", "closed_at", "scheduled_start", "scheduled_end"}
+
+// channelRow is an open, unscheduled channel whose passphrases are the name followed by -host and -viewer
+func channelRow(id int64, name string) []interface{} {
+	return []interface{}{id, "Title", name, "secret", name + "-host", name + "-viewer", nil, nil, nil, nil}
+}
+
+// testTokenCredentials sets the app credentials used to sign RTC and RTM tokens for the duration of the test
+func testTokenCredentials(t *testing.T) {
+	viper.Set("APP_ID", "970CA35de60c44645bbae8a215061b33")
+	viper.Set("APP_CERTIFICATE", "5CFd2fd1755d40ecb72977518be15d3b")
+	t.Cleanup(func() {
+		viper.Set("APP_ID", "")
+		viper.Set("APP_CERTIFICATE", nil)
+	})
+}
+
+// expectTokenBundle expects the statements of a GenerateTokenBundle call for the passphrase of the channel
+func expectTokenBundle(mock *dbtest.Mock, passphrase string, channel []interface{}) {
+	mock.ExpectQuery(`FROM channels WHERE host_passphrase = \$1 OR viewer_passphrase = \$1`).WithArgs(passphrase).WillReturnRows(channelColumnNames, channel)
+	mock.ExpectQuery(`FROM channel_allow_list WHERE channel_id = \$1`).WithArgs(channel[0])
+	mock.ExpectExec(`INSERT INTO usage_events`)
+	mock.ExpectExec(`INSERT INTO channel_tokens`)
+}
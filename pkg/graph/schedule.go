@@ -0,0 +1,44 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/samyak-jain/agora_backend/services"
+)
+
+// checkSchedule only lets tokens be issued for a scheduled channel within its window, see services.CheckSchedule
+func checkSchedule(channel *models.Channel) error {
+	err := services.CheckSchedule(channel, time.Now())
+	if errors.Is(err, services.ErrMeetingNotStarted) {
+		return errMeetingNotStarted()
+	} else if errors.Is(err, services.ErrMeetingEnded) {
+		return errMeetingEnded()
+	}
+
+	return err
+}
+
+// scheduledTTL clamps the requested token TTL to the window of a scheduled channel, warning when an explicitly requested
+// expiry was shortened
+func scheduledTTL(ctx context.Context, channel *models.Channel, requested int) int {
+	ttl := services.ClampToSchedule(channel, time.Now(), requested)
+	if requested > 0 && ttl < requested {
+		addWarning(ctx, ExpiryClampedWarning, fmt.Sprintf("Token expiry was clamped to the scheduled end, %d seconds", ttl))
+	}
+
+	return ttl
+}
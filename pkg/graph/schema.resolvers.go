@@ -17,9 +17,11 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/samyak-jain/agora_backend/internal/generated"
@@ -28,54 +30,73 @@ import (
 	"github.com/samyak-jain/agora_backend/services"
 	"github.com/samyak-jain/agora_backend/utils"
 	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-func (r *mutationResolver) CreateChannel(ctx context.Context, title string, backendURL string, enablePstn *bool) (*models.ShareResponse, error) {
+func (r *mutationResolver) CreateChannel(ctx context.Context, title string, backendURL string, enablePstn *bool, scheduledStart *time.Time, scheduledEnd *time.Time, slug *string) (*models.ShareResponse, error) {
 	r.Logger.Info().Str("mutation", "CreateChannel").Str("title", title).Msg("Creating Channel")
 	if enablePstn != nil {
 		r.Logger.Info().Bool("enablePstn", *enablePstn).Msg("")
 	}
 
+	var authUser *models.UserAccount
+	var err error
 	if viper.GetBool("ENABLE_OAUTH") {
-		_, err := middleware.GetUserFromContext(ctx)
+		authUser, err = middleware.GetUserFromContext(ctx)
 		if err != nil {
 			r.Logger.Debug().Msg("Invalid Token")
 			return nil, errors.New("Invalid Token")
 		}
 	}
 
-	var pstnResponse *models.Pstn
-	var newChannel *models.Channel
+	var tenant sql.NullString
+	if authUser != nil {
+		tenant = authUser.Tenant
+	}
 
-	hostPhrase, err := utils.GenerateUUID()
+	tenantConfig, err := services.LoadTenantConfig(ctx, r.DB, tenant)
 	if err != nil {
-		r.Logger.Error().Err(err).Msg("Host Phrase generation failed")
+		r.Logger.Error().Err(err).Str("tenant", tenant.String).Msg("Could not load tenant config")
 		return nil, errInternalServer
 	}
 
-	viewPhrase, err := utils.GenerateUUID()
-	if err != nil {
-		r.Logger.Error().Err(err).Msg("View Phrase generation failed")
-		return nil, errInternalServer
+	for _, name := range []*string{&title, slug} {
+		if name == nil {
+			continue
+		}
+
+		if entry := services.BlockedChannelName(tenantConfig, *name); entry != "" {
+			r.Logger.Info().Str("name", *name).Str("entry", entry).Str("tenant", tenant.String).Msg("Channel name is blocked")
+			return nil, errChannelNameBlocked()
+		}
 	}
 
-	channelName, err := utils.GenerateUUID()
+	var pstnResponse *models.Pstn
+
+	newChannel, err := services.GenerateChannel(title)
 	if err != nil {
-		r.Logger.Error().Err(err).Msg("Channel Name generation failed")
+		r.Logger.Error().Err(err).Msg("Channel generation failed")
 		return nil, errInternalServer
 	}
 
-	channel := strings.ReplaceAll(channelName, "-", "")
+	if authUser != nil {
+		newChannel.CreatorID = sql.NullInt64{Int64: authUser.ID, Valid: true}
+	}
 
-	secretGen, err := utils.GenerateUUID()
-	if err != nil {
-		return nil, err
+	if scheduledStart != nil && scheduledEnd != nil && !scheduledEnd.After(*scheduledStart) {
+		return nil, errors.New("Scheduled end must be after the scheduled start")
 	}
-	secret := strings.ReplaceAll(secretGen, "-", "")
-	dtmfResult, err := utils.GenerateDTMF()
-	if err != nil {
-		r.Logger.Error().Err(err).Msg("DTMF generation failed")
-		return nil, errInternalServer
+
+	if scheduledStart != nil {
+		newChannel.ScheduledStart = sql.NullTime{Time: *scheduledStart, Valid: true}
+	}
+
+	if scheduledEnd != nil {
+		newChannel.ScheduledEnd = sql.NullTime{Time: *scheduledEnd, Valid: true}
+	}
+
+	if slug != nil && *slug != "" {
+		newChannel.Slug = sql.NullString{String: *slug, Valid: true}
 	}
 
 	if *enablePstn {
@@ -100,40 +121,44 @@ func (r *mutationResolver) CreateChannel(ctx context.Context, title string, back
 			pstnNumber = viper.GetString("PSTN_NUMBER")
 		}
 
-		services.CreateBridge(r.Logger, *dtmfResult, finalBackendURL)
+		services.CreateBridge(r.Logger, newChannel.DTMF, finalBackendURL)
 		pstnResponse = &models.Pstn{
 			Number: pstnNumber,
-			Dtmf:   *dtmfResult,
+			Dtmf:   newChannel.DTMF,
 		}
 
-		r.Logger.Info().Str("DTMF", *dtmfResult).Msg("PSTN PIN")
+		r.Logger.Info().Str("DTMF", newChannel.DTMF).Msg("PSTN PIN")
 	} else {
 		pstnResponse = nil
 	}
 
-	newChannel = &models.Channel{
-		Title:            title,
-		ChannelName:      channel,
-		ChannelSecret:    secret,
-		HostPassphrase:   hostPhrase,
-		ViewerPassphrase: viewPhrase,
-		DTMF:             *dtmfResult,
-	}
-
-	_, err = r.DB.NamedExec("INSERT INTO channels (title, channel_name, channel_secret, host_passphrase, viewer_passphrase, dtmf) VALUES (:title, :channel_name, :channel_secret, :host_passphrase, :viewer_passphrase, :dtmf)", newChannel)
+	if newChannel.Slug.Valid {
+		existing, created, err := services.InsertChannelWithSlug(ctx, r.DB, newChannel)
+		if err != nil {
+			r.Logger.Error().Err(err).Interface("channel details", newChannel).Msg("Adding new channel to DB Failed")
+			return nil, queryError(err)
+		}
 
-	if err != nil {
-		r.Logger.Error().Err(err).Interface("channel details", newChannel).Msg("Adding new channel to DB Failed")
-		return nil, errInternalServer
+		if !created {
+			return r.existingChannelResponse(existing, authUser)
+		}
+	} else {
+		err = services.InsertChannel(ctx, r.DB, newChannel)
+		if err != nil {
+			r.Logger.Error().Err(err).Interface("channel details", newChannel).Msg("Adding new channel to DB Failed")
+			return nil, queryError(err)
+		}
 	}
 
+	services.DispatchWebhookEvent(r.DB, r.Logger, models.ChannelCreatedEvent, webhookChannelData(newChannel))
+
 	return &models.ShareResponse{
 		Passphrase: &models.Passphrase{
-			Host: &hostPhrase,
-			View: viewPhrase,
+			Host: &newChannel.HostPassphrase,
+			View: newChannel.ViewerPassphrase,
 		},
 		Title:   title,
-		Channel: channel,
+		Channel: newChannel.ChannelName,
 		Pstn:    pstnResponse,
 	}, nil
 }
@@ -197,7 +222,7 @@ func (r *mutationResolver) SetPresenter(ctx context.Context, uid int, passphrase
 	err = utils.ChangeRecordingMode(channelData.ChannelName, int(channelData.RecordingUID.Int32), channelData.RecordingRID.String, channelData.RecordingSID.String, 2, strconv.Itoa(uid), r.Logger)
 	if err != nil {
 		r.Logger.Error().Err(err).Msg("Stop recording failed")
-		return 0, errInternalServer
+		return 0, agoraError(err)
 	}
 
 	return uid, nil
@@ -226,7 +251,7 @@ func (r *mutationResolver) SetNormal(ctx context.Context, passphrase string) (st
 	err = utils.ChangeRecordingMode(channelData.ChannelName, int(channelData.RecordingUID.Int32), channelData.RecordingRID.String, channelData.RecordingSID.String, 1, "", r.Logger)
 	if err != nil {
 		r.Logger.Error().Err(err).Msg("Stop recording failed")
-		return "", errInternalServer
+		return "", agoraError(err)
 	}
 
 	return "success", nil
@@ -245,8 +270,17 @@ func (r *mutationResolver) UpdateUserName(ctx context.Context, name string) (*mo
 		return nil, errors.New("Invalid Token")
 	}
 
-	_, err = r.DB.NamedExec("UPDATE users SET user_name = ':name' WHERE identifier = ':ident'", &models.UserAccount{
-		Identifier: authUser.Identifier,
+	name, err = utils.ValidateName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if name == "" {
+		return nil, errors.New("Name cannot be empty")
+	}
+
+	_, err = r.DB.NamedExec("UPDATE users SET user_name = :user_name WHERE id = :id", &models.UserAccount{
+		ID: authUser.ID,
 		UserName: sql.NullString{
 			String: name,
 			Valid:  true,
@@ -286,6 +320,26 @@ func (r *mutationResolver) StartRecordingSession(ctx context.Context, passphrase
 		return "", errors.New("Passphrase cannot be empty")
 	}
 
+	var tenant sql.NullString
+	if authUser != nil {
+		tenant = authUser.Tenant
+	}
+
+	tenantConfig, err := services.LoadTenantConfig(ctx, r.DB, tenant)
+	if err != nil {
+		r.Logger.Error().Err(err).Str("tenant", tenant.String).Msg("Could not load tenant config")
+		return "", errInternalServer
+	}
+
+	if !tenantConfig.GetBool("ENABLE_RECORDING") {
+		return "", errRecordingDisabled()
+	}
+
+	if err := utils.CheckRESTCredentials(); err != nil && !utils.TestModeEnabled() {
+		r.Logger.Error().Err(err).Msg("Recording is not configured")
+		return "", errRecordingNotConfigured()
+	}
+
 	err = r.DB.Get(&channelData, "SELECT id, title, channel_name, channel_secret, host_passphrase, viewer_passphrase FROM channels WHERE host_passphrase = $1 OR viewer_passphrase = $1", passphrase)
 	if err != nil {
 		r.Logger.Error().Err(err).Str("passphrase", passphrase).Msg("Invalid Passphrase")
@@ -320,7 +374,19 @@ func (r *mutationResolver) StartRecordingSession(ctx context.Context, passphrase
 
 	finalTitle := utils.FirstN(reg.ReplaceAllString(title, ""), 100)
 
+	reserved, err := services.ReserveRecordingSlot(ctx, r.DB, channelData.ID)
+	if err != nil {
+		r.Logger.Error().Err(err).Msg("Could not reserve a recording slot")
+		return "", errInternalServer
+	}
+
+	if !reserved {
+		r.Logger.Info().Str("channel", channelData.ChannelName).Msg("Concurrent recording limit reached")
+		return "", errRecordingLimitReached()
+	}
+
 	recorder := &utils.Recorder{
+		Client: *utils.BreakerClient(utils.AgoraCircuit),
 		Logger: r.Logger,
 	}
 	recorder.Channel = channelData.ChannelName
@@ -328,14 +394,18 @@ func (r *mutationResolver) StartRecordingSession(ctx context.Context, passphrase
 	err = recorder.Acquire()
 	if err != nil {
 		r.Logger.Error().Err(err).Msg("Acquire Failed")
-		return "", errInternalServer
+		r.releaseRecordingSlot(channelData.ID)
+		return "", agoraError(err)
 	}
 
 	err = recorder.Start(finalTitle, secret)
 	if err != nil {
 		r.Logger.Error().Err(err).Msg("Start Failed")
-		return "", errInternalServer
+		r.releaseRecordingSlot(channelData.ID)
+		return "", agoraError(err)
 	}
+
+	r.recordUsage(ctx, models.RecordingUsageEvent, channelData.ID)
 	recordDetails := models.Channel{
 		ID:           channelData.ID,
 		RecordingUID: sql.NullInt32{Int32: recorder.UID, Valid: true},
@@ -343,12 +413,13 @@ func (r *mutationResolver) StartRecordingSession(ctx context.Context, passphrase
 		RecordingSID: sql.NullString{String: recorder.SID, Valid: true},
 	}
 
-	_, err = r.DB.NamedExec("UPDATE channels SET (recording_uid, recording_sid, recording_rid) = (:recording_uid, :recording_sid, :recording_rid) WHERE id = :id", &recordDetails)
+	_, err = r.DB.NamedExec("UPDATE channels SET (recording_uid, recording_sid, recording_rid, recording_started_at) = (:recording_uid, :recording_sid, :recording_rid, CURRENT_TIMESTAMP) WHERE id = :id", &recordDetails)
 	if err != nil {
 		r.Logger.Error().Err(err).Msg("Updating database for recording failed")
 		return "", errInternalServer
 	}
 
+	services.DispatchWebhookEvent(r.DB, r.Logger, models.RecordingStartedEvent, webhookChannelData(&channelData))
 	return "success", nil
 }
 
@@ -386,17 +457,29 @@ func (r *mutationResolver) StopRecordingSession(ctx context.Context, passphrase
 		return "", errors.New("Recording not started")
 	}
 
-	err = utils.Stop(channelData.ChannelName, int(channelData.RecordingUID.Int32), channelData.RecordingRID.String, channelData.RecordingSID.String, r.Logger)
+	fileNames, err := utils.Stop(channelData.ChannelName, int(channelData.RecordingUID.Int32), channelData.RecordingRID.String, channelData.RecordingSID.String, r.Logger)
 	if err != nil {
 		r.Logger.Error().Err(err).Msg("Stop recording failed")
-		return "", errInternalServer
+		return "", agoraError(err)
 	}
 
+	err = services.StoreRecordingFiles(r.DB, channelData.ID, channelData.RecordingSID.String, fileNames)
+	if err != nil {
+		r.Logger.Error().Err(err).Int64("channel", channelData.ID).Strs("files", fileNames).Msg("Could not store recording files")
+	}
+
+	// Clearing the recording frees its slot for MAX_CONCURRENT_RECORDINGS
+	_, err = r.DB.Exec("UPDATE channels SET (recording_uid, recording_sid, recording_rid, recording_started_at) = (NULL, NULL, NULL, NULL) WHERE id = $1", channelData.ID)
+	if err != nil {
+		r.Logger.Error().Err(err).Int64("channel", channelData.ID).Msg("Could not clear stopped recording")
+	}
+
+	services.DispatchWebhookEvent(r.DB, r.Logger, models.RecordingStoppedEvent, webhookChannelData(&channelData))
 	return "success", nil
 }
 
 func (r *mutationResolver) LogoutSession(ctx context.Context, token string) ([]string, error) {
-	r.Logger.Info().Str("mutation", "LogoutSession").Str("token", token).Msg("")
+	r.Logger.Info().Str("mutation", "LogoutSession").Str("token hash", utils.TokenFingerprint(token)).Msg("")
 
 	authUser, err := middleware.GetUserFromContext(ctx)
 	if err != nil {
@@ -416,7 +499,7 @@ func (r *mutationResolver) LogoutSession(ctx context.Context, token string) ([]s
 
 	rowsAffected, err := res.RowsAffected()
 	if err != nil {
-		r.Logger.Error().Str("Token", token).Int64("User ID", authUser.ID).Msg("Could not get Rows Affected by DELETE in database")
+		r.Logger.Error().Str("token hash", utils.TokenFingerprint(token)).Int64("User ID", authUser.ID).Msg("Could not get Rows Affected by DELETE in database")
 		return nil, errInternalServer
 	}
 
@@ -425,6 +508,8 @@ func (r *mutationResolver) LogoutSession(ctx context.Context, token string) ([]s
 		return nil, errBadRequest
 	}
 
+	middleware.ForgetToken(token)
+
 	tokens := []models.Token{}
 	string_token_slice := []string{}
 	err = r.DB.Select(&tokens, "SELECT * FROM tokens WHERE user_id = $1", authUser.ID)
@@ -440,9 +525,455 @@ func (r *mutationResolver) LogoutSession(ctx context.Context, token string) ([]s
 	return string_token_slice, nil
 }
 
-func (r *queryResolver) JoinChannel(ctx context.Context, passphrase string) (*models.Session, error) {
+func (r *mutationResolver) ReopenChannel(ctx context.Context, passphrase string) (bool, error) {
+	r.Logger.Info().Str("mutation", "ReopenChannel").Str("passphrase", passphrase).Msg("")
+
+	if passphrase == "" {
+		return false, errors.New("Passphrase cannot be empty")
+	}
+
+	res, err := r.DB.Exec("UPDATE channels SET closed_at = NULL, last_active_at = CURRENT_TIMESTAMP WHERE host_passphrase = $1", passphrase)
+	if err != nil {
+		r.Logger.Error().Err(err).Str("passphrase", passphrase).Msg("Could not reopen channel")
+		return false, errInternalServer
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		r.Logger.Error().Err(err).Str("passphrase", passphrase).Msg("Could not get Rows Affected by UPDATE in database")
+		return false, errInternalServer
+	}
+
+	if rowsAffected < 1 {
+		r.Logger.Debug().Str("passphrase", passphrase).Msg("Only hosts can reopen a channel")
+		return false, errors.New("Invalid URL")
+	}
+
+	return true, nil
+}
+
+func (r *mutationResolver) KickUser(ctx context.Context, passphrase string, uid int, duration *int) (bool, error) {
+	r.Logger.Info().Str("mutation", "KickUser").Str("passphrase", passphrase).Int("uid", uid).Msg("")
+
+	if passphrase == "" {
+		return false, errors.New("Passphrase cannot be empty")
+	}
+
+	var channelData models.Channel
+	err := r.DB.Get(&channelData, "SELECT id, channel_name FROM channels WHERE host_passphrase = $1", passphrase)
+	if err != nil {
+		r.Logger.Debug().Err(err).Str("passphrase", passphrase).Msg("Only hosts can kick users")
+		return false, errors.New("Invalid URL")
+	}
+
+	minutes := viper.GetInt("KICK_DURATION")
+	if duration != nil {
+		minutes = *duration
+	}
+
+	// Agora only accepts kicking rules which last between 1 minute and 24 hours
+	requested := minutes
+	if minutes < 1 {
+		minutes = 1
+	} else if minutes > 1440 {
+		minutes = 1440
+	}
+
+	if duration != nil && minutes != requested {
+		addWarning(ctx, DurationClampedWarning, fmt.Sprintf("Kick duration was clamped to %d minutes", minutes))
+	}
+
+	action := models.KickAction{
+		ChannelID: channelData.ID,
+		UID:       int64(uid),
+		Duration:  minutes,
+	}
+
+	authUser, err := middleware.GetUserFromContext(ctx)
+	if err == nil {
+		action.UserID = sql.NullInt64{Int64: authUser.ID, Valid: true}
+	}
+
+	ruleID, kickErr := utils.KickUser(channelData.ChannelName, uid, minutes)
+	if kickErr != nil {
+		action.Error = sql.NullString{String: kickErr.Error(), Valid: true}
+	} else {
+		action.RuleID = sql.NullInt64{Int64: ruleID, Valid: true}
+	}
+
+	_, err = r.DB.NamedExec("INSERT INTO kick_actions (channel_id, uid, user_id, duration, rule_id, error) VALUES (:channel_id, :uid, :user_id, :duration, :rule_id, :error)", &action)
+	if err != nil {
+		r.Logger.Error().Err(err).Interface("action", action).Msg("Could not record kick action")
+	}
+
+	if kickErr != nil {
+		r.Logger.Error().Err(kickErr).Str("channel", channelData.ChannelName).Int("uid", uid).Msg("Kicking user failed")
+		return false, agoraError(kickErr)
+	}
+
+	return true, nil
+}
+
+func (r *mutationResolver) SetChannelAllowList(ctx context.Context, passphrase string, entries []string) (bool, error) {
+	r.Logger.Info().Str("mutation", "SetChannelAllowList").Str("passphrase", passphrase).Int("entries", len(entries)).Msg("")
+
+	if passphrase == "" {
+		return false, errors.New("Passphrase cannot be empty")
+	}
+
+	var channelData models.Channel
+	err := r.DB.Get(&channelData, "SELECT id, channel_name FROM channels WHERE host_passphrase = $1", passphrase)
+	if err != nil {
+		r.Logger.Debug().Err(err).Str("passphrase", passphrase).Msg("Only hosts can set the channel allow list")
+		return false, errors.New("Invalid URL")
+	}
+
+	report := services.ValidateAllowListConfig(entries)
+	if !report.Valid {
+		r.Logger.Debug().Str("channel", channelData.ChannelName).Interface("issues", report.Issues).Msg("Invalid channel allow list")
+		return false, errors.New("Invalid allow list")
+	}
+
+	err = services.SetChannelAllowList(r.DB, channelData.ID, entries)
+	if err != nil {
+		r.Logger.Error().Err(err).Str("channel", channelData.ChannelName).Msg("Could not set channel allow list")
+		return false, queryError(err)
+	}
+
+	return true, nil
+}
+
+func (r *mutationResolver) BatchCreateUsers(ctx context.Context, users []*models.NewUser) ([]*models.BatchUserResult, error) {
+	r.Logger.Info().Str("mutation", "BatchCreateUsers").Int("users", len(users)).Msg("")
+
+	err := r.requireScope(ctx, models.UsersWriteScope)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(users) > viper.GetInt("BATCH_CREATE_USERS_LIMIT") {
+		return nil, fmt.Errorf("At most %d users can be created at once", viper.GetInt("BATCH_CREATE_USERS_LIMIT"))
+	}
+
+	results := []*models.BatchUserResult{}
+	for _, user := range users {
+		email := utils.NormalizeEmail(user.Email)
+		result := &models.BatchUserResult{Email: email}
+		results = append(results, result)
+
+		if email == "" || !strings.Contains(email, "@") {
+			message := "Invalid email"
+			result.Error = &message
+			continue
+		}
+
+		var userName sql.NullString
+		if user.Name != nil {
+			name, err := utils.ValidateName(*user.Name)
+			if err != nil {
+				message := err.Error()
+				result.Error = &message
+				continue
+			}
+
+			userName = sql.NullString{String: name, Valid: name != ""}
+		}
+
+		// Pre-provisioned users have no provider ID until their first login links one by email
+		res, err := r.DB.Exec("INSERT INTO users (identifier, user_name, email, tenant) SELECT '', $1, $2, $3 WHERE NOT EXISTS (SELECT 1 FROM users WHERE "+utils.EmailCondition("$2")+")", userName, email, services.TenantForEmail(email, true))
+		if err != nil {
+			r.Logger.Error().Err(err).Str("email", email).Msg("Could not pre-provision user")
+			message := errInternalServer.Error()
+			result.Error = &message
+			continue
+		}
+
+		rowsAffected, err := res.RowsAffected()
+		if err != nil || rowsAffected < 1 {
+			message := "User already exists"
+			result.Error = &message
+			continue
+		}
+
+		result.Created = true
+	}
+
+	return results, nil
+}
+
+func (r *mutationResolver) CreateWebhookSubscription(ctx context.Context, url string, eventTypes []string, secret string) (int, error) {
+	r.Logger.Info().Str("mutation", "CreateWebhookSubscription").Str("url", url).Strs("eventTypes", eventTypes).Msg("")
+
+	_, err := r.requireAdmin(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	if !strings.HasPrefix(url, "https://") && !strings.HasPrefix(url, "http://") {
+		return 0, errors.New("Invalid webhook URL")
+	}
+
+	if secret == "" {
+		return 0, errors.New("Secret cannot be empty")
+	}
+
+	id, err := services.CreateWebhookSubscription(r.DB, url, eventTypes, secret)
+	if errors.Is(err, services.ErrUnknownWebhookEventType) {
+		return 0, err
+	} else if err != nil {
+		r.Logger.Error().Err(err).Str("url", url).Msg("Could not create webhook subscription")
+		return 0, queryError(err)
+	}
+
+	return int(id), nil
+}
+
+func (r *mutationResolver) SetWebhookSubscriptionActive(ctx context.Context, id int, active bool) (bool, error) {
+	r.Logger.Info().Str("mutation", "SetWebhookSubscriptionActive").Int("id", id).Bool("active", active).Msg("")
+
+	_, err := r.requireAdmin(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	found, err := services.SetWebhookSubscriptionActive(r.DB, int64(id), active)
+	if err != nil {
+		r.Logger.Error().Err(err).Int("id", id).Msg("Could not update webhook subscription")
+		return false, errInternalServer
+	}
+
+	if !found {
+		return false, errors.New("Webhook subscription not found")
+	}
+
+	return true, nil
+}
+
+func (r *mutationResolver) RegenerateUID(ctx context.Context, email string) (int, error) {
+	r.Logger.Info().Str("mutation", "RegenerateUID").Str("email", email).Msg("")
+
+	err := r.requireScope(ctx, models.UsersWriteScope)
+	if err != nil {
+		return 0, err
+	}
+
+	var userIDs []int64
+	err = r.DB.Select(&userIDs, "SELECT id FROM users WHERE "+utils.EmailCondition("$1"), strings.TrimSpace(email))
+	if err != nil {
+		r.Logger.Error().Err(err).Str("email", email).Msg("Could not fetch user")
+		return 0, errInternalServer
+	}
+
+	if len(userIDs) == 0 {
+		return 0, errors.New("User not found")
+	}
+
+	if len(userIDs) > 1 {
+		return 0, errors.New("Multiple users have this email")
+	}
+
+	uid, err := services.RegenerateUserUID(r.DB, userIDs[0])
+	if err != nil {
+		r.Logger.Error().Err(err).Int64("User ID", userIDs[0]).Msg("Could not regenerate uid")
+		return 0, errInternalServer
+	}
+
+	r.Logger.Info().Int64("User ID", userIDs[0]).Int("uid", uid).Msg("Regenerated uid of user")
+	return uid, nil
+}
+
+func (r *mutationResolver) DeleteUser(ctx context.Context, email string) (bool, error) {
+	r.Logger.Info().Str("mutation", "DeleteUser").Str("email", email).Msg("")
+
+	err := r.requireScope(ctx, models.UsersWriteScope)
+	if err != nil {
+		return false, err
+	}
+
+	var userIDs []int64
+	err = r.DB.Select(&userIDs, "SELECT id FROM users WHERE "+utils.EmailCondition("$1"), strings.TrimSpace(email))
+	if err != nil {
+		r.Logger.Error().Err(err).Str("email", email).Msg("Could not fetch user")
+		return false, errInternalServer
+	}
+
+	if len(userIDs) == 0 {
+		return false, errors.New("User not found")
+	}
+
+	if len(userIDs) > 1 {
+		return false, errors.New("Multiple users have this email")
+	}
+
+	err = services.DeleteUser(ctx, r.DB, userIDs[0])
+	if err != nil {
+		r.Logger.Error().Err(err).Int64("User ID", userIDs[0]).Msg("Could not delete user")
+		return false, errInternalServer
+	}
+
+	middleware.ForgetUserTokens(userIDs[0])
+
+	r.Logger.Info().Int64("User ID", userIDs[0]).Msg("Deleted user")
+	return true, nil
+}
+
+func (r *mutationResolver) RefreshUserProfile(ctx context.Context, email string) (*models.UserProfile, error) {
+	r.Logger.Info().Str("mutation", "RefreshUserProfile").Str("email", email).Msg("")
+
+	err := r.requireScope(ctx, models.UsersWriteScope)
+	if err != nil {
+		return nil, err
+	}
+
+	var userIDs []int64
+	err = r.DB.Select(&userIDs, "SELECT id FROM users WHERE "+utils.EmailCondition("$1"), strings.TrimSpace(email))
+	if err != nil {
+		r.Logger.Error().Err(err).Str("email", email).Msg("Could not fetch user")
+		return nil, errInternalServer
+	}
+
+	if len(userIDs) == 0 {
+		return nil, errors.New("User not found")
+	}
+
+	if len(userIDs) > 1 {
+		return nil, errors.New("Multiple users have this email")
+	}
+
+	router := &services.ServiceRouter{DB: r.DB, Logger: r.Logger}
+	userData, err := router.RefreshUserProfile(ctx, userIDs[0])
+	if errors.Is(err, services.ErrNoRefreshToken) || errors.Is(err, services.ErrRefreshTokenRevoked) {
+		r.Logger.Info().Err(err).Int64("User ID", userIDs[0]).Msg("Cannot refresh user profile")
+		return nil, errors.New("The profile cannot be refreshed until the user logs in again")
+	} else if err != nil {
+		r.Logger.Error().Err(err).Int64("User ID", userIDs[0]).Msg("Could not refresh user profile")
+		return nil, errInternalServer
+	}
+
+	profile := &models.UserProfile{
+		Email:         userData.Email,
+		EmailVerified: userData.EmailVerified,
+	}
+	if userData.UserName.Valid {
+		profile.Name = &userData.UserName.String
+	}
+	if userData.Provider.Valid {
+		profile.Provider = &userData.Provider.String
+	}
+
+	r.Logger.Info().Int64("User ID", userData.ID).Msg("Refreshed user profile")
+	return profile, nil
+}
+
+func (r *mutationResolver) SetTenantSetting(ctx context.Context, tenant string, key string, value *string) (bool, error) {
+	r.Logger.Info().Str("mutation", "SetTenantSetting").Str("tenant", tenant).Str("key", key).Msg("")
+
+	_, err := r.requireAdmin(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	err = services.SetTenantSetting(r.DB, tenant, key, value)
+	if errors.Is(err, services.ErrNotTenantOverridable) || errors.Is(err, services.ErrInvalidTenantSetting) {
+		return false, err
+	} else if err != nil {
+		r.Logger.Error().Err(err).Str("tenant", tenant).Str("key", key).Msg("Could not set tenant setting")
+		return false, errInternalServer
+	}
+
+	return true, nil
+}
+
+func (r *mutationResolver) CreateJoinLink(ctx context.Context, passphrase string, role *string, expiresIn *int) (string, error) {
+	r.Logger.Info().Str("mutation", "CreateJoinLink").Str("passphrase", passphrase).Msg("")
+
+	if passphrase == "" {
+		return "", errors.New("Passphrase cannot be empty")
+	}
+
+	joinRole := utils.ViewerJoinRole
+	if role != nil {
+		joinRole = *role
+	}
+
+	if joinRole != utils.HostJoinRole && joinRole != utils.ViewerJoinRole {
+		return "", errors.New("Role must be host or viewer")
+	}
+
+	var channelData models.Channel
+	err := r.DB.Get(&channelData, "SELECT id, channel_name, host_passphrase FROM channels WHERE host_passphrase = $1", passphrase)
+	if err != nil {
+		r.Logger.Debug().Err(err).Str("passphrase", passphrase).Msg("Only the host can create join links")
+		return "", errors.New("Invalid URL")
+	}
+
+	ttl := viper.GetInt("JOIN_LINK_TTL")
+	if expiresIn != nil && *expiresIn > 0 {
+		ttl = *expiresIn
+	}
+
+	if ttl > viper.GetInt("JOIN_LINK_MAX_TTL") {
+		ttl = viper.GetInt("JOIN_LINK_MAX_TTL")
+		addWarning(ctx, ExpiryClampedWarning, fmt.Sprintf("Join link expiry was clamped to %d seconds", ttl))
+	}
+
+	link, err := utils.NewJoinLink(channelData.ChannelName, joinRole, time.Duration(ttl)*time.Second)
+	if err != nil {
+		r.Logger.Error().Err(err).Msg("Could not create join link")
+		return "", errInternalServer
+	}
+
+	return link, nil
+}
+
+func (r *mutationResolver) SetMaintenanceMode(ctx context.Context, enabled bool, message *string) (bool, error) {
+	r.Logger.Info().Str("mutation", "SetMaintenanceMode").Bool("enabled", enabled).Msg("")
+
+	_, err := r.requireAdmin(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	services.SetMaintenanceMode(enabled, message)
+	return enabled, nil
+}
+
+func (r *mutationResolver) RegisterServiceClient(ctx context.Context, scopes []string) (*models.ServiceClientCredentials, error) {
+	r.Logger.Info().Str("mutation", "RegisterServiceClient").Strs("scopes", scopes).Msg("")
+
+	_, err := r.requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials, err := services.RegisterServiceClient(r.DB, scopes)
+	if errors.Is(err, services.ErrUnknownScope) || errors.Is(err, services.ErrTooManyScopes) {
+		return nil, err
+	} else if err != nil {
+		r.Logger.Error().Err(err).Strs("scopes", scopes).Msg("Could not register service client")
+		return nil, queryError(err)
+	}
+
+	r.Logger.Info().Str("client", credentials.ClientID).Msg("Registered service client")
+	return credentials, nil
+}
+
+func (r *queryResolver) JoinChannel(ctx context.Context, passphrase string, expiry *int) (*models.Session, error) {
 	r.Logger.Info().Str("query", "JoinChannel").Str("passphrase", passphrase).Msg("")
 
+	if err := services.MaintenanceError(true); err != nil {
+		return nil, errMaintenance(err)
+	}
+
+	if err := utils.CheckEventNotEnded(); err != nil {
+		return nil, errEventEnded()
+	}
+
+	if !r.TokenLimiter.Allow(tokenLimiterKey(ctx)) {
+		r.Logger.Debug().Str("passphrase", passphrase).Msg("Token rate limit exceeded")
+		return nil, errTooManyRequests()
+	}
+
 	var channelData models.Channel
 	var host bool
 
@@ -450,12 +981,17 @@ func (r *queryResolver) JoinChannel(ctx context.Context, passphrase string) (*mo
 		return nil, errors.New("Passphrase cannot be empty")
 	}
 
-	err := r.DB.Get(&channelData, "SELECT title, channel_name, channel_secret, host_passphrase, viewer_passphrase FROM channels WHERE host_passphrase = $1 OR viewer_passphrase = $1", passphrase)
+	err := r.DB.Get(&channelData, "SELECT id, title, channel_name, channel_secret, host_passphrase, viewer_passphrase, creator_id, closed_at, scheduled_start, scheduled_end FROM channels WHERE host_passphrase = $1 OR viewer_passphrase = $1", passphrase)
 	if err != nil {
 		r.Logger.Error().Err(err).Str("passphrase", passphrase).Msg("Invalid Passphrase")
 		return nil, errors.New("Invalid URL")
 	}
 
+	if channelData.ClosedAt.Valid {
+		r.Logger.Debug().Str("channel", channelData.ChannelName).Time("closed at", channelData.ClosedAt.Time).Msg("Channel is closed")
+		return nil, errChannelClosed
+	}
+
 	if passphrase == channelData.HostPassphrase {
 		host = true
 	} else if passphrase == channelData.ViewerPassphrase {
@@ -465,18 +1001,56 @@ func (r *queryResolver) JoinChannel(ctx context.Context, passphrase string) (*mo
 		return nil, errors.New("Invalid URL")
 	}
 
-	mainUser, err := utils.GenerateUserCredentials(channelData.ChannelName, true, false)
+	err = checkSchedule(&channelData)
+	if err != nil {
+		r.Logger.Debug().Str("channel", channelData.ChannelName).Err(err).Msg("Channel is outside of its schedule")
+		return nil, err
+	}
+
+	err = r.checkChannelAllowList(ctx, &channelData)
+	if err != nil {
+		return nil, err
+	}
+
+	var ttl int
+	if expiry != nil {
+		ttl = *expiry
+	}
+	warnIfExpiryClamped(ctx, ttl)
+	ttl = scheduledTTL(ctx, &channelData, ttl)
+
+	userKey := uidUserKey(ctx)
+
+	mainUID, err := r.mainUserUID(ctx, channelData.ChannelName)
+	if err != nil {
+		r.Logger.Error().Err(err).Msg("Could not allocate main user uid")
+		return nil, errInternalServer
+	}
+
+	_, span := utils.StartSpan(ctx, "agora.GenerateUserCredentials", attribute.String("user", "main"))
+	mainUser, err := utils.GenerateUserCredentials(channelData.ChannelName, mainUID, true, ttl)
+	utils.EndSpan(span, err)
 	if err != nil {
 		r.Logger.Error().Err(err).Msg("Could not generate main user credentials")
 		return nil, errInternalServer
 	}
 
-	screenShare, err := utils.GenerateUserCredentials(channelData.ChannelName, false, false)
+	screenShareKey := userKey
+	if screenShareKey != "" {
+		screenShareKey += "/screen"
+	}
+
+	_, span = utils.StartSpan(ctx, "agora.GenerateUserCredentials", attribute.String("user", "screenshare"))
+	screenShare, err := utils.GenerateUserCredentials(channelData.ChannelName, utils.AllocateUID(screenShareKey, channelData.ChannelName, false), false, ttl)
+	utils.EndSpan(span, err)
 	if err != nil {
 		r.Logger.Error().Err(err).Msg("Could not generate screenshare user credentails")
 		return nil, errInternalServer
 	}
 
+	r.recordUsage(ctx, models.TokenUsageEvent, channelData.ID)
+	r.recordChannelToken(ctx, channelData.ID, mainUID, host, ttl)
+
 	return &models.Session{
 		Title:       channelData.Title,
 		Channel:     channelData.ChannelName,
@@ -487,6 +1061,17 @@ func (r *queryResolver) JoinChannel(ctx context.Context, passphrase string) (*mo
 	}, nil
 }
 
+func (r *queryResolver) RedeemJoinLink(ctx context.Context, channel string, role string, expires int, signature string, expiry *int) (*models.Session, error) {
+	r.Logger.Info().Str("query", "RedeemJoinLink").Str("channel", channel).Str("role", role).Msg("")
+
+	passphrase, err := r.joinLinkPassphrase(ctx, channel, role, expires, signature)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.JoinChannel(ctx, passphrase, expiry)
+}
+
 func (r *queryResolver) Share(ctx context.Context, passphrase string) (*models.ShareResponse, error) {
 	r.Logger.Info().Str("query", "Share").Str("passphrase", passphrase).Msg("Share")
 
@@ -575,6 +1160,334 @@ func (r *queryResolver) GetUser(ctx context.Context) (*models.User, error) {
 	}, nil
 }
 
+func (r *queryResolver) ProviderInfo(ctx context.Context) ([]*models.ProviderInfo, error) {
+	r.Logger.Info().Str("query", "ProviderInfo").Msg("")
+
+	return services.EnabledProviders(), nil
+}
+
+func (r *queryResolver) GenerateTokenBundle(ctx context.Context, passphrase string, expiry *int, preset *string) (*models.TokenBundle, error) {
+	r.Logger.Info().Str("query", "GenerateTokenBundle").Str("passphrase", passphrase).Msg("")
+
+	if err := services.MaintenanceError(true); err != nil {
+		return nil, errMaintenance(err)
+	}
+
+	if err := utils.CheckEventNotEnded(); err != nil {
+		return nil, errEventEnded()
+	}
+
+	if preset != nil {
+		r.Logger.Info().Str("preset", *preset).Msg("")
+	}
+
+	if viper.GetBool("ENABLE_OAUTH") {
+		_, err := middleware.GetUserFromContext(ctx)
+		if err != nil {
+			r.Logger.Debug().Msg("Invalid Token")
+			return nil, errors.New("Invalid Token")
+		}
+	}
+
+	if !r.TokenLimiter.Allow(tokenLimiterKey(ctx)) {
+		r.Logger.Debug().Str("passphrase", passphrase).Msg("Token rate limit exceeded")
+		return nil, errTooManyRequests()
+	}
+
+	var channelData models.Channel
+	var role string
+
+	if passphrase == "" {
+		return nil, errors.New("Passphrase cannot be empty")
+	}
+
+	err := r.DB.Get(&channelData, "SELECT id, title, channel_name, channel_secret, host_passphrase, viewer_passphrase, creator_id, closed_at, scheduled_start, scheduled_end FROM channels WHERE host_passphrase = $1 OR viewer_passphrase = $1", passphrase)
+	if err != nil {
+		r.Logger.Error().Err(err).Str("passphrase", passphrase).Msg("Invalid Passphrase")
+		return nil, errors.New("Invalid URL")
+	}
+
+	if channelData.ClosedAt.Valid {
+		r.Logger.Debug().Str("channel", channelData.ChannelName).Time("closed at", channelData.ClosedAt.Time).Msg("Channel is closed")
+		return nil, errChannelClosed
+	}
+
+	if passphrase == channelData.HostPassphrase {
+		role = "host"
+	} else if passphrase == channelData.ViewerPassphrase {
+		role = "viewer"
+	} else {
+		r.Logger.Debug().Str("passphrase", passphrase).Msg("Invalid Passphrase; Interal Server Error")
+		return nil, errors.New("Invalid URL")
+	}
+
+	err = checkSchedule(&channelData)
+	if err != nil {
+		r.Logger.Debug().Str("channel", channelData.ChannelName).Err(err).Msg("Channel is outside of its schedule")
+		return nil, err
+	}
+
+	err = r.checkChannelAllowList(ctx, &channelData)
+	if err != nil {
+		return nil, err
+	}
+
+	var tokenPreset utils.TokenPreset
+	if preset != nil {
+		var ok bool
+		tokenPreset, ok = utils.TokenPresets[*preset]
+		if !ok {
+			return nil, fmt.Errorf("Unknown token preset %s", *preset)
+		}
+
+		if tokenPreset.HostOnly && role != "host" {
+			r.Logger.Debug().Str("passphrase", passphrase).Str("preset", *preset).Msg("Preset requires the host passphrase")
+			return nil, errors.New("Token preset requires the host passphrase")
+		}
+	}
+
+	var ttl int
+	if expiry != nil {
+		ttl = *expiry
+	}
+	warnIfExpiryClamped(ctx, ttl)
+	ttl = scheduledTTL(ctx, &channelData, ttl)
+
+	uid, err := r.mainUserUID(ctx, channelData.ChannelName)
+	if err != nil {
+		r.Logger.Error().Err(err).Msg("Could not allocate uid")
+		return nil, errInternalServer
+	}
+
+	_, span := utils.StartSpan(ctx, "agora.GenerateTokenBundle", attribute.String("role", role))
+	var bundle *models.TokenBundle
+	if preset != nil {
+		bundle, err = utils.GeneratePresetTokenBundle(channelData.ChannelName, uid, ttl, tokenPreset)
+	} else {
+		bundle, err = utils.GenerateTokenBundle(channelData.ChannelName, uid, ttl)
+	}
+	utils.EndSpan(span, err)
+	if err != nil {
+		r.Logger.Error().Err(err).Msg("Could not generate token bundle")
+		return nil, errInternalServer
+	}
+
+	r.recordUsage(ctx, models.TokenUsageEvent, channelData.ID)
+	r.recordChannelToken(ctx, channelData.ID, uid, role == "host", ttl)
+
+	bundle.Role = role
+	bundle.Preset = preset
+	return bundle, nil
+}
+
+func (r *queryResolver) GenerateTokenBundles(ctx context.Context, passphrases []string, expiry *int) ([]*models.TokenBundleResult, error) {
+	r.Logger.Info().Str("query", "GenerateTokenBundles").Int("passphrases", len(passphrases)).Msg("")
+
+	if len(passphrases) > viper.GetInt("BATCH_TOKEN_BUNDLE_LIMIT") {
+		return nil, fmt.Errorf("At most %d token bundles can be generated at once", viper.GetInt("BATCH_TOKEN_BUNDLE_LIMIT"))
+	}
+
+	// A channel which fails only fails its own result so that the others are still usable. Every bundle counts against
+	// the TokenLimiter like a GenerateTokenBundle call of its own, so a batch of N passphrases uses N of the
+	// TOKEN_RATE_LIMIT and the bundles past the limit fail with TOO_MANY_REQUESTS.
+	results := []*models.TokenBundleResult{}
+	for _, passphrase := range passphrases {
+		result := &models.TokenBundleResult{Passphrase: passphrase}
+		results = append(results, result)
+
+		bundle, err := r.GenerateTokenBundle(ctx, passphrase, expiry, nil)
+		if err != nil {
+			message := err.Error()
+			result.Error = &message
+			continue
+		}
+
+		result.Bundle = bundle
+	}
+
+	return results, nil
+}
+
+func (r *queryResolver) ValidateAllowListConfig(ctx context.Context, entries []string) (*models.AllowListReport, error) {
+	r.Logger.Info().Str("query", "ValidateAllowListConfig").Int("entries", len(entries)).Msg("")
+
+	_, err := r.requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Lint the currently deployed allow list when no entries are passed
+	if entries == nil {
+		entries = viper.GetStringSlice("ALLOW_LIST")
+	}
+
+	return services.ValidateAllowListConfig(entries), nil
+}
+
+func (r *queryResolver) ValidateEmails(ctx context.Context, emails []string) ([]*models.EmailValidationResult, error) {
+	r.Logger.Info().Str("query", "ValidateEmails").Int("emails", len(emails)).Msg("")
+
+	_, err := r.requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(emails) > viper.GetInt("VALIDATE_EMAILS_LIMIT") {
+		return nil, fmt.Errorf("At most %d emails can be validated at once", viper.GetInt("VALIDATE_EMAILS_LIMIT"))
+	}
+
+	results, err := services.ValidateEmails(r.DB, r.Logger, emails)
+	if err != nil {
+		r.Logger.Error().Err(err).Msg("Could not validate emails")
+		return nil, errInternalServer
+	}
+
+	return results, nil
+}
+
+func (r *queryResolver) UsageStats(ctx context.Context, from time.Time, to time.Time) (*models.UsageStats, error) {
+	r.Logger.Info().Str("query", "UsageStats").Time("from", from).Time("to", to).Msg("")
+
+	err := r.requireScope(ctx, models.UsageReadScope)
+	if err != nil {
+		return nil, err
+	}
+
+	if !from.Before(to) {
+		return nil, errors.New("From has to be before to")
+	}
+
+	stats, err := services.GetUsageStats(r.DB, from, to)
+	if err != nil {
+		r.Logger.Error().Err(err).Time("from", from).Time("to", to).Msg("Could not aggregate usage stats")
+		return nil, errInternalServer
+	}
+
+	return stats, nil
+}
+
+func (r *queryResolver) ChannelParticipants(ctx context.Context, passphrase string) ([]*models.ChannelParticipant, error) {
+	r.Logger.Info().Str("query", "ChannelParticipants").Str("passphrase", passphrase).Msg("")
+
+	if passphrase == "" {
+		return nil, errors.New("Passphrase cannot be empty")
+	}
+
+	var channelData models.Channel
+	err := r.DB.Get(&channelData, "SELECT id, channel_name, host_passphrase FROM channels WHERE host_passphrase = $1 OR viewer_passphrase = $1", passphrase)
+	if err != nil {
+		r.Logger.Debug().Err(err).Str("passphrase", passphrase).Msg("Invalid Passphrase")
+		return nil, errors.New("Invalid URL")
+	}
+
+	// Admins may moderate any channel they know a passphrase of, everybody else needs the host passphrase
+	if passphrase != channelData.HostPassphrase {
+		_, err = r.requireAdmin(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	participants, err := services.GetChannelParticipants(r.DB, channelData.ID)
+	if err != nil {
+		r.Logger.Error().Err(err).Str("channel", channelData.ChannelName).Msg("Could not list channel participants")
+		return nil, errInternalServer
+	}
+
+	r.markOnline(channelData.ChannelName, participants)
+	return participants, nil
+}
+
+func (r *queryResolver) MyChannels(ctx context.Context, sort *models.ChannelSort, descending *bool, limit *int, offset *int) (*models.ChannelPage, error) {
+	r.Logger.Info().Str("query", "MyChannels").Msg("")
+
+	authUser, err := middleware.GetUserFromContext(ctx)
+	if err != nil {
+		r.Logger.Debug().Msg("Invalid Token")
+		return nil, errors.New("Invalid Token")
+	}
+
+	channelSort := models.ChannelSortCreatedAt
+	if sort != nil {
+		channelSort = *sort
+	}
+
+	pageSize := 20
+	if limit != nil {
+		pageSize = *limit
+	}
+
+	if pageSize <= 0 || pageSize > viper.GetInt("MY_CHANNELS_PAGE_LIMIT") {
+		return nil, fmt.Errorf("Limit must be between 1 and %d", viper.GetInt("MY_CHANNELS_PAGE_LIMIT"))
+	}
+
+	pageOffset := 0
+	if offset != nil {
+		pageOffset = *offset
+	}
+
+	if pageOffset < 0 {
+		return nil, errors.New("Offset cannot be negative")
+	}
+
+	page, err := services.ListUserChannels(ctx, r.DB, authUser.ID, channelSort, descending == nil || *descending, pageSize, pageOffset)
+	if err != nil {
+		r.Logger.Error().Err(err).Int64("User ID", authUser.ID).Msg("Could not list channels of user")
+		return nil, errInternalServer
+	}
+
+	return page, nil
+}
+
+func (r *queryResolver) Features(ctx context.Context) (*models.Features, error) {
+	r.Logger.Info().Str("query", "Features").Msg("")
+
+	// Features are also asked for before login, which gets the global config
+	var tenant sql.NullString
+	if authUser, err := middleware.GetUserFromContext(ctx); err == nil {
+		tenant = authUser.Tenant
+	}
+
+	tenantConfig, err := services.LoadTenantConfig(ctx, r.DB, tenant)
+	if err != nil {
+		r.Logger.Error().Err(err).Str("tenant", tenant.String).Msg("Could not load tenant config")
+		return nil, errInternalServer
+	}
+
+	return services.EnabledFeatures(tenantConfig), nil
+}
+
+func (r *queryResolver) Recordings(ctx context.Context, passphrase string) ([]*models.RecordingDownload, error) {
+	r.Logger.Info().Str("query", "Recordings").Str("passphrase", passphrase).Msg("")
+
+	if passphrase == "" {
+		return nil, errors.New("Passphrase cannot be empty")
+	}
+
+	var channelData models.Channel
+	err := r.DB.Get(&channelData, "SELECT id, channel_name, host_passphrase FROM channels WHERE host_passphrase = $1 OR viewer_passphrase = $1", passphrase)
+	if err != nil {
+		r.Logger.Debug().Err(err).Str("passphrase", passphrase).Msg("Invalid Passphrase")
+		return nil, errors.New("Invalid URL")
+	}
+
+	if passphrase != channelData.HostPassphrase {
+		r.Logger.Debug().Str("channel", channelData.ChannelName).Msg("Unauthorized to download recordings of channel")
+		return nil, errors.New("Unauthorised to download recordings of channel")
+	}
+
+	downloads, err := services.ListRecordingDownloads(r.DB, channelData.ID)
+	if errors.Is(err, utils.ErrUnsupportedStorageVendor) {
+		return nil, errRecordingNotConfigured()
+	}
+	if err != nil {
+		r.Logger.Error().Err(err).Str("channel", channelData.ChannelName).Msg("Could not list recordings")
+		return nil, errInternalServer
+	}
+
+	return downloads, nil
+}
+
 // Mutation returns generated.MutationResolver implementation.
 func (r *Resolver) Mutation() generated.MutationResolver { return &mutationResolver{r} }
 
@@ -587,8 +1500,9 @@ type queryResolver struct{ *Resolver }
 // !!! WARNING !!!
 // The code below was going to be deleted when updating resolvers. It has been copied here so you have
 // one last chance to move it out of harms way if you want. There are two reasons this happens:
-//  - When renaming or deleting a resolver the old code will be put in here. You can safely delete
-//    it when you're done.
-//  - You have helper methods in this file. Move them out to keep these resolver files clean.
+//   - When renaming or deleting a resolver the old code will be put in here. You can safely delete
+//     it when you're done.
+//   - You have helper methods in this file. Move them out to keep these resolver files clean.
 var errInternalServer error = errors.New("Internal Server Error")
 var errBadRequest error = errors.New("Bad Request")
+var errChannelClosed error = errors.New("Channel is closed")
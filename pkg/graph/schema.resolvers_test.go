@@ -0,0 +1,371 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/samyak-jain/agora_backend/pkg/middleware"
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/samyak-jain/agora_backend/pkg/models/dbtest"
+	"github.com/samyak-jain/agora_backend/services"
+	"github.com/samyak-jain/agora_backend/utils"
+	"github.com/spf13/viper"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+func TestKickUser(t *testing.T) {
+	viper.Set("KICK_DURATION", 60)
+	defer viper.Set("KICK_DURATION", 60)
+
+	tests := []struct {
+		name       string
+		host       bool
+		user       *models.UserAccount
+		ruleStatus int
+		wantUserID interface{}
+		wantRuleID interface{}
+		wantError  interface{}
+		wantErr    bool
+	}{
+		{name: "host kicks a user", host: true, ruleStatus: http.StatusOK, wantRuleID: 42},
+		{name: "signed in host is recorded", host: true, user: &models.UserAccount{ID: 5}, ruleStatus: http.StatusOK, wantUserID: 5, wantRuleID: 42},
+		{name: "failed kicking rule is recorded", host: true, ruleStatus: http.StatusBadRequest, wantError: "Kicking rule request failed with status 400", wantErr: true},
+		{name: "only hosts can kick", host: false, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver, mock := testResolver(t)
+
+			var rule kickingRuleBody
+			testAgoraAPI(t, func(w http.ResponseWriter, r *http.Request) {
+				if !tt.host {
+					t.Error("kicking rule was created for a non-host")
+				}
+
+				customerID, secret, ok := r.BasicAuth()
+				if r.Method != "POST" || r.URL.Path != "/dev/v1/kicking-rule" || !ok || customerID != "customer-id" || secret != "customer-secret" {
+					t.Errorf("got %s %s with basic auth %v %q, want the kicking rule endpoint with the customer credentials", r.Method, r.URL.Path, ok, customerID)
+				}
+
+				json.NewDecoder(r.Body).Decode(&rule)
+				w.WriteHeader(tt.ruleStatus)
+				json.NewEncoder(w).Encode(map[string]interface{}{"status": "success", "id": 42})
+			})
+
+			query := mock.ExpectQuery(`FROM channels WHERE host_passphrase = \$1`).WithArgs("host-passphrase")
+			if tt.host {
+				query.WillReturnRows([]string{"id", "channel_name"}, []interface{}{7, "channel"})
+				mock.ExpectExec(`INSERT INTO kick_actions`).WithArgs(7, 1234, tt.wantUserID, 60, tt.wantRuleID, tt.wantError)
+			}
+
+			ctx := context.Background()
+			if tt.user != nil {
+				ctx = middleware.ContextWithUser(ctx, tt.user)
+			}
+
+			ok, err := (&mutationResolver{resolver}).KickUser(ctx, "host-passphrase", 1234, nil)
+			if (err != nil) != tt.wantErr || ok == tt.wantErr {
+				t.Fatalf("KickUser() = %v, %v, wantErr %v", ok, err, tt.wantErr)
+			}
+
+			if tt.host && (rule.Cname != "channel" || rule.UID != 1234 || rule.Time != 60) {
+				t.Errorf("kicking rule = %+v, want channel, 1234 and 60 minutes", rule)
+			}
+		})
+	}
+}
+
+type kickingRuleBody struct {
+	Cname string `json:"cname"`
+	UID   int    `json:"uid"`
+	Time  int    `json:"time"`
+}
+
+func TestGenerateTokenBundles(t *testing.T) {
+	testTokenCredentials(t)
+	viper.Set("BATCH_TOKEN_BUNDLE_LIMIT", 20)
+	defer viper.Set("BATCH_TOKEN_BUNDLE_LIMIT", 0)
+
+	resolver, mock := testResolver(t)
+	resolver.TokenLimiter = utils.NewRateLimiter(3, time.Minute)
+
+	expectTokenBundle(mock, "first-host", channelRow(1, "first"))
+	mock.ExpectQuery(`FROM channels WHERE host_passphrase = \$1 OR viewer_passphrase = \$1`).WithArgs("unknown")
+	expectTokenBundle(mock, "second-viewer", channelRow(2, "second"))
+
+	// The unknown passphrase used a unit of the limit too, so the fourth bundle is refused
+	results, err := (&queryResolver{resolver}).GenerateTokenBundles(context.Background(), []string{"first-host", "unknown", "second-viewer", "third-host"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		passphrase string
+		wantRole   string
+		wantErr    string
+	}{
+		{passphrase: "first-host", wantRole: "host"},
+		{passphrase: "unknown", wantErr: "Invalid URL"},
+		{passphrase: "second-viewer", wantRole: "viewer"},
+		{passphrase: "third-host", wantErr: errTooManyRequests().Error()},
+	}
+
+	if len(results) != len(tests) {
+		t.Fatalf("GenerateTokenBundles() returned %d results, want %d", len(results), len(tests))
+	}
+
+	for i, tt := range tests {
+		result := results[i]
+		if result.Passphrase != tt.passphrase {
+			t.Errorf("result %d is for %q, want %q", i, result.Passphrase, tt.passphrase)
+		}
+
+		if tt.wantErr != "" {
+			if result.Error == nil || *result.Error != tt.wantErr || result.Bundle != nil {
+				t.Errorf("result for %q = %+v, want the error %q", tt.passphrase, result, tt.wantErr)
+			}
+			continue
+		}
+
+		if result.Error != nil || result.Bundle == nil || result.Bundle.Role != tt.wantRole || result.Bundle.Rtc == "" || result.Bundle.Rtm == "" {
+			t.Errorf("result for %q = %+v, want a %s bundle", tt.passphrase, result, tt.wantRole)
+		}
+	}
+}
+
+func TestSetMaintenanceMode(t *testing.T) {
+	viper.Set("ADMIN_LIST", []string{"admin@example.com"})
+	viper.Set("MAINTENANCE_BLOCK_TOKENS", true)
+	defer viper.Set("ADMIN_LIST", nil)
+	defer viper.Set("MAINTENANCE_BLOCK_TOKENS", false)
+	defer services.SetMaintenanceMode(false, nil)
+
+	message := "Upgrading the database"
+	tests := []struct {
+		name    string
+		user    *models.UserAccount
+		wantErr bool
+	}{
+		{name: "signed out", user: nil, wantErr: true},
+		{name: "not an admin", user: &models.UserAccount{ID: 1, Email: "user@example.com", EmailVerified: true}, wantErr: true},
+		{name: "unverified admin email", user: &models.UserAccount{ID: 2, Email: "admin@example.com"}, wantErr: true},
+		{name: "admin", user: &models.UserAccount{ID: 3, Email: "admin@example.com", EmailVerified: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			services.SetMaintenanceMode(false, nil)
+			resolver, _ := testResolver(t)
+
+			ctx := context.Background()
+			if tt.user != nil {
+				ctx = middleware.ContextWithUser(ctx, tt.user)
+			}
+
+			enabled, err := (&mutationResolver{resolver}).SetMaintenanceMode(ctx, true, &message)
+			maintenance, _ := services.MaintenanceMode()
+			if (err != nil) != tt.wantErr || maintenance == tt.wantErr {
+				t.Fatalf("SetMaintenanceMode() = %v, %v with maintenance %v, wantErr %v", enabled, err, maintenance, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			// Token requests are then rejected with the maintenance message
+			_, err = (&queryResolver{resolver}).GenerateTokenBundle(ctx, "host-passphrase", nil, nil)
+			var gqlErr *gqlerror.Error
+			if !errors.As(err, &gqlErr) || gqlErr.Extensions["code"] != "MAINTENANCE" || gqlErr.Extensions["status"] != http.StatusServiceUnavailable || gqlErr.Message != message {
+				t.Errorf("GenerateTokenBundle() = %#v, want a %d maintenance error with %q", err, http.StatusServiceUnavailable, message)
+			}
+		})
+	}
+}
+
+func TestCreateChannelBlockedName(t *testing.T) {
+	viper.Set("CHANNEL_NAME_BLOCKLIST", []string{"admin"})
+	defer viper.Set("CHANNEL_NAME_BLOCKLIST", nil)
+
+	blockedSlug, allowedSlug := "admin-room", "weekly-standup"
+	tests := []struct {
+		name  string
+		title string
+		slug  *string
+	}{
+		{name: "blocked title", title: "Admin room"},
+		{name: "blocked title with an allowed slug", title: "The admin room", slug: &allowedSlug},
+		{name: "blocked slug", title: "Weekly standup", slug: &blockedSlug},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The name is rejected before any channel is stored
+			resolver, _ := testResolver(t)
+
+			_, err := (&mutationResolver{resolver}).CreateChannel(context.Background(), tt.title, "", nil, nil, nil, tt.slug)
+			var gqlErr *gqlerror.Error
+			if !errors.As(err, &gqlErr) || gqlErr.Extensions["code"] != "CHANNEL_NAME_BLOCKED" {
+				t.Errorf("CreateChannel(%q) = %#v, want CHANNEL_NAME_BLOCKED", tt.title, err)
+			}
+		})
+	}
+}
+
+func TestBatchCreateUsers(t *testing.T) {
+	viper.Set("ADMIN_LIST", []string{"admin@example.com"})
+	viper.Set("BATCH_CREATE_USERS_LIMIT", 10)
+	defer viper.Set("ADMIN_LIST", nil)
+	defer viper.Set("BATCH_CREATE_USERS_LIMIT", 0)
+
+	admin := &models.UserAccount{ID: 1, Email: "admin@example.com", EmailVerified: true}
+	name := "  New User "
+
+	t.Run("not an admin", func(t *testing.T) {
+		resolver, _ := testResolver(t)
+		ctx := middleware.ContextWithUser(context.Background(), &models.UserAccount{ID: 2, Email: "user@example.com", EmailVerified: true})
+
+		if _, err := (&mutationResolver{resolver}).BatchCreateUsers(ctx, []*models.NewUser{{Email: "new@example.com"}}); err != errForbidden {
+			t.Errorf("BatchCreateUsers() error = %v, want %v", err, errForbidden)
+		}
+	})
+
+	resolver, mock := testResolver(t)
+
+	// Placeholder users have an empty identifier, which the first login of the email replaces
+	mock.ExpectExec(`INSERT INTO users \(identifier, user_name, email, tenant\) SELECT '', \$1, \$2, \$3 WHERE NOT EXISTS`).WithArgs("New User", "new@example.com", dbtest.Any)
+	mock.ExpectExec(`INSERT INTO users`).WithArgs(nil, "existing@example.com", dbtest.Any).WillReturnResult(0)
+
+	users := []*models.NewUser{{Email: " new@example.com ", Name: &name}, {Email: "existing@example.com"}, {Email: "not-an-email"}}
+	results, err := (&mutationResolver{resolver}).BatchCreateUsers(middleware.ContextWithUser(context.Background(), admin), users)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		email       string
+		wantCreated bool
+		wantErr     string
+	}{
+		{email: "new@example.com", wantCreated: true},
+		{email: "existing@example.com", wantErr: "User already exists"},
+		{email: "not-an-email", wantErr: "Invalid email"},
+	}
+
+	if len(results) != len(tests) {
+		t.Fatalf("BatchCreateUsers() returned %d results, want %d", len(results), len(tests))
+	}
+
+	for i, tt := range tests {
+		result := results[i]
+		if result.Email != tt.email || result.Created != tt.wantCreated || (result.Error == nil) != (tt.wantErr == "") || (result.Error != nil && *result.Error != tt.wantErr) {
+			t.Errorf("result %d = %+v, want %s created %v with error %q", i, result, tt.email, tt.wantCreated, tt.wantErr)
+		}
+	}
+}
+
+func TestUsageStats(t *testing.T) {
+	viper.Set("ADMIN_LIST", []string{"admin@example.com"})
+	defer viper.Set("ADMIN_LIST", nil)
+
+	admin := &models.UserAccount{ID: 1, Email: "admin@example.com", EmailVerified: true}
+	from := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		user       *models.UserAccount
+		to         time.Time
+		wantLogins int
+		wantErr    bool
+	}{
+		{name: "admin", user: admin, to: from.AddDate(0, 0, 7), wantLogins: 12},
+		{name: "not an admin", user: &models.UserAccount{ID: 2, Email: "user@example.com", EmailVerified: true}, to: from.AddDate(0, 0, 7), wantErr: true},
+		{name: "empty window", user: admin, to: from, wantErr: true},
+		{name: "inverted window", user: admin, to: from.AddDate(0, 0, -7), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver, mock := testResolver(t)
+			if !tt.wantErr {
+				mock.ExpectQuery(`FROM usage_events`).WithArgs(from, tt.to, dbtest.Any, dbtest.Any, dbtest.Any).
+					WillReturnRows([]string{"logins", "active_users", "new_users", "channels_created", "tokens_issued", "recordings_started"}, []interface{}{12, 5, 3, 4, 40, 2})
+			}
+
+			stats, err := (&queryResolver{resolver}).UsageStats(middleware.ContextWithUser(context.Background(), tt.user), from, tt.to)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UsageStats() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && (stats.Logins != tt.wantLogins || !stats.From.Equal(from) || !stats.To.Equal(tt.to)) {
+				t.Errorf("UsageStats() = %+v, want %d logins from %v to %v", stats, tt.wantLogins, from, tt.to)
+			}
+		})
+	}
+}
+
+func TestMyChannels(t *testing.T) {
+	viper.Set("MY_CHANNELS_PAGE_LIMIT", 50)
+	defer viper.Set("MY_CHANNELS_PAGE_LIMIT", nil)
+
+	user := &models.UserAccount{ID: 7, Email: "user@example.com"}
+	intPtr := func(i int) *int { return &i }
+
+	tests := []struct {
+		name       string
+		user       *models.UserAccount
+		limit      *int
+		offset     *int
+		wantLimit  int
+		wantOffset int
+		wantErr    bool
+	}{
+		{name: "default page", user: user, wantLimit: 20, wantOffset: 0},
+		{name: "second page", user: user, limit: intPtr(10), offset: intPtr(10), wantLimit: 10, wantOffset: 10},
+		{name: "signed out", wantErr: true},
+		{name: "zero limit", user: user, limit: intPtr(0), wantErr: true},
+		{name: "limit above the page limit", user: user, limit: intPtr(51), wantErr: true},
+		{name: "negative offset", user: user, offset: intPtr(-1), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver, mock := testResolver(t)
+			if !tt.wantErr {
+				mock.ExpectQuery(`SELECT COUNT\(\*\) FROM channels WHERE creator_id = \$1`).WithArgs(tt.user.ID).
+					WillReturnRows([]string{"count"}, []interface{}{1})
+				mock.ExpectQuery(`FROM channels WHERE creator_id = \$1 ORDER BY created_at DESC`).WithArgs(tt.user.ID, tt.wantLimit, tt.wantOffset).
+					WillReturnRows([]string{"title", "channel_name", "host_passphrase", "viewer_passphrase", "created_at", "scheduled_start", "scheduled_end", "closed_at", "recording", "recording_started_at"},
+						[]interface{}{"Standup", "standup", "host", "viewer", time.Now(), nil, nil, nil, false, nil})
+			}
+
+			ctx := context.Background()
+			if tt.user != nil {
+				ctx = middleware.ContextWithUser(ctx, tt.user)
+			}
+
+			page, err := (&queryResolver{resolver}).MyChannels(ctx, nil, nil, tt.limit, tt.offset)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MyChannels() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && (page.Total != 1 || len(page.Channels) != 1 || page.Channels[0].Channel != "standup") {
+				t.Errorf("MyChannels() = %+v, want the single channel of the user", page)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package graph
+
+import (
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/spf13/viper"
+)
+
+// Values of CHANNEL_SLUG_CONFLICT
+const (
+	// ConflictSlugPolicy fails the creation of a channel whose slug is taken
+	ConflictSlugPolicy = "conflict"
+	// JoinSlugPolicy returns the channel which took the slug, as if the caller had been shared its link
+	JoinSlugPolicy = "join"
+)
+
+// existingChannelResponse answers a createChannel whose slug was already taken, following CHANNEL_SLUG_CONFLICT.
+// Only the creator of the existing channel is given its host passphrase, everybody else joins as a viewer.
+func (r *mutationResolver) existingChannelResponse(channel *models.Channel, authUser *models.UserAccount) (*models.ShareResponse, error) {
+	r.Logger.Info().Str("slug", channel.Slug.String).Msg("Channel slug is already taken")
+	if viper.GetString("CHANNEL_SLUG_CONFLICT") != JoinSlugPolicy {
+		return nil, errChannelSlugTaken()
+	}
+
+	passphrase := &models.Passphrase{View: channel.ViewerPassphrase}
+	if authUser != nil && channel.CreatorID.Valid && channel.CreatorID.Int64 == authUser.ID {
+		passphrase.Host = &channel.HostPassphrase
+	}
+
+	return &models.ShareResponse{
+		Passphrase: passphrase,
+		Title:      channel.Title,
+		Channel:    channel.ChannelName,
+	}, nil
+}
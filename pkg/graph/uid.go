@@ -0,0 +1,34 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package graph
+
+import (
+	"context"
+
+	"github.com/samyak-jain/agora_backend/pkg/middleware"
+	"github.com/samyak-jain/agora_backend/services"
+	"github.com/samyak-jain/agora_backend/utils"
+	"github.com/spf13/viper"
+)
+
+// mainUserUID picks the uid of the main user joining the channel.
+// With derived uids an authenticated user gets the uid persisted on their account, so that it can be regenerated
+// by an admin when it collides. Everybody else goes through the regular UID_STRATEGY allocation.
+func (r *Resolver) mainUserUID(ctx context.Context, channel string) (int, error) {
+	strategy := viper.GetString("UID_STRATEGY")
+
+	authUser, err := middleware.GetUserFromContext(ctx)
+	if err != nil || (strategy != utils.DerivedUIDStrategy && strategy != utils.SDKUIDStrategy) {
+		return utils.AllocateUID(uidUserKey(ctx), channel, true), nil
+	}
+
+	return services.GetUserUID(r.DB, authUser.ID)
+}
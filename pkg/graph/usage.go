@@ -0,0 +1,38 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package graph
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/samyak-jain/agora_backend/pkg/middleware"
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/samyak-jain/agora_backend/services"
+)
+
+// recordUsage stores a usage event for the stats. Failing to do so is logged but never fails the request.
+func (r *Resolver) recordUsage(ctx context.Context, kind string, channelID int64) {
+	event := &models.UsageEvent{
+		Kind:      kind,
+		ChannelID: sql.NullInt64{Int64: channelID, Valid: channelID != 0},
+	}
+
+	authUser, err := middleware.GetUserFromContext(ctx)
+	if err == nil {
+		event.UserID = sql.NullInt64{Int64: authUser.ID, Valid: true}
+	}
+
+	err = services.RecordUsageEvent(r.DB, event)
+	if err != nil {
+		r.Logger.Error().Err(err).Str("kind", kind).Int64("channel", channelID).Msg("Could not record usage event")
+	}
+}
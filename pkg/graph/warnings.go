@@ -0,0 +1,83 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package graph
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/samyak-jain/agora_backend/utils"
+)
+
+// Stable codes of the warnings returned alongside successful responses
+const (
+	ExpiryClampedWarning   = "EXPIRY_CLAMPED"
+	DurationClampedWarning = "DURATION_CLAMPED"
+)
+
+// Warning is a non-fatal notice about a request which succeeded after being adjusted
+type Warning struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type warningsKey struct{}
+
+type warnings struct {
+	mu   sync.Mutex
+	list []Warning
+}
+
+// WarningsMiddleware collects the warnings added while resolving an operation and returns them
+// in the "warnings" extension of the response
+func WarningsMiddleware(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+	collected := &warnings{}
+	resp := next(context.WithValue(ctx, warningsKey{}, collected))
+	if resp == nil {
+		return resp
+	}
+
+	collected.mu.Lock()
+	defer collected.mu.Unlock()
+
+	if len(collected.list) > 0 {
+		if resp.Extensions == nil {
+			resp.Extensions = map[string]interface{}{}
+		}
+		resp.Extensions["warnings"] = collected.list
+	}
+
+	return resp
+}
+
+// addWarning adds a warning to the response of the current operation
+func addWarning(ctx context.Context, code string, message string) {
+	collected, ok := ctx.Value(warningsKey{}).(*warnings)
+	if !ok {
+		return
+	}
+
+	collected.mu.Lock()
+	collected.list = append(collected.list, Warning{Code: code, Message: message})
+	collected.mu.Unlock()
+}
+
+// warnIfExpiryClamped warns when the requested token expiry is above the maximum of the RTC or RTM endpoint
+func warnIfExpiryClamped(ctx context.Context, requested int) {
+	for _, endpoint := range []string{utils.RtcTokenEndpoint, utils.RtmTokenEndpoint} {
+		ttl := utils.GetTokenTTL(endpoint, requested)
+		if requested > 0 && ttl < requested {
+			addWarning(ctx, ExpiryClampedWarning, fmt.Sprintf("%s token expiry was clamped to %d seconds", endpoint, ttl))
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql"
+)
+
+func TestWarningsMiddleware(t *testing.T) {
+	tests := []struct {
+		name     string
+		warnings []Warning
+		want     string
+	}{
+		{name: "no warnings", want: `{"data":{"ok":true}}`},
+		{
+			name:     "kick duration clamped",
+			warnings: []Warning{{Code: DurationClampedWarning, Message: "Kick duration was clamped to 1440 minutes"}},
+			want:     `{"data":{"ok":true},"extensions":{"warnings":[{"code":"DURATION_CLAMPED","message":"Kick duration was clamped to 1440 minutes"}]}}`,
+		},
+		{
+			name: "several warnings in order",
+			warnings: []Warning{
+				{Code: ExpiryClampedWarning, Message: "rtc token expiry was clamped to 86400 seconds"},
+				{Code: ExpiryClampedWarning, Message: "rtm token expiry was clamped to 86400 seconds"},
+			},
+			want: `{"data":{"ok":true},"extensions":{"warnings":[{"code":"EXPIRY_CLAMPED","message":"rtc token expiry was clamped to 86400 seconds"},{"code":"EXPIRY_CLAMPED","message":"rtm token expiry was clamped to 86400 seconds"}]}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := WarningsMiddleware(context.Background(), func(ctx context.Context) *graphql.Response {
+				for _, warning := range tt.warnings {
+					addWarning(ctx, warning.Code, warning.Message)
+				}
+
+				return &graphql.Response{Data: json.RawMessage(`{"ok":true}`)}
+			})
+
+			got, err := json.Marshal(resp)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(got) != tt.want {
+				t.Errorf("response = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// The warning codes are part of the API, clients match on them
+func TestWarningCodes(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{code: ExpiryClampedWarning, want: "EXPIRY_CLAMPED"},
+		{code: DurationClampedWarning, want: "DURATION_CLAMPED"},
+	}
+
+	for _, tt := range tests {
+		if tt.code != tt.want {
+			t.Errorf("warning code = %q, want %q", tt.code, tt.want)
+		}
+	}
+}
+
+func TestAddWarningOutsideOperation(t *testing.T) {
+	// Resolvers called without the middleware, like from other resolvers, must not fail
+	addWarning(context.Background(), ExpiryClampedWarning, "ignored")
+}
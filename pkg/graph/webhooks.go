@@ -0,0 +1,21 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package graph
+
+import "github.com/samyak-jain/agora_backend/pkg/models"
+
+// webhookChannelData is the data of the channel events delivered to webhook subscriptions, which leaves out the passphrases
+func webhookChannelData(channel *models.Channel) map[string]interface{} {
+	return map[string]interface{}{
+		"channel": channel.ChannelName,
+		"title":   channel.Title,
+	}
+}
@@ -0,0 +1,80 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package middleware
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// redacted replaces secrets in the access log
+const redacted = "REDACTED"
+
+// credentialHeaders are the headers whose values are always redacted in the access log, except for the auth scheme
+var credentialHeaders = []string{"Authorization", "Cookie", "Proxy-Authorization"}
+
+// AccessLogURL returns the URL of the request for the access log, with the values of the query params in
+// ACCESS_LOG_REDACTED_PARAMS replaced, so that OAuth codes, states, tokens and join link signatures passed in URLs do
+// not leak into the logs.
+// Redaction can be turned off with REDACT_ACCESS_LOG.
+func AccessLogURL(u *url.URL) string {
+	if !viper.GetBool("REDACT_ACCESS_LOG") || u.RawQuery == "" {
+		return u.String()
+	}
+
+	query := u.Query()
+	for _, param := range viper.GetStringSlice("ACCESS_LOG_REDACTED_PARAMS") {
+		if _, ok := query[param]; ok {
+			query.Set(param, redacted)
+		}
+	}
+
+	logged := *u
+	logged.RawQuery = query.Encode()
+	return logged.String()
+}
+
+// AccessLogHeaders returns the request headers listed in ACCESS_LOG_HEADERS for the access log. Credentials are
+// redacted unless REDACT_ACCESS_LOG is turned off, an Authorization header keeps its scheme.
+func AccessLogHeaders(header http.Header) map[string]string {
+	logged := map[string]string{}
+	for _, name := range viper.GetStringSlice("ACCESS_LOG_HEADERS") {
+		value := header.Get(name)
+		if value == "" {
+			continue
+		}
+
+		if viper.GetBool("REDACT_ACCESS_LOG") && isCredentialHeader(name) {
+			if scheme := strings.SplitN(value, " ", 2); len(scheme) == 2 {
+				value = scheme[0] + " " + redacted
+			} else {
+				value = redacted
+			}
+		}
+
+		logged[http.CanonicalHeaderKey(name)] = value
+	}
+
+	return logged
+}
+
+func isCredentialHeader(name string) bool {
+	for _, header := range credentialHeaders {
+		if strings.EqualFold(name, header) {
+			return true
+		}
+	}
+
+	return false
+}
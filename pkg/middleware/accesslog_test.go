@@ -0,0 +1,50 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package middleware
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestAccessLogURL(t *testing.T) {
+	viper.Set("REDACT_ACCESS_LOG", true)
+	viper.Set("ACCESS_LOG_REDACTED_PARAMS", []string{"token", "code", "state", "flow", "signature"})
+	defer viper.Set("REDACT_ACCESS_LOG", true)
+
+	tests := []struct {
+		name   string
+		rawURL string
+		secret string
+	}{
+		{name: "oauth code", rawURL: "/oauth?code=secret-code&state=abc", secret: "secret-code"},
+		{name: "login flow", rawURL: "/oauth/retry?flow=secret-flow", secret: "secret-flow"},
+		{name: "token", rawURL: "/oauth/preview?token=secret-token&platform=mobile", secret: "secret-token"},
+		{name: "join link signature", rawURL: "/join?channel=abc&expires=1700000000&signature=secret-signature", secret: "secret-signature"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.rawURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := AccessLogURL(u)
+			if got == tt.rawURL || strings.Contains(got, tt.secret) {
+				t.Errorf("AccessLogURL(%q) = %q, want %q redacted", tt.rawURL, got, tt.secret)
+			}
+		})
+	}
+}
@@ -12,11 +12,15 @@ package middleware
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/samyak-jain/agora_backend/services"
 	"github.com/samyak-jain/agora_backend/utils"
 
 	"github.com/spf13/viper"
@@ -27,6 +31,7 @@ type contextKey struct {
 }
 
 var userContextKey = &contextKey{"user"}
+var serviceTokenContextKey = &contextKey{"service token"}
 
 // AuthHandler is a middleware for authentication
 func AuthHandler(db *models.Database, logger *utils.Logger) func(http.Handler) http.Handler {
@@ -42,34 +47,96 @@ func AuthHandler(db *models.Database, logger *utils.Logger) func(http.Handler) h
 				return
 			}
 
-			header := r.Header.Get("Authorization")
+			token, isBearer := bearerToken(r.Header.Get("Authorization"))
 
-			if header == "" {
+			if !isBearer {
+				// Other schemes, like the Basic client authentication of /oauth/token, are left to the handler
 				logger.Debug().Msg("No Token Provided")
+				if isProtectedPath(r.URL.Path) {
+					rejectMissingToken(w, r, next)
+					return
+				}
 			} else {
-				splitToken := strings.Split(header, "Bearer ")
-				token := splitToken[1]
+				if token == "" {
+					logger.Debug().Msg("Malformed Authorization header")
+					rejectToken(w, r, next, http.StatusBadRequest, "invalid_request", "The Authorization header must be a Bearer token")
+					return
+				}
 
 				var tokenData models.Token
-				var user models.User
+				var user models.UserAccount
 
 				// Fetch the token
-				err := db.Get(&tokenData, "SELECT token_id, user_id FROM tokens WHERE token_id=$1", token)
+				err := db.Get(&tokenData, "SELECT token_id, created_at, user_id, expires_at, role, device_name FROM tokens WHERE token_id=$1", token)
 				if err != nil {
-					logger.Debug().Str("token", token).Msg("Passed Invalid token")
-					next.ServeHTTP(w, r)
+					// Read only requests keep working through a short outage
+					if cachedUser := cachedTokenUser(r, token, err); cachedUser != nil {
+						logger.Warn().Err(err).Int64("id", cachedUser.ID).Msg("Could not validate token, using cached validation")
+						ctx := ContextWithUser(r.Context(), cachedUser)
+						next.ServeHTTP(w, r.WithContext(ctx))
+						return
+					}
+
+					// Service tokens carry no user, the resolvers check their scopes instead
+					if serviceToken := lookupServiceToken(db, token); serviceToken != nil {
+						logger.Info().Int64("client", serviceToken.ClientID).Str("scopes", serviceToken.Scopes).Msg("Authenticated service client")
+						ctx := context.WithValue(r.Context(), serviceTokenContextKey, serviceToken)
+						next.ServeHTTP(w, r.WithContext(ctx))
+						return
+					}
+
+					logger.Debug().Str("token hash", utils.TokenFingerprint(token)).Msg("Passed Invalid token")
+					rejectToken(w, r, next, http.StatusUnauthorized, "invalid_token", "The access token is invalid")
 					return
 				}
 
-				err = db.Get(&user, "SELECT id, identifier, user_name, email FROM users WHERE id=$1", tokenData.UserID)
+				expired := tokenData.ExpiresAt.Valid && tokenData.ExpiresAt.Time.Before(time.Now())
+				if expired && !withinRenewWindow(&tokenData) {
+					logger.Debug().Str("token hash", utils.TokenFingerprint(token)).Time("expiry", tokenData.ExpiresAt.Time).Msg("Passed Expired token")
+					rejectToken(w, r, next, http.StatusUnauthorized, "invalid_token", "The access token expired")
+					return
+				}
+
+				err = db.Get(&user, "SELECT id, identifier, user_name, email, provider, email_verified, tenant FROM users WHERE id=$1", tokenData.UserID)
 				if err != nil {
-					logger.Error().Int64("id", tokenData.UserID).Str("token", token).Msg("User does not exist for the provided token")
-					next.ServeHTTP(w, r)
+					logger.Error().Int64("id", tokenData.UserID).Str("token hash", utils.TokenFingerprint(token)).Msg("User does not exist for the provided token")
+					rejectToken(w, r, next, http.StatusUnauthorized, "invalid_token", "The access token is invalid")
 					return
 				}
 
-				logger.Info().Str("token", token).Interface("user", user).Msg("Successfull")
-				ctx := context.WithValue(r.Context(), userContextKey, &user)
+				if expired {
+					err = renewToken(r.Context(), db, &tokenData, &user)
+					if errors.Is(err, errSessionTooOld) || errors.Is(err, utils.ErrEventEnded) {
+						logger.Debug().Int64("id", tokenData.UserID).Time("created", tokenData.CreatedAt.Time).Err(err).Msg("Passed Expired token which cannot be renewed")
+						rejectToken(w, r, next, http.StatusUnauthorized, "invalid_token", "The access token expired")
+						return
+					} else if err != nil {
+						logger.Error().Err(err).Int64("id", tokenData.UserID).Msg("Could not renew token")
+						next.ServeHTTP(w, r)
+						return
+					}
+
+					logger.Debug().Int64("id", tokenData.UserID).Time("expiry", tokenData.ExpiresAt.Time).Msg("Renewed recently expired token")
+				}
+
+				// A token issued before the user's role changed is replaced so that it cannot keep the old privileges
+				if role := services.RoleOf(&user); viper.GetBool("ROTATE_TOKEN_ON_ROLE_CHANGE") && tokenData.Role != role {
+					newToken, err := rotateToken(db, &tokenData, role)
+					if err != nil {
+						logger.Error().Err(err).Int64("id", tokenData.UserID).Msg("Could not rotate token")
+						next.ServeHTTP(w, r)
+						return
+					}
+
+					logger.Info().Int64("id", tokenData.UserID).Str("old role", tokenData.Role).Str("role", role).Msg("Rotated token after role change")
+					w.Header().Set(RotatedTokenHeader, newToken)
+				} else {
+					// The rotated token was deleted, so only tokens which stay valid are cached
+					rememberValidatedToken(token, &tokenData, &user)
+				}
+
+				logger.Info().Str("token hash", utils.TokenFingerprint(token)).Int64("id", user.ID).Msg("Successfull")
+				ctx := ContextWithUser(r.Context(), &user)
 				next.ServeHTTP(w, r.WithContext(ctx))
 				return
 			}
@@ -80,6 +147,72 @@ func AuthHandler(db *models.Database, logger *utils.Logger) func(http.Handler) h
 	}
 }
 
+// bearerToken returns the token of a Bearer Authorization header, and whether the header used the Bearer scheme at all.
+// The scheme is case insensitive as described in RFC 7235.
+func bearerToken(header string) (string, bool) {
+	const scheme = "bearer"
+	if len(header) < len(scheme) || !strings.EqualFold(header[:len(scheme)], scheme) {
+		return "", false
+	}
+
+	if len(header) == len(scheme) {
+		return "", true
+	}
+
+	if header[len(scheme)] != ' ' {
+		return "", false
+	}
+
+	return strings.TrimSpace(header[len(scheme)+1:]), true
+}
+
+// isProtectedPath reports whether the path is one of PROTECTED_PATHS, which cannot be used without a bearer token
+func isProtectedPath(path string) bool {
+	for _, protected := range viper.GetStringSlice("PROTECTED_PATHS") {
+		if protected == path {
+			return true
+		}
+	}
+
+	return false
+}
+
+// rejectMissingToken answers a request to a protected path without a bearer token with a challenge carrying no error
+// code, as described in RFC 6750, when REJECT_INVALID_TOKENS is enabled
+func rejectMissingToken(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	if !viper.GetBool("REJECT_INVALID_TOKENS") {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	w.WriteHeader(http.StatusUnauthorized)
+}
+
+type bearerError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// rejectToken answers a request which carries an unusable bearer token as described in RFC 6750 when REJECT_INVALID_TOKENS
+// is enabled. Otherwise the request goes on without a user, like one without a token.
+func rejectToken(w http.ResponseWriter, r *http.Request, next http.Handler, status int, code string, description string) {
+	if !viper.GetBool("REJECT_INVALID_TOKENS") {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="%s", error_description="%s"`, code, description))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(bearerError{Error: code, ErrorDescription: description})
+}
+
+// ContextWithUser returns a copy of the context which carries the authenticated user
+func ContextWithUser(ctx context.Context, user *models.UserAccount) context.Context {
+	return context.WithValue(ctx, userContextKey, user)
+}
+
 // GetUserFromContext fetches the user from the context
 func GetUserFromContext(ctx context.Context) (*models.UserAccount, error) {
 	userObject := ctx.Value(userContextKey)
@@ -0,0 +1,101 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/samyak-jain/agora_backend/utils"
+	"github.com/spf13/viper"
+)
+
+func TestBearerToken(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     string
+		wantToken  string
+		wantBearer bool
+	}{
+		{name: "bearer", header: "Bearer abc", wantToken: "abc", wantBearer: true},
+		{name: "lower case scheme", header: "bearer abc", wantToken: "abc", wantBearer: true},
+		{name: "no token", header: "Bearer", wantToken: "", wantBearer: true},
+		{name: "blank token", header: "Bearer  ", wantToken: "", wantBearer: true},
+		{name: "basic", header: "Basic Y2xpZW50OnNlY3JldA==", wantToken: "", wantBearer: false},
+		{name: "scheme prefix", header: "Bearerabc", wantToken: "", wantBearer: false},
+		{name: "empty", header: "", wantToken: "", wantBearer: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, isBearer := bearerToken(tt.header)
+			if token != tt.wantToken || isBearer != tt.wantBearer {
+				t.Errorf("bearerToken(%q) = %q, %v, want %q, %v", tt.header, token, isBearer, tt.wantToken, tt.wantBearer)
+			}
+		})
+	}
+}
+
+func TestAuthHandlerWithoutBearerToken(t *testing.T) {
+	logger := zerolog.Nop()
+
+	tests := []struct {
+		name          string
+		path          string
+		header        string
+		reject        bool
+		wantStatus    int
+		wantChallenge string
+	}{
+		{name: "basic client authentication", path: "/oauth/token", header: "Basic Y2xpZW50OnNlY3JldA==", reject: true, wantStatus: http.StatusOK},
+		{name: "missing token on public path", path: "/oauth", reject: true, wantStatus: http.StatusOK},
+		{name: "missing token on protected path", path: "/query", reject: true, wantStatus: http.StatusUnauthorized, wantChallenge: "Bearer"},
+		{name: "basic on protected path", path: "/query", header: "Basic Y2xpZW50OnNlY3JldA==", reject: true, wantStatus: http.StatusUnauthorized, wantChallenge: "Bearer"},
+		{name: "missing token without rejection", path: "/query", reject: false, wantStatus: http.StatusOK},
+		{name: "malformed bearer", path: "/oauth", header: "Bearer", reject: true, wantStatus: http.StatusBadRequest, wantChallenge: `Bearer error="invalid_request", error_description="The Authorization header must be a Bearer token"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("ENABLE_OAUTH", true)
+			viper.Set("REJECT_INVALID_TOKENS", tt.reject)
+			viper.Set("PROTECTED_PATHS", []string{"/query"})
+			defer func() {
+				viper.Set("ENABLE_OAUTH", false)
+				viper.Set("REJECT_INVALID_TOKENS", false)
+				viper.Set("PROTECTED_PATHS", []string{})
+			}()
+
+			// The database is not reached without a bearer token
+			handler := AuthHandler(nil, &utils.Logger{Logger: &logger})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			r := httptest.NewRequest(http.MethodPost, tt.path, nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+
+			if got := w.Header().Get("WWW-Authenticate"); got != tt.wantChallenge {
+				t.Errorf("WWW-Authenticate = %q, want %q", got, tt.wantChallenge)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	trustedProxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", "fd00::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		realIP       string
+		want         string
+	}{
+		{name: "direct client", remoteAddr: "203.0.113.7:4321", want: "203.0.113.7"},
+		{name: "spoofed forwarded for from an untrusted peer", remoteAddr: "203.0.113.7:4321", forwardedFor: "198.51.100.1", want: "203.0.113.7"},
+		{name: "spoofed real ip from an untrusted peer", remoteAddr: "203.0.113.7:4321", realIP: "198.51.100.1", want: "203.0.113.7"},
+		{name: "trusted proxy", remoteAddr: "10.0.0.2:4321", forwardedFor: "198.51.100.1", want: "198.51.100.1"},
+		{name: "multi hop chain through trusted proxies", remoteAddr: "10.0.0.2:4321", forwardedFor: "198.51.100.1, 10.0.0.5, 10.0.0.3", want: "198.51.100.1"},
+		{name: "spoofed hop before an untrusted hop", remoteAddr: "10.0.0.2:4321", forwardedFor: "192.0.2.9, 198.51.100.1, 10.0.0.3", want: "198.51.100.1"},
+		{name: "chain of only trusted proxies", remoteAddr: "10.0.0.2:4321", forwardedFor: "10.0.0.4, 10.0.0.3", want: "10.0.0.4"},
+		{name: "malformed hop falls back to the peer", remoteAddr: "10.0.0.2:4321", forwardedFor: "198.51.100.1, not-an-ip", realIP: "192.0.2.9", want: "10.0.0.2"},
+		{name: "real ip from a trusted proxy", remoteAddr: "10.0.0.2:4321", realIP: "198.51.100.1", want: "198.51.100.1"},
+		{name: "ipv6 peer", remoteAddr: "[2001:db8::1]:4321", forwardedFor: "198.51.100.1", want: "2001:db8::1"},
+		{name: "ipv6 trusted proxy", remoteAddr: "[fd00::1]:4321", forwardedFor: "2001:db8::7", want: "2001:db8::7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.forwardedFor != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+
+			if got := ClientIP(r, trustedProxies); got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gofrs/uuid"
+)
+
+// RequestIDHeader is the header used to receive and return the ID of a request
+const RequestIDHeader = "X-Request-ID"
+
+var requestIDContextKey = &contextKey{"requestID"}
+
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// traceparent is version-traceid-parentid-flags as defined by W3C Trace Context
+var traceParentPattern = regexp.MustCompile(`^[0-9a-f]{2}-([0-9a-f]{32})-[0-9a-f]{16}-[0-9a-f]{2}$`)
+
+// IncomingRequestID returns the request ID assigned by an upstream gateway, if it is well formed.
+// X-Request-ID takes precedence over the trace ID of a traceparent header.
+func IncomingRequestID(r *http.Request) (string, bool) {
+	if requestID := strings.TrimSpace(r.Header.Get(RequestIDHeader)); requestIDPattern.MatchString(requestID) {
+		return requestID, true
+	}
+
+	match := traceParentPattern.FindStringSubmatch(strings.TrimSpace(r.Header.Get("traceparent")))
+	if match == nil || strings.Trim(match[1], "0") == "" {
+		return "", false
+	}
+
+	return match[1], true
+}
+
+// RequestIDHandler is a middleware which assigns an ID to every request, stores it in the context and returns it in the response.
+// When adoptIncoming is set, an ID provided by an upstream gateway is reused so that the request can be traced end to end.
+func RequestIDHandler(adoptIncoming bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestID, ok := "", false
+			if adoptIncoming {
+				requestID, ok = IncomingRequestID(r)
+			}
+
+			if !ok {
+				requestID = uuid.Must(uuid.NewV4()).String()
+			}
+
+			w.Header().Set(RequestIDHeader, requestID)
+			ctx := context.WithValue(r.Context(), requestIDContextKey, requestID)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// GetRequestIDFromContext fetches the ID of the request from the context
+func GetRequestIDFromContext(ctx context.Context) string {
+	requestID, ok := ctx.Value(requestIDContextKey).(string)
+	if !ok {
+		return ""
+	}
+
+	return requestID
+}
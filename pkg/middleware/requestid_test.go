@@ -0,0 +1,73 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofrs/uuid"
+)
+
+func TestRequestIDHandler(t *testing.T) {
+	tests := []struct {
+		name          string
+		adoptIncoming bool
+		requestID     string
+		traceParent   string
+		want          string
+	}{
+		{name: "generated", adoptIncoming: true},
+		{name: "incoming ID adopted", adoptIncoming: true, requestID: "gateway-1234", want: "gateway-1234"},
+		{name: "incoming ID ignored when not adopting", adoptIncoming: false, requestID: "gateway-1234"},
+		{name: "invalid incoming ID rejected", adoptIncoming: true, requestID: "bad id\r\nX-Injected: 1"},
+		{name: "overlong incoming ID rejected", adoptIncoming: true, requestID: string(make([]byte, 129))},
+		{name: "trace ID adopted", adoptIncoming: true, traceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", want: "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{name: "zero trace ID rejected", adoptIncoming: true, traceParent: "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var contextID string
+			handler := RequestIDHandler(tt.adoptIncoming)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				contextID = GetRequestIDFromContext(r.Context())
+			}))
+
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.requestID != "" {
+				r.Header.Set(RequestIDHeader, tt.requestID)
+			}
+			if tt.traceParent != "" {
+				r.Header.Set("traceparent", tt.traceParent)
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			responseID := w.Header().Get(RequestIDHeader)
+			if responseID != contextID {
+				t.Errorf("response header %q does not echo the request ID %q", responseID, contextID)
+			}
+
+			if tt.want != "" {
+				if contextID != tt.want {
+					t.Errorf("request ID = %q, want %q", contextID, tt.want)
+				}
+				return
+			}
+
+			if _, err := uuid.FromString(contextID); err != nil {
+				t.Errorf("request ID = %q, want a generated UUID", contextID)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/samyak-jain/agora_backend/services"
+	"github.com/samyak-jain/agora_backend/utils"
+	"github.com/spf13/viper"
+)
+
+// RotatedTokenHeader returns the new bearer token to the client after its old one was rotated
+const RotatedTokenHeader = "X-Session-Token"
+
+// rotateToken replaces the token with a new one which carries the current role of the user.
+// The old token is deleted in the same transaction, so it stops working as soon as the new one is issued. The new token
+// keeps the creation time of the old one, so that rotating does not extend the maximum session lifetime.
+func rotateToken(db *models.Database, tokenData *models.Token, role string) (string, error) {
+	newToken, err := utils.GenerateSessionToken()
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.NamedExec("INSERT INTO tokens (created_at, token_id, user_id, expires_at, role, device_name) VALUES (COALESCE(:created_at, CURRENT_TIMESTAMP), :token_id, :user_id, :expires_at, :role, :device_name)", &models.Token{
+		CreatedAt:  tokenData.CreatedAt,
+		TokenID:    newToken,
+		UserID:     tokenData.UserID,
+		ExpiresAt:  tokenData.ExpiresAt,
+		Role:       role,
+		DeviceName: tokenData.DeviceName,
+	})
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	_, err = tx.Exec("DELETE FROM tokens WHERE token_id = $1", tokenData.TokenID)
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return "", err
+	}
+
+	ForgetToken(tokenData.TokenID)
+	return newToken, nil
+}
+
+// withinRenewWindow reports whether the expired token was used within SESSION_TOKEN_RENEW_WINDOW seconds of its expiry.
+// Such tokens are renewed instead of rejected, so that active users get a sliding expiry. A window of 0 disables renewal.
+func withinRenewWindow(tokenData *models.Token) bool {
+	window := time.Duration(viper.GetInt("SESSION_TOKEN_RENEW_WINDOW")) * time.Second
+	return window > 0 && time.Now().Before(tokenData.ExpiresAt.Time.Add(window))
+}
+
+// errSessionTooOld is returned when renewing a token which was created SESSION_TOKEN_MAX_TTL seconds ago or earlier
+var errSessionTooOld = errors.New("Session is older than the maximum session lifetime")
+
+// renewedExpiry returns the expiry of a token renewed at now for the TTL. Renewals never push the expiry past the
+// creation of the token plus maxTTL, which is an absolute limit on the lifetime of a session, and a token past that
+// limit is not renewed at all. A TTL or maxTTL of 0 or less means no limit.
+func renewedExpiry(createdAt sql.NullTime, now time.Time, ttl time.Duration, maxTTL time.Duration) (sql.NullTime, error) {
+	expiresAt := sql.NullTime{Time: now.Add(ttl), Valid: ttl > 0}
+	if maxTTL <= 0 || !createdAt.Valid {
+		return expiresAt, nil
+	}
+
+	limit := createdAt.Time.Add(maxTTL)
+	if !now.Before(limit) {
+		return sql.NullTime{}, errSessionTooOld
+	}
+
+	if !expiresAt.Valid || expiresAt.Time.After(limit) {
+		expiresAt = sql.NullTime{Time: limit, Valid: true}
+	}
+
+	return expiresAt, nil
+}
+
+// renewToken extends the expiry of the token by the session token TTL, counting from now, within the maximum session
+// lifetime of SESSION_TOKEN_MAX_TTL seconds counted from its creation. Both come from the config of the user's tenant.
+// Tokens are not renewed once EVENT_END has passed.
+func renewToken(ctx context.Context, db *models.Database, tokenData *models.Token, user *models.UserAccount) error {
+	if err := utils.CheckEventNotEnded(); err != nil {
+		return err
+	}
+
+	tenantConfig, err := services.LoadTenantConfig(ctx, db, user.Tenant)
+	if err != nil {
+		return err
+	}
+
+	tokenTTL := time.Duration(utils.GetTokenTTLFrom(tenantConfig, utils.SessionTokenEndpoint, 0)) * time.Second
+	maxTTL := time.Duration(tenantConfig.GetInt("SESSION_TOKEN_MAX_TTL")) * time.Second
+
+	expiresAt, err := renewedExpiry(tokenData.CreatedAt, time.Now(), tokenTTL, maxTTL)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("UPDATE tokens SET expires_at = $1 WHERE token_id = $2", expiresAt, tokenData.TokenID)
+	if err != nil {
+		return err
+	}
+
+	tokenData.ExpiresAt = expiresAt
+	return nil
+}
@@ -0,0 +1,143 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package middleware
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/samyak-jain/agora_backend/pkg/models/dbtest"
+	"github.com/samyak-jain/agora_backend/utils"
+	"github.com/spf13/viper"
+)
+
+func TestRenewedExpiry(t *testing.T) {
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	created := func(ago time.Duration) sql.NullTime { return sql.NullTime{Time: now.Add(-ago), Valid: true} }
+	expiry := func(in time.Duration) sql.NullTime { return sql.NullTime{Time: now.Add(in), Valid: true} }
+
+	tests := []struct {
+		name      string
+		createdAt sql.NullTime
+		ttl       time.Duration
+		maxTTL    time.Duration
+		want      sql.NullTime
+		wantErr   error
+	}{
+		{name: "within lifetime", createdAt: created(time.Hour), ttl: time.Hour, maxTTL: 24 * time.Hour, want: expiry(time.Hour)},
+		{name: "capped at lifetime", createdAt: created(23 * time.Hour), ttl: 2 * time.Hour, maxTTL: 24 * time.Hour, want: expiry(time.Hour)},
+		{name: "past lifetime", createdAt: created(24 * time.Hour), ttl: time.Hour, maxTTL: 24 * time.Hour, wantErr: errSessionTooOld},
+		{name: "no maximum", createdAt: created(48 * time.Hour), ttl: time.Hour, maxTTL: 0, want: expiry(time.Hour)},
+		{name: "unknown creation", createdAt: sql.NullTime{}, ttl: time.Hour, maxTTL: 24 * time.Hour, want: expiry(time.Hour)},
+		{name: "never expiring ttl is capped", createdAt: created(time.Hour), ttl: 0, maxTTL: 24 * time.Hour, want: expiry(23 * time.Hour)},
+		{name: "never expiring", createdAt: created(time.Hour), ttl: 0, maxTTL: 0, want: sql.NullTime{Time: now, Valid: false}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renewedExpiry(tt.createdAt, now, tt.ttl, tt.maxTTL)
+			if err != tt.wantErr {
+				t.Fatalf("renewedExpiry() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("renewedExpiry() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthHandlerRotatesTokenOnRoleChange(t *testing.T) {
+	viper.Set("ENABLE_OAUTH", true)
+	viper.Set("REJECT_INVALID_TOKENS", true)
+	viper.Set("ROTATE_TOKEN_ON_ROLE_CHANGE", true)
+	viper.Set("ADMIN_LIST", []string{"admin@example.com"})
+	defer func() {
+		viper.Set("ENABLE_OAUTH", false)
+		viper.Set("REJECT_INVALID_TOKENS", false)
+		viper.Set("ROTATE_TOKEN_ON_ROLE_CHANGE", false)
+		viper.Set("ADMIN_LIST", []string{})
+	}()
+
+	createdAt := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	tokenColumns := []string{"token_id", "created_at", "user_id", "expires_at", "role", "device_name"}
+	userColumns := []string{"id", "identifier", "user_name", "email", "provider", "email_verified", "tenant"}
+
+	tests := []struct {
+		name       string
+		tokenRole  string
+		wantRotate bool
+	}{
+		{name: "promoted user", tokenRole: "user", wantRotate: true},
+		{name: "unchanged role", tokenRole: "admin", wantRotate: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := zerolog.Nop()
+			db, mock := dbtest.New(t)
+
+			mock.ExpectQuery(`FROM tokens WHERE token_id=\$1`).WithArgs("old-token").
+				WillReturnRows(tokenColumns, []interface{}{"old-token", createdAt, 1, nil, tt.tokenRole, "laptop"})
+			mock.ExpectQuery(`FROM users WHERE id=\$1`).WithArgs(1).
+				WillReturnRows(userColumns, []interface{}{1, "google-id", "Admin", "admin@example.com", "google", true, nil})
+			if tt.wantRotate {
+				mock.ExpectBegin()
+				mock.ExpectExec(`INSERT INTO tokens`).WithArgs(createdAt, dbtest.Any, 1, nil, "admin", "laptop")
+				mock.ExpectExec(`DELETE FROM tokens WHERE token_id = \$1`).WithArgs("old-token")
+				mock.ExpectCommit()
+
+				// The old token is gone afterwards, so it is rejected like any unknown token
+				mock.ExpectQuery(`FROM tokens WHERE token_id=\$1`).WithArgs("old-token")
+				mock.ExpectQuery(`FROM service_tokens WHERE token_id=\$1`).WithArgs("old-token")
+			}
+
+			var userID int64
+			handler := AuthHandler(db, &utils.Logger{Logger: &logger})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if user, err := GetUserFromContext(r.Context()); err == nil {
+					userID = user.ID
+				}
+			}))
+
+			request := func() *httptest.ResponseRecorder {
+				r := httptest.NewRequest("GET", "/query", nil)
+				r.Header.Set("Authorization", "Bearer old-token")
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, r)
+				return w
+			}
+
+			w := request()
+			if userID != 1 {
+				t.Fatalf("request was not authenticated, got user %d", userID)
+			}
+
+			newToken := w.Header().Get(RotatedTokenHeader)
+			if (newToken != "") != tt.wantRotate {
+				t.Fatalf("%s = %q, want rotation %v", RotatedTokenHeader, newToken, tt.wantRotate)
+			}
+
+			if tt.wantRotate {
+				if newToken == "old-token" {
+					t.Errorf("%s returned the old token", RotatedTokenHeader)
+				}
+
+				if w := request(); w.Code != http.StatusUnauthorized {
+					t.Errorf("old token got status %d, want %d", w.Code, http.StatusUnauthorized)
+				}
+			}
+		})
+	}
+}
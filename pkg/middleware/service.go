@@ -0,0 +1,40 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package middleware
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/samyak-jain/agora_backend/pkg/models"
+)
+
+// lookupServiceToken returns the unexpired service token with the ID, or nil if there is none
+func lookupServiceToken(db *models.Database, token string) *models.ServiceToken {
+	var serviceToken models.ServiceToken
+	err := db.Get(&serviceToken, "SELECT token_id, client_id, scopes, expires_at FROM service_tokens WHERE token_id=$1", token)
+	if err != nil || serviceToken.ExpiresAt.Before(time.Now()) {
+		return nil
+	}
+
+	return &serviceToken
+}
+
+// GetServiceTokenFromContext fetches the service token a service client authenticated with from the context
+func GetServiceTokenFromContext(ctx context.Context) (*models.ServiceToken, error) {
+	serviceToken := ctx.Value(serviceTokenContextKey)
+	if serviceToken != nil {
+		return serviceToken.(*models.ServiceToken), nil
+	}
+
+	return nil, errors.New("No service token")
+}
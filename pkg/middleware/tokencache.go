@@ -0,0 +1,164 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/spf13/viper"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/parser"
+)
+
+// maxTokenCacheTTL bounds TOKEN_CACHE_TTL, so that a revoked token is never honoured for long during an outage
+const maxTokenCacheTTL = 5 * time.Minute
+
+type validatedToken struct {
+	user        models.UserAccount
+	expiresAt   sql.NullTime
+	validatedAt time.Time
+}
+
+// validatedTokens caches recently validated session tokens by their SHA-256, so that the raw tokens are not kept
+var (
+	validatedTokensMutex sync.Mutex
+	validatedTokens      = map[[sha256.Size]byte]validatedToken{}
+)
+
+// tokenCacheTTL is how long a validation is reused while the database is unreachable, TOKEN_CACHE_TTL seconds capped
+// at five minutes. A TTL of 0 disables the cache.
+func tokenCacheTTL() time.Duration {
+	ttl := time.Duration(viper.GetInt("TOKEN_CACHE_TTL")) * time.Second
+	if ttl > maxTokenCacheTTL {
+		return maxTokenCacheTTL
+	}
+
+	return ttl
+}
+
+// rememberValidatedToken caches the user of a token which was just validated against the database.
+// Once TOKEN_CACHE_MAX_ENTRIES is reached, stale entries are dropped and new tokens are not cached until there is room.
+func rememberValidatedToken(token string, tokenData *models.Token, user *models.UserAccount) {
+	ttl := tokenCacheTTL()
+	if ttl <= 0 {
+		return
+	}
+
+	validatedTokensMutex.Lock()
+	defer validatedTokensMutex.Unlock()
+
+	if len(validatedTokens) >= viper.GetInt("TOKEN_CACHE_MAX_ENTRIES") {
+		for key, entry := range validatedTokens {
+			if time.Since(entry.validatedAt) >= ttl {
+				delete(validatedTokens, key)
+			}
+		}
+
+		if len(validatedTokens) >= viper.GetInt("TOKEN_CACHE_MAX_ENTRIES") {
+			return
+		}
+	}
+
+	validatedTokens[sha256.Sum256([]byte(token))] = validatedToken{user: *user, expiresAt: tokenData.ExpiresAt, validatedAt: time.Now()}
+}
+
+// cachedTokenUser returns the user of a token validated within the TTL, for when the database cannot be queried.
+// Tokens that expired since are not returned, and neither is anything for a query which failed because the token or
+// user does not exist, since then the database did answer. Only read only requests are let through on a cached
+// validation, so that a revoked token cannot change anything during an outage.
+func cachedTokenUser(r *http.Request, token string, queryErr error) *models.UserAccount {
+	ttl := tokenCacheTTL()
+	if ttl <= 0 || errors.Is(queryErr, sql.ErrNoRows) || !isReadOnlyRequest(r) {
+		return nil
+	}
+
+	validatedTokensMutex.Lock()
+	entry, ok := validatedTokens[sha256.Sum256([]byte(token))]
+	validatedTokensMutex.Unlock()
+
+	if !ok || time.Since(entry.validatedAt) >= ttl || (entry.expiresAt.Valid && entry.expiresAt.Time.Before(time.Now())) {
+		return nil
+	}
+
+	user := entry.user
+	return &user
+}
+
+// ForgetToken drops the cached validation of a token which was deleted, like on logout
+func ForgetToken(token string) {
+	validatedTokensMutex.Lock()
+	defer validatedTokensMutex.Unlock()
+
+	delete(validatedTokens, sha256.Sum256([]byte(token)))
+}
+
+// ForgetUserTokens drops the cached validations of every token of a user whose sessions were revoked or who was deleted
+func ForgetUserTokens(userID int64) {
+	validatedTokensMutex.Lock()
+	defer validatedTokensMutex.Unlock()
+
+	for key, entry := range validatedTokens {
+		if entry.user.ID == userID {
+			delete(validatedTokens, key)
+		}
+	}
+}
+
+type graphQLRequest struct {
+	Query         string `json:"query"`
+	OperationName string `json:"operationName"`
+}
+
+// isReadOnlyRequest reports whether the request is a GET, or a GraphQL POST whose operation is a query.
+// The body is read to find the operation and put back for the handler.
+func isReadOnlyRequest(r *http.Request) bool {
+	if r.Method == http.MethodGet {
+		return true
+	}
+
+	if r.Method != http.MethodPost || r.Body == nil {
+		return false
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return false
+	}
+
+	var request graphQLRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		return false
+	}
+
+	document, parseErr := parser.ParseQuery(&ast.Source{Input: request.Query})
+	if parseErr != nil {
+		return false
+	}
+
+	var operation *ast.OperationDefinition
+	if request.OperationName != "" {
+		operation = document.Operations.ForName(request.OperationName)
+	} else if len(document.Operations) == 1 {
+		operation = document.Operations[0]
+	}
+
+	return operation != nil && operation.Operation == ast.Query
+}
@@ -0,0 +1,96 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package middleware
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/spf13/viper"
+)
+
+func TestIsReadOnlyRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		want   bool
+	}{
+		{name: "get", method: http.MethodGet, want: true},
+		{name: "query", method: http.MethodPost, body: `{"query": "{ getUser { name } }"}`, want: true},
+		{name: "named query", method: http.MethodPost, body: `{"query": "query user { getUser { name } }"}`, want: true},
+		{name: "mutation", method: http.MethodPost, body: `{"query": "mutation { logoutSession(token: \"abc\") }"}`, want: false},
+		{name: "selected mutation", method: http.MethodPost, body: `{"query": "query user { getUser { name } } mutation logout { logoutSession(token: \"abc\") }", "operationName": "logout"}`, want: false},
+		{name: "selected query", method: http.MethodPost, body: `{"query": "query user { getUser { name } } mutation logout { logoutSession(token: \"abc\") }", "operationName": "user"}`, want: true},
+		{name: "ambiguous operation", method: http.MethodPost, body: `{"query": "query user { getUser { name } } mutation logout { logoutSession(token: \"abc\") }"}`, want: false},
+		{name: "unparseable query", method: http.MethodPost, body: `{"query": "{ getUser {"}`, want: false},
+		{name: "form post", method: http.MethodPost, body: "grant_type=client_credentials", want: false},
+		{name: "delete", method: http.MethodDelete, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/query", strings.NewReader(tt.body))
+			if got := isReadOnlyRequest(r); got != tt.want {
+				t.Errorf("isReadOnlyRequest() = %v, want %v", got, tt.want)
+			}
+
+			// The handler still gets the whole body
+			body, _ := ioutil.ReadAll(r.Body)
+			if string(body) != tt.body {
+				t.Errorf("body = %q, want %q", body, tt.body)
+			}
+		})
+	}
+}
+
+func TestCachedTokenUser(t *testing.T) {
+	viper.Set("TOKEN_CACHE_TTL", 60)
+	viper.Set("TOKEN_CACHE_MAX_ENTRIES", 10)
+	defer viper.Set("TOKEN_CACHE_TTL", 0)
+
+	outage := errors.New("connection refused")
+	query := `{"query": "{ getUser { name } }"}`
+
+	tests := []struct {
+		name   string
+		forget func()
+		body   string
+		want   bool
+	}{
+		{name: "query during an outage", body: query, want: true},
+		{name: "mutation during an outage", body: `{"query": "mutation { deleteUser(email: \"user@example.com\") }"}`, want: false},
+		{name: "logged out", forget: func() { ForgetToken("abc") }, body: query, want: false},
+		{name: "user deleted", forget: func() { ForgetUserTokens(1) }, body: query, want: false},
+		{name: "other user deleted", forget: func() { ForgetUserTokens(2) }, body: query, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rememberValidatedToken("abc", &models.Token{TokenID: "abc"}, &models.UserAccount{ID: 1})
+			defer ForgetToken("abc")
+
+			if tt.forget != nil {
+				tt.forget()
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(tt.body))
+			if got := cachedTokenUser(r, "abc", outage); (got != nil) != tt.want {
+				t.Errorf("cachedTokenUser() = %v, want a user %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package models
+
+import "time"
+
+// Outcomes of a login attempt
+const (
+	LoginSucceeded = "success"
+	LoginFailed    = "failure"
+	// LoginBreakGlass is a successful login of the break-glass account, which should alert whoever watches the sink
+	LoginBreakGlass = "break_glass"
+)
+
+// LoginEvent records a login attempt for security auditing
+type LoginEvent struct {
+	Time     time.Time `json:"time"`
+	Outcome  string    `json:"outcome"`
+	Reason   string    `json:"reason,omitempty"`
+	Email    string    `json:"email"`
+	Subject  string    `json:"subject"`
+	Provider string    `json:"provider"`
+}
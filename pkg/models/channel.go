@@ -10,7 +10,10 @@
 
 package models
 
-import "database/sql"
+import (
+	"database/sql"
+	"time"
+)
 
 // Channel Model contains all the details for a particular channel session
 type Channel struct {
@@ -24,4 +27,78 @@ type Channel struct {
 	RecordingUID     sql.NullInt32  `db:"recording_uid"`
 	RecordingSID     sql.NullString `db:"recording_sid"`
 	RecordingRID     sql.NullString `db:"recording_rid"`
+	CreatorID        sql.NullInt64  `db:"creator_id"`
+	LastActiveAt     sql.NullTime   `db:"last_active_at"`
+	ClosedAt         sql.NullTime   `db:"closed_at"`
+	ScheduledStart   sql.NullTime   `db:"scheduled_start"`
+	ScheduledEnd     sql.NullTime   `db:"scheduled_end"`
+	Slug             sql.NullString `db:"slug"`
+}
+
+// KickAction records a host removing a uid from a channel
+type KickAction struct {
+	ID        int64          `db:"id"`
+	ChannelID int64          `db:"channel_id"`
+	UID       int64          `db:"uid"`
+	UserID    sql.NullInt64  `db:"user_id"`
+	Duration  int            `db:"duration"`
+	RuleID    sql.NullInt64  `db:"rule_id"`
+	Error     sql.NullString `db:"error"`
+}
+
+// ChannelToken records an RTC token issued for a channel until it expires
+type ChannelToken struct {
+	ID        int64         `db:"id"`
+	ChannelID int64         `db:"channel_id"`
+	UserID    sql.NullInt64 `db:"user_id"`
+	UID       int64         `db:"uid"`
+	IsHost    bool          `db:"is_host"`
+	ExpiresAt time.Time     `db:"expires_at"`
+}
+
+// ChannelParticipant is a uid which holds an unexpired token for a channel
+type ChannelParticipant struct {
+	UID       int64     `json:"uid" db:"uid"`
+	Name      *string   `json:"name" db:"user_name"`
+	Email     *string   `json:"email" db:"email"`
+	IsHost    bool      `json:"isHost" db:"is_host"`
+	ExpiresAt time.Time `json:"expiresAt" db:"expires_at"`
+	Online    *bool     `json:"online"`
+}
+
+// ChannelSummary describes a channel in the list of channels of the user who created it
+type ChannelSummary struct {
+	Title              string     `json:"title" db:"title"`
+	Channel            string     `json:"channel" db:"channel_name"`
+	HostPassphrase     string     `json:"hostPassphrase" db:"host_passphrase"`
+	ViewerPassphrase   string     `json:"viewerPassphrase" db:"viewer_passphrase"`
+	CreatedAt          time.Time  `json:"createdAt" db:"created_at"`
+	ScheduledStart     *time.Time `json:"scheduledStart" db:"scheduled_start"`
+	ScheduledEnd       *time.Time `json:"scheduledEnd" db:"scheduled_end"`
+	ClosedAt           *time.Time `json:"closedAt" db:"closed_at"`
+	Recording          bool       `json:"recording" db:"recording"`
+	RecordingStartedAt *time.Time `json:"recordingStartedAt" db:"recording_started_at"`
+}
+
+// ChannelPage is a page of the channels of a user along with the number of channels across every page
+type ChannelPage struct {
+	Channels []*ChannelSummary `json:"channels"`
+	Total    int               `json:"total"`
+}
+
+// RecordingFile is a file uploaded to the recording storage by a cloud recording of a channel
+type RecordingFile struct {
+	ID        int64     `db:"id"`
+	CreatedAt time.Time `db:"created_at"`
+	ChannelID int64     `db:"channel_id"`
+	SID       string    `db:"sid"`
+	FileName  string    `db:"file_name"`
+}
+
+// RecordingDownload is a signed URL to download a recording file, which stops working at ExpiresAt
+type RecordingDownload struct {
+	FileName   string    `json:"fileName"`
+	URL        string    `json:"url"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	RecordedAt time.Time `json:"recordedAt"`
 }
@@ -0,0 +1,390 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+// Package dbtest provides a scripted database/sql driver for tests. Each test lists the statements it expects the code
+// to run, in order, along with what the database answers, so that code paths touching the database can be tested
+// without a Postgres server.
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/samyak-jain/agora_backend/pkg/models"
+)
+
+const (
+	queryKind    = "query"
+	execKind     = "exec"
+	beginKind    = "begin"
+	commitKind   = "commit"
+	rollbackKind = "rollback"
+)
+
+// Any matches every argument value
+var Any = anyArg{}
+
+type anyArg struct{}
+
+// Mock holds the statements a test expects, in the order they have to run
+type Mock struct {
+	t        testing.TB
+	mutex    sync.Mutex
+	expected []*Expectation
+	next     int
+}
+
+// Expectation is a statement the code is expected to run and the answer of the database to it
+type Expectation struct {
+	kind         string
+	pattern      *regexp.Regexp
+	args         []interface{}
+	columns      []string
+	rows         [][]interface{}
+	rowsAffected int64
+	err          error
+}
+
+// New returns a database answering from the returned mock. The test fails if expected statements did not run.
+func New(t testing.TB) (*models.Database, *Mock) {
+	mock := &Mock{t: t}
+	db := sqlx.NewDb(sql.OpenDB(connector{mock}), "postgres")
+	t.Cleanup(func() {
+		db.Close()
+		mock.mutex.Lock()
+		defer mock.mutex.Unlock()
+		for _, expectation := range mock.expected[mock.next:] {
+			t.Errorf("expected %s was not run", expectation)
+		}
+	})
+
+	return &models.Database{DB: db}, mock
+}
+
+func (m *Mock) expect(kind string, pattern string) *Expectation {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	expectation := &Expectation{kind: kind}
+	if pattern != "" {
+		expectation.pattern = regexp.MustCompile(pattern)
+	}
+
+	m.expected = append(m.expected, expectation)
+	return expectation
+}
+
+// ExpectQuery expects a query matching the regular expression, answered with no rows unless WillReturnRows is used
+func (m *Mock) ExpectQuery(pattern string) *Expectation {
+	return m.expect(queryKind, pattern)
+}
+
+// ExpectExec expects a statement matching the regular expression, which affects one row unless WillReturnResult is used
+func (m *Mock) ExpectExec(pattern string) *Expectation {
+	expectation := m.expect(execKind, pattern)
+	expectation.rowsAffected = 1
+	return expectation
+}
+
+// ExpectBegin expects a transaction to begin
+func (m *Mock) ExpectBegin() *Expectation {
+	return m.expect(beginKind, "")
+}
+
+// ExpectCommit expects the transaction to be committed
+func (m *Mock) ExpectCommit() *Expectation {
+	return m.expect(commitKind, "")
+}
+
+// ExpectRollback expects the transaction to be rolled back
+func (m *Mock) ExpectRollback() *Expectation {
+	return m.expect(rollbackKind, "")
+}
+
+// WithArgs expects the statement to be run with these arguments, Any matches every value
+func (e *Expectation) WithArgs(args ...interface{}) *Expectation {
+	e.args = args
+	return e
+}
+
+// WillReturnRows answers the query with rows of the columns
+func (e *Expectation) WillReturnRows(columns []string, rows ...[]interface{}) *Expectation {
+	e.columns = columns
+	e.rows = rows
+	return e
+}
+
+// WillReturnResult answers the statement with the number of affected rows
+func (e *Expectation) WillReturnResult(rowsAffected int64) *Expectation {
+	e.rowsAffected = rowsAffected
+	return e
+}
+
+// WillReturnError fails the statement with the error
+func (e *Expectation) WillReturnError(err error) *Expectation {
+	e.err = err
+	return e
+}
+
+func (e *Expectation) String() string {
+	if e.pattern == nil {
+		return e.kind
+	}
+
+	return fmt.Sprintf("%s matching %q", e.kind, e.pattern)
+}
+
+// match takes the next expectation, which has to be of the kind and match the query and arguments
+func (m *Mock) match(kind string, query string, args []driver.NamedValue) (*Expectation, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.next >= len(m.expected) {
+		m.t.Errorf("unexpected %s %q with %v", kind, query, namedValues(args))
+		return nil, fmt.Errorf("dbtest: unexpected %s", kind)
+	}
+
+	expectation := m.expected[m.next]
+	if expectation.kind != kind || (expectation.pattern != nil && !expectation.pattern.MatchString(query)) {
+		m.t.Errorf("got %s %q, want %s", kind, query, expectation)
+		return nil, fmt.Errorf("dbtest: unexpected %s", kind)
+	}
+
+	if expectation.args != nil {
+		if err := matchArgs(expectation.args, args); err != nil {
+			m.t.Errorf("%s %q: %v", kind, query, err)
+			return nil, err
+		}
+	}
+
+	m.next++
+	return expectation, expectation.err
+}
+
+func matchArgs(expected []interface{}, args []driver.NamedValue) error {
+	if len(expected) != len(args) {
+		return fmt.Errorf("dbtest: got arguments %v, want %v", namedValues(args), expected)
+	}
+
+	for i, want := range expected {
+		if _, ok := want.(anyArg); ok {
+			continue
+		}
+
+		wantValue, err := driver.DefaultParameterConverter.ConvertValue(want)
+		if valuer, ok := want.(driver.Valuer); ok {
+			wantValue, err = valuer.Value()
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if !reflect.DeepEqual(wantValue, args[i].Value) {
+			return fmt.Errorf("dbtest: got argument %d %#v, want %#v", i+1, args[i].Value, wantValue)
+		}
+	}
+
+	return nil
+}
+
+func namedValues(args []driver.NamedValue) []driver.Value {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+
+	return values
+}
+
+// sqlStateError is a driver error carrying a SQLSTATE, like the errors of lib/pq and pgx
+type sqlStateError struct {
+	code    string
+	message string
+}
+
+func (e *sqlStateError) Error() string    { return e.message }
+func (e *sqlStateError) SQLState() string { return e.code }
+
+// UniqueViolation returns the error Postgres reports for a unique constraint violation
+func UniqueViolation(constraint string) error {
+	return &sqlStateError{code: "23505", message: "duplicate key value violates unique constraint \"" + constraint + "\""}
+}
+
+type connector struct {
+	mock *Mock
+}
+
+func (c connector) Connect(context.Context) (driver.Conn, error) {
+	return &conn{mock: c.mock}, nil
+}
+
+func (c connector) Driver() driver.Driver {
+	return scriptedDriver{}
+}
+
+type scriptedDriver struct{}
+
+func (scriptedDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("dbtest: use New")
+}
+
+type conn struct {
+	mock *Mock
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return &stmt{conn: c, query: query}, nil
+}
+
+func (c *conn) Close() error {
+	return nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if _, err := c.mock.match(beginKind, "", nil); err != nil {
+		return nil, err
+	}
+
+	return &tx{conn: c}, nil
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	expectation, err := c.mock.match(queryKind, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rows{columns: expectation.columns, values: expectation.rows}, nil
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	expectation, err := c.mock.match(execKind, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return driver.RowsAffected(expectation.rowsAffected), nil
+}
+
+// CheckNamedValue accepts every argument as is, other than driver.Valuers which are resolved like by database/sql
+func (c *conn) CheckNamedValue(value *driver.NamedValue) error {
+	if valuer, ok := value.Value.(driver.Valuer); ok {
+		resolved, err := valuer.Value()
+		value.Value = resolved
+		return err
+	}
+
+	converted, err := driver.DefaultParameterConverter.ConvertValue(value.Value)
+	value.Value = converted
+	return err
+}
+
+type stmt struct {
+	conn  *conn
+	query string
+}
+
+func (s *stmt) Close() error {
+	return nil
+}
+
+func (s *stmt) NumInput() int {
+	return -1
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("dbtest: use ExecContext")
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, errors.New("dbtest: use QueryContext")
+}
+
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.conn.ExecContext(ctx, s.query, args)
+}
+
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.conn.QueryContext(ctx, s.query, args)
+}
+
+type tx struct {
+	conn *conn
+}
+
+func (t *tx) Commit() error {
+	_, err := t.conn.mock.match(commitKind, "", nil)
+	return err
+}
+
+func (t *tx) Rollback() error {
+	_, err := t.conn.mock.match(rollbackKind, "", nil)
+	return err
+}
+
+type rows struct {
+	columns []string
+	values  [][]interface{}
+	next    int
+}
+
+func (r *rows) Columns() []string {
+	return r.columns
+}
+
+func (r *rows) Close() error {
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.next >= len(r.values) {
+		return io.EOF
+	}
+
+	row := r.values[r.next]
+	r.next++
+	if len(row) != len(dest) {
+		return fmt.Errorf("dbtest: row has %d values for %d columns %s", len(row), len(dest), strings.Join(r.columns, ", "))
+	}
+
+	for i, value := range row {
+		converted, err := driver.DefaultParameterConverter.ConvertValue(value)
+		if err != nil {
+			return err
+		}
+
+		dest[i] = converted
+	}
+
+	return nil
+}
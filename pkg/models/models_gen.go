@@ -2,6 +2,44 @@
 
 package models
 
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+type AllowListIssue struct {
+	Line     int    `json:"line"`
+	Entry    string `json:"entry"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+type AllowListReport struct {
+	Valid  bool              `json:"valid"`
+	Issues []*AllowListIssue `json:"issues"`
+}
+
+type BatchUserResult struct {
+	Email   string  `json:"email"`
+	Created bool    `json:"created"`
+	Error   *string `json:"error"`
+}
+
+type EmailValidationResult struct {
+	Email         string  `json:"email"`
+	Allowed       bool    `json:"allowed"`
+	Denied        bool    `json:"denied"`
+	MatchedRule   *string `json:"matchedRule"`
+	BreakGlass    bool    `json:"breakGlass"`
+	Grandfathered bool    `json:"grandfathered"`
+}
+
+type NewUser struct {
+	Email string  `json:"email"`
+	Name  *string `json:"name"`
+}
+
 type Pstn struct {
 	Number string `json:"number"`
 	Dtmf   string `json:"dtmf"`
@@ -12,6 +50,12 @@ type Passphrase struct {
 	View string  `json:"view"`
 }
 
+type ProviderInfo struct {
+	Site   string   `json:"site"`
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
 type Session struct {
 	Channel     string           `json:"channel"`
 	Title       string           `json:"title"`
@@ -28,6 +72,23 @@ type ShareResponse struct {
 	Pstn       *Pstn       `json:"pstn"`
 }
 
+type TokenBundle struct {
+	AppID   string  `json:"appID"`
+	Channel string  `json:"channel"`
+	UID     int     `json:"uid"`
+	Role    string  `json:"role"`
+	Rtc     string  `json:"rtc"`
+	Rtm     string  `json:"rtm"`
+	Expiry  int     `json:"expiry"`
+	Preset  *string `json:"preset"`
+}
+
+type TokenBundleResult struct {
+	Passphrase string       `json:"passphrase"`
+	Bundle     *TokenBundle `json:"bundle"`
+	Error      *string      `json:"error"`
+}
+
 type UIDMuteState struct {
 	UID  int  `json:"uid"`
 	Mute bool `json:"mute"`
@@ -43,3 +104,51 @@ type UserCredentials struct {
 	Rtm *string `json:"rtm"`
 	UID int     `json:"uid"`
 }
+
+type UserProfile struct {
+	Email         string  `json:"email"`
+	Name          *string `json:"name"`
+	Provider      *string `json:"provider"`
+	EmailVerified bool    `json:"emailVerified"`
+}
+
+type ChannelSort string
+
+const (
+	ChannelSortCreatedAt      ChannelSort = "CREATED_AT"
+	ChannelSortScheduledStart ChannelSort = "SCHEDULED_START"
+)
+
+var AllChannelSort = []ChannelSort{
+	ChannelSortCreatedAt,
+	ChannelSortScheduledStart,
+}
+
+func (e ChannelSort) IsValid() bool {
+	switch e {
+	case ChannelSortCreatedAt, ChannelSortScheduledStart:
+		return true
+	}
+	return false
+}
+
+func (e ChannelSort) String() string {
+	return string(e)
+}
+
+func (e *ChannelSort) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ChannelSort(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ChannelSort", str)
+	}
+	return nil
+}
+
+func (e ChannelSort) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
@@ -0,0 +1,59 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Scopes a service client can be granted
+const (
+	UsageReadScope  = "usage:read"
+	UsersWriteScope = "users:write"
+)
+
+// ServiceScopes lists every scope a service client can be granted
+var ServiceScopes = []string{UsageReadScope, UsersWriteScope}
+
+// ServiceClient is a backend which calls the API without a user through the client credentials grant.
+// Only a hash of its secret is stored, and Scopes is a space separated list of the scopes it may request.
+type ServiceClient struct {
+	ID         int64  `db:"id"`
+	ClientID   string `db:"client_id"`
+	SecretHash string `db:"secret_hash"`
+	Scopes     string `db:"scopes"`
+}
+
+// ServiceToken is a bearer token issued to a service client for the scopes it was granted
+type ServiceToken struct {
+	TokenID   string    `db:"token_id"`
+	ClientID  int64     `db:"client_id"`
+	Scopes    string    `db:"scopes"`
+	ExpiresAt time.Time `db:"expires_at"`
+}
+
+// HasScope reports whether the token was granted the scope
+func (t *ServiceToken) HasScope(scope string) bool {
+	for _, granted := range strings.Fields(t.Scopes) {
+		if granted == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ServiceClientCredentials are returned once when a service client is registered
+type ServiceClientCredentials struct {
+	ClientID     string `json:"clientId"`
+	ClientSecret string `json:"clientSecret"`
+}
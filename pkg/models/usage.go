@@ -0,0 +1,43 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Kinds of usage events
+const (
+	TokenUsageEvent     = "token"
+	RecordingUsageEvent = "recording"
+	LoginUsageEvent     = "login"
+)
+
+// UsageEvent records an action which is counted in the usage stats but leaves no other trace in the database
+type UsageEvent struct {
+	ID        int64         `db:"id"`
+	Kind      string        `db:"kind"`
+	ChannelID sql.NullInt64 `db:"channel_id"`
+	UserID    sql.NullInt64 `db:"user_id"`
+}
+
+// UsageStats contains the aggregate usage between From and To
+type UsageStats struct {
+	From              time.Time `json:"from"`
+	To                time.Time `json:"to"`
+	Logins            int       `json:"logins" db:"logins"`
+	ActiveUsers       int       `json:"activeUsers" db:"active_users"`
+	NewUsers          int       `json:"newUsers" db:"new_users"`
+	ChannelsCreated   int       `json:"channelsCreated" db:"channels_created"`
+	TokensIssued      int       `json:"tokensIssued" db:"tokens_issued"`
+	RecordingsStarted int       `json:"recordingsStarted" db:"recordings_started"`
+}
@@ -17,10 +17,14 @@ import (
 
 // UserAccount model contains all relevant details of a particular user
 type UserAccount struct {
-	ID         int64          `db:"id"`
-	UserName   sql.NullString `db:"user_name"`
-	Email      string         `db:"email"`
-	Identifier string         `db:"identifier"`
+	ID            int64          `db:"id"`
+	UserName      sql.NullString `db:"user_name"`
+	Email         string         `db:"email"`
+	Identifier    string         `db:"identifier"`
+	Provider      sql.NullString `db:"provider"`
+	EmailVerified bool           `db:"email_verified"`
+	UID           sql.NullInt64  `db:"uid"`
+	Tenant        sql.NullString `db:"tenant"`
 }
 
 type Auth struct {
@@ -34,9 +38,13 @@ type Auth struct {
 
 // Token stores the token of a user
 type Token struct {
-	ID      int64  `db:"id"`
-	TokenID string `db:"token_id"`
-	UserID  int64  `db:"user_id"`
+	ID         int64          `db:"id"`
+	CreatedAt  sql.NullTime   `db:"created_at"`
+	TokenID    string         `db:"token_id"`
+	UserID     int64          `db:"user_id"`
+	ExpiresAt  sql.NullTime   `db:"expires_at"`
+	Role       string         `db:"role"`
+	DeviceName sql.NullString `db:"device_name"`
 }
 
 // GetAllTokens fetches the token id of all the tokens of that user
@@ -0,0 +1,58 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Types of the events delivered to webhook subscriptions
+const (
+	ChannelCreatedEvent   = "channel.created"
+	RecordingStartedEvent = "recording.started"
+	RecordingStoppedEvent = "recording.stopped"
+)
+
+// WebhookEventTypes lists every event type a subscription can filter on
+var WebhookEventTypes = []string{ChannelCreatedEvent, RecordingStartedEvent, RecordingStoppedEvent}
+
+// WebhookSubscription is an endpoint which receives the events it subscribed to, signed with its own secret.
+// EventTypes is a comma separated list of event types, empty to receive every event.
+type WebhookSubscription struct {
+	ID         int64  `db:"id"`
+	URL        string `db:"url"`
+	EventTypes string `db:"event_types"`
+	Secret     string `db:"secret"`
+	Active     bool   `db:"active"`
+}
+
+// Matches reports whether the subscription receives events of the type
+func (s *WebhookSubscription) Matches(eventType string) bool {
+	if s.EventTypes == "" {
+		return true
+	}
+
+	for _, subscribed := range strings.Split(s.EventTypes, ",") {
+		if subscribed == eventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WebhookEvent is the body posted to webhook subscriptions
+type WebhookEvent struct {
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"createdAt"`
+	Data      interface{} `json:"data"`
+}
@@ -0,0 +1,233 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/samyak-jain/agora_backend/utils"
+	"github.com/spf13/viper"
+)
+
+// Severities of the issues found in an allow list
+const (
+	AllowListError   = "error"
+	AllowListWarning = "warning"
+)
+
+var domainPattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]*[a-z0-9])?\.)+[a-z]{2,}$`)
+var wildcardDomainPattern = regexp.MustCompile(`^[a-z0-9.*-]+$`)
+
+// ValidateAllowListConfig lints allow list entries and reports errors and warnings per line.
+// Lines are numbered from 1 in the order of the entries.
+func ValidateAllowListConfig(entries []string) *models.AllowListReport {
+	report := &models.AllowListReport{
+		Valid:  true,
+		Issues: []*models.AllowListIssue{},
+	}
+
+	addIssue := func(line int, entry string, severity string, message string) {
+		if severity == AllowListError {
+			report.Valid = false
+		}
+
+		report.Issues = append(report.Issues, &models.AllowListIssue{
+			Line:     line,
+			Entry:    entry,
+			Severity: severity,
+			Message:  message,
+		})
+	}
+
+	seen := map[string]int{}
+	for index, entry := range entries {
+		line := index + 1
+		value := strings.ToLower(strings.TrimSpace(entry))
+
+		if value == "" {
+			addIssue(line, entry, AllowListError, "Entry is empty")
+			continue
+		}
+
+		if strings.ContainsAny(value, " \t") {
+			addIssue(line, entry, AllowListError, "Entry contains whitespace")
+			continue
+		}
+
+		if previous, ok := seen[value]; ok {
+			addIssue(line, entry, AllowListWarning, fmt.Sprintf("Duplicate of line %d", previous))
+		} else {
+			seen[value] = line
+		}
+
+		if strings.Trim(value, "*@") == "" {
+			addIssue(line, entry, AllowListWarning, "Entry matches every email")
+			continue
+		}
+
+		parts := strings.Split(value, "@")
+		if len(parts) > 2 {
+			addIssue(line, entry, AllowListError, "Entry contains more than one @")
+			continue
+		}
+
+		if len(parts) == 1 {
+			if !strings.Contains(value, "*") {
+				addIssue(line, entry, AllowListError, "Entry must be an email or a wildcard such as *@example.com")
+			}
+			continue
+		}
+
+		domain := parts[1]
+		if strings.Contains(domain, "*") {
+			if !wildcardDomainPattern.MatchString(domain) {
+				addIssue(line, entry, AllowListError, "Domain contains invalid characters")
+			} else if strings.Trim(domain, "*.") == "" || !strings.Contains(strings.Trim(domain, "*"), ".") {
+				addIssue(line, entry, AllowListWarning, "Domain wildcard is overly broad")
+			}
+			continue
+		}
+
+		if !domainPattern.MatchString(domain) {
+			addIssue(line, entry, AllowListError, "Domain is malformed")
+		}
+	}
+
+	return report
+}
+
+// Ways of treating existing users whose email no longer matches the allow list, set in ALLOW_LIST_EXISTING_USERS
+const (
+	StrictAllowListPolicy  = "strict"
+	LenientAllowListPolicy = "lenient"
+)
+
+// Roles a session token is issued for
+const (
+	UserRole  = "user"
+	AdminRole = "admin"
+)
+
+// RoleOf returns the role currently granted to the user
+func RoleOf(user *models.UserAccount) string {
+	if IsAdmin(user) {
+		return AdminRole
+	}
+
+	return UserRole
+}
+
+// IsAdmin checks whether the email of the user matches any of the patterns in ADMIN_LIST, or the user is the
+// break-glass account. Anybody can claim an unverified email, so it is never an admin, even when ALLOW_UNVERIFIED_EMAIL
+// lets it log in.
+func IsAdmin(user *models.UserAccount) bool {
+	if !user.EmailVerified {
+		return false
+	}
+
+	return MatchesAllowList(viper.GetStringSlice("ADMIN_LIST"), user.Email) || IsBreakGlass(user.Provider.String, user.Identifier, user.Email, user.EmailVerified)
+}
+
+// breakGlassProviders are the providers which only report an email as verified after checking it, so that it can be
+// trusted for the break-glass account
+var breakGlassProviders = []string{"google", "apple"}
+
+// CheckBreakGlass makes sure the break-glass account is either not configured at all, or bound to a provider identity
+// through BREAK_GLASS_PROVIDER and BREAK_GLASS_SUBJECT along with BREAK_GLASS_EMAIL
+func CheckBreakGlass() error {
+	email, provider, subject := viper.GetString("BREAK_GLASS_EMAIL"), viper.GetString("BREAK_GLASS_PROVIDER"), viper.GetString("BREAK_GLASS_SUBJECT")
+	if email == "" && provider == "" && subject == "" {
+		return nil
+	}
+
+	if email == "" || provider == "" || subject == "" {
+		return errors.New("BREAK_GLASS_EMAIL, BREAK_GLASS_PROVIDER and BREAK_GLASS_SUBJECT must be set together")
+	}
+
+	if !isBreakGlassProvider(provider) {
+		return fmt.Errorf("BREAK_GLASS_PROVIDER must be one of %s, which verify emails", strings.Join(breakGlassProviders, ", "))
+	}
+
+	return nil
+}
+
+func isBreakGlassProvider(provider string) bool {
+	for _, trusted := range breakGlassProviders {
+		if provider == trusted {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsBreakGlass checks whether the user signed in as the break-glass account, the emergency admin which bypasses the
+// allow list and the deny list so that a misconfigured allow list cannot lock everybody out. The provider and subject
+// must be BREAK_GLASS_PROVIDER and BREAK_GLASS_SUBJECT, which has to be a provider verifying emails, and the email must
+// be the verified BREAK_GLASS_EMAIL. Every comparison is an exact match.
+func IsBreakGlass(provider string, subject string, email string, verified bool) bool {
+	breakGlassEmail := viper.GetString("BREAK_GLASS_EMAIL")
+	breakGlassProvider := viper.GetString("BREAK_GLASS_PROVIDER")
+	breakGlassSubject := viper.GetString("BREAK_GLASS_SUBJECT")
+	if breakGlassEmail == "" || breakGlassProvider == "" || breakGlassSubject == "" || !verified {
+		return false
+	}
+
+	return isBreakGlassProvider(provider) && provider == breakGlassProvider && subject == breakGlassSubject && utils.NormalizeEmail(email) == utils.NormalizeEmail(breakGlassEmail)
+}
+
+// GetChannelAllowList returns the emails and wildcards a channel restricts joins to.
+// An empty list means the channel is not restricted beyond the global allow list.
+func GetChannelAllowList(db *models.Database, channelID int64) ([]string, error) {
+	entries := []string{}
+	err := db.Select(&entries, "SELECT entry FROM channel_allow_list WHERE channel_id = $1 ORDER BY entry", channelID)
+	return entries, err
+}
+
+// SetChannelAllowList replaces the allow list of a channel, clearing it when entries is empty
+func SetChannelAllowList(db *models.Database, channelID int64, entries []string) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM channel_allow_list WHERE channel_id = $1", channelID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, entry := range entries {
+		_, err = tx.Exec("INSERT INTO channel_allow_list (channel_id, entry) VALUES ($1, $2) ON CONFLICT DO NOTHING", channelID, strings.TrimSpace(entry))
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// MatchesAllowList checks whether the email matches any of the allow list entries
+func MatchesAllowList(entries []string, email string) bool {
+	for _, value := range entries {
+		match, err := regexp.MatchString(emailPattern(value), email)
+		if err == nil && match {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,248 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/samyak-jain/agora_backend/utils"
+	"github.com/spf13/viper"
+)
+
+func TestValidateAllowListConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		entry      string
+		wantValid  bool
+		wantIssues int
+	}{
+		{name: "email", entry: "user@example.com", wantValid: true, wantIssues: 0},
+		{name: "domain wildcard", entry: "*@example.com", wantValid: true, wantIssues: 0},
+		{name: "regexp characters are literal", entry: "user+(test)@example.com", wantValid: true, wantIssues: 0},
+		{name: "empty", entry: "  ", wantValid: false, wantIssues: 1},
+		{name: "whitespace", entry: "user @example.com", wantValid: false, wantIssues: 1},
+		{name: "matches everything", entry: "*@*", wantValid: true, wantIssues: 1},
+		{name: "two at signs", entry: "a@b@example.com", wantValid: false, wantIssues: 1},
+		{name: "no at sign", entry: "example.com", wantValid: false, wantIssues: 1},
+		{name: "broad domain wildcard", entry: "*@*.com", wantValid: true, wantIssues: 0},
+		{name: "wildcard only domain", entry: "*@*.*", wantValid: true, wantIssues: 1},
+		{name: "invalid wildcard domain", entry: "*@exa_mple.*", wantValid: false, wantIssues: 1},
+		{name: "malformed domain", entry: "user@example", wantValid: false, wantIssues: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := ValidateAllowListConfig([]string{tt.entry})
+			if report.Valid != tt.wantValid {
+				t.Errorf("Valid = %v, want %v", report.Valid, tt.wantValid)
+			}
+
+			if len(report.Issues) != tt.wantIssues {
+				t.Errorf("got %d issues, want %d: %+v", len(report.Issues), tt.wantIssues, report.Issues)
+			}
+		})
+	}
+}
+
+func TestValidateAllowListConfigDuplicates(t *testing.T) {
+	report := ValidateAllowListConfig([]string{"user@example.com", "USER@example.com"})
+	if !report.Valid || len(report.Issues) != 1 || report.Issues[0].Line != 2 || report.Issues[0].Severity != AllowListWarning {
+		t.Errorf("got %+v, want a single duplicate warning on line 2", report.Issues)
+	}
+}
+
+func TestRoleOf(t *testing.T) {
+	viper.Set("ADMIN_LIST", []string{"*@admins.example.com"})
+	viper.Set("BREAK_GLASS_EMAIL", "")
+	defer viper.Set("ADMIN_LIST", []string{})
+
+	tests := []struct {
+		name     string
+		email    string
+		verified bool
+		want     string
+	}{
+		{name: "verified admin", email: "root@admins.example.com", verified: true, want: AdminRole},
+		{name: "unverified admin email", email: "root@admins.example.com", verified: false, want: UserRole},
+		{name: "verified user", email: "user@example.com", verified: true, want: UserRole},
+		{name: "unverified user", email: "user@example.com", verified: false, want: UserRole},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RoleOf(&models.UserAccount{Email: tt.email, EmailVerified: tt.verified}); got != tt.want {
+				t.Errorf("RoleOf() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsBreakGlass(t *testing.T) {
+	viper.Set("BREAK_GLASS_EMAIL", "root@example.com")
+	viper.Set("BREAK_GLASS_PROVIDER", "google")
+	viper.Set("BREAK_GLASS_SUBJECT", "1234")
+	defer func() {
+		viper.Set("BREAK_GLASS_EMAIL", "")
+		viper.Set("BREAK_GLASS_PROVIDER", "")
+		viper.Set("BREAK_GLASS_SUBJECT", "")
+	}()
+
+	tests := []struct {
+		name     string
+		provider string
+		subject  string
+		email    string
+		verified bool
+		want     bool
+	}{
+		{name: "configured identity", provider: "google", subject: "1234", email: "root@example.com", verified: true, want: true},
+		{name: "unverified email", provider: "google", subject: "1234", email: "root@example.com", verified: false, want: false},
+		{name: "other subject with the email", provider: "google", subject: "5678", email: "root@example.com", verified: true, want: false},
+		{name: "other provider with the email", provider: "microsoft", subject: "1234", email: "root@example.com", verified: true, want: false},
+		{name: "other email", provider: "google", subject: "1234", email: "user@example.com", verified: true, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsBreakGlass(tt.provider, tt.subject, tt.email, tt.verified); got != tt.want {
+				t.Errorf("IsBreakGlass() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckBreakGlass(t *testing.T) {
+	defer func() {
+		viper.Set("BREAK_GLASS_EMAIL", "")
+		viper.Set("BREAK_GLASS_PROVIDER", "")
+		viper.Set("BREAK_GLASS_SUBJECT", "")
+	}()
+
+	tests := []struct {
+		name     string
+		email    string
+		provider string
+		subject  string
+		wantErr  bool
+	}{
+		{name: "not configured", wantErr: false},
+		{name: "bound to an identity", email: "root@example.com", provider: "apple", subject: "1234", wantErr: false},
+		{name: "email only", email: "root@example.com", wantErr: true},
+		{name: "missing subject", email: "root@example.com", provider: "google", wantErr: true},
+		{name: "provider without verified emails", email: "root@example.com", provider: "slack", subject: "1234", wantErr: true},
+		{name: "microsoft", email: "root@example.com", provider: "microsoft", subject: "1234", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("BREAK_GLASS_EMAIL", tt.email)
+			viper.Set("BREAK_GLASS_PROVIDER", tt.provider)
+			viper.Set("BREAK_GLASS_SUBJECT", tt.subject)
+			if err := CheckBreakGlass(); (err != nil) != tt.wantErr {
+				t.Errorf("CheckBreakGlass() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDecideAllowList(t *testing.T) {
+	logger := zerolog.Nop()
+	entries := []string{"*@example.com", "admin@partner.org"}
+
+	tests := []struct {
+		name        string
+		email       string
+		deny        []string
+		wantAllowed bool
+		wantDenied  bool
+	}{
+		{name: "domain wildcard", email: "user@example.com", wantAllowed: true},
+		{name: "exact email", email: "admin@partner.org", wantAllowed: true},
+		{name: "case insensitive", email: "Admin@Partner.org", wantAllowed: true},
+		{name: "suffix of the domain", email: "user@example.com.evil.org", wantAllowed: false},
+		{name: "prefix of the email", email: "eviladmin@partner.org", wantAllowed: false},
+		{name: "suffix of the email", email: "admin@partner.org.evil.org", wantAllowed: false},
+		{name: "denied", email: "user@example.com", deny: []string{"user@example.com"}, wantDenied: true},
+		{name: "deny is anchored", email: "user@example.com", deny: []string{"ser@example.com"}, wantAllowed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("CASE_INSENSITIVE_EMAIL", true)
+			viper.Set("DENY_LIST", tt.deny)
+			defer viper.Set("DENY_LIST", []string{})
+
+			decision, err := decideAllowList(&utils.Logger{Logger: &logger}, entries, tt.email)
+			if err != nil {
+				t.Fatalf("decideAllowList() error = %v", err)
+			}
+
+			if decision.Allowed != tt.wantAllowed || decision.Denied != tt.wantDenied {
+				t.Errorf("decideAllowList(%q) = allowed %v, denied %v, want %v, %v", tt.email, decision.Allowed, decision.Denied, tt.wantAllowed, tt.wantDenied)
+			}
+		})
+	}
+}
+
+func TestDecideLogin(t *testing.T) {
+	logger := zerolog.Nop()
+	errDatabase := errors.New("database is down")
+	entries := func() ([]string, error) { return []string{"*@example.com"}, nil }
+	unavailable := func() ([]string, error) { return nil, errDatabase }
+	existing := func(exists bool) func() (bool, error) {
+		return func() (bool, error) { return exists, nil }
+	}
+
+	tests := []struct {
+		name              string
+		email             string
+		breakGlass        bool
+		loadEntries       func() ([]string, error)
+		grandfathered     func() (bool, error)
+		deny              []string
+		wantAllowed       bool
+		wantBreakGlass    bool
+		wantGrandfathered bool
+		wantErr           error
+	}{
+		{name: "allowed", email: "user@example.com", loadEntries: entries, grandfathered: existing(false), wantAllowed: true},
+		{name: "not allowed", email: "user@other.org", loadEntries: entries, grandfathered: existing(false), wantAllowed: false},
+		{name: "anchored", email: "user@example.com.evil.org", loadEntries: entries, grandfathered: existing(false), wantAllowed: false},
+		{name: "grandfathered", email: "user@other.org", loadEntries: entries, grandfathered: existing(true), wantAllowed: true, wantGrandfathered: true},
+		{name: "denied is not grandfathered", email: "user@example.com", deny: []string{"user@example.com"}, loadEntries: entries, grandfathered: existing(true), wantAllowed: false},
+		{name: "break-glass", email: "root@other.org", breakGlass: true, loadEntries: entries, grandfathered: existing(false), wantAllowed: true, wantBreakGlass: true},
+		{name: "break-glass without allow list", email: "root@other.org", breakGlass: true, loadEntries: unavailable, grandfathered: existing(false), wantAllowed: true, wantBreakGlass: true},
+		{name: "allow list unavailable", email: "user@example.com", loadEntries: unavailable, grandfathered: existing(false), wantErr: errDatabase},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("DENY_LIST", tt.deny)
+			defer viper.Set("DENY_LIST", []string{})
+
+			decision, err := decideLogin(&utils.Logger{Logger: &logger}, tt.loadEntries, tt.email, tt.breakGlass, tt.grandfathered)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("decideLogin() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if decision.Allowed != tt.wantAllowed || decision.BreakGlass != tt.wantBreakGlass || decision.Grandfathered != tt.wantGrandfathered {
+				t.Errorf("decideLogin(%q) = %+v, want allowed %v, break-glass %v, grandfathered %v", tt.email, decision, tt.wantAllowed, tt.wantBreakGlass, tt.wantGrandfathered)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/spf13/viper"
+)
+
+// AllowListSource provides allow list entries, which are merged with the entries of every other configured source
+type AllowListSource interface {
+	AllowListEntries() ([]string, error)
+}
+
+// ConfigAllowListSource reads ALLOW_LIST from the environment or the config.json
+type ConfigAllowListSource struct{}
+
+// AllowListEntries returns the entries of ALLOW_LIST
+func (ConfigAllowListSource) AllowListEntries() ([]string, error) {
+	return viper.GetStringSlice("ALLOW_LIST"), nil
+}
+
+// FileAllowListSource reads one entry per line from a file, skipping blank lines and lines starting with #
+type FileAllowListSource struct {
+	Path string
+}
+
+// AllowListEntries returns the entries of the file
+func (s FileAllowListSource) AllowListEntries() ([]string, error) {
+	file, err := os.Open(s.Path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not open allow list file: %w", err)
+	}
+
+	defer file.Close()
+
+	entries := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		entries = append(entries, line)
+	}
+
+	return entries, scanner.Err()
+}
+
+// DatabaseAllowListSource reads the entries added to the allow_list_entries table
+type DatabaseAllowListSource struct {
+	DB *models.Database
+}
+
+// AllowListEntries returns the entries of the table
+func (s DatabaseAllowListSource) AllowListEntries() ([]string, error) {
+	entries := []string{}
+	err := s.DB.Select(&entries, "SELECT entry FROM allow_list_entries")
+	return entries, err
+}
+
+var (
+	allowListSourcesMutex sync.RWMutex
+	allowListSources      = map[string]AllowListSource{}
+)
+
+// RegisterAllowListSource makes an external allow list source, like a directory service, selectable in ALLOW_LIST_SOURCES
+func RegisterAllowListSource(name string, source AllowListSource) {
+	allowListSourcesMutex.Lock()
+	defer allowListSourcesMutex.Unlock()
+
+	allowListSources[name] = source
+}
+
+// getAllowListSource returns the allow list source with the name used in ALLOW_LIST_SOURCES
+func getAllowListSource(db *models.Database, name string) (AllowListSource, error) {
+	switch name {
+	case "config":
+		return ConfigAllowListSource{}, nil
+	case "file":
+		return FileAllowListSource{Path: viper.GetString("ALLOW_LIST_FILE")}, nil
+	case "database":
+		return DatabaseAllowListSource{DB: db}, nil
+	}
+
+	allowListSourcesMutex.RLock()
+	defer allowListSourcesMutex.RUnlock()
+
+	source, ok := allowListSources[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown allow list source %s", name)
+	}
+
+	return source, nil
+}
+
+// MergedAllowList returns the union of the entries of every source in ALLOW_LIST_SOURCES.
+// A source which fails fails the whole list, so that an outage never silently narrows or widens it.
+func MergedAllowList(db *models.Database) ([]string, error) {
+	entries := []string{}
+	for _, name := range viper.GetStringSlice("ALLOW_LIST_SOURCES") {
+		source, err := getAllowListSource(db, name)
+		if err != nil {
+			return nil, err
+		}
+
+		sourceEntries, err := source.AllowListEntries()
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, sourceEntries...)
+	}
+
+	return entries, nil
+}
+
+// IsDenied checks whether the email matches DENY_LIST, which takes precedence over every allow list source
+func IsDenied(email string) bool {
+	return deniedBy(email) != ""
+}
+
+// deniedBy returns the DENY_LIST entry which matches the email, or an empty string
+func deniedBy(email string) string {
+	for _, entry := range viper.GetStringSlice("DENY_LIST") {
+		if MatchesAllowList([]string{entry}, email) {
+			return entry
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,240 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/samyak-jain/agora_backend/utils"
+	"github.com/spf13/viper"
+)
+
+// AuditSink forwards a formatted login event to an external collector, like a SIEM
+type AuditSink interface {
+	Send(event *models.LoginEvent, payload []byte) error
+}
+
+// HTTPAuditSink posts every event to an HTTP collector
+type HTTPAuditSink struct {
+	URL         string
+	ContentType string
+	Client      *http.Client
+}
+
+// Send posts the payload to the collector
+func (s *HTTPAuditSink) Send(event *models.LoginEvent, payload []byte) error {
+	resp, err := s.Client.Post(s.URL, s.ContentType, bytes.NewBuffer(payload))
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Audit collector responded with status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// SyslogAuditSink sends every event as an RFC 5424 message with the auth facility to a syslog server
+type SyslogAuditSink struct {
+	Network string
+	Address string
+}
+
+// Send writes the payload as a syslog message. A new connection is made for every message, which is fine for the
+// rate of logins and means a restarted syslog server is picked up without reconnect logic.
+func (s *SyslogAuditSink) Send(event *models.LoginEvent, payload []byte) error {
+	conn, err := net.DialTimeout(s.Network, s.Address, 5*time.Second)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	// Facility auth (4), with severity informational (6) for a success, warning (4) for a failure and alert (1)
+	// for a break-glass login
+	priority := 4*8 + 6
+	if event.Outcome == models.LoginFailed {
+		priority = 4*8 + 4
+	} else if event.Outcome == models.LoginBreakGlass {
+		priority = 4*8 + 1
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "-"
+	}
+
+	message := fmt.Sprintf("<%d>1 %s %s app-builder - login - %s\n", priority, event.Time.UTC().Format(time.RFC3339), hostname, payload)
+	_, err = conn.Write([]byte(message))
+	return err
+}
+
+// Formats of AUDIT_SINK_FORMAT
+const (
+	JSONAuditFormat = "json"
+	CEFAuditFormat  = "cef"
+)
+
+// FormatLoginEvent formats the event as JSON or as an ArcSight CEF line
+func FormatLoginEvent(event *models.LoginEvent, format string) ([]byte, error) {
+	if format != CEFAuditFormat {
+		return json.Marshal(event)
+	}
+
+	severity := 3
+	name := "Login succeeded"
+	if event.Outcome == models.LoginFailed {
+		severity = 6
+		name = "Login failed"
+	} else if event.Outcome == models.LoginBreakGlass {
+		severity = 10
+		name = "Break-glass login"
+	}
+
+	extension := fmt.Sprintf("rt=%d suser=%s duid=%s cs1Label=provider cs1=%s outcome=%s",
+		event.Time.UnixNano()/int64(time.Millisecond), cefExtension(event.Email), cefExtension(event.Subject), cefExtension(event.Provider), event.Outcome)
+	if event.Reason != "" {
+		extension += " reason=" + cefExtension(event.Reason)
+	}
+
+	return []byte(fmt.Sprintf("CEF:0|Agora|AppBuilder|1.0|login.%s|%s|%d|%s", event.Outcome, name, severity, extension)), nil
+}
+
+// cefExtension escapes a value of a CEF extension
+func cefExtension(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "=", `\=`, "\r", `\r`, "\n", `\n`).Replace(value)
+}
+
+var (
+	auditSinksMutex sync.RWMutex
+	auditSinks      = map[string]AuditSink{}
+)
+
+// RegisterAuditSink makes a custom audit sink selectable in AUDIT_SINK
+func RegisterAuditSink(name string, sink AuditSink) {
+	auditSinksMutex.Lock()
+	defer auditSinksMutex.Unlock()
+
+	auditSinks[name] = sink
+}
+
+func getAuditSink(name string) (AuditSink, error) {
+	switch name {
+	case "http":
+		contentType := "application/json"
+		if viper.GetString("AUDIT_SINK_FORMAT") == CEFAuditFormat {
+			contentType = "text/plain"
+		}
+
+		return &HTTPAuditSink{
+			URL:         viper.GetString("AUDIT_SINK_URL"),
+			ContentType: contentType,
+			Client:      &http.Client{Timeout: time.Duration(viper.GetInt("WEBHOOK_TIMEOUT")) * time.Second},
+		}, nil
+	case "syslog":
+		return &SyslogAuditSink{Network: viper.GetString("AUDIT_SINK_NETWORK"), Address: viper.GetString("AUDIT_SINK_ADDRESS")}, nil
+	}
+
+	auditSinksMutex.RLock()
+	defer auditSinksMutex.RUnlock()
+
+	sink, ok := auditSinks[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown audit sink %s", name)
+	}
+
+	return sink, nil
+}
+
+// AuditForwarder buffers login events and forwards them to the AUDIT_SINK in the background, so that a slow or
+// unreachable collector never holds up a login. Events are dropped with a warning once the buffer is full.
+type AuditForwarder struct {
+	sink   AuditSink
+	format string
+	events chan *models.LoginEvent
+	logger *utils.Logger
+}
+
+// NewAuditForwarder starts forwarding to the AUDIT_SINK, and returns nil when no sink is configured
+func NewAuditForwarder(logger *utils.Logger) (*AuditForwarder, error) {
+	name := viper.GetString("AUDIT_SINK")
+	if name == "" {
+		return nil, nil
+	}
+
+	sink, err := getAuditSink(name)
+	if err != nil {
+		return nil, err
+	}
+
+	forwarder := &AuditForwarder{
+		sink:   sink,
+		format: viper.GetString("AUDIT_SINK_FORMAT"),
+		events: make(chan *models.LoginEvent, viper.GetInt("AUDIT_SINK_BUFFER")),
+		logger: logger,
+	}
+
+	go forwarder.run()
+
+	return forwarder, nil
+}
+
+func (f *AuditForwarder) run() {
+	for event := range f.events {
+		payload, err := FormatLoginEvent(event, f.format)
+		if err != nil {
+			f.logger.Error().Err(err).Msg("Could not format login event")
+			continue
+		}
+
+		err = f.sink.Send(event, payload)
+		if err != nil {
+			f.logger.Error().Err(err).Str("outcome", event.Outcome).Msg("Could not forward login event")
+		}
+	}
+}
+
+// Record queues the event for forwarding. It does nothing on a nil forwarder, which stands for no sink.
+func (f *AuditForwarder) Record(event *models.LoginEvent) {
+	if f == nil {
+		return
+	}
+
+	select {
+	case f.events <- event:
+	default:
+		f.logger.Warn().Str("outcome", event.Outcome).Msg("Audit sink buffer is full, dropping login event")
+	}
+}
+
+// auditLogin records the outcome of a login attempt with the audit sink
+func (router *ServiceRouter) auditLogin(userInfo *User, site string, outcome string, reason string) {
+	router.Audit.Record(&models.LoginEvent{
+		Time:     time.Now().UTC(),
+		Outcome:  outcome,
+		Reason:   reason,
+		Email:    userInfo.Email,
+		Subject:  userInfo.ID,
+		Provider: site,
+	})
+}
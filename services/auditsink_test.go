@@ -0,0 +1,135 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/spf13/viper"
+)
+
+// testAuditCollector configures the http audit sink to post to a collector served by handler
+func testAuditCollector(t *testing.T, format string, buffer int, handler http.HandlerFunc) {
+	server := httptest.NewServer(handler)
+	viper.Set("AUDIT_SINK", "http")
+	viper.Set("AUDIT_SINK_URL", server.URL)
+	viper.Set("AUDIT_SINK_FORMAT", format)
+	viper.Set("AUDIT_SINK_BUFFER", buffer)
+	viper.Set("WEBHOOK_TIMEOUT", 5)
+
+	t.Cleanup(func() {
+		server.Close()
+		viper.Set("AUDIT_SINK", "")
+		viper.Set("AUDIT_SINK_URL", "")
+		viper.Set("AUDIT_SINK_FORMAT", "")
+		viper.Set("AUDIT_SINK_BUFFER", 0)
+		viper.Set("WEBHOOK_TIMEOUT", 0)
+	})
+}
+
+type collectedEvent struct {
+	contentType string
+	body        string
+}
+
+func TestAuditForwarderShipsEvents(t *testing.T) {
+	tests := []struct {
+		name            string
+		format          string
+		status          int
+		wantContentType string
+		wantBody        string
+	}{
+		{name: "json", format: JSONAuditFormat, status: http.StatusOK, wantContentType: "application/json", wantBody: `"outcome":"failure"`},
+		{name: "cef", format: CEFAuditFormat, status: http.StatusOK, wantContentType: "text/plain", wantBody: "CEF:0|Agora|AppBuilder|1.0|login.failure|Login failed|6|"},
+		{name: "collector error", format: JSONAuditFormat, status: http.StatusInternalServerError, wantContentType: "application/json", wantBody: `"outcome":"failure"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			collected := make(chan collectedEvent, 2)
+			testAuditCollector(t, tt.format, 10, func(w http.ResponseWriter, r *http.Request) {
+				body, _ := ioutil.ReadAll(r.Body)
+				collected <- collectedEvent{contentType: r.Header.Get("Content-Type"), body: string(body)}
+				w.WriteHeader(tt.status)
+			})
+
+			router, _ := testRouter(t)
+			forwarder, err := NewAuditForwarder(router.Logger)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// A failed delivery does not stop the events after it
+			for i := 0; i < 2; i++ {
+				forwarder.Record(&models.LoginEvent{Time: time.Now(), Outcome: models.LoginFailed, Reason: "account_conflict", Email: "user@example.com", Subject: "google-id", Provider: "google"})
+			}
+
+			for i := 0; i < 2; i++ {
+				select {
+				case event := <-collected:
+					if event.contentType != tt.wantContentType || !strings.Contains(event.body, tt.wantBody) {
+						t.Errorf("collector got %s %q, want %s containing %q", event.contentType, event.body, tt.wantContentType, tt.wantBody)
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatal("timed out waiting for the login event")
+				}
+			}
+		})
+	}
+}
+
+func TestAuditForwarderDoesNotBlock(t *testing.T) {
+	release := make(chan struct{})
+	testAuditCollector(t, JSONAuditFormat, 1, func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	})
+	defer close(release)
+
+	router, _ := testRouter(t)
+	forwarder, err := NewAuditForwarder(router.Logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The collector hangs, so the buffer fills up and the events past it are dropped instead of holding up logins
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 10; i++ {
+			forwarder.Record(&models.LoginEvent{Time: time.Now(), Outcome: models.LoginSucceeded, Provider: "google"})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Record() blocked on a collector which does not answer")
+	}
+}
+
+func TestNilAuditForwarder(t *testing.T) {
+	viper.Set("AUDIT_SINK", "")
+
+	forwarder, err := NewAuditForwarder(nil)
+	if err != nil || forwarder != nil {
+		t.Fatalf("NewAuditForwarder() = %v, %v, want no forwarder without AUDIT_SINK", forwarder, err)
+	}
+
+	// Recording without a sink does nothing
+	forwarder.Record(&models.LoginEvent{Outcome: models.LoginSucceeded})
+}
@@ -0,0 +1,122 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"errors"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+
+	"github.com/spf13/viper"
+	"golang.org/x/oauth2"
+)
+
+// stateParams are the query params of Authorize which are carried to the OAuth callback in the state
+var stateParams = []string{"redirect", "backend", "site", "platform", "device"}
+
+// Authorize is a REST route which sends the browser to the authorize URL of the provider, with the query params that
+// parseState reads packed into the state. The login_hint param, usually the email the user last logged in with, is
+// forwarded to providers which support it so that the user does not have to pick an account again.
+func (router *ServiceRouter) Authorize(w http.ResponseWriter, r *http.Request) {
+	if err := rejectForMaintenance(w, false); err != nil {
+		router.Logger.Info().Msg("Rejected login in maintenance mode")
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Get("site") == "" {
+		query.Set("site", DefaultOAuthSite())
+	}
+
+	site := query.Get("site")
+	backendURL := strings.TrimSuffix(query.Get("backend"), "/")
+	if query.Get("redirect") == "" || backendURL == "" || site == "" {
+		http.Error(w, "Redirect, backend and site are required", http.StatusBadRequest)
+		return
+	}
+
+	if !redirectURIAllowed(backendURL) {
+		router.Logger.Info().Str("backend", backendURL).Msg("Rejected login with a backend which is not an allowed redirect URI")
+		http.Error(w, ErrRedirectURINotAllowed.Error(), http.StatusBadRequest)
+		return
+	}
+
+	oauthConfig, _, err := router.GetOAuthConfig(site, backendURL+"/oauth")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	state := url.Values{}
+	for _, param := range stateParams {
+		if value := query.Get(param); value != "" {
+			state.Set(param, value)
+		}
+	}
+
+	var options []oauth2.AuthCodeOption
+
+	// The nonce is issued here rather than taken from the query, as only a nonce we stored can be checked for reuse
+	if viper.GetBool("VERIFY_ID_TOKEN") {
+		nonce, err := router.issueNonce()
+		if err != nil {
+			router.Logger.Error().Err(err).Msg("Could not issue nonce")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		state.Set("nonce", nonce)
+		options = append(options, oauth2.SetAuthURLParam("nonce", nonce))
+	}
+
+	hint, err := loginHint(site, query.Get("login_hint"))
+	if err != nil {
+		router.Logger.Info().Str("provider", site).Msg("Rejected login with a malformed login_hint")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if hint != "" {
+		options = append(options, oauth2.SetAuthURLParam("login_hint", hint))
+	}
+
+	// parseState unescapes the state once more after the provider returns it
+	http.Redirect(w, r, oauthConfig.AuthCodeURL(url.QueryEscape(state.Encode()), options...), http.StatusFound)
+}
+
+// ErrInvalidLoginHint is returned by Authorize for a login_hint which is not a plain email address
+var ErrInvalidLoginHint = errors.New("The login_hint must be an email address")
+
+// maxLoginHintLength is the longest email address allowed in a login_hint
+const maxLoginHintLength = 254
+
+// loginHint returns the hint to pass on to the provider of the site, or nothing when ENABLE_LOGIN_HINT is off or the
+// provider does not support login_hint. A hint which would be passed on has to be a plain email address.
+func loginHint(site string, hint string) (string, error) {
+	if hint == "" || !viper.GetBool("ENABLE_LOGIN_HINT") {
+		return "", nil
+	}
+
+	provider, ok := GetOAuthProvider(site)
+	if !ok || !provider.LoginHint {
+		return "", nil
+	}
+
+	address, err := mail.ParseAddress(hint)
+	if err != nil || address.Address != hint || len(hint) > maxLoginHintLength {
+		return "", ErrInvalidLoginHint
+	}
+
+	return hint, nil
+}
@@ -0,0 +1,74 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestAuthorizeLoginHint(t *testing.T) {
+	defer viper.Set("ENABLE_LOGIN_HINT", false)
+
+	tests := []struct {
+		name       string
+		enabled    bool
+		site       string
+		hint       string
+		wantStatus int
+		wantHint   string
+	}{
+		{name: "forwarded", enabled: true, site: "microsoft", hint: "user@example.com", wantStatus: http.StatusFound, wantHint: "user@example.com"},
+		{name: "no hint", enabled: true, site: "microsoft", wantStatus: http.StatusFound},
+		{name: "disabled", enabled: false, site: "microsoft", hint: "user@example.com", wantStatus: http.StatusFound},
+		{name: "unsupported provider", enabled: true, site: "slack", hint: "user@example.com", wantStatus: http.StatusFound},
+		{name: "not an email", enabled: true, site: "microsoft", hint: "user", wantStatus: http.StatusBadRequest},
+		{name: "display name", enabled: true, site: "microsoft", hint: "User <user@example.com>", wantStatus: http.StatusBadRequest},
+		{name: "several addresses", enabled: true, site: "microsoft", hint: "user@example.com, other@example.com", wantStatus: http.StatusBadRequest},
+		{name: "malformed but disabled", enabled: false, site: "microsoft", hint: "user", wantStatus: http.StatusFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("ENABLE_LOGIN_HINT", tt.enabled)
+			router, _ := testRouter(t)
+
+			query := url.Values{"redirect": {"https://app.example.com"}, "backend": {"https://api.example.com"}, "site": {tt.site}}
+			if tt.hint != "" {
+				query.Set("login_hint", tt.hint)
+			}
+
+			w := httptest.NewRecorder()
+			router.Authorize(w, httptest.NewRequest("GET", "/authorize?"+query.Encode(), nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Authorize() = %d %q, want %d", w.Code, w.Body.String(), tt.wantStatus)
+			}
+
+			if tt.wantStatus != http.StatusFound {
+				return
+			}
+
+			location, err := url.Parse(w.Header().Get("Location"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			hint, ok := location.Query()["login_hint"]
+			if (tt.wantHint == "" && ok) || (tt.wantHint != "" && (len(hint) != 1 || hint[0] != tt.wantHint)) {
+				t.Errorf("authorize URL %s has login_hint %v, want %q", location, hint, tt.wantHint)
+			}
+		})
+	}
+}
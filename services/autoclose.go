@@ -0,0 +1,98 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/samyak-jain/agora_backend/utils"
+	"github.com/spf13/viper"
+)
+
+// CheckChannelAutoClose makes sure the idle check interval and timeout are usable when ENABLE_CHANNEL_AUTO_CLOSE is set,
+// as a ticker cannot be started with an interval of 0 or less
+func CheckChannelAutoClose() error {
+	if !viper.GetBool("ENABLE_CHANNEL_AUTO_CLOSE") {
+		return nil
+	}
+
+	if viper.GetInt("CHANNEL_IDLE_CHECK_INTERVAL") <= 0 {
+		return errors.New("CHANNEL_IDLE_CHECK_INTERVAL must be a positive number of seconds")
+	}
+
+	if viper.GetInt("CHANNEL_IDLE_TIMEOUT") < 0 {
+		return errors.New("CHANNEL_IDLE_TIMEOUT must not be negative")
+	}
+
+	return nil
+}
+
+// ChannelUserCounter returns the number of users currently present in a channel
+type ChannelUserCounter func(channel string) (int, error)
+
+// CloseIdleChannels marks every open channel which has had no participants for longer than idleTimeout as closed.
+// Channels with participants have their last activity refreshed instead.
+func CloseIdleChannels(db *models.Database, logger *utils.Logger, countUsers ChannelUserCounter, idleTimeout time.Duration) {
+	var channels []models.Channel
+	err := db.Select(&channels, "SELECT id, channel_name, last_active_at FROM channels WHERE closed_at IS NULL")
+	if err != nil {
+		logger.Error().Err(err).Msg("Could not fetch open channels")
+		return
+	}
+
+	now := time.Now()
+	for _, channel := range channels {
+		count, err := countUsers(channel.ChannelName)
+		if err != nil {
+			logger.Error().Err(err).Str("channel", channel.ChannelName).Msg("Could not fetch participants of channel")
+			continue
+		}
+
+		if count > 0 {
+			_, err = db.Exec("UPDATE channels SET last_active_at = $1 WHERE id = $2", now, channel.ID)
+			if err != nil {
+				logger.Error().Err(err).Str("channel", channel.ChannelName).Msg("Could not update channel activity")
+			}
+
+			continue
+		}
+
+		if channel.LastActiveAt.Valid && now.Sub(channel.LastActiveAt.Time) < idleTimeout {
+			continue
+		}
+
+		_, err = db.Exec("UPDATE channels SET closed_at = $1 WHERE id = $2 AND closed_at IS NULL", now, channel.ID)
+		if err != nil {
+			logger.Error().Err(err).Str("channel", channel.ChannelName).Msg("Could not close idle channel")
+			continue
+		}
+
+		logger.Info().Str("channel", channel.ChannelName).Msg("Closed idle channel")
+	}
+}
+
+// StartChannelAutoClose periodically closes idle channels until the process exits.
+// Nothing is started for an interval of 0 or less.
+func StartChannelAutoClose(db *models.Database, logger *utils.Logger, interval time.Duration, idleTimeout time.Duration) {
+	if interval <= 0 {
+		logger.Error().Dur("interval", interval).Msg("Channel auto close is disabled as the interval is not positive")
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			CloseIdleChannels(db, logger, utils.GetChannelUserCount, idleTimeout)
+		}
+	}()
+}
@@ -0,0 +1,47 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestCheckChannelAutoClose(t *testing.T) {
+	tests := []struct {
+		name        string
+		enabled     bool
+		interval    int
+		idleTimeout int
+		wantErr     bool
+	}{
+		{name: "disabled with a zero interval", enabled: false, interval: 0, idleTimeout: 3600, wantErr: false},
+		{name: "enabled", enabled: true, interval: 300, idleTimeout: 3600, wantErr: false},
+		{name: "zero interval", enabled: true, interval: 0, idleTimeout: 3600, wantErr: true},
+		{name: "negative interval", enabled: true, interval: -5, idleTimeout: 3600, wantErr: true},
+		{name: "zero timeout", enabled: true, interval: 300, idleTimeout: 0, wantErr: false},
+		{name: "negative timeout", enabled: true, interval: 300, idleTimeout: -1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("ENABLE_CHANNEL_AUTO_CLOSE", tt.enabled)
+			viper.Set("CHANNEL_IDLE_CHECK_INTERVAL", tt.interval)
+			viper.Set("CHANNEL_IDLE_TIMEOUT", tt.idleTimeout)
+			defer viper.Set("ENABLE_CHANNEL_AUTO_CLOSE", false)
+
+			if err := CheckChannelAutoClose(); (err != nil) != tt.wantErr {
+				t.Errorf("CheckChannelAutoClose() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
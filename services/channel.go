@@ -0,0 +1,127 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/samyak-jain/agora_backend/utils"
+)
+
+// GenerateChannel creates a new channel with freshly generated passphrases, channel name, secret and DTMF.
+// The Agora channel name is a random UUID which clients never choose, so channels of different tenants cannot collide
+// even when the tenants share an app ID, and the name is not namespaced by tenant.
+func GenerateChannel(title string) (*models.Channel, error) {
+	hostPhrase, err := utils.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	viewPhrase, err := utils.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	channelName, err := utils.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := utils.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	dtmf, err := utils.GenerateDTMF()
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.Channel{
+		Title:            title,
+		ChannelName:      strings.ReplaceAll(channelName, "-", ""),
+		ChannelSecret:    strings.ReplaceAll(secret, "-", ""),
+		HostPassphrase:   hostPhrase,
+		ViewerPassphrase: viewPhrase,
+		DTMF:             *dtmf,
+	}, nil
+}
+
+// InsertChannel stores the channel using either the database or an ongoing transaction
+func InsertChannel(ctx context.Context, db sqlx.ExtContext, channel *models.Channel) error {
+	_, err := sqlx.NamedExecContext(ctx, db, "INSERT INTO channels (title, channel_name, channel_secret, host_passphrase, viewer_passphrase, dtmf, creator_id, scheduled_start, scheduled_end) VALUES (:title, :channel_name, :channel_secret, :host_passphrase, :viewer_passphrase, :dtmf, :creator_id, :scheduled_start, :scheduled_end)", channel)
+	return err
+}
+
+// InsertChannelWithSlug stores a channel with an explicit, unique slug. When another channel already took the slug,
+// even through a concurrent insert, nothing is stored and the existing channel is returned instead.
+func InsertChannelWithSlug(ctx context.Context, db *models.Database, channel *models.Channel) (*models.Channel, bool, error) {
+	result, err := db.NamedExecContext(ctx, "INSERT INTO channels (title, channel_name, channel_secret, host_passphrase, viewer_passphrase, dtmf, creator_id, scheduled_start, scheduled_end, slug) VALUES (:title, :channel_name, :channel_secret, :host_passphrase, :viewer_passphrase, :dtmf, :creator_id, :scheduled_start, :scheduled_end, :slug) ON CONFLICT (slug) WHERE slug IS NOT NULL DO NOTHING", channel)
+	if err != nil {
+		return nil, false, err
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return nil, false, err
+	}
+
+	if inserted > 0 {
+		return channel, true, nil
+	}
+
+	var existing models.Channel
+	err = db.GetContext(ctx, &existing, "SELECT id, title, channel_name, channel_secret, host_passphrase, viewer_passphrase, dtmf, creator_id, slug FROM channels WHERE slug = $1", channel.Slug)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return &existing, false, nil
+}
+
+// channelSortColumns maps each sort order of myChannels to its column
+var channelSortColumns = map[models.ChannelSort]string{
+	models.ChannelSortCreatedAt:      "created_at",
+	models.ChannelSortScheduledStart: "scheduled_start",
+}
+
+// ListUserChannels returns a page of the channels the user created. Channels without a schedule come last when
+// sorting by the scheduled start, whatever the direction.
+func ListUserChannels(ctx context.Context, db *models.Database, userID int64, sort models.ChannelSort, descending bool, limit int, offset int) (*models.ChannelPage, error) {
+	column, ok := channelSortColumns[sort]
+	if !ok {
+		column = "created_at"
+	}
+
+	direction := "ASC"
+	if descending {
+		direction = "DESC"
+	}
+
+	ctx, cancel := utils.QueryContext(ctx)
+	defer cancel()
+
+	page := &models.ChannelPage{Channels: []*models.ChannelSummary{}}
+	err := db.GetContext(ctx, &page.Total, "SELECT COUNT(*) FROM channels WHERE creator_id = $1", userID)
+	if err != nil {
+		return nil, utils.QueryError(ctx, err)
+	}
+
+	err = db.SelectContext(ctx, &page.Channels, "SELECT title, channel_name, host_passphrase, viewer_passphrase, created_at, scheduled_start, scheduled_end, closed_at, EXISTS (SELECT 1 FROM recording_files WHERE recording_files.channel_id = channels.id) AS recording, recording_started_at FROM channels WHERE creator_id = $1 ORDER BY "+column+" "+direction+" NULLS LAST, id "+direction+" LIMIT $2 OFFSET $3", userID, limit, offset)
+	if err != nil {
+		return nil, utils.QueryError(ctx, err)
+	}
+
+	return page, nil
+}
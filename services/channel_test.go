@@ -0,0 +1,162 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/samyak-jain/agora_backend/pkg/models/dbtest"
+	"github.com/samyak-jain/agora_backend/utils"
+)
+
+func TestGenerateChannel(t *testing.T) {
+	tests := []struct {
+		name  string
+		title string
+	}{
+		{name: "default title", title: "Personal Room"},
+		{name: "empty title", title: ""},
+		{name: "unicode title", title: "Réunion d'équipe"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channel, err := GenerateChannel(tt.title)
+			if err != nil {
+				t.Fatalf("GenerateChannel() error = %v", err)
+			}
+
+			if channel.Title != tt.title {
+				t.Errorf("Title = %q, want %q", channel.Title, tt.title)
+			}
+
+			if channel.ChannelName == "" || strings.Contains(channel.ChannelName, "-") {
+				t.Errorf("ChannelName = %q, want a non-empty name without hyphens", channel.ChannelName)
+			}
+
+			if channel.ChannelSecret == "" || strings.Contains(channel.ChannelSecret, "-") {
+				t.Errorf("ChannelSecret = %q, want a non-empty secret without hyphens", channel.ChannelSecret)
+			}
+
+			if channel.HostPassphrase == channel.ViewerPassphrase {
+				t.Errorf("host and viewer passphrases are both %q", channel.HostPassphrase)
+			}
+
+			if len(channel.DTMF) != 8 {
+				t.Errorf("DTMF = %q, want 8 digits", channel.DTMF)
+			}
+		})
+	}
+}
+
+func TestInsertChannelWithSlug(t *testing.T) {
+	existingColumns := []string{"id", "title", "channel_name", "channel_secret", "host_passphrase", "viewer_passphrase", "dtmf", "creator_id", "slug"}
+
+	tests := []struct {
+		name        string
+		inserted    int64
+		insertErr   error
+		wantCreated bool
+		wantID      int64
+		wantErr     bool
+	}{
+		{name: "free slug", inserted: 1, wantCreated: true},
+		{name: "slug taken by a concurrent insert", inserted: 0, wantCreated: false, wantID: 3},
+		{name: "other unique violation", insertErr: dbtest.UniqueViolation("channels_host_passphrase_key"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, mock := testRouter(t)
+			channel, err := GenerateChannel("Standup")
+			if err != nil {
+				t.Fatal(err)
+			}
+			channel.Slug = sql.NullString{String: "standup", Valid: true}
+
+			mock.ExpectExec(`INSERT INTO channels .* ON CONFLICT \(slug\) WHERE slug IS NOT NULL DO NOTHING`).WillReturnResult(tt.inserted).WillReturnError(tt.insertErr)
+			if tt.insertErr == nil && tt.inserted == 0 {
+				mock.ExpectQuery(`FROM channels WHERE slug = \$1`).WithArgs("standup").
+					WillReturnRows(existingColumns, []interface{}{3, "Standup", "existing", "secret", "host", "viewer", "1234", 1, "standup"})
+			}
+
+			got, created, err := InsertChannelWithSlug(context.Background(), router.DB, channel)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("InsertChannelWithSlug() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				if !utils.IsUniqueViolation(err) {
+					t.Errorf("InsertChannelWithSlug() error = %v, want the unique violation", err)
+				}
+				return
+			}
+
+			if created != tt.wantCreated || got.ID != tt.wantID {
+				t.Errorf("InsertChannelWithSlug() = channel %d, created %v, want channel %d, created %v", got.ID, created, tt.wantID, tt.wantCreated)
+			}
+
+			if !created && got.ChannelName != "existing" {
+				t.Errorf("InsertChannelWithSlug() returned %+v, want the existing channel", got)
+			}
+		})
+	}
+}
+
+func TestListUserChannels(t *testing.T) {
+	columns := []string{"title", "channel_name", "host_passphrase", "viewer_passphrase", "created_at", "scheduled_start", "scheduled_end", "closed_at", "recording", "recording_started_at"}
+	createdAt := time.Date(2021, 6, 1, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		sort       models.ChannelSort
+		descending bool
+		limit      int
+		offset     int
+		wantOrder  string
+	}{
+		{name: "newest first", sort: models.ChannelSortCreatedAt, descending: true, limit: 20, offset: 0, wantOrder: "ORDER BY created_at DESC NULLS LAST, id DESC"},
+		{name: "next page by schedule", sort: models.ChannelSortScheduledStart, limit: 2, offset: 2, wantOrder: "ORDER BY scheduled_start ASC NULLS LAST, id ASC"},
+		{name: "unknown sort", sort: models.ChannelSort("TITLE"), limit: 5, offset: 0, wantOrder: "ORDER BY created_at ASC NULLS LAST, id ASC"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, mock := testRouter(t)
+			mock.ExpectQuery(`SELECT COUNT\(\*\) FROM channels WHERE creator_id = \$1`).WithArgs(7).
+				WillReturnRows([]string{"count"}, []interface{}{4})
+			mock.ExpectQuery(`FROM channels WHERE creator_id = \$1 `+regexp.QuoteMeta(tt.wantOrder)+` LIMIT \$2 OFFSET \$3`).WithArgs(7, tt.limit, tt.offset).
+				WillReturnRows(columns,
+					[]interface{}{"Standup", "standup", "host-1", "viewer-1", createdAt, nil, nil, nil, true, nil},
+					[]interface{}{"Retro", "retro", "host-2", "viewer-2", createdAt.Add(time.Hour), nil, nil, nil, false, nil},
+				)
+
+			page, err := ListUserChannels(context.Background(), router.DB, 7, tt.sort, tt.descending, tt.limit, tt.offset)
+			if err != nil {
+				t.Fatalf("ListUserChannels() error = %v", err)
+			}
+
+			if page.Total != 4 || len(page.Channels) != 2 {
+				t.Fatalf("ListUserChannels() = %d channels of %d, want 2 of 4", len(page.Channels), page.Total)
+			}
+
+			if first := page.Channels[0]; first.Channel != "standup" || first.HostPassphrase != "host-1" || !first.Recording || !first.CreatedAt.Equal(createdAt) {
+				t.Errorf("ListUserChannels() first channel = %+v", first)
+			}
+		})
+	}
+}
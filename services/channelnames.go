@@ -0,0 +1,39 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"strings"
+	"unicode"
+)
+
+// BlockedChannelName returns the entry of the CHANNEL_NAME_BLOCKLIST of the tenant that the channel name matches, or an
+// empty string when it is not blocked. Matching ignores case and punctuation, and an entry only matches whole words of
+// the name, so that blocking "test" does not block "contest". Entries may be several words long.
+func BlockedChannelName(config *TenantConfig, name string) string {
+	words := " " + channelNameWords(name) + " "
+
+	for _, entry := range config.GetStringSlice("CHANNEL_NAME_BLOCKLIST") {
+		blocked := channelNameWords(entry)
+		if blocked != "" && strings.Contains(words, " "+blocked+" ") {
+			return entry
+		}
+	}
+
+	return ""
+}
+
+// channelNameWords lowercases the name and separates its words with single spaces
+func channelNameWords(name string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}), " ")
+}
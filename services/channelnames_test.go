@@ -0,0 +1,73 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestBlockedChannelName(t *testing.T) {
+	viper.Set("CHANNEL_NAME_BLOCKLIST", []string{"admin", "Acme Corp"})
+	defer viper.Set("CHANNEL_NAME_BLOCKLIST", nil)
+
+	tenantConfig := &TenantConfig{overrides: map[string]string{"CHANNEL_NAME_BLOCKLIST": "test, ,internal only"}}
+
+	tests := []struct {
+		name   string
+		config *TenantConfig
+		title  string
+		want   string
+	}{
+		{name: "allowed", config: &TenantConfig{}, title: "Weekly standup", want: ""},
+		{name: "blocked", config: &TenantConfig{}, title: "admin", want: "admin"},
+		{name: "case is ignored", config: &TenantConfig{}, title: "ADMIN room", want: "admin"},
+		{name: "punctuation is ignored", config: &TenantConfig{}, title: "the-admin_room!", want: "admin"},
+		{name: "only whole words match", config: &TenantConfig{}, title: "administration", want: ""},
+		{name: "several words", config: &TenantConfig{}, title: "acme-corp all hands", want: "Acme Corp"},
+		{name: "several words split up", config: &TenantConfig{}, title: "acme and corp", want: ""},
+		{name: "tenant list replaces the global one", config: tenantConfig, title: "admin", want: ""},
+		{name: "blocked for the tenant", config: tenantConfig, title: "Test call", want: "test"},
+		{name: "tenant only whole words match", config: tenantConfig, title: "contest", want: ""},
+		{name: "tenant several words", config: tenantConfig, title: "Internal, only!", want: "internal only"},
+		{name: "no tenant uses the global list", config: nil, title: "admin", want: "admin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := BlockedChannelName(tt.config, tt.title); got != tt.want {
+				t.Errorf("BlockedChannelName(%q) = %q, want %q", tt.title, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChannelNameWords(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "Weekly Standup", want: "weekly standup"},
+		{name: "  team--sync__2021 ", want: "team sync 2021"},
+		{name: "Équipe Réunion", want: "équipe réunion"},
+		{name: "!!!", want: ""},
+		{name: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := channelNameWords(tt.name); got != tt.want {
+				t.Errorf("channelNameWords(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
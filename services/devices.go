@@ -0,0 +1,52 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/samyak-jain/agora_backend/utils"
+	"github.com/spf13/viper"
+)
+
+// deviceName cleans up the device name a client sent along with a login, like a user supplied name
+func deviceName(name string) sql.NullString {
+	name = utils.SanitizeName(name)
+	return sql.NullString{String: name, Valid: name != ""}
+}
+
+// insertSessionToken stores the session token of an existing user. With UNIQUE_DEVICE_NAMES, the sessions the user
+// already has on a device of the same name are deleted in the same transaction, so that logging in again from a
+// device rotates its token instead of adding another session of the same name.
+func (router *ServiceRouter) insertSessionToken(ctx context.Context, token *models.Token) error {
+	tx, err := router.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if viper.GetBool("UNIQUE_DEVICE_NAMES") && token.DeviceName.Valid {
+		_, err = tx.ExecContext(ctx, "DELETE FROM tokens WHERE user_id = $1 AND device_name = $2", token.UserID, token.DeviceName.String)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.NamedExecContext(ctx, "INSERT INTO tokens (token_id, user_id, expires_at, role, device_name) VALUES (:token_id, :user_id, :expires_at, :role, :device_name)", token)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,81 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/spf13/viper"
+)
+
+func TestInsertSessionTokenDeviceNames(t *testing.T) {
+	defer viper.Set("UNIQUE_DEVICE_NAMES", false)
+
+	// The user already has a session on a device named iPhone
+	tests := []struct {
+		name       string
+		unique     bool
+		device     string
+		wantDelete bool
+		deleted    int64
+	}{
+		{name: "same name rotates the session", unique: true, device: "iPhone", wantDelete: true, deleted: 1},
+		{name: "distinct name is a separate session", unique: true, device: "iPad", wantDelete: true, deleted: 0},
+		{name: "without a name", unique: true, device: ""},
+		{name: "names are not unique by default", unique: false, device: "iPhone"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("UNIQUE_DEVICE_NAMES", tt.unique)
+			router, mock := testRouter(t)
+
+			token := &models.Token{TokenID: "new-token", UserID: 5, Role: "user", DeviceName: deviceName(tt.device)}
+
+			mock.ExpectBegin()
+			if tt.wantDelete {
+				mock.ExpectExec(`DELETE FROM tokens WHERE user_id = \$1 AND device_name = \$2`).WithArgs(5, tt.device).WillReturnResult(tt.deleted)
+			}
+			mock.ExpectExec(`INSERT INTO tokens \(token_id, user_id, expires_at, role, device_name\)`).WithArgs("new-token", 5, nil, "user", token.DeviceName)
+			mock.ExpectCommit()
+
+			if err := router.insertSessionToken(context.Background(), token); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestDeviceName(t *testing.T) {
+	viper.Set("MAX_USER_NAME_LENGTH", 10)
+	defer viper.Set("MAX_USER_NAME_LENGTH", 0)
+
+	tests := []struct {
+		name string
+		want sql.NullString
+	}{
+		{name: "iPhone", want: sql.NullString{String: "iPhone", Valid: true}},
+		{name: "  Pixel\u200b 5 ", want: sql.NullString{String: "Pixel 5", Valid: true}},
+		{name: "A very long device name", want: sql.NullString{String: "A very lon", Valid: true}},
+		{name: "  ", want: sql.NullString{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := deviceName(tt.name); got != tt.want {
+				t.Errorf("deviceName(%q) = %+v, want %+v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/samyak-jain/agora_backend/utils"
+	"github.com/spf13/viper"
+)
+
+// cachesEmailVerified reports whether the provider is listed in EMAIL_VERIFIED_CACHE_PROVIDERS. Providers like Apple
+// only send the email and its verified status on the first consent, so for them the status stored at the first login
+// is used when a later login does not carry it.
+func cachesEmailVerified(site string) bool {
+	for _, provider := range viper.GetStringSlice("EMAIL_VERIFIED_CACHE_PROVIDERS") {
+		if provider == site {
+			return true
+		}
+	}
+
+	return false
+}
+
+// applyCachedEmailVerified fills in the verified status, and the email if it is missing too, of a login without the
+// email_verified claim from the user stored for the provider ID. Without a stored user the email counts as unverified,
+// since nothing vouches for it. Logins which carry the claim, and providers which do not cache it, are left as they are.
+func (router *ServiceRouter) applyCachedEmailVerified(ctx context.Context, userInfo *User, site string) error {
+	if !userInfo.EmailVerifiedMissing || !cachesEmailVerified(site) {
+		return nil
+	}
+
+	ctx, cancel := utils.QueryContext(ctx)
+	defer cancel()
+
+	var cached struct {
+		Email         string `db:"email"`
+		EmailVerified bool   `db:"email_verified"`
+	}
+	err := router.DB.GetContext(ctx, &cached, "SELECT email, email_verified FROM users WHERE provider = $1 AND identifier = $2", site, userInfo.ID)
+	if err == sql.ErrNoRows {
+		userInfo.EmailVerified = false
+		return nil
+	} else if err != nil {
+		return utils.QueryError(ctx, err)
+	}
+
+	if userInfo.Email == "" {
+		userInfo.Email = cached.Email
+	}
+
+	userInfo.EmailVerified = cached.EmailVerified && utils.NormalizeEmail(userInfo.Email) == utils.NormalizeEmail(cached.Email)
+	router.Logger.Debug().Str("Sub", userInfo.ID).Str("provider", site).Bool("verified", userInfo.EmailVerified).Msg("Using cached email verified status")
+	return nil
+}
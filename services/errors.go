@@ -0,0 +1,104 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/samyak-jain/agora_backend/utils"
+)
+
+// ErrUserInfoAuthFailed is returned when the provider rejects the access token, usually because it expired
+var ErrUserInfoAuthFailed = errors.New("Provider rejected the access token")
+
+// ErrUserInfoUnavailable is returned when the provider userinfo endpoint fails in a way that may succeed on retry
+var ErrUserInfoUnavailable = errors.New("Provider userinfo endpoint is unavailable")
+
+// UserInfoError describes a non-200 response from the provider userinfo endpoint
+type UserInfoError struct {
+	StatusCode int
+	Err        error
+}
+
+func (e *UserInfoError) Error() string {
+	return fmt.Sprintf("%s (status %d)", e.Err.Error(), e.StatusCode)
+}
+
+func (e *UserInfoError) Unwrap() error {
+	return e.Err
+}
+
+func newUserInfoError(statusCode int) error {
+	switch {
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		return &UserInfoError{StatusCode: statusCode, Err: ErrUserInfoAuthFailed}
+	case statusCode == http.StatusTooManyRequests || statusCode >= 500:
+		return &UserInfoError{StatusCode: statusCode, Err: ErrUserInfoUnavailable}
+	default:
+		return &UserInfoError{StatusCode: statusCode, Err: errors.New("Unexpected response from provider userinfo endpoint")}
+	}
+}
+
+// checkUserInfoResponse makes sure that the userinfo endpoint responded with a 200
+func checkUserInfoResponse(response *http.Response) error {
+	if response.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	return newUserInfoError(response.StatusCode)
+}
+
+// userInfoErrorFromOIDC converts the error of oidc.Provider.UserInfo, which starts with the response status, into a UserInfoError
+func userInfoErrorFromOIDC(err error) error {
+	message := err.Error()
+	if len(message) < 3 {
+		return err
+	}
+
+	statusCode, convErr := strconv.Atoi(message[:3])
+	if convErr != nil || !strings.HasPrefix(message[3:], " ") {
+		return err
+	}
+
+	return newUserInfoError(statusCode)
+}
+
+// userInfoStatusCode maps an error from GetUserInfo to the status code which is sent back to the client
+func userInfoStatusCode(err error) int {
+	switch {
+	case errors.Is(err, ErrUserInfoAuthFailed), errors.Is(err, ErrInvalidIDToken):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrUserInfoUnavailable), errors.Is(err, utils.ErrCircuitOpen):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// writeQueryErrorStatus sends 503 for database queries which timed out, 409 for unique constraint violations, like
+// two concurrent first logins of the same user, and 500 for any other database error
+func writeQueryErrorStatus(w http.ResponseWriter, err error) {
+	if errors.Is(err, utils.ErrQueryTimeout) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	if utils.IsUniqueViolation(err) {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	w.WriteHeader(http.StatusInternalServerError)
+}
@@ -0,0 +1,89 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/coreos/go-oidc"
+	"github.com/samyak-jain/agora_backend/pkg/models/dbtest"
+	"github.com/samyak-jain/agora_backend/utils"
+	"golang.org/x/oauth2"
+)
+
+func TestGetUserInfoStatusCode(t *testing.T) {
+	tests := []struct {
+		name           string
+		userInfoStatus int
+		want           int
+	}{
+		{name: "expired access token", userInfoStatus: http.StatusUnauthorized, want: http.StatusUnauthorized},
+		{name: "forbidden", userInfoStatus: http.StatusForbidden, want: http.StatusUnauthorized},
+		{name: "rate limited", userInfoStatus: http.StatusTooManyRequests, want: http.StatusServiceUnavailable},
+		{name: "provider error", userInfoStatus: http.StatusInternalServerError, want: http.StatusServiceUnavailable},
+		{name: "provider unavailable", userInfoStatus: http.StatusServiceUnavailable, want: http.StatusServiceUnavailable},
+		{name: "unexpected response", userInfoStatus: http.StatusNotFound, want: http.StatusBadGateway},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := testProvider(t, tt.userInfoStatus)
+			provider, err := oidc.NewProvider(context.Background(), server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			router, mock := testRouter(t)
+			mock.ExpectQuery(`FROM credentials WHERE code=\$1`).WithArgs("code")
+			mock.ExpectExec(`INSERT INTO credentials`)
+
+			// Every case gets a circuit of its own so that the failures don't open it for the others
+			oauthConfig := oauth2.Config{ClientID: "client", Endpoint: provider.Endpoint()}
+			_, err = router.GetUserInfo(context.Background(), oauthConfig, Details{Code: "code", OAuthSite: "test " + tt.name}, provider)
+			if err == nil {
+				t.Fatal("GetUserInfo() error = nil")
+			}
+
+			if got := userInfoStatusCode(err); got != tt.want {
+				t.Errorf("userInfoStatusCode(%v) = %d, want %d", err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteQueryErrorStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "timeout", err: fmt.Errorf("%w: %v", utils.ErrQueryTimeout, context.DeadlineExceeded), want: http.StatusServiceUnavailable},
+		{name: "unique violation", err: dbtest.UniqueViolation("users_provider_identifier_key"), want: http.StatusConflict},
+		{name: "wrapped unique violation", err: fmt.Errorf("could not create user: %w", dbtest.UniqueViolation("users_provider_identifier_key")), want: http.StatusConflict},
+		{name: "other error", err: errors.New("connection refused"), want: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			writeQueryErrorStatus(w, tt.err)
+
+			if w.Code != tt.want {
+				t.Errorf("writeQueryErrorStatus(%v) = %d, want %d", tt.err, w.Code, tt.want)
+			}
+		})
+	}
+}
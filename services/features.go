@@ -0,0 +1,30 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/samyak-jain/agora_backend/utils"
+	"github.com/spf13/viper"
+)
+
+// EnabledFeatures derives the optional features a client can offer from the config of the user's tenant.
+// Recording and PSTN count as enabled once their credentials are configured, and FEATURE_FLAGS lists further
+// flags which are passed to clients as is.
+func EnabledFeatures(tenantConfig *TenantConfig) *models.Features {
+	return &models.Features{
+		OAuth:      viper.GetBool("ENABLE_OAUTH"),
+		Recording:  tenantConfig.GetBool("ENABLE_RECORDING") && utils.CheckRESTCredentials() == nil && viper.GetString("BUCKET_NAME") != "",
+		Pstn:       viper.GetString("PSTN_ACCOUNT") != "" && viper.GetString("PSTN_EMAIL") != "",
+		Encryption: viper.GetBool("ENCRYPTION_ENABLED"),
+		Flags:      append([]string{}, viper.GetStringSlice("FEATURE_FLAGS")...),
+	}
+}
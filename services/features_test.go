@@ -0,0 +1,51 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestEnabledFeaturesRecording(t *testing.T) {
+	viper.Set("CUSTOMER_ID", "customer")
+	viper.Set("CUSTOMER_CERTIFICATE", "certificate")
+	viper.Set("BUCKET_NAME", "recordings")
+	defer func() {
+		viper.Set("CUSTOMER_ID", "")
+		viper.Set("CUSTOMER_CERTIFICATE", "")
+		viper.Set("BUCKET_NAME", "")
+		viper.Set("ENABLE_RECORDING", true)
+	}()
+
+	tests := []struct {
+		name         string
+		global       bool
+		tenantConfig *TenantConfig
+		want         bool
+	}{
+		{name: "global config", global: true, tenantConfig: &TenantConfig{}, want: true},
+		{name: "disabled globally", global: false, tenantConfig: &TenantConfig{}, want: false},
+		{name: "disabled for the tenant", global: true, tenantConfig: &TenantConfig{overrides: map[string]string{"ENABLE_RECORDING": "false"}}, want: false},
+		{name: "enabled for the tenant", global: false, tenantConfig: &TenantConfig{overrides: map[string]string{"ENABLE_RECORDING": "true"}}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("ENABLE_RECORDING", tt.global)
+
+			if got := EnabledFeatures(tt.tenantConfig).Recording; got != tt.want {
+				t.Errorf("EnabledFeatures().Recording = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
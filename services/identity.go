@@ -0,0 +1,223 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/samyak-jain/agora_backend/utils"
+	"github.com/spf13/viper"
+)
+
+// ErrProviderIDChanged is returned when the provider returns a different ID for the email of an existing user and
+// REASSOCIATE_PROVIDER_ID is disabled
+var ErrProviderIDChanged = errors.New("An account with this email already exists")
+
+// Ways of handling a login with an unverified email which matches an existing user, set in UNVERIFIED_EMAIL_COLLISION
+const (
+	RejectUnverifiedCollision   = "reject"
+	SeparateUnverifiedCollision = "separate"
+)
+
+// ErrUnverifiedEmailCollision is returned when an unverified email matches an existing user and such logins are rejected
+var ErrUnverifiedEmailCollision = errors.New("An account with this email already exists")
+
+// Account linking policies for a verified email which belongs to a user of another provider, set in
+// ACCOUNT_LINKING_POLICY and overridden per provider with <SITE>_ACCOUNT_LINKING_POLICY
+const (
+	AutoLinkingPolicy     = "auto"
+	SeparateLinkingPolicy = "separate"
+	PromptLinkingPolicy   = "prompt"
+)
+
+// ErrAccountLinkRequired is returned by the prompt policy, the user has to sign in with the provider they used before
+var ErrAccountLinkRequired = errors.New("An account with this email already exists")
+
+// LinkingPolicy returns the account linking policy for logins through the site
+func LinkingPolicy(site string) string {
+	if policy := viper.GetString(strings.ToUpper(site) + "_ACCOUNT_LINKING_POLICY"); policy != "" {
+		return policy
+	}
+
+	return viper.GetString("ACCOUNT_LINKING_POLICY")
+}
+
+// CheckAccountLinkingPolicy makes sure ACCOUNT_LINKING_POLICY and the overrides of every provider are known policies,
+// so that a typo cannot change how accounts are linked
+func CheckAccountLinkingPolicy() error {
+	for _, provider := range OAuthProviders {
+		switch policy := LinkingPolicy(provider.Site); policy {
+		case AutoLinkingPolicy, SeparateLinkingPolicy, PromptLinkingPolicy:
+		default:
+			return fmt.Errorf("Unknown account linking policy %q for %s, it must be %s, %s or %s", policy, provider.Site, AutoLinkingPolicy, SeparateLinkingPolicy, PromptLinkingPolicy)
+		}
+	}
+
+	return nil
+}
+
+const userColumns = "id, identifier, user_name, email, provider, email_verified, tenant"
+
+// findUser looks up the account a login belongs to.
+// The provider ID is matched first. Otherwise the user is linked by email, which is only done for verified emails
+// since anybody can claim an unverified one. Users of another provider are linked according to LinkingPolicy.
+// A nil user means that a new user has to be created. The queries are bound to ctx.
+func (router *ServiceRouter) findUser(ctx context.Context, userInfo *User, site string) (*models.UserAccount, error) {
+	var userData models.UserAccount
+
+	err := router.DB.GetContext(ctx, &userData, "SELECT "+userColumns+" FROM users WHERE provider = $1 AND identifier = $2", site, userInfo.ID)
+	if err == nil {
+		return &userData, nil
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	// Users created before the provider was stored are backfilled once their ID is confirmed
+	err = router.DB.GetContext(ctx, &userData, "SELECT "+userColumns+" FROM users WHERE provider IS NULL AND identifier = $1 AND "+utils.EmailCondition("$2"), userInfo.ID, userInfo.Email)
+	if err == nil {
+		_, err = router.DB.ExecContext(ctx, "UPDATE users SET provider = $1 WHERE id = $2", site, userData.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		userData.Provider = sql.NullString{String: site, Valid: true}
+		return &userData, nil
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	err = router.DB.GetContext(ctx, &userData, "SELECT "+userColumns+" FROM users WHERE "+utils.EmailCondition("$1")+" AND (email_verified OR identifier = '') ORDER BY provider IS NOT DISTINCT FROM $2 DESC, id LIMIT 1", userInfo.Email, site)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	// An unverified email is never linked. Only the separate setting gives the login a user of its own, so that an
+	// unknown setting fails closed.
+	if !userInfo.EmailVerified {
+		if viper.GetString("UNVERIFIED_EMAIL_COLLISION") == SeparateUnverifiedCollision {
+			router.Logger.Warn().Int64("User ID", userData.ID).Str("provider", site).Str("identifier", userInfo.ID).Msg("Unverified email matches an existing user, creating a separate user")
+			return nil, nil
+		}
+
+		router.Logger.Warn().Int64("User ID", userData.ID).Str("provider", site).Str("identifier", userInfo.ID).Msg("Unverified email matches an existing user")
+		return nil, ErrUnverifiedEmailCollision
+	}
+
+	if isPreProvisioned(&userData) {
+		err = router.linkPreProvisionedUser(ctx, &userData, userInfo, site)
+	} else if userData.Provider.String == site || !userData.Provider.Valid {
+		err = router.reconcileProviderID(ctx, &userData, userInfo, site)
+	} else {
+		// Only the auto policy links and only the separate policy creates a user, so that an unknown policy fails closed
+		switch policy := LinkingPolicy(site); {
+		case policy == SeparateLinkingPolicy:
+			router.Logger.Info().Int64("User ID", userData.ID).Str("provider", site).Str("linked provider", userData.Provider.String).Msg("Email matches a user of another provider, creating a separate user")
+			return nil, nil
+		case policy != AutoLinkingPolicy:
+			router.Logger.Info().Int64("User ID", userData.ID).Str("provider", site).Str("linked provider", userData.Provider.String).Msg("Email matches a user of another provider, asking the user to sign in with it")
+			return nil, fmt.Errorf("%w, please sign in with %s", ErrAccountLinkRequired, userData.Provider.String)
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &userData, nil
+}
+
+// isGrandfathered reports whether a login which failed the allow list belongs to an existing user who is let in anyway.
+// With the lenient ALLOW_LIST_EXISTING_USERS policy, users keep access after their email changes to a domain which is
+// not allowed, as long as the provider ID is unchanged. Matching the email would let anybody in instead.
+// The DENY_LIST still applies to them.
+func (router *ServiceRouter) isGrandfathered(ctx context.Context, userInfo *User, site string) (bool, error) {
+	if !grandfatheringApplies(userInfo.Email) {
+		return false, nil
+	}
+
+	var exists bool
+	err := router.DB.GetContext(ctx, &exists, "SELECT EXISTS (SELECT 1 FROM users WHERE provider = $1 AND identifier = $2)", site, userInfo.ID)
+	return exists, err
+}
+
+// isGrandfatheredEmail is isGrandfathered for an email instead of a provider identity, reporting whether a user
+// who already signed in has the email
+func isGrandfatheredEmail(db *models.Database, email string) (bool, error) {
+	if !grandfatheringApplies(email) {
+		return false, nil
+	}
+
+	var exists bool
+	err := db.Get(&exists, "SELECT EXISTS (SELECT 1 FROM users WHERE email = $1 AND identifier <> '')", email)
+	return exists, err
+}
+
+// grandfatheringApplies reports whether existing users with the email are let in when the allow list does not match
+// it, which is only the case under the lenient ALLOW_LIST_EXISTING_USERS policy and never for a denied email
+func grandfatheringApplies(email string) bool {
+	return viper.GetString("ALLOW_LIST_EXISTING_USERS") == LenientAllowListPolicy && !IsDenied(email)
+}
+
+// isPreProvisioned reports whether the user was created by an admin and has not logged in yet
+func isPreProvisioned(userData *models.UserAccount) bool {
+	return userData.Identifier == ""
+}
+
+// linkPreProvisionedUser attaches the provider ID to a user created by BatchCreateUsers on their first login
+func (router *ServiceRouter) linkPreProvisionedUser(ctx context.Context, userData *models.UserAccount, userInfo *User, site string) error {
+	userName := userData.UserName
+	if !userName.Valid && userInfo.Name != "" {
+		userName = sql.NullString{String: userInfo.Name, Valid: true}
+	}
+
+	_, err := router.DB.ExecContext(ctx, "UPDATE users SET identifier = $1, provider = $2, user_name = $3, email_verified = true WHERE id = $4 AND identifier = ''", userInfo.ID, site, userName, userData.ID)
+	if err != nil {
+		return err
+	}
+
+	router.Logger.Info().Int64("User ID", userData.ID).Str("provider", site).Str("identifier", userInfo.ID).Msg("Linked pre-provisioned user on first login")
+	userData.Identifier = userInfo.ID
+	userData.Provider = sql.NullString{String: site, Valid: true}
+	userData.UserName = userName
+	userData.EmailVerified = true
+	return nil
+}
+
+// reconcileProviderID handles an existing user whose provider now returns a different ID for the same email.
+// This happens when the identity provider migrates its users. When REASSOCIATE_PROVIDER_ID is enabled and the
+// email is verified, the stored ID is replaced so that the account keeps working with the new ID. Otherwise the
+// login is refused with ErrProviderIDChanged, since the new ID may belong to somebody else who was given the email.
+func (router *ServiceRouter) reconcileProviderID(ctx context.Context, userData *models.UserAccount, userInfo *User, site string) error {
+	if userData.Provider.String != site || userData.Identifier == userInfo.ID {
+		return nil
+	}
+
+	if !viper.GetBool("REASSOCIATE_PROVIDER_ID") || !userInfo.EmailVerified {
+		router.Logger.Warn().Int64("User ID", userData.ID).Str("provider", site).Str("stored identifier", userData.Identifier).Str("identifier", userInfo.ID).Msg("Provider returned a different ID for an existing email")
+		return ErrProviderIDChanged
+	}
+
+	_, err := router.DB.ExecContext(ctx, "UPDATE users SET identifier = $1 WHERE id = $2", userInfo.ID, userData.ID)
+	if err != nil {
+		return err
+	}
+
+	router.Logger.Info().Int64("User ID", userData.ID).Str("provider", site).Str("old identifier", userData.Identifier).Str("identifier", userInfo.ID).Msg("Re-associated user with new provider ID")
+	userData.Identifier = userInfo.ID
+	return nil
+}
@@ -0,0 +1,329 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/samyak-jain/agora_backend/pkg/models/dbtest"
+	"github.com/samyak-jain/agora_backend/utils"
+	"github.com/spf13/viper"
+)
+
+var userColumnNames = []string{"id", "identifier", "user_name", "email", "provider", "email_verified", "tenant"}
+
+// testRouter returns a router on a scripted database
+func testRouter(t *testing.T) (*ServiceRouter, *dbtest.Mock) {
+	logger := zerolog.Nop()
+	db, mock := dbtest.New(t)
+	return &ServiceRouter{DB: db, Logger: &utils.Logger{Logger: &logger}}, mock
+}
+
+// expectNoProviderMatch expects the lookups of findUser by provider ID to find nothing
+func expectNoProviderMatch(mock *dbtest.Mock, site string, identifier string) {
+	mock.ExpectQuery(`FROM users WHERE provider = \$1 AND identifier = \$2`).WithArgs(site, identifier)
+	mock.ExpectQuery(`FROM users WHERE provider IS NULL AND identifier = \$1`)
+}
+
+func TestCheckAccountLinkingPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   string
+		override string
+		wantErr  bool
+	}{
+		{name: "auto", policy: AutoLinkingPolicy, wantErr: false},
+		{name: "prompt", policy: PromptLinkingPolicy, wantErr: false},
+		{name: "separate", policy: SeparateLinkingPolicy, wantErr: false},
+		{name: "unknown", policy: "automatic", wantErr: true},
+		{name: "empty", policy: "", wantErr: true},
+		{name: "valid override", policy: AutoLinkingPolicy, override: PromptLinkingPolicy, wantErr: false},
+		{name: "separate override", policy: AutoLinkingPolicy, override: SeparateLinkingPolicy, wantErr: false},
+		{name: "unknown override", policy: AutoLinkingPolicy, override: "never", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("ACCOUNT_LINKING_POLICY", tt.policy)
+			viper.Set("APPLE_ACCOUNT_LINKING_POLICY", tt.override)
+			defer viper.Set("ACCOUNT_LINKING_POLICY", AutoLinkingPolicy)
+			defer viper.Set("APPLE_ACCOUNT_LINKING_POLICY", "")
+
+			if err := CheckAccountLinkingPolicy(); (err != nil) != tt.wantErr {
+				t.Errorf("CheckAccountLinkingPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFindUserUnverifiedEmailCollision(t *testing.T) {
+	// The verified login has a new provider ID, which is only linked when it can be re-associated
+	viper.Set("REASSOCIATE_PROVIDER_ID", true)
+	defer viper.Set("REASSOCIATE_PROVIDER_ID", false)
+	defer viper.Set("UNVERIFIED_EMAIL_COLLISION", RejectUnverifiedCollision)
+
+	tests := []struct {
+		name      string
+		collision string
+		verified  bool
+		wantUser  bool
+		wantErr   error
+	}{
+		{name: "verified email links", collision: RejectUnverifiedCollision, verified: true, wantUser: true},
+		{name: "unverified collision rejected", collision: RejectUnverifiedCollision, verified: false, wantErr: ErrUnverifiedEmailCollision},
+		{name: "unverified collision gets a separate user", collision: SeparateUnverifiedCollision, verified: false, wantUser: false},
+		{name: "unknown setting rejects", collision: "link", verified: false, wantErr: ErrUnverifiedEmailCollision},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("UNVERIFIED_EMAIL_COLLISION", tt.collision)
+			router, mock := testRouter(t)
+
+			expectNoProviderMatch(mock, "google", "new-id")
+			mock.ExpectQuery(`FROM users WHERE .*email.* AND \(email_verified OR identifier = ''\)`).WithArgs("user@example.com", "google").
+				WillReturnRows(userColumnNames, []interface{}{1, "old-id", "User", "user@example.com", "google", true, nil})
+			if tt.verified {
+				mock.ExpectExec(`UPDATE users SET identifier = \$1 WHERE id = \$2`).WithArgs("new-id", 1)
+			}
+
+			userData, err := router.findUser(context.Background(), &User{ID: "new-id", Email: "user@example.com", EmailVerified: tt.verified}, "google")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("findUser() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if (userData != nil) != tt.wantUser {
+				t.Errorf("findUser() = %+v, want the existing user %v", userData, tt.wantUser)
+			}
+		})
+	}
+}
+
+func TestFindUserLinkingPolicy(t *testing.T) {
+	defer viper.Set("ACCOUNT_LINKING_POLICY", AutoLinkingPolicy)
+
+	tests := []struct {
+		name       string
+		policy     string
+		wantUserID int64
+		wantErr    error
+	}{
+		{name: "auto links to the existing user", policy: AutoLinkingPolicy, wantUserID: 1},
+		{name: "separate creates another user", policy: SeparateLinkingPolicy, wantUserID: 0},
+		{name: "prompt asks for the other provider", policy: PromptLinkingPolicy, wantErr: ErrAccountLinkRequired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("ACCOUNT_LINKING_POLICY", tt.policy)
+			router, mock := testRouter(t)
+
+			// The same verified email signs in with microsoft after signing in with google
+			expectNoProviderMatch(mock, "microsoft", "microsoft-id")
+			mock.ExpectQuery(`FROM users WHERE .*email.* AND \(email_verified OR identifier = ''\)`).WithArgs("user@example.com", "microsoft").
+				WillReturnRows(userColumnNames, []interface{}{1, "google-id", "User", "user@example.com", "google", true, nil})
+
+			userData, err := router.findUser(context.Background(), &User{ID: "microsoft-id", Email: "user@example.com", EmailVerified: true}, "microsoft")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("findUser() error = %v, want %v", err, tt.wantErr)
+			}
+
+			var userID int64
+			if userData != nil {
+				userID = userData.ID
+			}
+
+			if userID != tt.wantUserID {
+				t.Errorf("findUser() user = %d, want %d", userID, tt.wantUserID)
+			}
+		})
+	}
+}
+
+func TestFindUserReassociateProviderID(t *testing.T) {
+	defer viper.Set("REASSOCIATE_PROVIDER_ID", false)
+
+	tests := []struct {
+		name           string
+		reassociate    bool
+		wantIdentifier string
+		wantErr        error
+	}{
+		{name: "new ID is re-associated", reassociate: true, wantIdentifier: "new-id"},
+		{name: "new ID is refused", reassociate: false, wantErr: ErrProviderIDChanged},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("REASSOCIATE_PROVIDER_ID", tt.reassociate)
+			router, mock := testRouter(t)
+
+			expectNoProviderMatch(mock, "google", "new-id")
+			mock.ExpectQuery(`FROM users WHERE .*email.* AND \(email_verified OR identifier = ''\)`).WithArgs("user@example.com", "google").
+				WillReturnRows(userColumnNames, []interface{}{1, "old-id", "User", "user@example.com", "google", true, nil})
+			if tt.reassociate {
+				mock.ExpectExec(`UPDATE users SET identifier = \$1 WHERE id = \$2`).WithArgs("new-id", 1)
+			}
+
+			userData, err := router.findUser(context.Background(), &User{ID: "new-id", Email: "user@example.com", EmailVerified: true}, "google")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("findUser() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr == nil && userData.Identifier != tt.wantIdentifier {
+				t.Errorf("findUser() identifier = %q, want %q", userData.Identifier, tt.wantIdentifier)
+			}
+		})
+	}
+}
+
+func TestFindUserPreProvisioned(t *testing.T) {
+	defer viper.Set("UNVERIFIED_EMAIL_COLLISION", RejectUnverifiedCollision)
+
+	tests := []struct {
+		name         string
+		userName     interface{}
+		verified     bool
+		wantUserName string
+		wantErr      error
+	}{
+		{name: "first login links the provider ID", userName: nil, verified: true, wantUserName: "Provider Name"},
+		{name: "name given by the admin is kept", userName: "Admin Name", verified: true, wantUserName: "Admin Name"},
+		{name: "unverified login is not linked", userName: nil, verified: false, wantErr: ErrUnverifiedEmailCollision},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("UNVERIFIED_EMAIL_COLLISION", RejectUnverifiedCollision)
+			router, mock := testRouter(t)
+
+			// BatchCreateUsers stored the user without a provider ID
+			expectNoProviderMatch(mock, "google", "google-id")
+			mock.ExpectQuery(`FROM users WHERE .*email.* AND \(email_verified OR identifier = ''\)`).WithArgs("user@example.com", "google").
+				WillReturnRows(userColumnNames, []interface{}{4, "", tt.userName, "user@example.com", nil, false, nil})
+			if tt.wantErr == nil {
+				mock.ExpectExec(`UPDATE users SET identifier = \$1, provider = \$2, user_name = \$3, email_verified = true WHERE id = \$4 AND identifier = ''`).
+					WithArgs("google-id", "google", tt.wantUserName, 4)
+			}
+
+			userInfo := &User{ID: "google-id", Name: "Provider Name", Email: "user@example.com", EmailVerified: tt.verified}
+			userData, err := router.findUser(context.Background(), userInfo, "google")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("findUser() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr != nil {
+				return
+			}
+
+			if userData.ID != 4 || userData.Identifier != "google-id" || userData.Provider.String != "google" || userData.UserName.String != tt.wantUserName || !userData.EmailVerified {
+				t.Errorf("findUser() = %+v, want the pre-provisioned user linked to google-id", userData)
+			}
+		})
+	}
+}
+
+func TestFindUserEmailCase(t *testing.T) {
+	defer viper.Set("CASE_INSENSITIVE_EMAIL", false)
+	defer viper.Set("REASSOCIATE_PROVIDER_ID", false)
+
+	tests := []struct {
+		name            string
+		caseInsensitive bool
+		wantUserID      int64
+	}{
+		{name: "differently cased email links", caseInsensitive: true, wantUserID: 1},
+		{name: "case sensitive emails are separate users", caseInsensitive: false, wantUserID: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("CASE_INSENSITIVE_EMAIL", tt.caseInsensitive)
+			viper.Set("REASSOCIATE_PROVIDER_ID", true)
+			router, mock := testRouter(t)
+
+			// john@example.com signed in before, the provider now reports John@Example.com with a new ID
+			expectNoProviderMatch(mock, "google", "new-id")
+			if tt.caseInsensitive {
+				mock.ExpectQuery(`FROM users WHERE lower\(email\) = lower\(\$1\) AND \(email_verified OR identifier = ''\)`).WithArgs("John@Example.com", "google").
+					WillReturnRows(userColumnNames, []interface{}{1, "old-id", "John", "john@example.com", "google", true, nil})
+				mock.ExpectExec(`UPDATE users SET identifier = \$1 WHERE id = \$2`).WithArgs("new-id", 1)
+			} else {
+				mock.ExpectQuery(`FROM users WHERE email = \$1 AND \(email_verified OR identifier = ''\)`).WithArgs("John@Example.com", "google")
+			}
+
+			userData, err := router.findUser(context.Background(), &User{ID: "new-id", Email: "John@Example.com", EmailVerified: true}, "google")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var userID int64
+			if userData != nil {
+				userID = userData.ID
+			}
+
+			if userID != tt.wantUserID {
+				t.Errorf("findUser() user = %d, want %d", userID, tt.wantUserID)
+			}
+		})
+	}
+}
+
+func TestAllowListExistingUsers(t *testing.T) {
+	defer viper.Set("ALLOW_LIST_EXISTING_USERS", StrictAllowListPolicy)
+	defer viper.Set("DENY_LIST", []string{})
+
+	// The user signed in while at example.com, and the provider now reports an email at other.org for the same ID
+	entries := func() ([]string, error) { return []string{"*@example.com"}, nil }
+
+	tests := []struct {
+		name        string
+		policy      string
+		existing    bool
+		deny        []string
+		wantQuery   bool
+		wantAllowed bool
+	}{
+		{name: "strict re-checks existing users", policy: StrictAllowListPolicy, existing: true, wantAllowed: false},
+		{name: "lenient lets existing users in", policy: LenientAllowListPolicy, existing: true, wantQuery: true, wantAllowed: true},
+		{name: "lenient still rejects new users", policy: LenientAllowListPolicy, existing: false, wantQuery: true, wantAllowed: false},
+		{name: "lenient still applies the deny list", policy: LenientAllowListPolicy, existing: true, deny: []string{"*@other.org"}, wantAllowed: false},
+		{name: "unknown policy is strict", policy: "grandfather", existing: true, wantAllowed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("ALLOW_LIST_EXISTING_USERS", tt.policy)
+			viper.Set("DENY_LIST", tt.deny)
+			router, mock := testRouter(t)
+
+			if tt.wantQuery {
+				mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM users WHERE provider = \$1 AND identifier = \$2\)`).WithArgs("google", "google-id").
+					WillReturnRows([]string{"exists"}, []interface{}{tt.existing})
+			}
+
+			userInfo := &User{ID: "google-id", Email: "user@other.org", EmailVerified: true}
+			decision, err := decideLogin(router.Logger, entries, userInfo.Email, false, func() (bool, error) {
+				return router.isGrandfathered(context.Background(), userInfo, "google")
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if decision.Allowed != tt.wantAllowed || decision.Grandfathered != tt.wantAllowed {
+				t.Errorf("decideLogin() = %+v, want allowed and grandfathered %v", decision, tt.wantAllowed)
+			}
+		})
+	}
+}
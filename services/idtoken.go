@@ -0,0 +1,117 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/coreos/go-oidc"
+	"golang.org/x/oauth2"
+)
+
+// ErrInvalidIDToken is returned when the id_token fails signature, issuer, audience, expiry or nonce validation
+var ErrInvalidIDToken = errors.New("Could not verify id_token")
+
+const microsoftKeysURL = "https://login.microsoftonline.com/common/discovery/v2.0/keys"
+
+var (
+	oidcProvidersMutex sync.Mutex
+	oidcProviders      = map[string]*oidc.Provider{}
+
+	microsoftKeySetOnce sync.Once
+	microsoftKeySet     oidc.KeySet
+)
+
+// getOIDCProvider returns a cached provider for the issuer so that its discovery document and JWKS are fetched only once
+func getOIDCProvider(ctx context.Context, issuer string) (*oidc.Provider, error) {
+	oidcProvidersMutex.Lock()
+	defer oidcProvidersMutex.Unlock()
+
+	if provider, ok := oidcProviders[issuer]; ok {
+		return provider, nil
+	}
+
+	provider, err := oidc.NewProvider(ctx, issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	oidcProviders[issuer] = provider
+	return provider, nil
+}
+
+// microsoftVerifier verifies id_tokens issued through the multi-tenant "common" endpoint.
+// The issuer contains the tenant of the user, so it is checked separately by verifyMicrosoftIssuer.
+func microsoftVerifier(config *oidc.Config) *oidc.IDTokenVerifier {
+	microsoftKeySetOnce.Do(func() {
+		microsoftKeySet = oidc.NewRemoteKeySet(context.Background(), microsoftKeysURL)
+	})
+
+	config.SkipIssuerCheck = true
+	return oidc.NewVerifier("", microsoftKeySet, config)
+}
+
+func verifyMicrosoftIssuer(idToken *oidc.IDToken) error {
+	var claims struct {
+		TenantID string `json:"tid"`
+	}
+
+	if err := idToken.Claims(&claims); err != nil {
+		return err
+	}
+
+	if claims.TenantID == "" || idToken.Issuer != "https://login.microsoftonline.com/"+claims.TenantID+"/v2.0" {
+		return errors.New("id_token issuer does not match tenant")
+	}
+
+	return nil
+}
+
+// verifyIDToken validates the id_token returned alongside the access token.
+// The verifier checks the signature, issuer, audience and expiry, while the nonce and at_hash are checked here. The
+// nonce must have been issued by issueNonce and is consumed, so the same id_token cannot be replayed.
+func (r *ServiceRouter) verifyIDToken(token *oauth2.Token, verifier *oidc.IDTokenVerifier, nonce string) (*oidc.IDToken, error) {
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		r.Logger.Error().Msg("No id_token in OAuth Response")
+		return nil, ErrInvalidIDToken
+	}
+
+	idToken, err := verifier.Verify(context.Background(), rawIDToken)
+	if err != nil {
+		r.Logger.Error().Err(err).Msg("Could not verify id_token")
+		return nil, ErrInvalidIDToken
+	}
+
+	if err := checkNonce(idToken.Nonce, nonce); err != nil {
+		r.Logger.Error().Err(err).Str("Sub", idToken.Subject).Msg("Could not verify id_token nonce")
+		return nil, ErrInvalidIDToken
+	}
+
+	// The nonce comes from the client, so it only proves freshness when it was issued by us and is used once
+	if nonce != "" {
+		if err := r.consumeNonce(nonce); err != nil {
+			r.Logger.Error().Err(err).Str("Sub", idToken.Subject).Msg("Could not consume id_token nonce")
+			return nil, ErrInvalidIDToken
+		}
+	}
+
+	if idToken.AccessTokenHash != "" {
+		if err := idToken.VerifyAccessToken(token.AccessToken); err != nil {
+			r.Logger.Error().Err(err).Str("Sub", idToken.Subject).Msg("id_token at_hash does not match")
+			return nil, ErrInvalidIDToken
+		}
+	}
+
+	return idToken, nil
+}
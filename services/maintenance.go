@@ -0,0 +1,78 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+// maintenanceOverride is the maintenance mode set at runtime by an admin, which takes over from MAINTENANCE_MODE.
+// It only applies to this instance, deployments with several instances toggle MAINTENANCE_MODE instead.
+var maintenanceOverride struct {
+	sync.RWMutex
+	set     bool
+	enabled bool
+	message string
+}
+
+// MaintenanceMode reports whether new logins are rejected, and the message shown to the users
+func MaintenanceMode() (bool, string) {
+	maintenanceOverride.RLock()
+	defer maintenanceOverride.RUnlock()
+
+	if maintenanceOverride.set {
+		return maintenanceOverride.enabled, maintenanceOverride.message
+	}
+
+	return viper.GetBool("MAINTENANCE_MODE"), viper.GetString("MAINTENANCE_MESSAGE")
+}
+
+// SetMaintenanceMode turns the maintenance mode of this instance on or off, keeping MAINTENANCE_MESSAGE when no
+// message is given. The mode is only held in the memory of this process, so the other instances behind the load
+// balancer keep issuing sessions and a restart goes back to MAINTENANCE_MODE. Set MAINTENANCE_MODE on every instance
+// to cover a whole deployment.
+func SetMaintenanceMode(enabled bool, message *string) {
+	maintenanceOverride.Lock()
+	defer maintenanceOverride.Unlock()
+
+	maintenanceOverride.set = true
+	maintenanceOverride.enabled = enabled
+	maintenanceOverride.message = viper.GetString("MAINTENANCE_MESSAGE")
+	if message != nil {
+		maintenanceOverride.message = *message
+	}
+}
+
+// MaintenanceError returns the error of the maintenance message while new logins are rejected, and nil otherwise.
+// With MAINTENANCE_BLOCK_TOKENS, the token endpoints pass tokens as true to be rejected as well.
+func MaintenanceError(tokens bool) error {
+	enabled, message := MaintenanceMode()
+	if !enabled || (tokens && !viper.GetBool("MAINTENANCE_BLOCK_TOKENS")) {
+		return nil
+	}
+
+	return errors.New(message)
+}
+
+// rejectForMaintenance sends 503 and returns the maintenance message as an error while in maintenance.
+// Existing sessions keep working, only the endpoints issuing new ones check it.
+func rejectForMaintenance(w http.ResponseWriter, tokens bool) error {
+	err := MaintenanceError(tokens)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	return err
+}
@@ -0,0 +1,112 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// resetMaintenanceMode drops the runtime override so that MAINTENANCE_MODE applies again
+func resetMaintenanceMode() {
+	maintenanceOverride.Lock()
+	defer maintenanceOverride.Unlock()
+
+	maintenanceOverride.set = false
+}
+
+func TestMaintenanceModeRejectsLogins(t *testing.T) {
+	viper.Set("MAINTENANCE_MESSAGE", "Back in 10 minutes")
+	defer viper.Set("MAINTENANCE_MESSAGE", "")
+	defer resetMaintenanceMode()
+
+	message := "Upgrading the database"
+	tests := []struct {
+		name        string
+		setting     bool
+		override    func()
+		wantMessage string
+	}{
+		{name: "disabled", setting: false},
+		{name: "enabled by MAINTENANCE_MODE", setting: true, wantMessage: "Back in 10 minutes"},
+		{name: "enabled at runtime", setting: false, override: func() { SetMaintenanceMode(true, &message) }, wantMessage: message},
+		{name: "disabled at runtime", setting: true, override: func() { SetMaintenanceMode(false, nil) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetMaintenanceMode()
+			viper.Set("MAINTENANCE_MODE", tt.setting)
+			defer viper.Set("MAINTENANCE_MODE", false)
+			if tt.override != nil {
+				tt.override()
+			}
+
+			router, _ := testRouter(t)
+
+			w := httptest.NewRecorder()
+			_, _, _, err := router.Handler(w, httptest.NewRequest("GET", "/oauth?code=code", nil))
+			if tt.wantMessage == "" {
+				// The login goes on and fails later on for the missing state
+				if w.Code == http.StatusServiceUnavailable {
+					t.Errorf("Handler() = %d, want the login to go on", w.Code)
+				}
+			} else if w.Code != http.StatusServiceUnavailable || err == nil || err.Error() != tt.wantMessage {
+				t.Errorf("Handler() = %d, %v, want %d with %q", w.Code, err, http.StatusServiceUnavailable, tt.wantMessage)
+			}
+
+			w = httptest.NewRecorder()
+			router.NativeLogin(w, httptest.NewRequest("POST", "/oauth/native", bytes.NewBufferString(`{"provider":"unknown"}`)))
+			if tt.wantMessage == "" {
+				if w.Code == http.StatusServiceUnavailable {
+					t.Errorf("NativeLogin() = %d, want the login to go on", w.Code)
+				}
+			} else if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), tt.wantMessage) {
+				t.Errorf("NativeLogin() = %d %q, want %d with %q", w.Code, w.Body.String(), http.StatusServiceUnavailable, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestMaintenanceErrorForTokens(t *testing.T) {
+	viper.Set("MAINTENANCE_MODE", true)
+	viper.Set("MAINTENANCE_MESSAGE", "Back soon")
+	defer viper.Set("MAINTENANCE_MODE", false)
+	defer viper.Set("MAINTENANCE_MESSAGE", "")
+	defer viper.Set("MAINTENANCE_BLOCK_TOKENS", false)
+	resetMaintenanceMode()
+
+	tests := []struct {
+		name        string
+		blockTokens bool
+		tokens      bool
+		wantErr     bool
+	}{
+		{name: "logins are rejected", blockTokens: false, tokens: false, wantErr: true},
+		{name: "existing sessions keep getting tokens", blockTokens: false, tokens: true, wantErr: false},
+		{name: "tokens are rejected with MAINTENANCE_BLOCK_TOKENS", blockTokens: true, tokens: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("MAINTENANCE_BLOCK_TOKENS", tt.blockTokens)
+
+			if err := MaintenanceError(tt.tokens); (err != nil) != tt.wantErr {
+				t.Errorf("MaintenanceError(%v) = %v, wantErr %v", tt.tokens, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/coreos/go-oidc"
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/samyak-jain/agora_backend/utils"
+	"github.com/spf13/viper"
+	"golang.org/x/oauth2"
+)
+
+// NativeLoginRequest is sent by apps which ran the OAuth flow natively and already hold the provider tokens
+type NativeLoginRequest struct {
+	Provider    string `json:"provider"`
+	AccessToken string `json:"access_token"`
+	// RefreshToken is optional, it lets the profile of the user be refreshed later like after a redirect login
+	RefreshToken string `json:"refresh_token"`
+	IDToken      string `json:"id_token"`
+	Nonce        string `json:"nonce"`
+	DeviceName   string `json:"device_name"`
+}
+
+// nativeCredentialsPrefix sets the codes of the credentials stored for native logins apart from authorization codes
+const nativeCredentialsPrefix = "native:"
+
+// NativeLoginResponse contains the bearer token issued for the user
+type NativeLoginResponse struct {
+	Token string `json:"token"`
+}
+
+// NativeLogin is a REST route which exchanges a provider id_token for a bearer token without the OAuth redirects.
+// Only the id_token proves that the user signed into one of our apps, since an access token issued to any other app
+// would also be accepted by the provider's userinfo endpoint. Slack does not issue id_tokens and is not supported.
+func (router *ServiceRouter) NativeLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := rejectForMaintenance(w, false)
+	if err != nil {
+		router.Logger.Info().Msg("Rejected native login in maintenance mode")
+		fmt.Fprint(w, err)
+		return
+	}
+
+	var request NativeLoginRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		router.Logger.Error().Err(err).Msg("Could not parse native login request")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	oauthProvider, ok := GetOAuthProvider(request.Provider)
+	if !ok || !viper.GetBool(oauthProvider.EnableKey) || request.Provider == "slack" {
+		router.Logger.Error().Str("provider", request.Provider).Msg("Native login is not supported for provider")
+		http.Error(w, "Native login is not supported for provider", http.StatusBadRequest)
+		return
+	}
+
+	if request.IDToken == "" {
+		http.Error(w, ErrInvalidIDToken.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	oauthConfig, provider, err := router.GetOAuthConfig(request.Provider, "")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	userInfo, err := router.nativeUserInfo(oauthConfig, provider, &request)
+	if err != nil {
+		http.Error(w, err.Error(), userInfoStatusCode(err))
+		return
+	}
+
+	bearerToken, err := router.login(r.Context(), w, userInfo, request.Provider, request.DeviceName)
+	if err != nil {
+		fmt.Fprint(w, err)
+		return
+	}
+
+	if code := router.storeNativeCredentials(&request); code != "" {
+		router.linkCredentials(r.Context(), code, *bearerToken)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(NativeLoginResponse{Token: *bearerToken})
+}
+
+// storeNativeCredentials stores the provider tokens of a native login like the redirect flow stores those of an
+// authorization code. There is no code, so the credentials are stored under a random one. Without a refresh token
+// nothing is stored, since the profile could not be refreshed anyway. The code is returned, or nothing when the
+// credentials were not stored.
+func (router *ServiceRouter) storeNativeCredentials(request *NativeLoginRequest) string {
+	if request.RefreshToken == "" {
+		return ""
+	}
+
+	id, err := utils.GenerateUUID()
+	if err != nil {
+		router.Logger.Error().Err(err).Msg("Could not generate credentials code")
+		return ""
+	}
+
+	code := nativeCredentialsPrefix + id
+
+	// The access token expiry is not sent, so it is taken as expired and refreshed on first use
+	_, err = router.DB.NamedExec("INSERT INTO credentials (code, access_token, refresh_token, token_type, expiry) VALUES (:code, :access_token, :refresh_token, :token_type, :expiry)", &models.Auth{
+		Code:         code,
+		AccessToken:  request.AccessToken,
+		RefreshToken: request.RefreshToken,
+		TokenType:    "Bearer",
+		Expiry:       time.Now(),
+	})
+	if err != nil {
+		router.Logger.Error().Err(err).Msg("Cannot insert credentials")
+		return ""
+	}
+
+	return code
+}
+
+// nativeUserInfo verifies the id_token of a native login and reads the user from its claims.
+// Native apps are registered with their own client IDs, so NATIVE_CLIENT_IDS are accepted as audiences as well.
+func (router *ServiceRouter) nativeUserInfo(oauthConfig *oauth2.Config, provider *oidc.Provider, request *NativeLoginRequest) (*User, error) {
+	if utils.TestModeEnabled() {
+		return testModeUser(), nil
+	}
+
+	config := &oidc.Config{SkipClientIDCheck: true}
+
+	var verifier *oidc.IDTokenVerifier
+	if request.Provider == "microsoft" {
+		verifier = microsoftVerifier(config)
+	} else {
+		verifier = provider.Verifier(config)
+	}
+
+	token := (&oauth2.Token{AccessToken: request.AccessToken, TokenType: "Bearer"}).WithExtra(map[string]interface{}{
+		"id_token": request.IDToken,
+	})
+
+	idToken, err := router.verifyIDToken(token, verifier, request.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isNativeAudience(idToken.Audience, append([]string{oauthConfig.ClientID}, viper.GetStringSlice("NATIVE_CLIENT_IDS")...)) {
+		router.Logger.Error().Strs("audience", idToken.Audience).Str("provider", request.Provider).Msg("id_token was not issued to one of our clients")
+		return nil, ErrInvalidIDToken
+	}
+
+	if request.Provider == "microsoft" {
+		if err := verifyMicrosoftIssuer(idToken); err != nil {
+			router.Logger.Error().Err(err).Str("issuer", idToken.Issuer).Msg("Could not verify id_token issuer")
+			return nil, ErrInvalidIDToken
+		}
+	}
+
+	var claims struct {
+		Name          string      `json:"given_name"`
+		Email         string      `json:"email"`
+		EmailVerified interface{} `json:"email_verified"`
+	}
+
+	if err := idToken.Claims(&claims); err != nil {
+		router.Logger.Error().Err(err).Str("Sub", idToken.Subject).Msg("Could not parse id_token claims")
+		return nil, ErrInvalidIDToken
+	}
+
+	// Providers caching the verified status may leave the email out on later logins, it is filled in from the user
+	if claims.Email == "" && !cachesEmailVerified(request.Provider) {
+		router.Logger.Error().Str("Sub", idToken.Subject).Str("provider", request.Provider).Msg("No email in id_token")
+		return nil, ErrInvalidIDToken
+	}
+
+	// Without the claim Microsoft is treated as verified like in the redirect flow, and Apple is filled in from the user
+	emailVerified, ok := parseEmailVerified(claims.EmailVerified)
+	if !ok {
+		emailVerified = request.Provider == "microsoft"
+	}
+
+	return &User{ID: idToken.Subject, Name: claims.Name, Email: claims.Email, EmailVerified: emailVerified, EmailVerifiedMissing: !ok}, nil
+}
+
+func isNativeAudience(audience []string, clientIDs []string) bool {
+	for _, aud := range audience {
+		for _, clientID := range clientIDs {
+			if clientID != "" && aud == clientID {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,77 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-oidc"
+	"github.com/spf13/viper"
+	"golang.org/x/oauth2"
+)
+
+func TestNativeUserInfo(t *testing.T) {
+	viper.Set("NATIVE_CLIENT_IDS", []string{"native-client"})
+	defer viper.Set("NATIVE_CLIENT_IDS", []string{})
+
+	server := testProvider(t, http.StatusOK)
+	provider, err := oidc.NewProvider(context.Background(), server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	tests := []struct {
+		name     string
+		audience string
+		issuer   string
+		expiry   time.Time
+		wantErr  error
+	}{
+		{name: "valid token", audience: "client", issuer: server.URL, expiry: now.Add(time.Hour)},
+		{name: "native client audience", audience: "native-client", issuer: server.URL, expiry: now.Add(time.Hour)},
+		{name: "bad audience", audience: "other-app", issuer: server.URL, expiry: now.Add(time.Hour), wantErr: ErrInvalidIDToken},
+		{name: "bad issuer", audience: "client", issuer: "https://issuer.example.com", expiry: now.Add(time.Hour), wantErr: ErrInvalidIDToken},
+		{name: "expired token", audience: "client", issuer: server.URL, expiry: now.Add(-time.Hour), wantErr: ErrInvalidIDToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, _ := testRouter(t)
+			request := &NativeLoginRequest{
+				Provider:    "google",
+				AccessToken: "access-token",
+				IDToken: signIDToken(t, map[string]interface{}{
+					"iss":            tt.issuer,
+					"aud":            tt.audience,
+					"sub":            "google-id",
+					"exp":            tt.expiry.Unix(),
+					"iat":            now.Add(-time.Minute).Unix(),
+					"email":          "user@example.com",
+					"email_verified": true,
+				}),
+			}
+
+			userInfo, err := router.nativeUserInfo(&oauth2.Config{ClientID: "client"}, provider, request)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("nativeUserInfo() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr == nil && (userInfo.ID != "google-id" || userInfo.Email != "user@example.com" || !userInfo.EmailVerified) {
+				t.Errorf("nativeUserInfo() = %+v, want the verified user of the id_token", userInfo)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/samyak-jain/agora_backend/utils"
+	"github.com/spf13/viper"
+)
+
+// ErrUnknownNonce is returned when an id_token carries a nonce which was not issued by issueNonce, expired or was
+// already used
+var ErrUnknownNonce = errors.New("Unknown or already used nonce")
+
+// NonceResponse contains a nonce for a client which starts the OAuth flow itself
+type NonceResponse struct {
+	Nonce string `json:"nonce"`
+}
+
+// issueNonce stores a new nonce for LOGIN_NONCE_TTL seconds. The id_token of the login must carry it, and it can only
+// be consumed once, so that a captured id_token cannot be replayed.
+func (router *ServiceRouter) issueNonce() (string, error) {
+	nonce, err := utils.GenerateUUID()
+	if err != nil {
+		return "", err
+	}
+
+	// Expired nonces are only ever looked up to be refused, so they are cleaned up on the way
+	_, err = router.DB.Exec("DELETE FROM login_nonces WHERE expires_at < CURRENT_TIMESTAMP")
+	if err != nil {
+		return "", err
+	}
+
+	_, err = router.DB.Exec("INSERT INTO login_nonces (nonce, expires_at) VALUES ($1, $2)", nonce, time.Now().Add(time.Duration(viper.GetInt("LOGIN_NONCE_TTL"))*time.Second))
+	if err != nil {
+		return "", err
+	}
+
+	return nonce, nil
+}
+
+// consumeNonce deletes the nonce, failing with ErrUnknownNonce when it was never issued, expired or was already used
+func (router *ServiceRouter) consumeNonce(nonce string) error {
+	var consumed []string
+	err := router.DB.Select(&consumed, "DELETE FROM login_nonces WHERE nonce = $1 AND expires_at > CURRENT_TIMESTAMP RETURNING nonce", nonce)
+	if err != nil {
+		return err
+	}
+
+	if len(consumed) == 0 {
+		return ErrUnknownNonce
+	}
+
+	return nil
+}
+
+// checkNonce compares the nonce of the id_token with the one the login was started with.
+// A login without a nonce passes unless REQUIRE_ID_TOKEN_NONCE is set.
+func checkNonce(idTokenNonce string, nonce string) error {
+	if nonce == "" {
+		if viper.GetBool("REQUIRE_ID_TOKEN_NONCE") {
+			return errors.New("No nonce passed in state")
+		}
+
+		return nil
+	}
+
+	if idTokenNonce != nonce {
+		return errors.New("id_token nonce does not match")
+	}
+
+	return nil
+}
+
+// Nonce is a REST route issuing a nonce to clients which build the authorize URL themselves or log in natively. The
+// nonce is passed to the provider and in the state or native login request, and it is consumed by the login.
+func (router *ServiceRouter) Nonce(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	nonce, err := router.issueNonce()
+	if err != nil {
+		router.Logger.Error().Err(err).Msg("Could not issue nonce")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(NonceResponse{Nonce: nonce})
+}
@@ -0,0 +1,45 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestCheckNonce(t *testing.T) {
+	tests := []struct {
+		name         string
+		required     bool
+		idTokenNonce string
+		nonce        string
+		wantErr      bool
+	}{
+		{name: "matching nonce", idTokenNonce: "abc", nonce: "abc", wantErr: false},
+		{name: "mismatched nonce", idTokenNonce: "abc", nonce: "abd", wantErr: true},
+		{name: "nonce missing from id_token", idTokenNonce: "", nonce: "abc", wantErr: true},
+		{name: "no nonce", idTokenNonce: "", nonce: "", wantErr: false},
+		{name: "no nonce when required", required: true, idTokenNonce: "abc", nonce: "", wantErr: true},
+		{name: "matching nonce when required", required: true, idTokenNonce: "abc", nonce: "abc", wantErr: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("REQUIRE_ID_TOKEN_NONCE", tt.required)
+			defer viper.Set("REQUIRE_ID_TOKEN_NONCE", false)
+
+			if err := checkNonce(tt.idTokenNonce, tt.nonce); (err != nil) != tt.wantErr {
+				t.Errorf("checkNonce() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -21,12 +21,17 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"strings"
+	"time"
 
 	"github.com/coreos/go-oidc"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/samyak-jain/agora_backend/pkg/models"
 	"github.com/samyak-jain/agora_backend/utils"
 	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/microsoft"
 	"golang.org/x/oauth2/slack"
@@ -38,12 +43,59 @@ type User struct {
 	Name          string `json:"given_name"`
 	Email         string
 	EmailVerified bool `json:"verified_email"`
+	// EmailVerifiedMissing is set when the provider did not say whether the email is verified
+	EmailVerifiedMissing bool `json:"-"`
 }
 
 // TokenTemplate is a struct that will be used to template the token into the html that will be served for Desktop and Mobile
 type TokenTemplate struct {
-	Token  string
-	Scheme string
+	Token    string
+	Scheme   string
+	RetryURL string
+	// FallbackURL is where the hybrid page sends web views which did not open the deep link after FallbackDelay ms
+	FallbackURL   string
+	FallbackDelay int
+}
+
+// hybridFallbackURL returns the URL carrying the token that hybrid apps fall back to when the deep link is not handled,
+// HYBRID_FALLBACK_URL or otherwise the redirect of the login, with the token appended to the path as for web
+func hybridFallbackURL(redirect string, token string) (string, error) {
+	fallback := viper.GetString("HYBRID_FALLBACK_URL")
+	if fallback == "" {
+		fallback = redirect
+	}
+
+	fallbackURL, err := url.Parse(fallback)
+	if err != nil {
+		return "", err
+	}
+
+	fallbackURL.Path = path.Join(fallbackURL.Path, token)
+	return fallbackURL.String(), nil
+}
+
+// writeHybridPage writes the page of the hybrid platform. Web views inside native apps get the deep link, and the web
+// redirect in case the app does not pick it up.
+func writeHybridPage(w http.ResponseWriter, redirect string, token string) {
+	fallbackURL, err := hybridFallbackURL(redirect, token)
+	if err != nil {
+		log.Error().Err(err).Str("redirect_url", redirect).Msg("Failed to parse hybrid fallback url")
+		fmt.Fprint(w, err)
+		return
+	}
+
+	t, err := template.ParseFiles("web/hybrid.html")
+	if err != nil {
+		fmt.Fprint(w, "Internal Server Error")
+		return
+	}
+
+	t.Execute(w, TokenTemplate{
+		Token:         token,
+		Scheme:        viper.GetString("SCHEME"),
+		FallbackURL:   fallbackURL,
+		FallbackDelay: viper.GetInt("HYBRID_FALLBACK_DELAY"),
+	})
 }
 
 // Details contains all the OAuth related information parsed from the request
@@ -53,12 +105,56 @@ type Details struct {
 	BackendURL  string
 	OAuthSite   string
 	Platform    string
+	Nonce       string
+	DeviceName  string
+}
+
+// MarshalZerologObject logs the details without the one-time authorization code and nonce, the code is only logged
+// as a fingerprint
+func (d *Details) MarshalZerologObject(e *zerolog.Event) {
+	if d == nil {
+		return
+	}
+
+	e.Str("code hash", utils.TokenFingerprint(d.Code)).
+		Str("redirect", d.RedirectURL).
+		Str("backend", d.BackendURL).
+		Str("site", d.OAuthSite).
+		Str("platform", d.Platform).
+		Str("device", d.DeviceName)
+}
+
+// NoDefaultOAuthSite can be set in DEFAULT_OAUTH_SITE so that clients must always pass a site. An empty
+// DEFAULT_OAUTH_SITE cannot be told apart from an unset one, which uses the built-in default.
+const NoDefaultOAuthSite = "none"
+
+// parseEmailVerified reads the email_verified claim of an id_token, which Apple sends as a "true" or "false" string
+// instead of a boolean. It reports false when the claim is missing or has another type.
+func parseEmailVerified(claim interface{}) (bool, bool) {
+	switch verified := claim.(type) {
+	case bool:
+		return verified, true
+	case string:
+		return verified == "true", verified == "true" || verified == "false"
+	}
+
+	return false, false
+}
+
+// DefaultOAuthSite returns the provider used when a client does not pass a site, or nothing when there is none
+func DefaultOAuthSite() string {
+	site := viper.GetString("DEFAULT_OAUTH_SITE")
+	if strings.EqualFold(site, NoDefaultOAuthSite) {
+		return ""
+	}
+
+	return site
 }
 
 func parseState(r *http.Request) (*Details, error) {
 	code := r.FormValue("code")
 	if len(code) <= 0 {
-		log.Error().Str("code", code).Msg("Code is empty")
+		log.Error().Msg("Code is empty")
 		return nil, errors.New("Code is empty")
 	}
 
@@ -99,12 +195,20 @@ func parseState(r *http.Request) (*Details, error) {
 	}
 
 	finalBackendURL := string(runeBackendURL)
+	if !redirectURIAllowed(finalBackendURL) {
+		log.Error().Str("backend", finalBackendURL).Msg("Backend URL is not an allowed redirect URI")
+		return nil, ErrRedirectURINotAllowed
+	}
 
 	site := parsedState.Get("site")
 
-	// Let's assume by default that we are using Google OAuth
+	// Clients which do not pass a site use DEFAULT_OAUTH_SITE, which can be set to none to require an explicit site
 	if site == "" {
-		site = "google"
+		site = DefaultOAuthSite()
+		if site == "" {
+			log.Error().Msg("Site is empty")
+			return nil, errors.New("Site is empty")
+		}
 	}
 
 	platform := parsedState.Get("platform")
@@ -120,126 +224,358 @@ func parseState(r *http.Request) (*Details, error) {
 		BackendURL:  finalBackendURL,
 		OAuthSite:   site,
 		Platform:    platform,
+		Nonce:       parsedState.Get("nonce"),
+		DeviceName:  parsedState.Get("device"),
 	}, nil
 }
 
 // Handler is the handler that will do most of the heavy lifting for OAuth
 func (router *ServiceRouter) Handler(w http.ResponseWriter, r *http.Request) (*string, *string, *string, error) {
-	err := r.ParseForm()
+	err := rejectForMaintenance(w, false)
+	if err != nil {
+		router.Logger.Info().Msg("Rejected login in maintenance mode")
+		return nil, nil, nil, err
+	}
+
+	err = r.ParseForm()
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		router.Logger.Error().Err(err).Msg("Could not parse form request")
 		return nil, nil, nil, err
 	}
 
+	ctx := r.Context()
+
+	_, span := utils.StartSpan(ctx, "oauth.parseState")
 	oauthDetails, err := parseState(r)
-	router.Logger.Debug().Interface("OAuth Details", oauthDetails).Msg("OAuth Debug Information")
+	utils.EndSpan(span, err)
+	router.Logger.Debug().Object("OAuth Details", oauthDetails).Msg("OAuth Debug Information")
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		return nil, nil, nil, err
 	}
 
+	providerAttribute := attribute.String("provider", oauthDetails.OAuthSite)
+	trace.SpanFromContext(ctx).SetAttributes(providerAttribute)
+
+	_, span = utils.StartSpan(ctx, "oauth.GetOAuthConfig", providerAttribute)
 	oauthConfig, provider, err := router.GetOAuthConfig(oauthDetails.OAuthSite, oauthDetails.BackendURL+"/oauth")
-	router.Logger.Debug().Interface("OAuth Config", oauthConfig).Interface("Provider", provider).Msg("OAuth Configuration Debug Information")
+	utils.EndSpan(span, err)
+	router.Logger.Debug().Interface("Provider", provider).Msg("OAuth Configuration Debug Information")
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return nil, nil, nil, err
 	}
 
-	userInfo, err := router.GetUserInfo(*oauthConfig, *oauthDetails, provider)
+	userInfoCtx, span := utils.StartSpan(ctx, "oauth.GetUserInfo", providerAttribute)
+	userInfo, err := router.GetUserInfo(userInfoCtx, *oauthConfig, *oauthDetails, provider)
+	utils.EndSpan(span, err)
 	router.Logger.Debug().Interface("User Info", userInfo).Msg("Debug User Information")
 	if err != nil {
+		var userInfoErr *UserInfoError
+		if errors.As(err, &userInfoErr) || errors.Is(err, ErrInvalidIDToken) || errors.Is(err, utils.ErrCircuitOpen) {
+			w.WriteHeader(userInfoStatusCode(err))
+		}
+
+		// The platform is still returned so that browsers can be sent back to start the login again
+		if errors.Is(err, ErrAuthorizationCodeExpired) {
+			return nil, nil, &oauthDetails.Platform, err
+		}
 		return nil, nil, nil, err
 	}
 
-	ok, err := router.AllowListValidator(userInfo.Email)
+	bearerToken, err := router.login(ctx, w, userInfo, oauthDetails.OAuthSite, oauthDetails.DeviceName)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		log.Error().Err(err).Str("email", userInfo.Email).Str("Sub", userInfo.ID).Interface("OAuth Details", oauthDetails).Interface("OAuth Config", oauthConfig).Msg("Email cannot be validated in Allow List")
 		return nil, nil, nil, err
 	}
 
-	if !ok {
-		w.WriteHeader(http.StatusBadRequest)
-		log.Error().Str("Email", userInfo.Email).Msg("Email not found in Allow List")
-		return nil, nil, nil, errors.New("Email not found in Allow List")
+	router.linkCredentials(ctx, oauthDetails.Code, *bearerToken)
+
+	redirect := stripRedirectParams(oauthDetails.RedirectURL)
+	return &redirect, bearerToken, &oauthDetails.Platform, nil
+}
+
+// Orders of the allow list and email verified checks of a login, set in LOGIN_CHECK_ORDER
+const (
+	AllowListFirstCheckOrder = "allow_list_first"
+	VerifiedFirstCheckOrder  = "verified_first"
+)
+
+// CheckLoginCheckOrder makes sure LOGIN_CHECK_ORDER is one of the supported orders, so that a typo does not silently
+// fall back to checking the allow list first
+func CheckLoginCheckOrder() error {
+	order := viper.GetString("LOGIN_CHECK_ORDER")
+	if order != AllowListFirstCheckOrder && order != VerifiedFirstCheckOrder {
+		return fmt.Errorf("LOGIN_CHECK_ORDER must be %s or %s, not %q", AllowListFirstCheckOrder, VerifiedFirstCheckOrder, order)
 	}
 
-	if !userInfo.EmailVerified {
-		w.WriteHeader(http.StatusBadRequest)
-		log.Error().Str("Sub", userInfo.ID).Interface("OAuth Details", oauthDetails).Interface("OAuth Config", oauthConfig).Msg("Email is not verified")
-		return nil, nil, nil, errors.New("Email is not verified")
+	return nil
+}
+
+// ErrLoginNotPermitted is returned for every login the allow list or the email verified check turns down, so that the
+// response does not tell which check failed. The reason is logged and audited instead.
+var ErrLoginNotPermitted = errors.New("This account is not permitted to log in")
+
+// ErrEmailNotAllowed is logged when logging in with an email which does not pass the allow list
+var ErrEmailNotAllowed = errors.New("Email not found in Allow List")
+
+// ErrEmailNotVerified is logged when logging in with an email the provider did not verify
+var ErrEmailNotVerified = errors.New("Email is not verified")
+
+// checkEmailVerified rejects the login when the email is not verified, unless ALLOW_UNVERIFIED_EMAIL is set
+func (router *ServiceRouter) checkEmailVerified(w http.ResponseWriter, userInfo *User, site string) error {
+	if userInfo.EmailVerified || viper.GetBool("ALLOW_UNVERIFIED_EMAIL") {
+		return nil
 	}
 
-	bearerToken, err := utils.GenerateUUID()
+	w.WriteHeader(http.StatusBadRequest)
+	log.Error().Err(ErrEmailNotVerified).Str("Sub", userInfo.ID).Str("provider", site).Msg("Login not permitted")
+	router.auditLogin(userInfo, site, models.LoginFailed, "email_unverified")
+	return ErrLoginNotPermitted
+}
+
+// login checks that the user may sign in, finds or creates the user and issues a new bearer token for them.
+// The device name labels the session, it is optional.
+func (router *ServiceRouter) login(ctx context.Context, w http.ResponseWriter, userInfo *User, site string, device string) (*string, error) {
+	providerAttribute := attribute.String("provider", site)
+	err := router.applyCachedEmailVerified(ctx, userInfo, site)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		log.Error().Err(err).Msg("Could not generate bearer token")
-		return nil, nil, nil, err
+		writeQueryErrorStatus(w, err)
+		log.Error().Err(err).Str("Sub", userInfo.ID).Str("provider", site).Msg("Could not look up cached email verified status")
+		router.auditLogin(userInfo, site, models.LoginFailed, "server_error")
+		return nil, err
+	}
+
+	name, err := utils.ValidateName(userInfo.Name)
+	if err != nil {
+		// The provider name is only a default the user can change, so an unsafe one is dropped instead of failing the login
+		log.Info().Str("Sub", userInfo.ID).Str("provider", site).Msg("Dropping provider name with unsafe characters")
+	}
+
+	userInfo.Name = name
+	userInfo.Email = utils.NormalizeEmail(userInfo.Email)
+
+	// Checking the email is verified first keeps the allow list from telling anything about unverified addresses
+	verifiedFirst := viper.GetString("LOGIN_CHECK_ORDER") == VerifiedFirstCheckOrder
+	if verifiedFirst {
+		if err := router.checkEmailVerified(w, userInfo, site); err != nil {
+			return nil, err
+		}
 	}
 
-	var userData models.UserAccount
-	err = router.DB.Get(&userData, "SELECT id, identifier, user_name, email FROM users WHERE email=$1", userInfo.Email)
+	breakGlass := IsBreakGlass(site, userInfo.ID, userInfo.Email, userInfo.EmailVerified)
+	if breakGlass {
+		log.Warn().Str("Email", userInfo.Email).Str("Sub", userInfo.ID).Str("provider", site).Msg("Break-glass account is logging in, skipping the Allow List")
+	}
 
+	_, span := utils.StartSpan(ctx, "oauth.AllowListValidator", providerAttribute)
+	decision, err := decideLogin(router.Logger, func() ([]string, error) { return MergedAllowList(router.DB) }, userInfo.Email, breakGlass, func() (bool, error) {
+		return router.isGrandfathered(ctx, userInfo, site)
+	})
+	utils.EndSpan(span, err)
 	if err != nil {
-		tx := router.DB.MustBegin()
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error().Err(err).Str("email", userInfo.Email).Str("Sub", userInfo.ID).Str("provider", site).Msg("Email cannot be validated in Allow List")
+		router.auditLogin(userInfo, site, models.LoginFailed, "server_error")
+		return nil, err
+	}
 
-		statement, err := tx.PrepareNamed("INSERT INTO users (identifier, user_name, email) VALUES (:identifier, :user_name, :email) RETURNING id")
-		if err != nil {
-			router.Logger.Error().Err(err).Str("identifier", userInfo.ID).Msg("Could not insert user")
-			tx.Rollback()
-			return nil, nil, nil, err
+	if !decision.Allowed {
+		w.WriteHeader(http.StatusBadRequest)
+		log.Error().Err(ErrEmailNotAllowed).Str("Email", userInfo.Email).Str("Sub", userInfo.ID).Str("provider", site).Msg("Login not permitted")
+		router.auditLogin(userInfo, site, models.LoginFailed, "not_allowed")
+		return nil, ErrLoginNotPermitted
+	}
+
+	if decision.Grandfathered {
+		log.Info().Str("Email", userInfo.Email).Str("Sub", userInfo.ID).Str("provider", site).Msg("Existing user let in despite email not in Allow List")
+	}
+
+	if !verifiedFirst {
+		if err := router.checkEmailVerified(w, userInfo, site); err != nil {
+			return nil, err
 		}
+	}
+
+	bearerToken, err := utils.GenerateSessionToken()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error().Err(err).Msg("Could not generate bearer token")
+		router.auditLogin(userInfo, site, models.LoginFailed, "server_error")
+		return nil, err
+	}
 
-		var userID int64
-		var userName sql.NullString
-		if userInfo.Name == "" {
-			userName = sql.NullString{Valid: false}
+	// The database work of a login shares a single DB_QUERY_TIMEOUT so that a slow or locked database fails it fast
+	dbCtx, cancel := utils.QueryContext(ctx)
+	defer cancel()
+
+	findCtx, span := utils.StartSpan(dbCtx, "db.findUser", providerAttribute)
+	userData, err := router.findUser(findCtx, userInfo, site)
+	err = utils.QueryError(dbCtx, err)
+	utils.EndSpan(span, err)
+	if err != nil {
+		if errors.Is(err, ErrUnverifiedEmailCollision) || errors.Is(err, ErrAccountLinkRequired) || errors.Is(err, ErrProviderIDChanged) {
+			w.WriteHeader(http.StatusConflict)
+			router.auditLogin(userInfo, site, models.LoginFailed, "account_conflict")
 		} else {
-			userName = sql.NullString{String: userInfo.Name, Valid: true}
+			writeQueryErrorStatus(w, err)
+			router.auditLogin(userInfo, site, models.LoginFailed, "server_error")
 		}
-		err = statement.Get(&userID, &models.UserAccount{
-			Identifier: userInfo.ID,
-			UserName:   userName,
-			Email:      userInfo.Email,
-		})
+		router.Logger.Error().Err(err).Str("identifier", userInfo.ID).Msg("Could not find user")
+		return nil, err
+	}
+
+	tenant := TenantForEmail(userInfo.Email, userInfo.EmailVerified)
+	if userData != nil {
+		tenant = userData.Tenant
+	}
+
+	tenantConfig, err := LoadTenantConfig(dbCtx, router.DB, tenant)
+	err = utils.QueryError(dbCtx, err)
+	if err != nil {
+		writeQueryErrorStatus(w, err)
+		router.Logger.Error().Err(err).Str("tenant", tenant.String).Msg("Could not load tenant config")
+		router.auditLogin(userInfo, site, models.LoginFailed, "server_error")
+		return nil, err
+	}
+
+	// A tenant can only turn off a provider, the provider still needs to be configured globally to be used at all
+	if enableKey := providerEnableKey(site); enableKey != "" && !tenantConfig.GetBool(enableKey) {
+		w.WriteHeader(http.StatusForbidden)
+		log.Error().Str("tenant", tenant.String).Str("provider", site).Msg("Provider is disabled for the tenant")
+		router.auditLogin(userInfo, site, models.LoginFailed, "provider_disabled")
+		return nil, errors.New("Provider is disabled for this tenant")
+	}
+
+	if err := utils.CheckEventNotEnded(); err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		log.Info().Str("Sub", userInfo.ID).Str("provider", site).Msg("Refusing login after the event ended")
+		router.auditLogin(userInfo, site, models.LoginFailed, "event_ended")
+		return nil, err
+	}
+
+	tokenTTL := time.Duration(utils.GetTokenTTLFrom(tenantConfig, utils.SessionTokenEndpoint, 0)) * time.Second
+	tokenExpiry := sql.NullTime{Time: time.Now().Add(tokenTTL), Valid: tokenTTL > 0}
+
+	token := &models.Token{
+		TokenID:    bearerToken,
+		ExpiresAt:  tokenExpiry,
+		Role:       RoleOf(&models.UserAccount{Email: userInfo.Email, EmailVerified: userInfo.EmailVerified, Provider: sql.NullString{String: site, Valid: true}, Identifier: userInfo.ID}),
+		DeviceName: deviceName(device),
+	}
+
+	if userData == nil {
+		createCtx, span := utils.StartSpan(dbCtx, "db.createUser", providerAttribute)
+		err = utils.QueryError(dbCtx, router.createUser(createCtx, userInfo, site, token))
+		utils.EndSpan(span, err)
 		if err != nil {
-			router.Logger.Error().Err(err).Str("identifier", userInfo.ID).Msg("Could not fetch User Database ID")
-			tx.Rollback()
-			return nil, nil, nil, err
+			writeQueryErrorStatus(w, err)
+			router.auditLogin(userInfo, site, models.LoginFailed, "server_error")
+			return nil, err
 		}
+	} else {
+		token.UserID = userData.ID
 
-		_, err = tx.NamedExec("INSERT INTO tokens (token_id, user_id) VALUES (:token_id, :user_id)", &models.Token{
-			TokenID: bearerToken,
-			UserID:  userID,
-		})
+		insertCtx, span := utils.StartSpan(dbCtx, "db.insertToken", providerAttribute)
+		err = utils.QueryError(dbCtx, router.insertSessionToken(insertCtx, token))
+		utils.EndSpan(span, err)
 
 		if err != nil {
-			router.Logger.Error().Err(err).Str("identifier", userInfo.ID).Str("token", bearerToken).Msg("Could not insert token")
-			tx.Rollback()
-			return nil, nil, nil, err
+			writeQueryErrorStatus(w, err)
+			router.Logger.Error().Err(err).Str("identifier", userInfo.ID).Str("token hash", utils.TokenFingerprint(bearerToken)).Msg("Could not insert token")
+			router.auditLogin(userInfo, site, models.LoginFailed, "server_error")
+			return nil, err
 		}
+	}
+
+	// The login already succeeded, so failing to count it only affects the usage stats
+	err = RecordUsageEvent(router.DB, &models.UsageEvent{Kind: models.LoginUsageEvent, UserID: sql.NullInt64{Int64: token.UserID, Valid: true}})
+	if err != nil {
+		router.Logger.Error().Err(err).Int64("User ID", token.UserID).Msg("Could not record login event")
+	}
 
-		tx.Commit()
+	if breakGlass {
+		log.Error().Str("Email", userInfo.Email).Str("Sub", userInfo.ID).Str("provider", site).Msg("BREAK-GLASS LOGIN: the break-glass account signed in bypassing the Allow List")
+		router.auditLogin(userInfo, site, models.LoginBreakGlass, "allow_list_bypassed")
 	} else {
+		router.auditLogin(userInfo, site, models.LoginSucceeded, "")
+	}
+	return &bearerToken, nil
+}
 
-		_, err = router.DB.NamedExec("INSERT INTO tokens (token_id, user_id) VALUES (:token_id, :user_id)", &models.Token{
-			TokenID: bearerToken,
-			UserID:  userData.ID,
-		})
+// createUser inserts a new user along with its first token and, if enabled, its default channel
+func (router *ServiceRouter) createUser(ctx context.Context, userInfo *User, site string, token *models.Token) error {
+	tx, err := router.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		router.Logger.Error().Err(err).Str("identifier", userInfo.ID).Msg("Could not begin transaction")
+		return err
+	}
+
+	statement, err := tx.PrepareNamedContext(ctx, "INSERT INTO users (identifier, user_name, email, provider, email_verified, tenant) VALUES (:identifier, :user_name, :email, :provider, :email_verified, :tenant) RETURNING id")
+	if err != nil {
+		router.Logger.Error().Err(err).Str("identifier", userInfo.ID).Msg("Could not insert user")
+		tx.Rollback()
+		return err
+	}
+
+	var userID int64
+	var userName sql.NullString
+	if userInfo.Name == "" {
+		userName = sql.NullString{Valid: false}
+	} else {
+		userName = sql.NullString{String: userInfo.Name, Valid: true}
+	}
+	err = statement.GetContext(ctx, &userID, &models.UserAccount{
+		Identifier:    userInfo.ID,
+		UserName:      userName,
+		Email:         userInfo.Email,
+		Provider:      sql.NullString{String: site, Valid: true},
+		EmailVerified: userInfo.EmailVerified,
+		Tenant:        TenantForEmail(userInfo.Email, userInfo.EmailVerified),
+	})
+	if err != nil {
+		router.Logger.Error().Err(err).Str("identifier", userInfo.ID).Msg("Could not fetch User Database ID")
+		tx.Rollback()
+		return err
+	}
+
+	token.UserID = userID
+	_, err = tx.NamedExecContext(ctx, "INSERT INTO tokens (token_id, user_id, expires_at, role, device_name) VALUES (:token_id, :user_id, :expires_at, :role, :device_name)", token)
+
+	if err != nil {
+		router.Logger.Error().Err(err).Str("identifier", userInfo.ID).Str("token hash", utils.TokenFingerprint(token.TokenID)).Msg("Could not insert token")
+		tx.Rollback()
+		return err
+	}
+
+	// The default channel is only created alongside a brand new user so that subsequent logins never repeat it
+	if viper.GetBool("CREATE_DEFAULT_CHANNEL") {
+		defaultChannel, err := GenerateChannel(viper.GetString("DEFAULT_CHANNEL_TITLE"))
+		if err != nil {
+			router.Logger.Error().Err(err).Int64("User ID", userID).Msg("Could not generate default channel")
+			tx.Rollback()
+			return err
+		}
 
+		defaultChannel.CreatorID = sql.NullInt64{Int64: userID, Valid: true}
+		err = InsertChannel(ctx, tx, defaultChannel)
 		if err != nil {
-			router.Logger.Error().Err(err).Str("identifier", userInfo.ID).Str("token", bearerToken).Msg("Could not insert token")
-			return nil, nil, nil, err
+			router.Logger.Error().Err(err).Int64("User ID", userID).Interface("channel details", defaultChannel).Msg("Could not insert default channel")
+			tx.Rollback()
+			return err
 		}
 	}
 
-	return &oauthDetails.RedirectURL, &bearerToken, &oauthDetails.Platform, nil
+	return tx.Commit()
 }
 
 // OAuth is a REST route that is called when the oauth provider redirects to here and provides the code
 func (o *ServiceRouter) OAuth(w http.ResponseWriter, r *http.Request) {
 	redirect, token, platform, err := o.Handler(w, r)
+	if errors.Is(err, ErrAuthorizationCodeExpired) && *platform == "web" && redirectSessionExpired(w, r, CodeExpiredReason) {
+		return
+	}
+
 	if err != nil || platform == nil {
 		log.Print(err)
 		fmt.Fprint(w, err)
@@ -256,10 +592,14 @@ func (o *ServiceRouter) OAuth(w http.ResponseWriter, r *http.Request) {
 
 		newURL.Path = path.Join(newURL.Path, *token)
 
-		fmt.Printf("%+v\n", newURL)
-
 		http.Redirect(w, r, newURL.String(), http.StatusSeeOther)
 	} else if *platform == "mobile" {
+		flowID, err := o.createPendingLogin(*token)
+		if err != nil {
+			// The deep link still works, it only cannot be retried
+			log.Error().Err(err).Msg("Could not store pending login")
+		}
+
 		t, err := template.ParseFiles("web/mobile.html")
 		if err != nil {
 			fmt.Fprint(w, "Internal Server Error")
@@ -267,9 +607,12 @@ func (o *ServiceRouter) OAuth(w http.ResponseWriter, r *http.Request) {
 		}
 
 		t.Execute(w, TokenTemplate{
-			Token:  *token,
-			Scheme: viper.GetString("SCHEME"),
+			Token:    *token,
+			Scheme:   viper.GetString("SCHEME"),
+			RetryURL: retryURL(flowID),
 		})
+	} else if *platform == "hybrid" {
+		writeHybridPage(w, *redirect, *token)
 	} else if *platform == "desktop" {
 		t, err := template.ParseFiles("web/desktop.html")
 		if err != nil {
@@ -283,6 +626,118 @@ func (o *ServiceRouter) OAuth(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// previewToken is rendered into the token page by TokenPagePreview in place of a real bearer token
+const previewToken = "preview-token"
+
+// tokenPagePreviewEnabled reports whether the token page preview is served. Environments have to be allowed explicitly,
+// so that a misspelled or unset ENVIRONMENT never exposes the route.
+func tokenPagePreviewEnabled() bool {
+	if !viper.GetBool("ENABLE_TOKEN_PAGE_PREVIEW") {
+		return false
+	}
+
+	environment := viper.GetString("ENVIRONMENT")
+	for _, allowed := range viper.GetStringSlice("TOKEN_PAGE_PREVIEW_ENVIRONMENTS") {
+		if allowed != "" && allowed != utils.ProductionEnvironment && allowed == environment {
+			return true
+		}
+	}
+
+	return false
+}
+
+// TokenPagePreview is a development route which renders the mobile or desktop token page with a dummy token, so that the
+// deep link can be tested without an OAuth flow. The scheme query param overrides SCHEME. It is only served when
+// ENABLE_TOKEN_PAGE_PREVIEW is set and ENVIRONMENT is one of TOKEN_PAGE_PREVIEW_ENVIRONMENTS.
+func (o *ServiceRouter) TokenPagePreview(w http.ResponseWriter, r *http.Request) {
+	if !tokenPagePreviewEnabled() {
+		http.NotFound(w, r)
+		return
+	}
+
+	platform := r.URL.Query().Get("platform")
+	if platform != "mobile" && platform != "desktop" && platform != "hybrid" {
+		http.Error(w, "Platform must be mobile, desktop or hybrid", http.StatusBadRequest)
+		return
+	}
+
+	scheme := r.URL.Query().Get("scheme")
+	if scheme == "" {
+		scheme = viper.GetString("SCHEME")
+	}
+
+	t, err := template.ParseFiles("web/" + platform + ".html")
+	if err != nil {
+		fmt.Fprint(w, "Internal Server Error")
+		return
+	}
+
+	var fallbackURL string
+	if platform == "hybrid" && viper.GetString("HYBRID_FALLBACK_URL") != "" {
+		fallbackURL, _ = hybridFallbackURL("", previewToken)
+	}
+
+	t.Execute(w, TokenTemplate{
+		Token:         previewToken,
+		Scheme:        scheme,
+		FallbackURL:   fallbackURL,
+		FallbackDelay: viper.GetInt("HYBRID_FALLBACK_DELAY"),
+	})
+}
+
+// OAuthProvider contains the static details of a supported OAuth provider
+type OAuthProvider struct {
+	Site      string
+	Name      string
+	EnableKey string
+	Scopes    []string
+	// LoginHint is set for providers which preselect the account passed as login_hint
+	LoginHint bool
+	// RequiredKeys are the settings the provider cannot be used without
+	RequiredKeys []string
+}
+
+// OAuthProviders lists every supported OAuth provider along with the scopes requested from it
+var OAuthProviders = []OAuthProvider{
+	{Site: "google", Name: "Google", EnableKey: "ENABLE_GOOGLE_OAUTH", Scopes: []string{oidc.ScopeOpenID, "profile", "email"}, LoginHint: true,
+		RequiredKeys: []string{"GOOGLE_CLIENT_ID", "GOOGLE_CLIENT_SECRET"}},
+	{Site: "microsoft", Name: "Microsoft", EnableKey: "ENABLE_MICROSOFT_OAUTH", Scopes: []string{oidc.ScopeOpenID, "profile", "email", "offline_access"}, LoginHint: true,
+		RequiredKeys: []string{"MICROSOFT_CLIENT_ID", "MICROSOFT_CLIENT_SECRET"}},
+	{Site: "slack", Name: "Slack", EnableKey: "ENABLE_SLACK_OAUTH", Scopes: []string{"users.profile:read"},
+		RequiredKeys: []string{"SLACK_CLIENT_ID", "SLACK_CLIENT_SECRET"}},
+	{Site: "apple", Name: "Apple", EnableKey: "ENABLE_APPLE_OAUTH", Scopes: []string{oidc.ScopeOpenID, "profile", "email"},
+		RequiredKeys: []string{"APPLE_CLIENT_ID", "APPLE_PRIVATE_KEY", "APPLE_TEAM_ID", "APPLE_KEY_ID"}},
+}
+
+// GetOAuthProvider finds the supported OAuth provider for the site
+func GetOAuthProvider(site string) (*OAuthProvider, bool) {
+	for index := range OAuthProviders {
+		if OAuthProviders[index].Site == site {
+			return &OAuthProviders[index], true
+		}
+	}
+
+	return nil, false
+}
+
+// EnabledProviders returns the display name and requested scopes of every enabled OAuth provider
+func EnabledProviders() []*models.ProviderInfo {
+	enabled := []*models.ProviderInfo{}
+	for _, provider := range OAuthProviders {
+		if !viper.GetBool(provider.EnableKey) {
+			continue
+		}
+
+		enabled = append(enabled, &models.ProviderInfo{
+			Site:   provider.Site,
+			Name:   provider.Name,
+			Scopes: append([]string{}, provider.Scopes...),
+		})
+	}
+
+	return enabled
+}
+
 // GetOAuthConfig makes the oauth2 config for the relevant site
 func (r *ServiceRouter) GetOAuthConfig(site string, redirectURI string) (*oauth2.Config, *oidc.Provider, error) {
 	var provider *oidc.Provider
@@ -293,9 +748,20 @@ func (r *ServiceRouter) GetOAuthConfig(site string, redirectURI string) (*oauth2
 	var client_id string
 	var client_secret string
 
+	oauthProvider, ok := GetOAuthProvider(site)
+	if !ok {
+		r.Logger.Error().Msg("Unknown state parameter passed")
+		return nil, nil, errors.New("Unknow state parameter passed")
+	}
+
+	// The provider is never contacted in test mode, so there is nothing to discover
+	if utils.TestModeEnabled() {
+		return &oauth2.Config{ClientID: "test", Scopes: oauthProvider.Scopes, RedirectURL: redirectURI}, nil, nil
+	}
+
 	switch site {
 	case "google":
-		provider, err = oidc.NewProvider(ctx, "https://accounts.google.com")
+		provider, err = getOIDCProvider(ctx, "https://accounts.google.com")
 		client_id = viper.GetString("GOOGLE_CLIENT_ID")
 		client_secret = viper.GetString("GOOGLE_CLIENT_SECRET")
 		if err != nil {
@@ -306,7 +772,7 @@ func (r *ServiceRouter) GetOAuthConfig(site string, redirectURI string) (*oauth2
 		return &oauth2.Config{
 			ClientID:     viper.GetString("MICROSOFT_CLIENT_ID"),
 			ClientSecret: viper.GetString("MICROSOFT_CLIENT_SECRET"),
-			Scopes:       []string{oidc.ScopeOpenID, "profile", "email", "offline_access"},
+			Scopes:       oauthProvider.Scopes,
 			Endpoint:     microsoft.AzureADEndpoint("common"),
 			RedirectURL:  redirectURI,
 		}, nil, nil
@@ -314,12 +780,12 @@ func (r *ServiceRouter) GetOAuthConfig(site string, redirectURI string) (*oauth2
 		return &oauth2.Config{
 			ClientID:     viper.GetString("SLACK_CLIENT_ID"),
 			ClientSecret: viper.GetString("SLACK_CLIENT_SECRET"),
-			Scopes:       []string{"users.profile:read"},
+			Scopes:       oauthProvider.Scopes,
 			Endpoint:     slack.Endpoint,
 			RedirectURL:  redirectURI,
 		}, nil, nil
 	case "apple":
-		provider, err = oidc.NewProvider(ctx, "https://appleid.apple.com")
+		provider, err = getOIDCProvider(ctx, "https://appleid.apple.com")
 		if err != nil {
 			r.Logger.Error().Err(err).Msg("Apple Provider failed")
 			return nil, nil, err
@@ -344,24 +810,91 @@ func (r *ServiceRouter) GetOAuthConfig(site string, redirectURI string) (*oauth2
 	return &oauth2.Config{
 		ClientID:     client_id,
 		ClientSecret: client_secret,
-		Scopes:       []string{oidc.ScopeOpenID, "profile", "email"},
+		Scopes:       oauthProvider.Scopes,
 		Endpoint:     provider.Endpoint(),
 		RedirectURL:  redirectURI,
 	}, provider, nil
 }
 
+// ErrUnsupportedTokenType is returned for a provider token whose token_type is not Bearer under OAUTH_STRICT_TOKEN_TYPE
+var ErrUnsupportedTokenType = errors.New("Provider issued an unsupported token type")
+
+// normalizeTokenType makes the userinfo requests authenticate with a Bearer token even when the provider omitted the
+// token_type or sent an odd one, which would otherwise end up verbatim in the Authorization header.
+// With OAUTH_STRICT_TOKEN_TYPE, token types other than Bearer are rejected instead, a missing one is still defaulted.
+func (r *ServiceRouter) normalizeTokenType(token *oauth2.Token, site string) error {
+	if strings.EqualFold(strings.TrimSpace(token.TokenType), "bearer") {
+		token.TokenType = "Bearer"
+		return nil
+	}
+
+	if token.TokenType != "" && viper.GetBool("OAUTH_STRICT_TOKEN_TYPE") {
+		r.Logger.Error().Str("provider", site).Str("token_type", token.TokenType).Msg("Provider issued an unsupported token type")
+		return ErrUnsupportedTokenType
+	}
+
+	r.Logger.Warn().Str("provider", site).Str("token_type", token.TokenType).Msg("Provider token type is missing or unexpected, using Bearer")
+	token.TokenType = "Bearer"
+	return nil
+}
+
+// refreshedCredentials returns the credentials to store for the code once its token was refreshed, or nil when the
+// refresh kept the tokens. Providers which rotate refresh tokens invalidate the stored one, so the refresh token and
+// expiry are stored along with the access token.
+func refreshedCredentials(code string, token *oauth2.Token, newToken *oauth2.Token) *models.Auth {
+	if newToken.AccessToken == token.AccessToken && newToken.RefreshToken == token.RefreshToken {
+		return nil
+	}
+
+	return &models.Auth{
+		Code:         code,
+		AccessToken:  newToken.AccessToken,
+		RefreshToken: newToken.RefreshToken,
+		TokenType:    newToken.TokenType,
+		Expiry:       newToken.Expiry,
+	}
+}
+
 // GetUserInfo fetches the User Info from the Open ID Endpoint
-func (r *ServiceRouter) GetUserInfo(oauthConfig oauth2.Config, oauthDetails Details, provider *oidc.Provider) (*User, error) {
+func (r *ServiceRouter) GetUserInfo(ctx context.Context, oauthConfig oauth2.Config, oauthDetails Details, provider *oidc.Provider) (*User, error) {
 
 	var tokenData models.Auth
 	var token *oauth2.Token
+
+	if utils.TestModeEnabled() {
+		return testModeUser(), nil
+	}
+
+	// The id_token is only part of the initial code exchange, so it is only verified when we perform that exchange
+	verifyIDToken := false
+
+	// Every request to the provider goes through its circuit breaker, and nothing is attempted while it is open
+	circuit := "oauth:" + oauthDetails.OAuthSite
+	if err := utils.GetCircuitBreaker(circuit).Check(); err != nil {
+		r.Logger.Error().Err(err).Str("provider", oauthDetails.OAuthSite).Msg("Provider circuit breaker is open")
+		return nil, err
+	}
+
+	providerClient := utils.BreakerClient(circuit)
+	ctx = oidc.ClientContext(ctx, providerClient)
+
 	err := r.DB.Get(&tokenData, "SELECT id, code, access_token, refresh_token, token_type, expiry FROM credentials WHERE code=$1", oauthDetails.Code)
 	if err != nil {
 		r.Logger.Debug().Msg("Code not found in database")
 
-		token, err = oauthConfig.Exchange(oauth2.NoContext, oauthDetails.Code)
+		exchangeCtx, span := utils.StartSpan(ctx, "oauth.Exchange", attribute.String("provider", oauthDetails.OAuthSite))
+		token, err = oauthConfig.Exchange(exchangeCtx, oauthDetails.Code)
+		utils.EndSpan(span, err)
+		if err != nil {
+			r.Logger.Error().Err(err).Object("OAuth Details", &oauthDetails).Str("client", oauthConfig.ClientID).Msg("OAuth Token Exchange failed")
+			if isInvalidGrant(err) {
+				return nil, fmt.Errorf("%w: %v", ErrAuthorizationCodeExpired, err)
+			}
+			return nil, err
+		}
+
+		err = r.normalizeTokenType(token, oauthDetails.OAuthSite)
 		if err != nil {
-			r.Logger.Error().Err(err).Interface("OAuth Details", oauthDetails).Interface("config", oauthConfig).Msg("OAuth Token Exchange failed")
 			return nil, err
 		}
 
@@ -375,23 +908,37 @@ func (r *ServiceRouter) GetUserInfo(oauthConfig oauth2.Config, oauthDetails Deta
 		if err != nil {
 			r.Logger.Error().Err(err).Msg("Cannot insert credentials")
 		}
+
+		verifyIDToken = viper.GetBool("VERIFY_ID_TOKEN")
 	} else {
-		token.AccessToken = tokenData.AccessToken
-		token.RefreshToken = tokenData.RefreshToken
-		token.Expiry = tokenData.Expiry
-		token.TokenType = tokenData.TokenType
+		token = &oauth2.Token{
+			AccessToken:  tokenData.AccessToken,
+			RefreshToken: tokenData.RefreshToken,
+			Expiry:       tokenData.Expiry,
+			TokenType:    tokenData.TokenType,
+		}
 
-		tokenSource := oauthConfig.TokenSource(oauth2.NoContext, token)
+		refreshCtx, span := utils.StartSpan(ctx, "oauth.RefreshToken", attribute.String("provider", oauthDetails.OAuthSite))
+		tokenSource := oauthConfig.TokenSource(refreshCtx, token)
 		newToken, err := tokenSource.Token()
+		utils.EndSpan(span, err)
+		if err != nil {
+			if isInvalidGrant(err) {
+				return nil, fmt.Errorf("%w: %v", ErrRefreshTokenRevoked, err)
+			}
+			return nil, err
+		}
+
+		err = r.normalizeTokenType(newToken, oauthDetails.OAuthSite)
 		if err != nil {
 			return nil, err
 		}
 
-		if newToken.AccessToken != token.AccessToken {
-			r.DB.NamedExec("UPDATE credentials SET access_token = ':access_token' WHERE code = ':code'", &models.Auth{
-				AccessToken: newToken.AccessToken,
-				Code:        oauthDetails.Code,
-			})
+		if credentials := refreshedCredentials(oauthDetails.Code, token, newToken); credentials != nil {
+			_, err = r.DB.NamedExec("UPDATE credentials SET (access_token, refresh_token, token_type, expiry) = (:access_token, :refresh_token, :token_type, :expiry) WHERE code = :code", credentials)
+			if err != nil {
+				r.Logger.Error().Err(err).Msg("Cannot update credentials")
+			}
 		}
 
 		token = newToken
@@ -409,21 +956,29 @@ func (r *ServiceRouter) GetUserInfo(oauthConfig oauth2.Config, oauthDetails Deta
 
 			authedUser, ok := token.Extra("user_id").(string)
 			if !ok {
-				r.Logger.Error().Str("OAuth Details", oauthDetails.Code).Interface("OAuth Exchange", token).Msg("No UserID in Slack OAuth Response")
+				r.Logger.Error().Object("OAuth Details", &oauthDetails).Str("token type", token.TokenType).Time("expiry", token.Expiry).Msg("No UserID in Slack OAuth Response")
 				return nil, errors.New("No UserID in Slack OAuth Response")
 			}
 
-			client := oauthConfig.Client(oauth2.NoContext, token)
+			requestCtx, span := utils.StartSpan(ctx, "oauth.UserInfoRequest", attribute.String("provider", oauthDetails.OAuthSite))
+			client := oauthConfig.Client(requestCtx, token)
 
 			data := url.Values{}
 			data.Set("user", authedUser)
 			response, err := client.PostForm(userInfoURL, data)
+			utils.EndSpan(span, err)
 			if err != nil {
-				r.Logger.Error().Err(err).Str("OAuth Details", oauthDetails.Code).Str("token", token.AccessToken).Msg("Could not fetch user info details")
+				r.Logger.Error().Err(err).Str("site", oauthDetails.OAuthSite).Msg("Could not fetch user info details")
 				return nil, err
 			}
 			defer response.Body.Close()
 
+			err = checkUserInfoResponse(response)
+			if err != nil {
+				r.Logger.Error().Err(err).Object("OAuth Details", &oauthDetails).Msg("Slack userinfo request failed")
+				return nil, err
+			}
+
 			contents, err := ioutil.ReadAll(response.Body)
 			if err != nil {
 				r.Logger.Error().Interface("Response Body", response.Body).Err(err).Msg("Could not read response body")
@@ -457,10 +1012,12 @@ func (r *ServiceRouter) GetUserInfo(oauthConfig oauth2.Config, oauthDetails Deta
 		}
 
 		if oauthDetails.OAuthSite == "microsoft" {
-			client := &http.Client{}
-			req, err := http.NewRequest("GET", "https://graph.microsoft.com/oidc/userinfo", nil)
+			client := providerClient
+			requestCtx, span := utils.StartSpan(ctx, "oauth.UserInfoRequest", attribute.String("provider", oauthDetails.OAuthSite))
+			req, err := http.NewRequestWithContext(requestCtx, "GET", "https://graph.microsoft.com/oidc/userinfo", nil)
 			if err != nil {
-				log.Error().Err(err).Str("code", oauthDetails.Code).Str("token", token.AccessToken).Msg("Could not fetch user info details")
+				utils.EndSpan(span, err)
+				log.Error().Err(err).Str("site", oauthDetails.OAuthSite).Msg("Could not fetch user info details")
 				return nil, err
 			}
 
@@ -468,13 +1025,20 @@ func (r *ServiceRouter) GetUserInfo(oauthConfig oauth2.Config, oauthDetails Deta
 			req.Header.Add("Authorization", bearer)
 
 			response, err := client.Do(req)
+			utils.EndSpan(span, err)
 			if err != nil {
-				log.Error().Err(err).Str("code", oauthDetails.Code).Str("token", token.AccessToken).Msg("Could not fetch user info details")
+				log.Error().Err(err).Str("site", oauthDetails.OAuthSite).Msg("Could not fetch user info details")
 				return nil, err
 			}
 
 			defer response.Body.Close()
 
+			err = checkUserInfoResponse(response)
+			if err != nil {
+				log.Error().Err(err).Object("OAuth Details", &oauthDetails).Msg("Microsoft userinfo request failed")
+				return nil, err
+			}
+
 			contents, err := ioutil.ReadAll(response.Body)
 			if err != nil {
 				log.Error().Err(err).Msg("Could not read response body")
@@ -488,45 +1052,72 @@ func (r *ServiceRouter) GetUserInfo(oauthConfig oauth2.Config, oauthDetails Deta
 				return nil, err
 			}
 
+			if verifyIDToken {
+				idToken, err := r.verifyIDToken(token, microsoftVerifier(&oidc.Config{ClientID: oauthConfig.ClientID}), oauthDetails.Nonce)
+				if err != nil {
+					return nil, err
+				}
+
+				if err := verifyMicrosoftIssuer(idToken); err != nil {
+					r.Logger.Error().Err(err).Str("issuer", idToken.Issuer).Msg("Could not verify id_token issuer")
+					return nil, ErrInvalidIDToken
+				}
+
+				if idToken.Subject != user.ID {
+					r.Logger.Error().Str("id_token sub", idToken.Subject).Str("userinfo sub", user.ID).Msg("id_token does not belong to the user")
+					return nil, ErrInvalidIDToken
+				}
+			}
+
 			user.EmailVerified = true
 			return user, nil
 		}
 
-		r.Logger.Error().Interface("OAuth Config", oauthConfig).Interface("OAuth Details", oauthDetails).Msg("Provider should not be nil")
+		r.Logger.Error().Str("client", oauthConfig.ClientID).Object("OAuth Details", &oauthDetails).Msg("Provider should not be nil")
 		return nil, errors.New("Provider should not be nil")
 	}
 
 	if oauthDetails.OAuthSite == "apple" {
-		rawIDToken, ok := token.Extra("id_token").(string)
-		if !ok {
-			r.Logger.Error().Interface("token", token).Msg("Could not get id_token from apple token")
-			return nil, errors.New("Could not get id_token from apple token")
-		}
-		idTokenVerifier := provider.Verifier(&oidc.Config{ClientID: oauthConfig.ClientID})
-		idToken, err := idTokenVerifier.Verify(oauth2.NoContext, rawIDToken)
+		// Apple only returns the user in the id_token
+		idToken, err := r.verifyIDToken(token, provider.Verifier(&oidc.Config{ClientID: oauthConfig.ClientID}), oauthDetails.Nonce)
 		if err != nil {
-			r.Logger.Error().Str("rawIDToken", rawIDToken).Interface("idTokenVerifier", idTokenVerifier).Interface("OAuth Config", oauthConfig).Interface("OAuth Details", oauthDetails).Msg("Could not verify id_token")
-			return nil, errors.New("Could not verify id_token")
+			r.Logger.Error().Str("client", oauthConfig.ClientID).Object("OAuth Details", &oauthDetails).Msg("Could not verify id_token")
+			return nil, err
 		}
 
 		// Get Email from idToken
 		var claims struct {
-			Email string `json:"email"`
+			Email         string      `json:"email"`
+			EmailVerified interface{} `json:"email_verified"`
 		}
 
 		if err := idToken.Claims(&claims); err != nil {
-			return &User{ID: idToken.Subject, EmailVerified: true}, nil
+			return &User{ID: idToken.Subject, EmailVerifiedMissing: true}, nil
 		}
 
-		return &User{ID: idToken.Subject, Email: claims.Email, EmailVerified: true}, nil
-
+		emailVerified, ok := parseEmailVerified(claims.EmailVerified)
+		return &User{ID: idToken.Subject, Email: claims.Email, EmailVerified: emailVerified, EmailVerifiedMissing: !ok}, nil
 	}
 
-	tokenSource := oauthConfig.TokenSource(oauth2.NoContext, token)
-	userInfo, err := provider.UserInfo(oauth2.NoContext, tokenSource)
+	requestCtx, span := utils.StartSpan(ctx, "oauth.UserInfoRequest", attribute.String("provider", oauthDetails.OAuthSite))
+	tokenSource := oauthConfig.TokenSource(requestCtx, token)
+	userInfo, err := provider.UserInfo(requestCtx, tokenSource)
+	utils.EndSpan(span, err)
 	if err != nil {
-		r.Logger.Error().Err(err).Str("code", oauthDetails.Code).Interface("config", oauthConfig).Interface("token", token).Msg("Fetching UserInfo Failed")
-		return nil, err
+		r.Logger.Error().Err(err).Str("site", oauthDetails.OAuthSite).Str("client", oauthConfig.ClientID).Msg("Fetching UserInfo Failed")
+		return nil, userInfoErrorFromOIDC(err)
+	}
+
+	if verifyIDToken {
+		idToken, err := r.verifyIDToken(token, provider.Verifier(&oidc.Config{ClientID: oauthConfig.ClientID}), oauthDetails.Nonce)
+		if err != nil {
+			return nil, err
+		}
+
+		if idToken.Subject != userInfo.Subject {
+			r.Logger.Error().Str("id_token sub", idToken.Subject).Str("userinfo sub", userInfo.Subject).Msg("id_token does not belong to the user")
+			return nil, ErrInvalidIDToken
+		}
 	}
 
 	return &User{
@@ -0,0 +1,341 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/samyak-jain/agora_backend/utils"
+	"github.com/spf13/viper"
+	"golang.org/x/oauth2"
+)
+
+func TestDefaultOAuthSite(t *testing.T) {
+	tests := []struct {
+		name string
+		site string
+		want string
+	}{
+		{name: "provider", site: "google", want: "google"},
+		{name: "none", site: "none", want: ""},
+		{name: "none in capitals", site: "NONE", want: ""},
+		{name: "empty", site: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("DEFAULT_OAUTH_SITE", tt.site)
+			defer viper.Set("DEFAULT_OAUTH_SITE", "google")
+
+			if got := DefaultOAuthSite(); got != tt.want {
+				t.Errorf("DefaultOAuthSite() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenPagePreviewEnabled(t *testing.T) {
+	tests := []struct {
+		name         string
+		enabled      bool
+		environment  string
+		environments []string
+		want         bool
+	}{
+		{name: "allowed environment", enabled: true, environment: "development", environments: []string{"development"}, want: true},
+		{name: "disabled", enabled: false, environment: "development", environments: []string{"development"}, want: false},
+		{name: "unlisted environment", enabled: true, environment: "staging", environments: []string{"development"}, want: false},
+		{name: "misspelled production", enabled: true, environment: "prod", environments: []string{"development"}, want: false},
+		{name: "production is never allowed", enabled: true, environment: "production", environments: []string{"production"}, want: false},
+		{name: "empty environment", enabled: true, environment: "", environments: []string{""}, want: false},
+		{name: "empty allowlist", enabled: true, environment: "development", environments: []string{}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("ENABLE_TOKEN_PAGE_PREVIEW", tt.enabled)
+			viper.Set("ENVIRONMENT", tt.environment)
+			viper.Set("TOKEN_PAGE_PREVIEW_ENVIRONMENTS", tt.environments)
+			defer func() {
+				viper.Set("ENABLE_TOKEN_PAGE_PREVIEW", false)
+				viper.Set("ENVIRONMENT", "production")
+				viper.Set("TOKEN_PAGE_PREVIEW_ENVIRONMENTS", []string{"development"})
+			}()
+
+			if got := tokenPagePreviewEnabled(); got != tt.want {
+				t.Errorf("tokenPagePreviewEnabled() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseEmailVerified(t *testing.T) {
+	tests := []struct {
+		name         string
+		claim        interface{}
+		wantVerified bool
+		wantPresent  bool
+	}{
+		{name: "true", claim: true, wantVerified: true, wantPresent: true},
+		{name: "false", claim: false, wantVerified: false, wantPresent: true},
+		{name: "true string", claim: "true", wantVerified: true, wantPresent: true},
+		{name: "false string", claim: "false", wantVerified: false, wantPresent: true},
+		{name: "other string", claim: "yes", wantVerified: false, wantPresent: false},
+		{name: "number", claim: float64(1), wantVerified: false, wantPresent: false},
+		{name: "missing", claim: nil, wantVerified: false, wantPresent: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verified, present := parseEmailVerified(tt.claim)
+			if verified != tt.wantVerified || present != tt.wantPresent {
+				t.Errorf("parseEmailVerified(%v) = %v, %v, want %v, %v", tt.claim, verified, present, tt.wantVerified, tt.wantPresent)
+			}
+		})
+	}
+}
+
+func TestRefreshedCredentials(t *testing.T) {
+	expiry := time.Now().Add(time.Hour)
+	token := &oauth2.Token{AccessToken: "access", RefreshToken: "refresh", TokenType: "Bearer"}
+
+	tests := []struct {
+		name     string
+		newToken *oauth2.Token
+		want     *models.Auth
+	}{
+		{name: "unchanged", newToken: &oauth2.Token{AccessToken: "access", RefreshToken: "refresh", TokenType: "Bearer"}, want: nil},
+		{name: "new access token", newToken: &oauth2.Token{AccessToken: "new access", RefreshToken: "refresh", TokenType: "Bearer", Expiry: expiry},
+			want: &models.Auth{Code: "code", AccessToken: "new access", RefreshToken: "refresh", TokenType: "Bearer", Expiry: expiry}},
+		{name: "rotated refresh token", newToken: &oauth2.Token{AccessToken: "access", RefreshToken: "new refresh", TokenType: "Bearer", Expiry: expiry},
+			want: &models.Auth{Code: "code", AccessToken: "access", RefreshToken: "new refresh", TokenType: "Bearer", Expiry: expiry}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := refreshedCredentials("code", token, tt.newToken)
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("refreshedCredentials() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeTokenType(t *testing.T) {
+	defer viper.Set("OAUTH_STRICT_TOKEN_TYPE", false)
+
+	tests := []struct {
+		name      string
+		tokenType string
+		strict    bool
+		wantErr   error
+	}{
+		{name: "bearer", tokenType: "Bearer"},
+		{name: "lower case", tokenType: "bearer"},
+		{name: "upper case", tokenType: "BEARER"},
+		{name: "padded", tokenType: " Bearer "},
+		{name: "missing", tokenType: ""},
+		{name: "unknown", tokenType: "mac"},
+		{name: "strict bearer", tokenType: "bearer", strict: true},
+		{name: "strict missing", tokenType: "", strict: true},
+		{name: "strict unknown", tokenType: "mac", strict: true, wantErr: ErrUnsupportedTokenType},
+		{name: "strict DPoP", tokenType: "DPoP", strict: true, wantErr: ErrUnsupportedTokenType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("OAUTH_STRICT_TOKEN_TYPE", tt.strict)
+			router, _ := testRouter(t)
+
+			token := &oauth2.Token{AccessToken: "access", TokenType: tt.tokenType}
+			err := router.normalizeTokenType(token, "google")
+			if err != tt.wantErr {
+				t.Fatalf("normalizeTokenType(%q) = %v, want %v", tt.tokenType, err, tt.wantErr)
+			}
+
+			if tt.wantErr == nil && token.TokenType != "Bearer" {
+				t.Errorf("normalizeTokenType(%q) set %q, want Bearer", tt.tokenType, token.TokenType)
+			}
+		})
+	}
+}
+
+func TestStoreNativeCredentialsWithoutRefreshToken(t *testing.T) {
+	logger := zerolog.Nop()
+	router := &ServiceRouter{Logger: &utils.Logger{Logger: &logger}}
+
+	// Nothing is stored, so the database is not reached
+	if code := router.storeNativeCredentials(&NativeLoginRequest{Provider: "google", AccessToken: "access"}); code != "" {
+		t.Errorf("storeNativeCredentials() = %q, want no credentials", code)
+	}
+}
+
+func TestCheckLoginCheckOrder(t *testing.T) {
+	defer viper.Set("LOGIN_CHECK_ORDER", AllowListFirstCheckOrder)
+
+	tests := []struct {
+		name    string
+		order   string
+		wantErr bool
+	}{
+		{name: "allow list first", order: AllowListFirstCheckOrder, wantErr: false},
+		{name: "verified first", order: VerifiedFirstCheckOrder, wantErr: false},
+		{name: "typo", order: "verify_first", wantErr: true},
+		{name: "empty", order: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("LOGIN_CHECK_ORDER", tt.order)
+			if err := CheckLoginCheckOrder(); (err != nil) != tt.wantErr {
+				t.Errorf("CheckLoginCheckOrder() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoginNotPermitted(t *testing.T) {
+	logger := zerolog.Nop()
+	router := &ServiceRouter{Logger: &utils.Logger{Logger: &logger}}
+	viper.Set("ALLOW_LIST_SOURCES", []string{"config"})
+	viper.Set("ALLOW_LIST", []string{"*@example.com"})
+	defer func() {
+		viper.Set("LOGIN_CHECK_ORDER", AllowListFirstCheckOrder)
+		viper.Set("ALLOW_LIST", []string{})
+	}()
+
+	tests := []struct {
+		name     string
+		order    string
+		userInfo *User
+	}{
+		{name: "unverified email checked first", order: VerifiedFirstCheckOrder, userInfo: &User{ID: "1234", Email: "user@example.com"}},
+		{name: "unverified email checked last", order: AllowListFirstCheckOrder, userInfo: &User{ID: "1234", Email: "user@example.com"}},
+		{name: "email not in allow list", order: AllowListFirstCheckOrder, userInfo: &User{ID: "5678", Email: "user@example.org", EmailVerified: true}},
+		{name: "unverified email not in allow list", order: AllowListFirstCheckOrder, userInfo: &User{ID: "5678", Email: "user@example.org"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("LOGIN_CHECK_ORDER", tt.order)
+
+			// Both checks turn the login down before the database is reached, with the same error
+			w := httptest.NewRecorder()
+			_, err := router.login(context.Background(), w, tt.userInfo, "google", "")
+			if !errors.Is(err, ErrLoginNotPermitted) {
+				t.Errorf("login() error = %v, want %v", err, ErrLoginNotPermitted)
+			}
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+func TestDetailsLogObject(t *testing.T) {
+	tests := []struct {
+		name    string
+		details *Details
+		want    []string
+		hidden  []string
+	}{
+		{
+			name:    "code and nonce are not logged",
+			details: &Details{Code: "4/0AX4XfWsecretcode", Nonce: "secretnonce", OAuthSite: "site", Platform: "web"},
+			want:    []string{utils.TokenFingerprint("4/0AX4XfWsecretcode"), `"site":"site"`, `"platform":"web"`},
+			hidden:  []string{"4/0AX4XfWsecretcode", "secretnonce"},
+		},
+		{
+			name:    "nil details",
+			details: nil,
+			want:    []string{`"OAuth Details":{}`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := zerolog.New(&buf)
+			logger.Error().Object("OAuth Details", tt.details).Msg("test")
+
+			for _, want := range tt.want {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("log %s does not contain %q", buf.String(), want)
+				}
+			}
+			for _, hidden := range tt.hidden {
+				if strings.Contains(buf.String(), hidden) {
+					t.Errorf("log %s contains %q", buf.String(), hidden)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteHybridPage(t *testing.T) {
+	// The pages are loaded relative to the root of the repository, as in the server
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(".."); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	viper.Set("SCHEME", "myapp")
+	viper.Set("HYBRID_FALLBACK_DELAY", 1500)
+	defer func() {
+		viper.Set("SCHEME", nil)
+		viper.Set("HYBRID_FALLBACK_DELAY", nil)
+		viper.Set("HYBRID_FALLBACK_URL", "")
+	}()
+
+	tests := []struct {
+		name         string
+		fallbackURL  string
+		wantFallback string
+	}{
+		{name: "redirect of the login", wantFallback: "https://app.example.com/login/header.payload.signature?lang=en"},
+		{name: "configured fallback", fallbackURL: "https://hybrid.example.com/done", wantFallback: "https://hybrid.example.com/done/header.payload.signature"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("HYBRID_FALLBACK_URL", tt.fallbackURL)
+
+			w := httptest.NewRecorder()
+			writeHybridPage(w, "https://app.example.com/login?lang=en", "header.payload.signature")
+			body := w.Body.String()
+
+			if !strings.Contains(body, `window.location = "myapp://my-host/auth-token/" + "header.payload.signature"`) {
+				t.Errorf("writeHybridPage() = %q, want the deep link with the token", body)
+			}
+
+			// The fallback is both the link shown on the page and the delayed redirect of the script
+			scriptFallback := strings.ReplaceAll(tt.wantFallback, "/", `\/`)
+			if !strings.Contains(body, `href="`+tt.wantFallback+`"`) || !strings.Contains(body, `window.location = "`+scriptFallback+`"`) || !strings.Contains(body, "1500") {
+				t.Errorf("writeHybridPage() = %q, want the fallback redirect to %s after 1500 ms", body, tt.wantFallback)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"github.com/samyak-jain/agora_backend/pkg/models"
+)
+
+// RecordChannelToken stores an issued RTC token so that its holder is listed by GetChannelParticipants until it expires
+func RecordChannelToken(db *models.Database, token *models.ChannelToken) error {
+	_, err := db.NamedExec("INSERT INTO channel_tokens (channel_id, user_id, uid, is_host, expires_at) VALUES (:channel_id, :user_id, :uid, :is_host, :expires_at)", token)
+	return err
+}
+
+// GetChannelParticipants lists every uid holding an unexpired token for the channel along with its user, if any.
+// A uid which was issued several tokens is listed once with its latest expiry.
+func GetChannelParticipants(db *models.Database, channelID int64) ([]*models.ChannelParticipant, error) {
+	participants := []*models.ChannelParticipant{}
+	err := db.Select(&participants, `SELECT DISTINCT ON (t.uid) t.uid, t.is_host, t.expires_at, u.user_name, u.email
+		FROM channel_tokens t LEFT JOIN users u ON u.id = t.user_id
+		WHERE t.channel_id = $1 AND t.expires_at > CURRENT_TIMESTAMP
+		ORDER BY t.uid, t.expires_at DESC`, channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	return participants, nil
+}
@@ -0,0 +1,146 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/samyak-jain/agora_backend/utils"
+	"github.com/spf13/viper"
+)
+
+// ErrPendingLoginExpired is returned when a login flow reference is unknown, expired, or its token was logged out
+var ErrPendingLoginExpired = errors.New("Login has expired, please sign in again")
+
+// hashFlowID hashes a login flow reference for storage. Whoever knows the reference can retrieve the token, so the
+// database only keeps its hash, and references are random and long enough for a fast hash.
+func hashFlowID(flowID string) string {
+	hash := sha256.Sum256([]byte(flowID))
+	return hex.EncodeToString(hash[:])
+}
+
+// createPendingLogin keeps the token of a mobile login retrievable for MOBILE_LOGIN_RETRY_TTL seconds under a new flow
+// reference, so that the deep link can be retried when the app failed to open. It returns an empty reference when
+// retries are disabled.
+func (router *ServiceRouter) createPendingLogin(token string) (string, error) {
+	ttl := viper.GetInt("MOBILE_LOGIN_RETRY_TTL")
+	if ttl <= 0 {
+		return "", nil
+	}
+
+	return router.storePendingLogin(token, time.Now().Add(time.Duration(ttl)*time.Second))
+}
+
+// storePendingLogin stores the token under a new flow reference until expiresAt
+func (router *ServiceRouter) storePendingLogin(token string, expiresAt time.Time) (string, error) {
+	flowID, err := utils.GenerateSessionToken()
+	if err != nil {
+		return "", err
+	}
+
+	// Expired flows are only ever looked up to be refused, so they are cleaned up on the way
+	_, err = router.DB.Exec("DELETE FROM pending_logins WHERE expires_at < CURRENT_TIMESTAMP")
+	if err != nil {
+		return "", err
+	}
+
+	_, err = router.DB.Exec("INSERT INTO pending_logins (flow_hash, token_id, expires_at) VALUES ($1, $2, $3)", hashFlowID(flowID), token, expiresAt)
+	if err != nil {
+		return "", err
+	}
+
+	return flowID, nil
+}
+
+type pendingLogin struct {
+	TokenID   string    `db:"token_id"`
+	ExpiresAt time.Time `db:"expires_at"`
+}
+
+// takePendingLogin removes an unexpired login flow whose token is still valid and returns it, so that every flow
+// reference can only be used once
+func (router *ServiceRouter) takePendingLogin(flowID string) (*pendingLogin, error) {
+	var logins []pendingLogin
+	err := router.DB.Select(&logins, "DELETE FROM pending_logins USING tokens WHERE tokens.token_id = pending_logins.token_id AND pending_logins.flow_hash = $1 AND pending_logins.expires_at > CURRENT_TIMESTAMP RETURNING pending_logins.token_id, pending_logins.expires_at", hashFlowID(flowID))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(logins) == 0 {
+		return nil, ErrPendingLoginExpired
+	}
+
+	return &logins[0], nil
+}
+
+// retryURL links the token page to RetryMobileLogin, relative to the directory of the page
+func retryURL(flowID string) string {
+	if flowID == "" {
+		return ""
+	}
+
+	return fmt.Sprintf("oauth/retry?flow=%s", url.QueryEscape(flowID))
+}
+
+// retryPageURL links the retried token page to RetryMobileLogin, which is in the same directory
+func retryPageURL(flowID string) string {
+	if flowID == "" {
+		return ""
+	}
+
+	return "retry?flow=" + url.QueryEscape(flowID)
+}
+
+// RetryMobileLogin is a REST route which renders the mobile token page of a pending login again, so that a user whose
+// app did not open can retry the deep link without another OAuth flow
+func (router *ServiceRouter) RetryMobileLogin(w http.ResponseWriter, r *http.Request) {
+	flowID := r.URL.Query().Get("flow")
+	if flowID == "" {
+		http.Error(w, "Flow reference is missing", http.StatusBadRequest)
+		return
+	}
+
+	login, err := router.takePendingLogin(flowID)
+	if errors.Is(err, ErrPendingLoginExpired) {
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	} else if err != nil {
+		router.Logger.Error().Err(err).Msg("Could not fetch pending login")
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// The used reference is replaced by a new one which expires with it, so that the page can be retried again
+	nextFlowID, err := router.storePendingLogin(login.TokenID, login.ExpiresAt)
+	if err != nil {
+		router.Logger.Error().Err(err).Msg("Could not store pending login")
+	}
+
+	t, err := template.ParseFiles("web/mobile.html")
+	if err != nil {
+		fmt.Fprint(w, "Internal Server Error")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	t.Execute(w, TokenTemplate{
+		Token:    login.TokenID,
+		Scheme:   viper.GetString("SCHEME"),
+		RetryURL: retryPageURL(nextFlowID),
+	})
+}
@@ -0,0 +1,66 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import "testing"
+
+func TestHashFlowID(t *testing.T) {
+	tests := []struct {
+		name   string
+		flowID string
+		other  string
+	}{
+		{name: "random reference", flowID: "d2d1b9a4c3e0", other: "d2d1b9a4c3e1"},
+		{name: "empty reference", flowID: "", other: " "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash := hashFlowID(tt.flowID)
+			if hash == tt.flowID || len(hash) != 64 {
+				t.Errorf("hashFlowID(%q) = %q, want a hex encoded SHA-256", tt.flowID, hash)
+			}
+
+			if hashFlowID(tt.flowID) != hash {
+				t.Errorf("hashFlowID(%q) is not deterministic", tt.flowID)
+			}
+
+			if hashFlowID(tt.other) == hash {
+				t.Errorf("hashFlowID(%q) = hashFlowID(%q)", tt.other, tt.flowID)
+			}
+		})
+	}
+}
+
+func TestRetryURLs(t *testing.T) {
+	tests := []struct {
+		name        string
+		flowID      string
+		wantToken   string
+		wantRetried string
+	}{
+		{name: "reference", flowID: "abc", wantToken: "oauth/retry?flow=abc", wantRetried: "retry?flow=abc"},
+		{name: "escaped reference", flowID: "a+b", wantToken: "oauth/retry?flow=a%2Bb", wantRetried: "retry?flow=a%2Bb"},
+		{name: "retries disabled", flowID: "", wantToken: "", wantRetried: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryURL(tt.flowID); got != tt.wantToken {
+				t.Errorf("retryURL() = %q, want %q", got, tt.wantToken)
+			}
+
+			if got := retryPageURL(tt.flowID); got != tt.wantRetried {
+				t.Errorf("retryPageURL() = %q, want %q", got, tt.wantRetried)
+			}
+		})
+	}
+}
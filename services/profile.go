@@ -0,0 +1,90 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/samyak-jain/agora_backend/utils"
+)
+
+// ErrNoRefreshToken is returned when refreshing the profile of a user we hold no provider refresh token for
+var ErrNoRefreshToken = errors.New("No provider refresh token is stored for the user")
+
+// ErrRefreshTokenRevoked is returned when the provider rejects the stored refresh token, the user has to log in again
+var ErrRefreshTokenRevoked = errors.New("Provider refresh token was revoked or expired")
+
+// linkCredentials attaches the provider credentials stored for the authorization code to the user the session token
+// was issued to, so that the profile of the user can be refreshed later
+func (router *ServiceRouter) linkCredentials(ctx context.Context, code string, bearerToken string) {
+	_, err := router.DB.ExecContext(ctx, "UPDATE credentials SET user_id = (SELECT user_id FROM tokens WHERE token_id = $1) WHERE code = $2", bearerToken, code)
+	if err != nil {
+		router.Logger.Error().Err(err).Msg("Could not link credentials to user")
+	}
+}
+
+// RefreshUserProfile fetches the profile of the user from their provider with the latest stored refresh token, and
+// stores the name, email and verified status it returns. The updated user is returned.
+func (router *ServiceRouter) RefreshUserProfile(ctx context.Context, userID int64) (*models.UserAccount, error) {
+	var userData models.UserAccount
+	err := router.DB.GetContext(ctx, &userData, "SELECT "+userColumns+" FROM users WHERE id = $1", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var code string
+	err = router.DB.GetContext(ctx, &code, "SELECT code FROM credentials WHERE user_id = $1 AND refresh_token <> '' ORDER BY id DESC LIMIT 1", userID)
+	if err == sql.ErrNoRows || !userData.Provider.Valid {
+		return nil, ErrNoRefreshToken
+	} else if err != nil {
+		return nil, err
+	}
+
+	site := userData.Provider.String
+	oauthConfig, provider, err := router.GetOAuthConfig(site, "")
+	if err != nil {
+		return nil, err
+	}
+
+	userInfo, err := router.GetUserInfo(ctx, *oauthConfig, Details{Code: code, OAuthSite: site}, provider)
+	if errors.Is(err, ErrRefreshTokenRevoked) {
+		// The credentials cannot be used again, so later refreshes report that there is no refresh token
+		router.DB.ExecContext(ctx, "DELETE FROM credentials WHERE code = $1", code)
+		return nil, err
+	} else if err != nil {
+		return nil, err
+	}
+
+	if userInfo.ID != userData.Identifier {
+		return nil, fmt.Errorf("Provider returned the profile of another user, %s instead of %s", userInfo.ID, userData.Identifier)
+	}
+
+	name, err := utils.ValidateName(userInfo.Name)
+	if err == nil && name != "" {
+		userData.UserName = sql.NullString{String: name, Valid: true}
+	}
+
+	if email := utils.NormalizeEmail(userInfo.Email); email != "" && !userInfo.EmailVerifiedMissing {
+		userData.Email = email
+		userData.EmailVerified = userInfo.EmailVerified
+	}
+
+	_, err = router.DB.ExecContext(ctx, "UPDATE users SET user_name = $1, email = $2, email_verified = $3 WHERE id = $4", userData.UserName, userData.Email, userData.EmailVerified, userData.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &userData, nil
+}
@@ -0,0 +1,139 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Modes of PROVIDER_SELF_TEST
+const (
+	OffProviderSelfTest  = "off"
+	WarnProviderSelfTest = "warn"
+	FailProviderSelfTest = "fail"
+)
+
+// ErrProviderMisconfigured is returned by CheckOAuthProviders when the self-test finds a problem in fail mode
+var ErrProviderMisconfigured = errors.New("OAuth providers are misconfigured")
+
+// CheckOAuthProviders runs the startup self-test of the enabled OAuth providers. It checks that their credentials are
+// configured and that every redirect URI in OAUTH_REDIRECT_URIS, which logins are restricted to, is an absolute https
+// URL of the /oauth callback. With PROVIDER_SELF_TEST_BUILD_CONFIG the provider config is also built, which runs OIDC
+// discovery and generates the Apple client secret. The problems are logged as warnings, in fail mode they are also
+// returned.
+func (router *ServiceRouter) CheckOAuthProviders() error {
+	mode := viper.GetString("PROVIDER_SELF_TEST")
+	if mode == OffProviderSelfTest || !viper.GetBool("ENABLE_OAUTH") {
+		return nil
+	}
+
+	var problems []string
+	for _, redirectURI := range viper.GetStringSlice("OAUTH_REDIRECT_URIS") {
+		if err := checkRedirectURI(redirectURI); err != nil {
+			problems = append(problems, fmt.Sprintf("redirect URI %q: %s", redirectURI, err))
+		}
+	}
+
+	for _, provider := range OAuthProviders {
+		if !viper.GetBool(provider.EnableKey) {
+			continue
+		}
+
+		var missing []string
+		for _, key := range provider.RequiredKeys {
+			if viper.GetString(key) == "" {
+				missing = append(missing, key)
+			}
+		}
+
+		if len(missing) > 0 {
+			problems = append(problems, fmt.Sprintf("%s: missing %s", provider.Site, strings.Join(missing, ", ")))
+			continue
+		}
+
+		if viper.GetBool("PROVIDER_SELF_TEST_BUILD_CONFIG") {
+			if _, _, err := router.GetOAuthConfig(provider.Site, "https://localhost/oauth"); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %s", provider.Site, err))
+			}
+		}
+	}
+
+	for _, problem := range problems {
+		router.Logger.Warn().Str("problem", problem).Msg("OAuth provider self-test failed")
+	}
+
+	if len(problems) > 0 && mode == FailProviderSelfTest {
+		return fmt.Errorf("%w: %s", ErrProviderMisconfigured, strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// ErrRedirectURINotAllowed is returned when a login uses a backend whose callback is not one of OAUTH_REDIRECT_URIS
+var ErrRedirectURINotAllowed = errors.New("Backend URL is not an allowed redirect URI")
+
+// redirectURIAllowed checks that the /oauth callback of the backend passed by a login is one of OAUTH_REDIRECT_URIS,
+// which are the URIs registered with the providers and checked by the self-test. When none are configured, every
+// backend is allowed.
+func redirectURIAllowed(backendURL string) bool {
+	allowed := viper.GetStringSlice("OAUTH_REDIRECT_URIS")
+	if len(allowed) == 0 {
+		return true
+	}
+
+	redirectURI := strings.TrimSuffix(backendURL, "/") + "/oauth"
+	for _, allowedURI := range allowed {
+		if strings.TrimSuffix(allowedURI, "/") == redirectURI {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkRedirectURI checks that the URI registered with the providers points to the /oauth callback of this server.
+// Plain http is only accepted for localhost.
+func checkRedirectURI(redirectURI string) error {
+	parsed, err := url.Parse(redirectURI)
+	if err != nil {
+		return err
+	}
+
+	if !parsed.IsAbs() || parsed.Host == "" {
+		return errors.New("must be an absolute URL")
+	}
+
+	host := parsed.Hostname()
+	isLocal := host == "localhost"
+	if ip := net.ParseIP(host); ip != nil {
+		isLocal = ip.IsLoopback()
+	}
+
+	if parsed.Scheme != "https" && !(parsed.Scheme == "http" && isLocal) {
+		return errors.New("must use https")
+	}
+
+	if !strings.HasSuffix(strings.TrimSuffix(parsed.Path, "/"), "/oauth") {
+		return errors.New("must point to the /oauth callback")
+	}
+
+	if parsed.RawQuery != "" || parsed.Fragment != "" {
+		return errors.New("must not carry a query or fragment")
+	}
+
+	return nil
+}
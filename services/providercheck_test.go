@@ -0,0 +1,82 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/samyak-jain/agora_backend/utils"
+	"github.com/spf13/viper"
+)
+
+func TestRedirectURIAllowed(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		backend string
+		want    bool
+	}{
+		{name: "none configured", allowed: []string{}, backend: "https://attacker.example.com", want: true},
+		{name: "registered backend", allowed: []string{"https://api.example.com/oauth"}, backend: "https://api.example.com", want: true},
+		{name: "trailing slashes", allowed: []string{"https://api.example.com/oauth/"}, backend: "https://api.example.com/", want: true},
+		{name: "other backend", allowed: []string{"https://api.example.com/oauth"}, backend: "https://attacker.example.com", want: false},
+		{name: "backend with a suffix", allowed: []string{"https://api.example.com/oauth"}, backend: "https://api.example.com.attacker.com", want: false},
+		{name: "plain http", allowed: []string{"https://api.example.com/oauth"}, backend: "http://api.example.com", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("OAUTH_REDIRECT_URIS", tt.allowed)
+			defer viper.Set("OAUTH_REDIRECT_URIS", []string{})
+
+			if got := redirectURIAllowed(tt.backend); got != tt.want {
+				t.Errorf("redirectURIAllowed(%q) = %v, want %v", tt.backend, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoginRejectsUnregisteredBackend(t *testing.T) {
+	logger := zerolog.Nop()
+	router := &ServiceRouter{Logger: &utils.Logger{Logger: &logger}}
+	viper.Set("OAUTH_REDIRECT_URIS", []string{"https://api.example.com/oauth"})
+	defer viper.Set("OAUTH_REDIRECT_URIS", []string{})
+
+	// The state is escaped twice, as Authorize sends it to the provider
+	state := "redirect%3Dhttps%253A%252F%252Fapp.example.com%26backend%3Dhttps%253A%252F%252Fattacker.example.com%26site%3Dgoogle"
+
+	tests := []struct {
+		name    string
+		handler func(w http.ResponseWriter, r *http.Request)
+		target  string
+	}{
+		{name: "authorize", handler: router.Authorize, target: "/oauth/authorize?site=google&redirect=https://app.example.com&backend=https://attacker.example.com"},
+		{name: "callback", handler: func(w http.ResponseWriter, r *http.Request) {
+			if _, _, _, err := router.Handler(w, r); !errors.Is(err, ErrRedirectURINotAllowed) {
+				t.Errorf("Handler() error = %v, want %v", err, ErrRedirectURINotAllowed)
+			}
+		}, target: "/oauth?code=abc&state=" + state},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tt.handler(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
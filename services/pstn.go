@@ -15,10 +15,12 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/samyak-jain/agora_backend/pkg/models"
 	"github.com/samyak-jain/agora_backend/utils"
 	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type AuthAccount struct {
@@ -133,13 +135,39 @@ func (router *ServiceRouter) PSTN(w http.ResponseWriter, r *http.Request) {
 	router.Logger.Debug().Str("Conference ID", conferenceID).Msg("Got conference ID")
 
 	var channelData models.Channel
-	err := router.DB.Get(&channelData, "SELECT channel_name, channel_secret FROM channels WHERE dtmf=$1", conferenceID)
+	err := router.DB.Get(&channelData, "SELECT id, channel_name, channel_secret, closed_at, scheduled_start, scheduled_end FROM channels WHERE dtmf=$1", conferenceID)
 	if err != nil {
 		router.Logger.Error().Err(err).Str("Conference ID", conferenceID).Msg("Could not fetch relevant channel from DB")
 		return
 	}
 
-	user, err := utils.GenerateUserCredentials(channelData.ChannelName, false, true)
+	if channelData.ClosedAt.Valid {
+		router.Logger.Error().Str("Conference ID", conferenceID).Msg("Channel is closed")
+		return
+	}
+
+	now := time.Now()
+	err = CheckSchedule(&channelData, now)
+	if err != nil {
+		router.Logger.Info().Err(err).Str("Conference ID", conferenceID).Msg("Channel is outside of its schedule")
+		return
+	}
+
+	// A phone caller has no verified email, so it can never be on the allow list of a channel
+	entries, err := GetChannelAllowList(router.DB, channelData.ID)
+	if err != nil {
+		router.Logger.Error().Err(err).Str("Conference ID", conferenceID).Msg("Could not fetch channel allow list")
+		return
+	}
+
+	if len(entries) > 0 {
+		router.Logger.Info().Str("Conference ID", conferenceID).Msg("Channel allow list does not admit PSTN callers")
+		return
+	}
+
+	_, span := utils.StartSpan(r.Context(), "agora.GenerateUserCredentials", attribute.String("user", "pstn"))
+	user, err := utils.GenerateUserCredentials(channelData.ChannelName, utils.GenerateUID(true), false, ClampToSchedule(&channelData, now, 0))
+	utils.EndSpan(span, err)
 	if err != nil {
 		router.Logger.Error().Err(err).Msg("Could not generate main user credentials")
 		return
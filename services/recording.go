@@ -0,0 +1,129 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/samyak-jain/agora_backend/utils"
+	"github.com/spf13/viper"
+)
+
+// channelTenant returns the tenant of the channel, which is the tenant of its creator
+func channelTenant(ctx context.Context, db sqlx.QueryerContext, channelID int64) (sql.NullString, error) {
+	var tenant sql.NullString
+	err := sqlx.GetContext(ctx, db, &tenant, "SELECT users.tenant FROM channels LEFT JOIN users ON users.id = channels.creator_id WHERE channels.id = $1", channelID)
+	return tenant, err
+}
+
+// ReserveRecordingSlot claims one of the MAX_CONCURRENT_RECORDINGS slots of the channel's tenant by setting its
+// recording_started_at, and reports false when the tenant has none left. Counting and claiming happen under an
+// advisory lock per tenant, so concurrent starts cannot both take the last slot. A limit of 0 or less allows any
+// number of recordings. Recordings which Agora stopped on its own are never marked as stopped, so those started more
+// than RECORDING_SLOT_TTL seconds ago no longer hold a slot.
+func ReserveRecordingSlot(ctx context.Context, db *models.Database, channelID int64) (bool, error) {
+	tenant, err := channelTenant(ctx, db, channelID)
+	if err != nil {
+		return false, err
+	}
+
+	tenantConfig, err := LoadTenantConfig(ctx, db, tenant)
+	if err != nil {
+		return false, err
+	}
+
+	limit := tenantConfig.GetInt("MAX_CONCURRENT_RECORDINGS")
+	if limit <= 0 {
+		return true, nil
+	}
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", "recordings/"+tenant.String)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	var count int
+	err = tx.GetContext(ctx, &count, "SELECT COUNT(*) FROM channels LEFT JOIN users ON users.id = channels.creator_id WHERE channels.recording_started_at > $1 AND users.tenant IS NOT DISTINCT FROM $2 AND channels.id <> $3",
+		time.Now().Add(-time.Duration(viper.GetInt("RECORDING_SLOT_TTL"))*time.Second), tenant, channelID)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	if count >= limit {
+		tx.Rollback()
+		return false, nil
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE channels SET recording_started_at = CURRENT_TIMESTAMP WHERE id = $1", channelID)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// ReleaseRecordingSlot frees the slot reserved for a recording which could not be started
+func ReleaseRecordingSlot(db *models.Database, channelID int64) error {
+	_, err := db.Exec("UPDATE channels SET recording_started_at = NULL WHERE id = $1 AND recording_sid IS NULL", channelID)
+	return err
+}
+
+// StoreRecordingFiles keeps the files uploaded by a stopped recording, so that they can be downloaded later
+func StoreRecordingFiles(db *models.Database, channelID int64, sid string, fileNames []string) error {
+	for _, fileName := range fileNames {
+		_, err := db.Exec("INSERT INTO recording_files (channel_id, sid, file_name) VALUES ($1, $2, $3)", channelID, sid, fileName)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ListRecordingDownloads returns signed URLs for every recording file of the channel, newest first.
+// The URLs expire after RECORDING_URL_TTL seconds, so they are signed again on every call.
+func ListRecordingDownloads(db *models.Database, channelID int64) ([]*models.RecordingDownload, error) {
+	var files []models.RecordingFile
+	err := db.Select(&files, "SELECT id, created_at, channel_id, sid, file_name FROM recording_files WHERE channel_id = $1 ORDER BY created_at DESC, id DESC", channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	downloads := []*models.RecordingDownload{}
+	for _, file := range files {
+		signedURL, expiresAt, err := utils.PresignRecordingURL(file.FileName, now)
+		if err != nil {
+			return nil, err
+		}
+
+		downloads = append(downloads, &models.RecordingDownload{
+			FileName:   file.FileName,
+			URL:        signedURL,
+			ExpiresAt:  expiresAt,
+			RecordedAt: file.CreatedAt,
+		})
+	}
+
+	return downloads, nil
+}
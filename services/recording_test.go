@@ -0,0 +1,97 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/samyak-jain/agora_backend/pkg/models/dbtest"
+	"github.com/spf13/viper"
+)
+
+// expectRecordingCount expects ReserveRecordingSlot to count the other recordings of a channel without a tenant
+func expectRecordingCount(mock *dbtest.Mock, channelID int64, count int) {
+	mock.ExpectQuery(`SELECT users.tenant FROM channels`).WithArgs(channelID).WillReturnRows([]string{"tenant"}, []interface{}{nil})
+	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT pg_advisory_xact_lock\(hashtext\(\$1\)\)`).WithArgs("recordings/")
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM channels .* WHERE channels.recording_started_at > \$1`).WithArgs(dbtest.Any, nil, channelID).
+		WillReturnRows([]string{"count"}, []interface{}{count})
+}
+
+func TestReserveRecordingSlot(t *testing.T) {
+	defer viper.Set("MAX_CONCURRENT_RECORDINGS", 0)
+
+	tests := []struct {
+		name         string
+		limit        int
+		running      int
+		wantReserved bool
+	}{
+		{name: "under the cap", limit: 2, running: 1, wantReserved: true},
+		{name: "at the cap", limit: 2, running: 2, wantReserved: false},
+		{name: "above the cap", limit: 1, running: 3, wantReserved: false},
+		{name: "no cap", limit: 0, wantReserved: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("MAX_CONCURRENT_RECORDINGS", tt.limit)
+			db, mock := dbtest.New(t)
+
+			if tt.limit <= 0 {
+				mock.ExpectQuery(`SELECT users.tenant FROM channels`).WithArgs(7).WillReturnRows([]string{"tenant"}, []interface{}{nil})
+			} else {
+				expectRecordingCount(mock, 7, tt.running)
+				if tt.wantReserved {
+					mock.ExpectExec(`UPDATE channels SET recording_started_at = CURRENT_TIMESTAMP WHERE id = \$1`).WithArgs(7)
+					mock.ExpectCommit()
+				} else {
+					mock.ExpectRollback()
+				}
+			}
+
+			reserved, err := ReserveRecordingSlot(context.Background(), db, 7)
+			if err != nil || reserved != tt.wantReserved {
+				t.Errorf("ReserveRecordingSlot() = %v, %v, want %v", reserved, err, tt.wantReserved)
+			}
+		})
+	}
+}
+
+func TestRecordingSlotFreedOnStop(t *testing.T) {
+	viper.Set("MAX_CONCURRENT_RECORDINGS", 1)
+	defer viper.Set("MAX_CONCURRENT_RECORDINGS", 0)
+
+	db, mock := dbtest.New(t)
+
+	// Channel 1 records, which takes the only slot
+	expectRecordingCount(mock, 2, 1)
+	mock.ExpectRollback()
+
+	// Releasing or stopping the recording clears its recording_started_at, so it is no longer counted
+	mock.ExpectExec(`UPDATE channels SET recording_started_at = NULL WHERE id = \$1 AND recording_sid IS NULL`).WithArgs(1)
+	expectRecordingCount(mock, 2, 0)
+	mock.ExpectExec(`UPDATE channels SET recording_started_at = CURRENT_TIMESTAMP WHERE id = \$1`).WithArgs(2)
+	mock.ExpectCommit()
+
+	if reserved, err := ReserveRecordingSlot(context.Background(), db, 2); err != nil || reserved {
+		t.Fatalf("ReserveRecordingSlot() = %v, %v, want the cap to be reached", reserved, err)
+	}
+
+	if err := ReleaseRecordingSlot(db, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if reserved, err := ReserveRecordingSlot(context.Background(), db, 2); err != nil || !reserved {
+		t.Fatalf("ReserveRecordingSlot() = %v, %v, want the freed slot", reserved, err)
+	}
+}
@@ -0,0 +1,255 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/samyak-jain/agora_backend/utils"
+	"github.com/spf13/viper"
+)
+
+// errInvalidBatchSize is returned by the purges for a batch size which would never finish or is not a valid LIMIT
+var errInvalidBatchSize = errors.New("batch size must be positive")
+
+// CheckPurge refuses a purge interval or batch size which is not positive, since the ticker panics on the former and
+// the latter is not a valid LIMIT
+func CheckPurge() error {
+	if viper.GetInt("AUDIT_PURGE_INTERVAL") <= 0 {
+		return errors.New("AUDIT_PURGE_INTERVAL must be a positive number of seconds")
+	}
+
+	if viper.GetInt("AUDIT_PURGE_BATCH_SIZE") <= 0 {
+		return errors.New("AUDIT_PURGE_BATCH_SIZE must be a positive number of rows")
+	}
+
+	return nil
+}
+
+// auditExportEntry is the JSON line written for every kick action exported before it is purged
+type auditExportEntry struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	ChannelID int64     `json:"channelId"`
+	UID       int64     `json:"uid"`
+	UserID    *int64    `json:"userId"`
+	Duration  int       `json:"duration"`
+	RuleID    *int64    `json:"ruleId"`
+	Error     *string   `json:"error"`
+}
+
+type auditRow struct {
+	ID        int64          `db:"id"`
+	CreatedAt time.Time      `db:"created_at"`
+	ChannelID int64          `db:"channel_id"`
+	UID       int64          `db:"uid"`
+	UserID    sql.NullInt64  `db:"user_id"`
+	Duration  int            `db:"duration"`
+	RuleID    sql.NullInt64  `db:"rule_id"`
+	Error     sql.NullString `db:"error"`
+}
+
+// PurgeAuditEntries deletes the kick actions, which are the audit trail of moderation, recorded before the cutoff.
+// They are deleted in batches of batchSize so that a large backlog does not lock the table for long. When export is
+// not nil every batch is written to it as JSON lines before it is deleted, and a failed export stops the purge.
+func PurgeAuditEntries(db *models.Database, cutoff time.Time, batchSize int, export io.Writer) (int, error) {
+	if batchSize <= 0 {
+		return 0, errInvalidBatchSize
+	}
+
+	purged := 0
+	for {
+		var rows []auditRow
+		err := db.Select(&rows, "SELECT id, created_at, channel_id, uid, user_id, duration, rule_id, error FROM kick_actions WHERE created_at < $1 ORDER BY id LIMIT $2", cutoff, batchSize)
+		if err != nil {
+			return purged, err
+		}
+
+		if len(rows) == 0 {
+			return purged, nil
+		}
+
+		if export != nil {
+			err = exportAuditRows(export, rows)
+			if err != nil {
+				return purged, err
+			}
+		}
+
+		// Every entry older than the cutoff between the first and last ID is part of the batch since it is ordered by ID
+		res, err := db.Exec("DELETE FROM kick_actions WHERE created_at < $1 AND id BETWEEN $2 AND $3", cutoff, rows[0].ID, rows[len(rows)-1].ID)
+		if err != nil {
+			return purged, err
+		}
+
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return purged, err
+		}
+
+		purged += int(rowsAffected)
+		if len(rows) < batchSize {
+			return purged, nil
+		}
+	}
+}
+
+func exportAuditRows(export io.Writer, rows []auditRow) error {
+	encoder := json.NewEncoder(export)
+	for _, row := range rows {
+		entry := auditExportEntry{
+			ID:        row.ID,
+			CreatedAt: row.CreatedAt,
+			ChannelID: row.ChannelID,
+			UID:       row.UID,
+			Duration:  row.Duration,
+		}
+
+		if row.UserID.Valid {
+			entry.UserID = &row.UserID.Int64
+		}
+
+		if row.RuleID.Valid {
+			entry.RuleID = &row.RuleID.Int64
+		}
+
+		if row.Error.Valid {
+			entry.Error = &row.Error.String
+		}
+
+		err := encoder.Encode(&entry)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// purgeExpiredAuditEntries purges the audit entries older than AUDIT_RETENTION_DAYS, appending them to
+// AUDIT_EXPORT_FILE first when it is set
+func purgeExpiredAuditEntries(db *models.Database, logger *utils.Logger) {
+	cutoff := time.Now().AddDate(0, 0, -viper.GetInt("AUDIT_RETENTION_DAYS"))
+
+	var export io.Writer
+	if path := viper.GetString("AUDIT_EXPORT_FILE"); path != "" {
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			logger.Error().Err(err).Str("file", path).Msg("Could not open audit export file, skipping purge")
+			return
+		}
+
+		defer file.Close()
+		export = file
+	}
+
+	purged, err := PurgeAuditEntries(db, cutoff, viper.GetInt("AUDIT_PURGE_BATCH_SIZE"), export)
+	if err != nil {
+		logger.Error().Err(err).Int("purged", purged).Msg("Could not purge audit entries")
+		return
+	}
+
+	if purged > 0 {
+		logger.Info().Int("purged", purged).Time("cutoff", cutoff).Msg("Purged expired audit entries")
+	}
+}
+
+// expiredRowConditions are the rows of tables which grow with every token or login and are pruned by StartPurge.
+// The condition compares with the current time as $1, or with the cutoff of AUDIT_RETENTION_DAYS for retained rows,
+// which are kept when no retention is set.
+var expiredRowConditions = []struct {
+	Table     string
+	Condition string
+	Retained  bool
+}{
+	{Table: "channel_tokens", Condition: "expires_at < $1"},
+	{Table: "service_tokens", Condition: "expires_at < $1"},
+	{Table: "usage_events", Condition: "created_at < $1", Retained: true},
+}
+
+// PurgeRows deletes the rows of the table matching the condition on the cutoff in batches of batchSize, so that a
+// large backlog does not lock the table for long
+func PurgeRows(db *models.Database, table string, condition string, cutoff time.Time, batchSize int) (int, error) {
+	if batchSize <= 0 {
+		return 0, errInvalidBatchSize
+	}
+
+	purged := 0
+	for {
+		res, err := db.Exec("DELETE FROM "+table+" WHERE ctid IN (SELECT ctid FROM "+table+" WHERE "+condition+" LIMIT $2)", cutoff, batchSize)
+		if err != nil {
+			return purged, err
+		}
+
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return purged, err
+		}
+
+		purged += int(rowsAffected)
+		if int(rowsAffected) < batchSize {
+			return purged, nil
+		}
+	}
+}
+
+// purgeExpiredRows deletes expired channel and service tokens, and the usage events older than AUDIT_RETENTION_DAYS
+// when it is set
+func purgeExpiredRows(db *models.Database, logger *utils.Logger) {
+	retentionDays := viper.GetInt("AUDIT_RETENTION_DAYS")
+	now := time.Now()
+
+	for _, expired := range expiredRowConditions {
+		cutoff := now
+		if expired.Retained {
+			if retentionDays <= 0 {
+				continue
+			}
+
+			cutoff = now.AddDate(0, 0, -retentionDays)
+		}
+
+		purged, err := PurgeRows(db, expired.Table, expired.Condition, cutoff, viper.GetInt("AUDIT_PURGE_BATCH_SIZE"))
+		if err != nil {
+			logger.Error().Err(err).Str("table", expired.Table).Int("purged", purged).Msg("Could not purge expired rows")
+			continue
+		}
+
+		if purged > 0 {
+			logger.Info().Str("table", expired.Table).Int("purged", purged).Msg("Purged expired rows")
+		}
+	}
+}
+
+// StartPurge periodically purges expired tokens, and the audit entries and usage events older than the retention
+// period when AUDIT_RETENTION_DAYS is set, until the process exits. It does nothing for an interval which is not positive.
+func StartPurge(db *models.Database, logger *utils.Logger, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			if viper.GetInt("AUDIT_RETENTION_DAYS") > 0 {
+				purgeExpiredAuditEntries(db, logger)
+			}
+
+			purgeExpiredRows(db, logger)
+		}
+	}()
+}
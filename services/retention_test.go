@@ -0,0 +1,71 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestCheckPurge(t *testing.T) {
+	tests := []struct {
+		name      string
+		interval  int
+		batchSize int
+		wantErr   bool
+	}{
+		{name: "defaults", interval: 3600, batchSize: 1000, wantErr: false},
+		{name: "zero interval", interval: 0, batchSize: 1000, wantErr: true},
+		{name: "negative interval", interval: -1, batchSize: 1000, wantErr: true},
+		{name: "zero batch size", interval: 3600, batchSize: 0, wantErr: true},
+		{name: "negative batch size", interval: 3600, batchSize: -10, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("AUDIT_PURGE_INTERVAL", tt.interval)
+			viper.Set("AUDIT_PURGE_BATCH_SIZE", tt.batchSize)
+			defer func() {
+				viper.Set("AUDIT_PURGE_INTERVAL", 3600)
+				viper.Set("AUDIT_PURGE_BATCH_SIZE", 1000)
+			}()
+
+			if err := CheckPurge(); (err != nil) != tt.wantErr {
+				t.Errorf("CheckPurge() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPurgeInvalidBatchSize(t *testing.T) {
+	tests := []struct {
+		name      string
+		batchSize int
+	}{
+		{name: "zero", batchSize: 0},
+		{name: "negative", batchSize: -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The database is never reached for an invalid batch size
+			if _, err := PurgeRows(nil, "usage_events", "created_at < $1", time.Now(), tt.batchSize); err != errInvalidBatchSize {
+				t.Errorf("PurgeRows() error = %v, want %v", err, errInvalidBatchSize)
+			}
+
+			if _, err := PurgeAuditEntries(nil, time.Now(), tt.batchSize, nil); err != errInvalidBatchSize {
+				t.Errorf("PurgeAuditEntries() error = %v, want %v", err, errInvalidBatchSize)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/samyak-jain/agora_backend/utils"
+	"github.com/spf13/viper"
+)
+
+// ErrMeetingNotStarted is returned by CheckSchedule before the window of a scheduled channel opens
+var ErrMeetingNotStarted = errors.New("meeting has not started")
+
+// ErrMeetingEnded is returned by CheckSchedule after the window of a scheduled channel closes
+var ErrMeetingEnded = errors.New("meeting has ended")
+
+// scheduleClosesAt returns when the window of a channel with a scheduled end closes, SCHEDULE_LATE_JOIN seconds after the end
+func scheduleClosesAt(channel *models.Channel) (time.Time, bool) {
+	if !channel.ScheduledEnd.Valid {
+		return time.Time{}, false
+	}
+
+	return channel.ScheduledEnd.Time.Add(time.Duration(viper.GetInt("SCHEDULE_LATE_JOIN")) * time.Second), true
+}
+
+// CheckSchedule only lets tokens be issued for a scheduled channel within its window. The window opens
+// SCHEDULE_EARLY_JOIN seconds before the scheduled start and closes SCHEDULE_LATE_JOIN seconds after the scheduled end.
+func CheckSchedule(channel *models.Channel, now time.Time) error {
+	if channel.ScheduledStart.Valid {
+		opensAt := channel.ScheduledStart.Time.Add(-time.Duration(viper.GetInt("SCHEDULE_EARLY_JOIN")) * time.Second)
+		if now.Before(opensAt) {
+			return ErrMeetingNotStarted
+		}
+	}
+
+	if closesAt, ok := scheduleClosesAt(channel); ok && now.After(closesAt) {
+		return ErrMeetingEnded
+	}
+
+	return nil
+}
+
+// ClampToSchedule shortens the requested token TTL so that tokens issued now for a scheduled channel expire when its
+// window closes. A request for the default TTL is only replaced when the RTC or RTM default would outlive the window.
+func ClampToSchedule(channel *models.Channel, now time.Time, requested int) int {
+	closesAt, ok := scheduleClosesAt(channel)
+	if !ok {
+		return requested
+	}
+
+	remaining := int(closesAt.Sub(now).Seconds())
+	if remaining < 1 {
+		remaining = 1
+	}
+
+	if requested <= 0 {
+		for _, endpoint := range []string{utils.RtcTokenEndpoint, utils.RtmTokenEndpoint} {
+			if ttl := utils.GetTokenTTL(endpoint, 0); ttl <= 0 || ttl > remaining {
+				return remaining
+			}
+		}
+
+		return requested
+	}
+
+	if requested > remaining {
+		return remaining
+	}
+
+	return requested
+}
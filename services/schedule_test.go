@@ -0,0 +1,87 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/spf13/viper"
+)
+
+func TestCheckSchedule(t *testing.T) {
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	at := func(offset time.Duration) sql.NullTime { return sql.NullTime{Time: now.Add(offset), Valid: true} }
+
+	tests := []struct {
+		name    string
+		start   sql.NullTime
+		end     sql.NullTime
+		wantErr error
+	}{
+		{name: "unscheduled", wantErr: nil},
+		{name: "within window", start: at(-time.Hour), end: at(time.Hour), wantErr: nil},
+		{name: "early join", start: at(5 * time.Minute), end: at(time.Hour), wantErr: nil},
+		{name: "too early", start: at(time.Hour), end: at(2 * time.Hour), wantErr: ErrMeetingNotStarted},
+		{name: "ended", start: at(-2 * time.Hour), end: at(-time.Hour), wantErr: ErrMeetingEnded},
+		{name: "open ended", start: at(-time.Hour), wantErr: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("SCHEDULE_EARLY_JOIN", 600)
+			viper.Set("SCHEDULE_LATE_JOIN", 0)
+
+			channel := &models.Channel{ScheduledStart: tt.start, ScheduledEnd: tt.end}
+			if err := CheckSchedule(channel, now); err != tt.wantErr {
+				t.Errorf("CheckSchedule() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClampToSchedule(t *testing.T) {
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	at := func(offset time.Duration) sql.NullTime { return sql.NullTime{Time: now.Add(offset), Valid: true} }
+
+	tests := []struct {
+		name      string
+		end       sql.NullTime
+		lateJoin  int
+		requested int
+		want      int
+	}{
+		{name: "unscheduled", requested: 7200, want: 7200},
+		{name: "unscheduled default", requested: 0, want: 0},
+		{name: "requested within window", end: at(2 * time.Hour), requested: 3600, want: 3600},
+		{name: "requested past window", end: at(time.Hour), requested: 7200, want: 3600},
+		{name: "late join extends window", end: at(time.Hour), lateJoin: 600, requested: 7200, want: 4200},
+		{name: "default past window", end: at(time.Hour), requested: 0, want: 3600},
+		{name: "default within window", end: at(48 * time.Hour), requested: 0, want: 0},
+		{name: "window closing", end: at(0), requested: 3600, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("SCHEDULE_LATE_JOIN", tt.lateJoin)
+			viper.Set("RTC_TOKEN_TTL", 86400)
+			viper.Set("RTM_TOKEN_TTL", 86400)
+			defer viper.Set("SCHEDULE_LATE_JOIN", 0)
+
+			channel := &models.Channel{ScheduledEnd: tt.end}
+			if got := ClampToSchedule(channel, now, tt.requested); got != tt.want {
+				t.Errorf("ClampToSchedule() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,326 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/samyak-jain/agora_backend/utils"
+	"github.com/spf13/viper"
+)
+
+// ErrInvalidClient is returned when the client ID is unknown or the secret does not match
+var ErrInvalidClient = errors.New("Invalid client credentials")
+
+// ErrInvalidScope is returned when a service client requests a scope it was not granted
+var ErrInvalidScope = errors.New("Requested scope was not granted to the client")
+
+// ErrUnknownScope is returned when a scope which is not in models.ServiceScopes is requested
+var ErrUnknownScope = errors.New("Unknown scope")
+
+// ErrTooManyScopes is returned when more than MAX_REQUESTED_SCOPES scopes are requested at once
+var ErrTooManyScopes = errors.New("Too many scopes requested")
+
+// ErrInvalidExpiry is returned when the requested expires_in of a service token is not a positive number of seconds
+var ErrInvalidExpiry = errors.New("Requested expiry must be a positive number of seconds")
+
+// ErrInvalidSubjectToken is returned when the token presented for downscoping is unknown or expired
+var ErrInvalidSubjectToken = errors.New("Invalid subject token")
+
+// TokenExchangeGrantType is the grant type of RFC 8693 token exchange, used to downscope a service token
+const TokenExchangeGrantType = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+// ServiceTokenResponse is the response of the client credentials grant
+type ServiceTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	Scope       string `json:"scope"`
+}
+
+type serviceTokenError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// hashClientSecret hashes a client secret for storage. Secrets are random and long, so a fast hash is enough.
+func hashClientSecret(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
+
+// RegisterServiceClient stores a new service client granted the scopes and returns its credentials.
+// The secret is only known to the caller, the database keeps its hash.
+func RegisterServiceClient(db *models.Database, scopes []string) (*models.ServiceClientCredentials, error) {
+	err := validateScopes(scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	clientID, err := utils.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := utils.GenerateSessionToken()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.NamedExec("INSERT INTO service_clients (client_id, secret_hash, scopes) VALUES (:client_id, :secret_hash, :scopes)", &models.ServiceClient{
+		ClientID:   clientID,
+		SecretHash: hashClientSecret(secret),
+		Scopes:     strings.Join(scopes, " "),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.ServiceClientCredentials{ClientID: clientID, ClientSecret: secret}, nil
+}
+
+// validateScopes rejects unknown scopes and lists longer than MAX_REQUESTED_SCOPES, before any of them is looked at
+func validateScopes(scopes []string) error {
+	if len(scopes) > viper.GetInt("MAX_REQUESTED_SCOPES") {
+		return fmt.Errorf("%w, at most %d are allowed", ErrTooManyScopes, viper.GetInt("MAX_REQUESTED_SCOPES"))
+	}
+
+	for _, scope := range scopes {
+		if !isServiceScope(scope) {
+			return fmt.Errorf("%w %s", ErrUnknownScope, scope)
+		}
+	}
+
+	return nil
+}
+
+func isServiceScope(scope string) bool {
+	for _, known := range models.ServiceScopes {
+		if scope == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+// serviceTokenTTL returns the lifetime of a new service token. The requested expires_in is clamped to
+// SERVICE_TOKEN_MAX_TTL, and SERVICE_TOKEN_TTL is used when none is requested.
+func serviceTokenTTL(requestedExpiry string) (time.Duration, error) {
+	ttl := viper.GetInt("SERVICE_TOKEN_TTL")
+	if requestedExpiry != "" {
+		requested, err := strconv.Atoi(requestedExpiry)
+		if err != nil || requested <= 0 {
+			return 0, ErrInvalidExpiry
+		}
+
+		ttl = requested
+	}
+
+	if maxTTL := viper.GetInt("SERVICE_TOKEN_MAX_TTL"); maxTTL > 0 && ttl > maxTTL {
+		ttl = maxTTL
+	}
+
+	return time.Duration(ttl) * time.Second, nil
+}
+
+// issueServiceToken exchanges the credentials of a service client for a token with the requested scopes.
+// A client which requests no scope is issued a token for every scope it was granted.
+func issueServiceToken(db *models.Database, clientID string, clientSecret string, requestedScope string, requestedExpiry string) (*models.ServiceToken, error) {
+	var client models.ServiceClient
+	err := db.Get(&client, "SELECT id, client_id, secret_hash, scopes FROM service_clients WHERE client_id = $1", clientID)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidClient
+	} else if err != nil {
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashClientSecret(clientSecret)), []byte(client.SecretHash)) != 1 {
+		return nil, ErrInvalidClient
+	}
+
+	scopes, err := requestScopes(client.Scopes, requestedScope)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl, err := serviceTokenTTL(requestedExpiry)
+	if err != nil {
+		return nil, err
+	}
+
+	return storeServiceToken(db, client.ID, scopes, utils.ClampExpiryToEventEnd(time.Now().Add(ttl)))
+}
+
+// downscopeServiceToken exchanges a service token for a short lived token with a subset of its scopes, which a
+// client can hand to a less trusted component. The new token never outlives the token it was exchanged for.
+func downscopeServiceToken(db *models.Database, subjectToken string, requestedScope string) (*models.ServiceToken, error) {
+	var subject models.ServiceToken
+	err := db.Get(&subject, "SELECT token_id, client_id, scopes, expires_at FROM service_tokens WHERE token_id = $1", subjectToken)
+	if err == sql.ErrNoRows || (err == nil && subject.ExpiresAt.Before(time.Now())) {
+		return nil, ErrInvalidSubjectToken
+	} else if err != nil {
+		return nil, err
+	}
+
+	scopes, err := requestScopes(subject.Scopes, requestedScope)
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(time.Duration(viper.GetInt("DOWNSCOPED_TOKEN_TTL")) * time.Second)
+	if subject.ExpiresAt.Before(expiresAt) {
+		expiresAt = subject.ExpiresAt
+	}
+
+	return storeServiceToken(db, subject.ClientID, scopes, utils.ClampExpiryToEventEnd(expiresAt))
+}
+
+// requestScopes checks that every requested scope is among the granted ones, and returns the scopes of the new token.
+// Requesting no scope requests every granted scope.
+func requestScopes(grantedScopes string, requestedScope string) (string, error) {
+	requested := strings.Fields(requestedScope)
+	if len(requested) == 0 {
+		return grantedScopes, nil
+	}
+
+	err := validateScopes(requested)
+	if err != nil {
+		return "", err
+	}
+
+	granted := &models.ServiceToken{Scopes: grantedScopes}
+	for _, scope := range requested {
+		if !granted.HasScope(scope) {
+			return "", ErrInvalidScope
+		}
+	}
+
+	return strings.Join(requested, " "), nil
+}
+
+func storeServiceToken(db *models.Database, clientID int64, scopes string, expiresAt time.Time) (*models.ServiceToken, error) {
+	if err := utils.CheckEventNotEnded(); err != nil {
+		return nil, err
+	}
+
+	tokenID, err := utils.GenerateSessionToken()
+	if err != nil {
+		return nil, err
+	}
+
+	token := &models.ServiceToken{
+		TokenID:   tokenID,
+		ClientID:  clientID,
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	}
+
+	_, err = db.NamedExec("INSERT INTO service_tokens (token_id, client_id, scopes, expires_at) VALUES (:token_id, :client_id, :scopes, :expires_at)", token)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// ServiceTokenEndpoint is a REST route implementing the OAuth client credentials grant for our own backends.
+// The credentials are read from HTTP basic auth or from the client_id and client_secret form values.
+// It also implements token exchange, which downscopes the service token passed as subject_token.
+func (router *ServiceRouter) ServiceTokenEndpoint(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := MaintenanceError(true)
+	if err != nil {
+		writeServiceTokenError(w, http.StatusServiceUnavailable, "temporarily_unavailable", err.Error())
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		writeServiceTokenError(w, http.StatusBadRequest, "invalid_request", "Could not parse form request")
+		return
+	}
+
+	var token *models.ServiceToken
+	var clientID string
+
+	switch r.PostForm.Get("grant_type") {
+	case "client_credentials":
+		var clientSecret string
+		var ok bool
+		clientID, clientSecret, ok = r.BasicAuth()
+		if !ok {
+			clientID = r.PostForm.Get("client_id")
+			clientSecret = r.PostForm.Get("client_secret")
+		}
+
+		token, err = issueServiceToken(router.DB, clientID, clientSecret, r.PostForm.Get("scope"), r.PostForm.Get("expires_in"))
+	case TokenExchangeGrantType:
+		if r.PostForm.Get("subject_token_type") != "urn:ietf:params:oauth:token-type:access_token" {
+			writeServiceTokenError(w, http.StatusBadRequest, "invalid_request", "Unsupported subject token type")
+			return
+		}
+
+		token, err = downscopeServiceToken(router.DB, r.PostForm.Get("subject_token"), r.PostForm.Get("scope"))
+	default:
+		writeServiceTokenError(w, http.StatusBadRequest, "unsupported_grant_type", "")
+		return
+	}
+
+	if errors.Is(err, ErrInvalidExpiry) {
+		writeServiceTokenError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	} else if errors.Is(err, ErrInvalidSubjectToken) || errors.Is(err, utils.ErrEventEnded) {
+		writeServiceTokenError(w, http.StatusBadRequest, "invalid_grant", err.Error())
+		return
+	} else if errors.Is(err, ErrInvalidClient) {
+		router.Logger.Info().Str("client", clientID).Msg("Rejected invalid client credentials")
+		writeServiceTokenError(w, http.StatusUnauthorized, "invalid_client", err.Error())
+		return
+	} else if errors.Is(err, ErrInvalidScope) || errors.Is(err, ErrUnknownScope) || errors.Is(err, ErrTooManyScopes) {
+		writeServiceTokenError(w, http.StatusBadRequest, "invalid_scope", err.Error())
+		return
+	} else if err != nil {
+		router.Logger.Error().Err(err).Str("client", clientID).Msg("Could not issue service token")
+		writeServiceTokenError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(ServiceTokenResponse{
+		AccessToken: token.TokenID,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(time.Until(token.ExpiresAt).Seconds()),
+		Scope:       token.Scopes,
+	})
+}
+
+func writeServiceTokenError(w http.ResponseWriter, status int, code string, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(serviceTokenError{Error: code, ErrorDescription: description})
+}
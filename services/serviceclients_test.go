@@ -0,0 +1,124 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/samyak-jain/agora_backend/pkg/models/dbtest"
+	"github.com/spf13/viper"
+)
+
+func TestValidateScopes(t *testing.T) {
+	viper.Set("MAX_REQUESTED_SCOPES", 2)
+
+	tests := []struct {
+		name    string
+		scopes  []string
+		wantErr error
+	}{
+		{name: "no scopes", scopes: nil, wantErr: nil},
+		{name: "known scopes", scopes: []string{models.UsageReadScope, models.UsersWriteScope}, wantErr: nil},
+		{name: "unknown scope", scopes: []string{"admin"}, wantErr: ErrUnknownScope},
+		{name: "too many scopes", scopes: []string{models.UsageReadScope, models.UsageReadScope, models.UsersWriteScope}, wantErr: ErrTooManyScopes},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateScopes(tt.scopes); !errors.Is(err, tt.wantErr) {
+				t.Errorf("validateScopes() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDownscopeServiceToken(t *testing.T) {
+	viper.Set("MAX_REQUESTED_SCOPES", 2)
+	viper.Set("DOWNSCOPED_TOKEN_TTL", 300)
+	defer viper.Set("DOWNSCOPED_TOKEN_TTL", 0)
+
+	subjectColumns := []string{"token_id", "client_id", "scopes", "expires_at"}
+	now := time.Now()
+
+	tests := []struct {
+		name       string
+		granted    string
+		expiresAt  time.Time
+		requested  string
+		wantScopes string
+		wantErr    error
+	}{
+		{name: "subset of the granted scopes", granted: "usage:read users:write", expiresAt: now.Add(time.Hour), requested: "usage:read", wantScopes: "usage:read"},
+		{name: "every granted scope", granted: "usage:read users:write", expiresAt: now.Add(time.Hour), requested: "", wantScopes: "usage:read users:write"},
+		{name: "scope which was not granted", granted: "usage:read", expiresAt: now.Add(time.Hour), requested: "usage:read users:write", wantErr: ErrInvalidScope},
+		{name: "unknown scope", granted: "usage:read", expiresAt: now.Add(time.Hour), requested: "admin", wantErr: ErrUnknownScope},
+		{name: "expired subject token", granted: "usage:read", expiresAt: now.Add(-time.Minute), requested: "usage:read", wantErr: ErrInvalidSubjectToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, mock := testRouter(t)
+			mock.ExpectQuery(`FROM service_tokens WHERE token_id = \$1`).WithArgs("subject-token").
+				WillReturnRows(subjectColumns, []interface{}{"subject-token", 7, tt.granted, tt.expiresAt})
+			if tt.wantErr == nil {
+				mock.ExpectExec(`INSERT INTO service_tokens`).WithArgs(dbtest.Any, 7, tt.wantScopes, dbtest.Any)
+			}
+
+			token, err := downscopeServiceToken(router.DB, "subject-token", tt.requested)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("downscopeServiceToken() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr == nil && (token.Scopes != tt.wantScopes || token.ClientID != 7 || token.ExpiresAt.After(now.Add(301*time.Second))) {
+				t.Errorf("downscopeServiceToken() = %+v, want scopes %q within the downscoped TTL", token, tt.wantScopes)
+			}
+		})
+	}
+}
+
+func TestServiceTokenTTL(t *testing.T) {
+	viper.Set("SERVICE_TOKEN_TTL", 3600)
+	viper.Set("SERVICE_TOKEN_MAX_TTL", 7776000)
+	defer viper.Set("SERVICE_TOKEN_TTL", 3600)
+	defer viper.Set("SERVICE_TOKEN_MAX_TTL", 7776000)
+
+	tests := []struct {
+		name    string
+		maxTTL  int
+		expiry  string
+		want    time.Duration
+		wantErr error
+	}{
+		{name: "default", maxTTL: 7776000, expiry: "", want: time.Hour},
+		{name: "requested", maxTTL: 7776000, expiry: "86400", want: 24 * time.Hour},
+		{name: "requested 90 days", maxTTL: 7776000, expiry: "7776000", want: 90 * 24 * time.Hour},
+		{name: "clamped to the maximum", maxTTL: 7776000, expiry: "31536000", want: 90 * 24 * time.Hour},
+		{name: "default clamped to the maximum", maxTTL: 600, expiry: "", want: 10 * time.Minute},
+		{name: "no maximum", maxTTL: 0, expiry: "31536000", want: 365 * 24 * time.Hour},
+		{name: "zero", maxTTL: 7776000, expiry: "0", wantErr: ErrInvalidExpiry},
+		{name: "negative", maxTTL: 7776000, expiry: "-60", wantErr: ErrInvalidExpiry},
+		{name: "not a number", maxTTL: 7776000, expiry: "90d", wantErr: ErrInvalidExpiry},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("SERVICE_TOKEN_MAX_TTL", tt.maxTTL)
+
+			got, err := serviceTokenTTL(tt.expiry)
+			if err != tt.wantErr || got != tt.want {
+				t.Errorf("serviceTokenTTL(%q) = %v, %v, want %v, %v", tt.expiry, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
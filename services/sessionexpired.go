@@ -0,0 +1,70 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+	"golang.org/x/oauth2"
+)
+
+// ErrAuthorizationCodeExpired is returned when the provider rejects the authorization code with invalid_grant,
+// usually because the user took too long to come back from the provider or reused the code
+var ErrAuthorizationCodeExpired = errors.New("Authorization code is expired or invalid")
+
+// CodeExpiredReason is the reason passed to SESSION_EXPIRED_URL when the authorization code was rejected
+const CodeExpiredReason = "code_expired"
+
+// isInvalidGrant reports whether the token endpoint of the provider answered with the invalid_grant error.
+// Providers answer with either a JSON or a form encoded body.
+func isInvalidGrant(err error) bool {
+	var retrieveErr *oauth2.RetrieveError
+	if !errors.As(err, &retrieveErr) {
+		return false
+	}
+
+	var body struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(retrieveErr.Body, &body) == nil {
+		return body.Error == "invalid_grant"
+	}
+
+	values, parseErr := url.ParseQuery(string(retrieveErr.Body))
+	return parseErr == nil && values.Get("error") == "invalid_grant"
+}
+
+// redirectSessionExpired sends a browser whose login failed back to SESSION_EXPIRED_URL with the reason in the query,
+// so that the UI can start the login again. It reports false when SESSION_EXPIRED_URL is not set or is not valid.
+func redirectSessionExpired(w http.ResponseWriter, r *http.Request, reason string) bool {
+	sessionExpiredURL := viper.GetString("SESSION_EXPIRED_URL")
+	if sessionExpiredURL == "" {
+		return false
+	}
+
+	newURL, err := url.Parse(sessionExpiredURL)
+	if err != nil {
+		log.Error().Err(err).Str("session_expired_url", sessionExpiredURL).Msg("Failed to parse session expired url")
+		return false
+	}
+
+	query := newURL.Query()
+	query.Set("reason", reason)
+	newURL.RawQuery = query.Encode()
+
+	http.Redirect(w, r, newURL.String(), http.StatusSeeOther)
+	return true
+}
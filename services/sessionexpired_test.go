@@ -0,0 +1,117 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/coreos/go-oidc"
+	"github.com/spf13/viper"
+)
+
+// testGoogleTokenError serves as Google for the test, with a token endpoint rejecting every code with the body
+func testGoogleTokenError(t *testing.T, contentType string, body string) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 server.URL,
+			"authorization_endpoint": server.URL + "/authorize",
+			"token_endpoint":         server.URL + "/token",
+			"jwks_uri":               server.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(body))
+	})
+
+	provider, err := oidc.NewProvider(context.Background(), server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oidcProvidersMutex.Lock()
+	oidcProviders["https://accounts.google.com"] = provider
+	oidcProvidersMutex.Unlock()
+	t.Cleanup(func() {
+		oidcProvidersMutex.Lock()
+		delete(oidcProviders, "https://accounts.google.com")
+		oidcProvidersMutex.Unlock()
+	})
+}
+
+func TestOAuthCodeExpired(t *testing.T) {
+	viper.Set("GOOGLE_CLIENT_ID", "client")
+	viper.Set("GOOGLE_CLIENT_SECRET", "secret")
+	defer func() {
+		viper.Set("GOOGLE_CLIENT_ID", nil)
+		viper.Set("GOOGLE_CLIENT_SECRET", nil)
+		viper.Set("SESSION_EXPIRED_URL", "")
+	}()
+
+	tests := []struct {
+		name              string
+		platform          string
+		sessionExpiredURL string
+		contentType       string
+		body              string
+		wantRedirect      string
+	}{
+		{name: "web with a JSON error", platform: "web", sessionExpiredURL: "https://app.example.com/expired", contentType: "application/json", body: `{"error":"invalid_grant"}`, wantRedirect: "https://app.example.com/expired?reason=code_expired"},
+		{name: "web with a form error", platform: "web", sessionExpiredURL: "https://app.example.com/expired?lang=en", contentType: "application/x-www-form-urlencoded", body: "error=invalid_grant", wantRedirect: "https://app.example.com/expired?lang=en&reason=code_expired"},
+		{name: "web without SESSION_EXPIRED_URL", platform: "web", contentType: "application/json", body: `{"error":"invalid_grant"}`},
+		{name: "mobile", platform: "mobile", sessionExpiredURL: "https://app.example.com/expired", contentType: "application/json", body: `{"error":"invalid_grant"}`},
+		{name: "other token error", platform: "web", sessionExpiredURL: "https://app.example.com/expired", contentType: "application/json", body: `{"error":"invalid_client"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("SESSION_EXPIRED_URL", tt.sessionExpiredURL)
+			testGoogleTokenError(t, tt.contentType, tt.body)
+
+			router, mock := testRouter(t)
+			mock.ExpectQuery(`FROM credentials WHERE code=\$1`).WithArgs("code")
+
+			state := url.Values{
+				"redirect": {"https://app.example.com/login"},
+				"backend":  {"https://backend.example.com"},
+				"site":     {"google"},
+				"platform": {tt.platform},
+			}
+			query := url.Values{"code": {"code"}, "state": {state.Encode()}}
+
+			w := httptest.NewRecorder()
+			router.OAuth(w, httptest.NewRequest("GET", "/oauth?"+query.Encode(), nil))
+
+			if tt.wantRedirect != "" {
+				if w.Code != http.StatusSeeOther || w.Header().Get("Location") != tt.wantRedirect {
+					t.Errorf("OAuth() = %d to %q, want %d to %q", w.Code, w.Header().Get("Location"), http.StatusSeeOther, tt.wantRedirect)
+				}
+				return
+			}
+
+			if w.Header().Get("Location") != "" || !strings.Contains(w.Body.String(), "oauth2: cannot fetch token") {
+				t.Errorf("OAuth() = %d to %q with %q, want the provider error", w.Code, w.Header().Get("Location"), w.Body.String())
+			}
+		})
+	}
+}
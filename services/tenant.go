@@ -0,0 +1,38 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// TenantForEmail picks the tenant of a new user from the domain of their email.
+// EMAIL_DOMAIN_TENANTS maps domains to tenants with entries such as example.com=acme, and emails of unmapped domains
+// belong to DEFAULT_TENANT. No tenant is assigned when neither applies. Anybody can claim an unverified email, so it
+// is never mapped by its domain and only gets DEFAULT_TENANT.
+func TenantForEmail(email string, verified bool) sql.NullString {
+	domain := strings.ToLower(email[strings.LastIndex(email, "@")+1:])
+
+	if verified {
+		for _, entry := range viper.GetStringSlice("EMAIL_DOMAIN_TENANTS") {
+			parts := strings.SplitN(entry, "=", 2)
+			if len(parts) == 2 && strings.ToLower(strings.TrimSpace(parts[0])) == domain {
+				return sql.NullString{String: strings.TrimSpace(parts[1]), Valid: true}
+			}
+		}
+	}
+
+	tenant := viper.GetString("DEFAULT_TENANT")
+	return sql.NullString{String: tenant, Valid: tenant != ""}
+}
@@ -0,0 +1,49 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestTenantForEmail(t *testing.T) {
+	viper.Set("EMAIL_DOMAIN_TENANTS", []string{"example.com=acme", " Other.org = globex "})
+	defer viper.Set("EMAIL_DOMAIN_TENANTS", []string{})
+
+	tests := []struct {
+		name          string
+		email         string
+		verified      bool
+		defaultTenant string
+		want          sql.NullString
+	}{
+		{name: "mapped domain", email: "user@example.com", verified: true, want: sql.NullString{String: "acme", Valid: true}},
+		{name: "mapped domain with spaces and capitals", email: "user@OTHER.org", verified: true, want: sql.NullString{String: "globex", Valid: true}},
+		{name: "unmapped domain", email: "user@unknown.com", verified: true, defaultTenant: "public", want: sql.NullString{String: "public", Valid: true}},
+		{name: "unmapped domain without default", email: "user@unknown.com", verified: true, want: sql.NullString{}},
+		{name: "unverified mapped domain", email: "user@example.com", verified: false, want: sql.NullString{}},
+		{name: "unverified mapped domain with default", email: "user@example.com", verified: false, defaultTenant: "public", want: sql.NullString{String: "public", Valid: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("DEFAULT_TENANT", tt.defaultTenant)
+			defer viper.Set("DEFAULT_TENANT", "")
+
+			if got := TenantForEmail(tt.email, tt.verified); got != tt.want {
+				t.Errorf("TenantForEmail() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/spf13/viper"
+)
+
+// TenantOverridableKeys lists the settings a tenant can override, anything else always comes from the global config
+var TenantOverridableKeys = []string{
+	"SESSION_TOKEN_TTL",
+	"SESSION_TOKEN_MAX_TTL",
+	"ENABLE_GOOGLE_OAUTH",
+	"ENABLE_MICROSOFT_OAUTH",
+	"ENABLE_SLACK_OAUTH",
+	"ENABLE_APPLE_OAUTH",
+	"ENABLE_RECORDING",
+	"MAX_CONCURRENT_RECORDINGS",
+	"CHANNEL_NAME_BLOCKLIST",
+}
+
+// ErrNotTenantOverridable is returned when setting a key which is not in TenantOverridableKeys
+var ErrNotTenantOverridable = errors.New("Setting cannot be overridden per tenant")
+
+// ErrInvalidTenantSetting is returned when setting a value which does not fit the type of the key
+var ErrInvalidTenantSetting = errors.New("Setting value is invalid")
+
+// TenantConfig resolves settings as the tenant's override from the tenant_settings table over the global config
+type TenantConfig struct {
+	overrides map[string]string
+}
+
+// GetString returns the tenant's override of the key, or the global setting
+func (c *TenantConfig) GetString(key string) string {
+	if c != nil {
+		if value, ok := c.overrides[key]; ok {
+			return value
+		}
+	}
+
+	return viper.GetString(key)
+}
+
+// GetInt returns the tenant's override of the key, or the global setting when there is none or it is not a number
+func (c *TenantConfig) GetInt(key string) int {
+	if c != nil {
+		if value, err := strconv.Atoi(c.overrides[key]); err == nil {
+			return value
+		}
+	}
+
+	return viper.GetInt(key)
+}
+
+// GetBool returns the tenant's override of the key, or the global setting when there is none or it is not a boolean
+func (c *TenantConfig) GetBool(key string) bool {
+	if c != nil {
+		if value, err := strconv.ParseBool(c.overrides[key]); err == nil {
+			return value
+		}
+	}
+
+	return viper.GetBool(key)
+}
+
+// GetStringSlice returns the tenant's override of the key as a comma separated list, or the global setting.
+// An empty override is an empty list.
+func (c *TenantConfig) GetStringSlice(key string) []string {
+	if c != nil {
+		if value, ok := c.overrides[key]; ok {
+			var values []string
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					values = append(values, item)
+				}
+			}
+			return values
+		}
+	}
+
+	return viper.GetStringSlice(key)
+}
+
+type cachedTenantConfig struct {
+	config   *TenantConfig
+	loadedAt time.Time
+}
+
+var (
+	tenantConfigMutex sync.Mutex
+	tenantConfigCache = map[string]cachedTenantConfig{}
+)
+
+// LoadTenantConfig returns the effective config of the tenant. Overrides are cached for TENANT_CONFIG_CACHE_TTL
+// seconds, so changes take up to that long to apply. Users without a tenant get the global config.
+func LoadTenantConfig(ctx context.Context, db *models.Database, tenant sql.NullString) (*TenantConfig, error) {
+	if !tenant.Valid {
+		return &TenantConfig{}, nil
+	}
+
+	tenantConfigMutex.Lock()
+	cached, ok := tenantConfigCache[tenant.String]
+	tenantConfigMutex.Unlock()
+
+	if ok && time.Since(cached.loadedAt) < time.Duration(viper.GetInt("TENANT_CONFIG_CACHE_TTL"))*time.Second {
+		return cached.config, nil
+	}
+
+	var settings []struct {
+		Key   string `db:"key"`
+		Value string `db:"value"`
+	}
+
+	err := db.SelectContext(ctx, &settings, "SELECT key, value FROM tenant_settings WHERE tenant = $1", tenant.String)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &TenantConfig{overrides: map[string]string{}}
+	for _, setting := range settings {
+		config.overrides[setting.Key] = setting.Value
+	}
+
+	tenantConfigMutex.Lock()
+	tenantConfigCache[tenant.String] = cachedTenantConfig{config: config, loadedAt: time.Now()}
+	tenantConfigMutex.Unlock()
+
+	return config, nil
+}
+
+// SetTenantSetting stores the tenant's override of the key, or removes it when the value is nil
+func SetTenantSetting(db *models.Database, tenant string, key string, value *string) error {
+	if !isTenantOverridableKey(key) {
+		return fmt.Errorf("%w: %s", ErrNotTenantOverridable, key)
+	}
+
+	if value != nil {
+		if err := validateTenantSetting(key, *value); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	if value == nil {
+		_, err = db.Exec("DELETE FROM tenant_settings WHERE tenant = $1 AND key = $2", tenant, key)
+	} else {
+		_, err = db.Exec("INSERT INTO tenant_settings (tenant, key, value) VALUES ($1, $2, $3) ON CONFLICT (tenant, key) DO UPDATE SET value = EXCLUDED.value", tenant, key, *value)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	tenantConfigMutex.Lock()
+	delete(tenantConfigCache, tenant)
+	tenantConfigMutex.Unlock()
+
+	return nil
+}
+
+// validateTenantSetting makes sure an override parses as the type the key is read as. Otherwise it would silently fall
+// back to the global setting.
+func validateTenantSetting(key string, value string) error {
+	switch key {
+	case "SESSION_TOKEN_TTL", "SESSION_TOKEN_MAX_TTL", "MAX_CONCURRENT_RECORDINGS":
+		number, err := strconv.Atoi(value)
+		if err != nil || number < 0 {
+			return fmt.Errorf("%w: %s must be a non-negative integer", ErrInvalidTenantSetting, key)
+		}
+	case "ENABLE_GOOGLE_OAUTH", "ENABLE_MICROSOFT_OAUTH", "ENABLE_SLACK_OAUTH", "ENABLE_APPLE_OAUTH", "ENABLE_RECORDING":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("%w: %s must be true or false", ErrInvalidTenantSetting, key)
+		}
+	}
+
+	return nil
+}
+
+func isTenantOverridableKey(key string) bool {
+	for _, overridable := range TenantOverridableKeys {
+		if key == overridable {
+			return true
+		}
+	}
+
+	return false
+}
+
+// providerEnableKey returns the setting which enables the OAuth provider of the site
+func providerEnableKey(site string) string {
+	for _, provider := range OAuthProviders {
+		if provider.Site == site {
+			return provider.EnableKey
+		}
+	}
+
+	return ""
+}
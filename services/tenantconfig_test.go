@@ -0,0 +1,91 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/samyak-jain/agora_backend/pkg/models/dbtest"
+)
+
+func TestSetTenantSettingValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		value   string
+		wantErr error
+	}{
+		{name: "not overridable", key: "APP_ID", value: "app", wantErr: ErrNotTenantOverridable},
+		{name: "ttl", key: "SESSION_TOKEN_TTL", value: "3600", wantErr: nil},
+		{name: "zero max ttl", key: "SESSION_TOKEN_MAX_TTL", value: "0", wantErr: nil},
+		{name: "ttl with unit", key: "SESSION_TOKEN_TTL", value: "1h", wantErr: ErrInvalidTenantSetting},
+		{name: "negative ttl", key: "SESSION_TOKEN_MAX_TTL", value: "-1", wantErr: ErrInvalidTenantSetting},
+		{name: "recording cap", key: "MAX_CONCURRENT_RECORDINGS", value: "two", wantErr: ErrInvalidTenantSetting},
+		{name: "boolean", key: "ENABLE_RECORDING", value: "false", wantErr: nil},
+		{name: "not a boolean", key: "ENABLE_APPLE_OAUTH", value: "yes", wantErr: ErrInvalidTenantSetting},
+		{name: "list", key: "CHANNEL_NAME_BLOCKLIST", value: "admin, support", wantErr: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			if tt.wantErr == nil {
+				err = validateTenantSetting(tt.key, tt.value)
+			} else {
+				// Invalid settings are refused before the database is reached
+				value := tt.value
+				err = SetTenantSetting(nil, "acme", tt.key, &value)
+			}
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadTenantConfigContext(t *testing.T) {
+	expired, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		tenant  string
+		wantErr bool
+	}{
+		{name: "loaded", ctx: context.Background(), tenant: "context-loaded"},
+		{name: "timed out", ctx: expired, tenant: "context-timed-out", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := dbtest.New(t)
+			if !tt.wantErr {
+				mock.ExpectQuery(`FROM tenant_settings WHERE tenant = \$1`).WithArgs(tt.tenant).
+					WillReturnRows([]string{"key", "value"}, []interface{}{"SESSION_TOKEN_TTL", "60"})
+			}
+
+			config, err := LoadTenantConfig(tt.ctx, db, sql.NullString{String: tt.tenant, Valid: true})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadTenantConfig() = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && config.GetInt("SESSION_TOKEN_TTL") != 60 {
+				t.Errorf("SESSION_TOKEN_TTL = %d, want 60", config.GetInt("SESSION_TOKEN_TTL"))
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/samyak-jain/agora_backend/utils"
+)
+
+const maxUIDAttempts = 16
+
+// ErrUIDExhausted is returned when every derived candidate uid is already used by other users
+var ErrUIDExhausted = errors.New("Could not find an unused uid")
+
+// userUID is the uid persisted for a user, along with the attempt of DeriveUserUID it was derived from
+type userUID struct {
+	UID     sql.NullInt64 `db:"uid"`
+	Attempt int           `db:"uid_attempt"`
+}
+
+// GetUserUID returns the uid persisted for the user, deriving and storing one if the user has none yet
+func GetUserUID(db *models.Database, userID int64) (int, error) {
+	var current userUID
+	err := db.Get(&current, "SELECT uid, uid_attempt FROM users WHERE id = $1", userID)
+	if err != nil {
+		return 0, err
+	}
+
+	if current.UID.Valid {
+		return int(current.UID.Int64), nil
+	}
+
+	return assignUserUID(db, userID, current.Attempt)
+}
+
+// RegenerateUserUID replaces the uid of the user with a different one which no other user has.
+// The candidates continue after the attempt of the current uid, so that regenerating never returns to an earlier uid.
+func RegenerateUserUID(db *models.Database, userID int64) (int, error) {
+	var current userUID
+	err := db.Get(&current, "SELECT uid, uid_attempt FROM users WHERE id = $1", userID)
+	if err != nil {
+		return 0, err
+	}
+
+	firstAttempt := current.Attempt
+	if current.UID.Valid {
+		firstAttempt++
+	}
+
+	return assignUserUID(db, userID, firstAttempt)
+}
+
+// assignUserUID walks through the derived candidates of the user from firstAttempt on and stores the first one which
+// is unused, along with its attempt. The unique index on users.uid guards against two users claiming the same
+// candidate at once.
+func assignUserUID(db *models.Database, userID int64, firstAttempt int) (int, error) {
+	userKey := strconv.FormatInt(userID, 10)
+
+	for attempt := firstAttempt; attempt < firstAttempt+maxUIDAttempts; attempt++ {
+		candidate := utils.DeriveUserUID(userKey, attempt)
+
+		result, err := db.Exec("UPDATE users SET uid = $1, uid_attempt = $2 WHERE id = $3 AND NOT EXISTS (SELECT 1 FROM users WHERE uid = $1)", candidate, attempt, userID)
+		if utils.IsUniqueViolation(err) {
+			// Another user claimed the candidate between the check and the update
+			continue
+		} else if err != nil {
+			return 0, err
+		}
+
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+
+		if rows == 1 {
+			return candidate, nil
+		}
+	}
+
+	return 0, ErrUIDExhausted
+}
@@ -0,0 +1,43 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"time"
+
+	"github.com/samyak-jain/agora_backend/pkg/models"
+)
+
+// RecordUsageEvent stores an event which is counted by GetUsageStats
+func RecordUsageEvent(db *models.Database, event *models.UsageEvent) error {
+	_, err := db.NamedExec("INSERT INTO usage_events (kind, channel_id, user_id) VALUES (:kind, :channel_id, :user_id)", event)
+	return err
+}
+
+// GetUsageStats aggregates the usage in the window [from, to) in a single round trip.
+// Logins and active users are counted from the login events, as tokens are also issued by rotations and other flows.
+func GetUsageStats(db *models.Database, from time.Time, to time.Time) (*models.UsageStats, error) {
+	stats := models.UsageStats{From: from, To: to}
+
+	err := db.Get(&stats, `SELECT
+		(SELECT COUNT(*) FROM usage_events WHERE kind = $5 AND created_at >= $1 AND created_at < $2) AS logins,
+		(SELECT COUNT(DISTINCT user_id) FROM usage_events WHERE kind = $5 AND created_at >= $1 AND created_at < $2) AS active_users,
+		(SELECT COUNT(*) FROM users WHERE created_at >= $1 AND created_at < $2) AS new_users,
+		(SELECT COUNT(*) FROM channels WHERE created_at >= $1 AND created_at < $2) AS channels_created,
+		(SELECT COUNT(*) FROM usage_events WHERE kind = $3 AND created_at >= $1 AND created_at < $2) AS tokens_issued,
+		(SELECT COUNT(*) FROM usage_events WHERE kind = $4 AND created_at >= $1 AND created_at < $2) AS recordings_started`,
+		from, to, models.TokenUsageEvent, models.RecordingUsageEvent, models.LoginUsageEvent)
+	if err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
@@ -0,0 +1,56 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/samyak-jain/agora_backend/pkg/models/dbtest"
+)
+
+var usageStatsColumnNames = []string{"logins", "active_users", "new_users", "channels_created", "tokens_issued", "recordings_started"}
+
+func TestGetUsageStats(t *testing.T) {
+	from := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+
+	tests := []struct {
+		name string
+		row  []interface{}
+		want models.UsageStats
+	}{
+		{name: "empty window", row: []interface{}{0, 0, 0, 0, 0, 0}, want: models.UsageStats{From: from, To: to}},
+		{name: "seeded window", row: []interface{}{12, 5, 3, 4, 40, 2},
+			want: models.UsageStats{From: from, To: to, Logins: 12, ActiveUsers: 5, NewUsers: 3, ChannelsCreated: 4, TokensIssued: 40, RecordingsStarted: 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := dbtest.New(t)
+
+			// Every aggregate is computed from the same window in one query
+			mock.ExpectQuery(`COUNT\(DISTINCT user_id\) FROM usage_events WHERE kind = \$5 AND created_at >= \$1 AND created_at < \$2`).
+				WithArgs(from, to, models.TokenUsageEvent, models.RecordingUsageEvent, models.LoginUsageEvent).
+				WillReturnRows(usageStatsColumnNames, tt.row)
+
+			stats, err := GetUsageStats(db, from, to)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if *stats != tt.want {
+				t.Errorf("GetUsageStats() = %+v, want %+v", stats, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"context"
+
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/samyak-jain/agora_backend/utils"
+)
+
+// DeleteUser hard deletes a user along with its session tokens and stored provider credentials in a single transaction.
+// The tokens are deleted explicitly instead of relying on ON DELETE CASCADE, which databases migrated by hand may lack,
+// so that no session is left pointing at a user which does not exist anymore. Records kept for auditing, like kick
+// actions and usage events, only lose their reference to the user.
+func DeleteUser(ctx context.Context, db *models.Database, userID int64) error {
+	ctx, cancel := utils.QueryContext(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return utils.QueryError(ctx, err)
+	}
+
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM tokens WHERE user_id = $1", userID)
+	if err != nil {
+		return utils.QueryError(ctx, err)
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM credentials WHERE user_id = $1", userID)
+	if err != nil {
+		return utils.QueryError(ctx, err)
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM users WHERE id = $1", userID)
+	if err != nil {
+		return utils.QueryError(ctx, err)
+	}
+
+	return utils.QueryError(ctx, tx.Commit())
+}
@@ -0,0 +1,64 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/samyak-jain/agora_backend/pkg/models/dbtest"
+)
+
+func TestDeleteUser(t *testing.T) {
+	errDatabase := errors.New("database is down")
+
+	tests := []struct {
+		name      string
+		failingAt string
+		wantErr   error
+	}{
+		{name: "tokens and credentials go with the user"},
+		{name: "tokens cannot be deleted", failingAt: "tokens", wantErr: errDatabase},
+		{name: "credentials cannot be deleted", failingAt: "credentials", wantErr: errDatabase},
+		{name: "user cannot be deleted", failingAt: "users", wantErr: errDatabase},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := dbtest.New(t)
+
+			// Every statement runs in one transaction, so a failure leaves no user without its tokens or the reverse
+			mock.ExpectBegin()
+			for _, statement := range []struct{ table, pattern string }{
+				{"tokens", `DELETE FROM tokens WHERE user_id = \$1`},
+				{"credentials", `DELETE FROM credentials WHERE user_id = \$1`},
+				{"users", `DELETE FROM users WHERE id = \$1`},
+			} {
+				exec := mock.ExpectExec(statement.pattern).WithArgs(5)
+				if statement.table == tt.failingAt {
+					exec.WillReturnError(errDatabase)
+					break
+				}
+			}
+
+			if tt.wantErr == nil {
+				mock.ExpectCommit()
+			} else {
+				mock.ExpectRollback()
+			}
+
+			if err := DeleteUser(context.Background(), db, 5); !errors.Is(err, tt.wantErr) {
+				t.Errorf("DeleteUser() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
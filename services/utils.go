@@ -14,6 +14,7 @@ import (
 	"crypto/x509"
 	"encoding/pem"
 	"errors"
+	"net/url"
 	"regexp"
 	"strings"
 	"time"
@@ -28,29 +29,144 @@ import (
 type ServiceRouter struct {
 	DB     *models.Database
 	Logger *utils.Logger
+	Audit  *AuditForwarder
 }
 
-// AllowListValidator takes an email and searches the Allow List for a match
-func (r *ServiceRouter) AllowListValidator(email string) (bool, error) {
-	for _, value := range viper.GetStringSlice("ALLOW_LIST") {
+// testModeUser is the fake user every login resolves to in test mode
+func testModeUser() *User {
+	return &User{
+		ID:            viper.GetString("TEST_MODE_USER_ID"),
+		Name:          viper.GetString("TEST_MODE_USER_NAME"),
+		Email:         viper.GetString("TEST_MODE_USER_EMAIL"),
+		EmailVerified: true,
+	}
+}
+
+// decideAllowList checks the email against the DENY_LIST and then the allow list entries, and reports which rule decided
+func decideAllowList(logger *utils.Logger, entries []string, email string) (*models.EmailValidationResult, error) {
+	decision := &models.EmailValidationResult{Email: email}
+
+	if rule := deniedBy(email); rule != "" {
+		logger.Info().Str("Email", email).Str("Match", rule).Msg("Email matched the Deny List")
+		decision.Denied = true
+		decision.MatchedRule = &rule
+		return decision, nil
+	}
+
+	for _, value := range entries {
+		value := value
 
-		pattern := wildCardToRegexp(value)
-		r.Logger.Debug().Str("Allow List Pattern", value).Str("Email", email).Str("Regex Pattern", pattern).Msg("Allow List Debug Information")
+		pattern := emailPattern(value)
+		logger.Debug().Str("Allow List Pattern", value).Str("Email", email).Str("Regex Pattern", pattern).Msg("Allow List Debug Information")
 
 		match, err := regexp.MatchString(pattern, email)
 		if err != nil {
-			r.Logger.Error().Err(err).Str("Pattern", value).Str("Email", email).Msg("Could not match wildcard")
-			return false, err
+			logger.Error().Err(err).Str("Pattern", value).Str("Email", email).Msg("Could not match wildcard")
+			return nil, err
 		}
 
 		if match {
-			r.Logger.Info().Str("Email", email).Str("Match", value).Msg("Allow list email matched")
-			return true, nil
+			logger.Info().Str("Email", email).Str("Match", value).Msg("Allow list email matched")
+			decision.Allowed = true
+			decision.MatchedRule = &value
+			return decision, nil
 		}
 	}
 
-	r.Logger.Info().Str("Email", email).Msg("No match found for email in Allow List")
-	return false, nil
+	logger.Info().Str("Email", email).Msg("No match found for email in Allow List")
+	return decision, nil
+}
+
+// decideLogin is the allow list decision of a login. ValidateEmails shares it so that the dry run always agrees with
+// the login. The break-glass account skips the allow list, even when it cannot be loaded. An email which the allow
+// list does not match, and the deny list does not reject, is still let in when grandfathered reports an existing user.
+func decideLogin(logger *utils.Logger, loadEntries func() ([]string, error), email string, breakGlass bool, grandfathered func() (bool, error)) (*models.EmailValidationResult, error) {
+	if breakGlass {
+		return &models.EmailValidationResult{Email: email, Allowed: true, BreakGlass: true}, nil
+	}
+
+	entries, err := loadEntries()
+	if err != nil {
+		logger.Error().Err(err).Msg("Could not load Allow List")
+		return nil, err
+	}
+
+	decision, err := decideAllowList(logger, entries, email)
+	if err != nil {
+		return nil, err
+	}
+
+	if decision.Allowed || decision.Denied {
+		return decision, nil
+	}
+
+	decision.Grandfathered, err = grandfathered()
+	if err != nil {
+		return nil, err
+	}
+
+	decision.Allowed = decision.Grandfathered
+	return decision, nil
+}
+
+// ValidateEmails decides for each email whether it would pass the allow list at login, loading the allow list once.
+// The emails are taken to be verified, to belong to the user who already signed in with them, if any, and to be signed
+// in with the break-glass identity of BREAK_GLASS_PROVIDER and BREAK_GLASS_SUBJECT.
+func ValidateEmails(db *models.Database, logger *utils.Logger, emails []string) ([]*models.EmailValidationResult, error) {
+	entries, err := MergedAllowList(db)
+	if err != nil {
+		return nil, err
+	}
+
+	loadEntries := func() ([]string, error) { return entries, nil }
+
+	results := []*models.EmailValidationResult{}
+	for _, email := range emails {
+		email := utils.NormalizeEmail(email)
+		decision, err := decideLogin(logger, loadEntries, email, IsBreakGlass(viper.GetString("BREAK_GLASS_PROVIDER"), viper.GetString("BREAK_GLASS_SUBJECT"), email, true), func() (bool, error) {
+			return isGrandfatheredEmail(db, email)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, decision)
+	}
+
+	return results, nil
+}
+
+// emailPattern converts an allow, deny or admin list entry into a regular expression which matches the whole email and
+// honours CASE_INSENSITIVE_EMAIL
+func emailPattern(value string) string {
+	pattern := "^(?:" + wildCardToRegexp(value) + ")$"
+	if utils.CaseInsensitiveEmails() {
+		return "(?i)" + pattern
+	}
+
+	return pattern
+}
+
+// stripRedirectParams removes the query params listed in REDIRECT_STRIP_PARAMS from the redirect URL, keeping every other param.
+// A redirect which cannot be parsed is returned unchanged and rejected later on.
+func stripRedirectParams(redirect string) string {
+	denylist := viper.GetStringSlice("REDIRECT_STRIP_PARAMS")
+	if len(denylist) == 0 {
+		return redirect
+	}
+
+	redirectURL, err := url.Parse(redirect)
+	if err != nil {
+		return redirect
+	}
+
+	query := redirectURL.Query()
+	for _, param := range denylist {
+		query.Del(param)
+	}
+
+	redirectURL.RawQuery = query.Encode()
+	return redirectURL.String()
 }
 
 // Converts a wildcard string to RegExp Pattern
@@ -0,0 +1,72 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/samyak-jain/agora_backend/utils"
+	"github.com/spf13/viper"
+	"golang.org/x/oauth2"
+)
+
+func TestStripRedirectParams(t *testing.T) {
+	defer viper.Set("REDIRECT_STRIP_PARAMS", []string{})
+
+	tests := []struct {
+		name     string
+		denylist []string
+		redirect string
+		want     string
+	}{
+		{name: "token and code removed", denylist: []string{"token", "code"}, redirect: "https://app.example.com/join?token=old&code=abc&channel=xyz", want: "https://app.example.com/join?channel=xyz"},
+		{name: "other params kept", denylist: []string{"token"}, redirect: "https://app.example.com/join?channel=xyz&lang=en", want: "https://app.example.com/join?channel=xyz&lang=en"},
+		{name: "repeated param removed", denylist: []string{"token"}, redirect: "https://app.example.com/?token=a&token=b&x=1", want: "https://app.example.com/?x=1"},
+		{name: "fragment kept", denylist: []string{"token"}, redirect: "https://app.example.com/?token=a#/room", want: "https://app.example.com/#/room"},
+		{name: "custom scheme", denylist: []string{"code"}, redirect: "myapp://login?code=abc&state=1", want: "myapp://login?state=1"},
+		{name: "empty denylist", denylist: []string{}, redirect: "https://app.example.com/?token=a", want: "https://app.example.com/?token=a"},
+		{name: "unparsable redirect unchanged", denylist: []string{"token"}, redirect: "http://[::1", want: "http://[::1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("REDIRECT_STRIP_PARAMS", tt.denylist)
+
+			if got := stripRedirectParams(tt.redirect); got != tt.want {
+				t.Errorf("stripRedirectParams(%q) = %q, want %q", tt.redirect, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetUserInfoTestMode(t *testing.T) {
+	viper.Set("TEST_MODE", true)
+	viper.Set("ENVIRONMENT", utils.TestEnvironment)
+	viper.Set("TEST_MODE_USER_ID", "fake-id")
+	viper.Set("TEST_MODE_USER_NAME", "Fake User")
+	viper.Set("TEST_MODE_USER_EMAIL", "fake@example.com")
+	defer viper.Set("TEST_MODE", false)
+	defer viper.Set("ENVIRONMENT", utils.ProductionEnvironment)
+
+	// Neither the provider nor the database is used
+	router, _ := testRouter(t)
+
+	user, err := router.GetUserInfo(context.Background(), oauth2.Config{}, Details{Code: "code", OAuthSite: "google"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := User{ID: "fake-id", Name: "Fake User", Email: "fake@example.com", EmailVerified: true}
+	if *user != want {
+		t.Errorf("GetUserInfo() = %+v, want %+v", user, want)
+	}
+}
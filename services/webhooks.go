@@ -0,0 +1,144 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/samyak-jain/agora_backend/utils"
+	"github.com/spf13/viper"
+)
+
+// Headers of a webhook delivery
+const (
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+)
+
+// ErrUnknownWebhookEventType is returned when subscribing to an event type which is not in models.WebhookEventTypes
+var ErrUnknownWebhookEventType = errors.New("Unknown event type")
+
+// SignWebhookPayload returns the hex encoded HMAC-SHA256 of "<timestamp>.<body>" with the subscription secret, which
+// is sent prefixed with "sha256=" in the X-Webhook-Signature header. The timestamp is the unix time of the delivery
+// sent in X-Webhook-Timestamp, so that receivers can refuse old deliveries and a captured one cannot be replayed.
+func SignWebhookPayload(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// CreateWebhookSubscription stores an active subscription to the event types, or to every event when none are given
+func CreateWebhookSubscription(db *models.Database, url string, eventTypes []string, secret string) (int64, error) {
+	for _, eventType := range eventTypes {
+		if !isWebhookEventType(eventType) {
+			return 0, fmt.Errorf("%w %s", ErrUnknownWebhookEventType, eventType)
+		}
+	}
+
+	var id int64
+	err := db.Get(&id, "INSERT INTO webhook_subscriptions (url, event_types, secret) VALUES ($1, $2, $3) RETURNING id", url, strings.Join(eventTypes, ","), secret)
+	return id, err
+}
+
+// SetWebhookSubscriptionActive pauses or resumes deliveries to a subscription and reports whether it exists
+func SetWebhookSubscriptionActive(db *models.Database, id int64, active bool) (bool, error) {
+	res, err := db.Exec("UPDATE webhook_subscriptions SET active = $1 WHERE id = $2", active, id)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	return rowsAffected > 0, err
+}
+
+func isWebhookEventType(eventType string) bool {
+	for _, known := range models.WebhookEventTypes {
+		if eventType == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DispatchWebhookEvent delivers the event in the background to every active subscription which matches its type.
+// Each delivery is signed with the secret of its subscription. Failed deliveries are logged and not retried.
+func DispatchWebhookEvent(db *models.Database, logger *utils.Logger, eventType string, data interface{}) {
+	// The subscriptions are looked up in the background too, so that a slow database never delays the request
+	go dispatchWebhookEvent(db, logger, eventType, data)
+}
+
+func dispatchWebhookEvent(db *models.Database, logger *utils.Logger, eventType string, data interface{}) {
+	var subscriptions []models.WebhookSubscription
+	err := db.Select(&subscriptions, "SELECT id, url, event_types, secret, active FROM webhook_subscriptions WHERE active")
+	if err != nil {
+		logger.Error().Err(err).Str("event", eventType).Msg("Could not fetch webhook subscriptions")
+		return
+	}
+
+	body, err := json.Marshal(&models.WebhookEvent{
+		Type:      eventType,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	})
+	if err != nil {
+		logger.Error().Err(err).Str("event", eventType).Msg("Unable to Marshal JSON")
+		return
+	}
+
+	for _, subscription := range subscriptions {
+		if !subscription.Matches(eventType) {
+			continue
+		}
+
+		go deliverWebhook(logger, subscription, eventType, body)
+	}
+}
+
+func deliverWebhook(logger *utils.Logger, subscription models.WebhookSubscription, eventType string, body []byte) {
+	req, err := http.NewRequest("POST", subscription.URL, bytes.NewBuffer(body))
+	if err != nil {
+		logger.Error().Err(err).Int64("subscription", subscription.ID).Msg("Could not create webhook request")
+		return
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, eventType)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhookPayload(subscription.Secret, timestamp, body))
+
+	client := &http.Client{Timeout: time.Duration(viper.GetInt("WEBHOOK_TIMEOUT")) * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		logger.Error().Err(err).Int64("subscription", subscription.ID).Str("event", eventType).Msg("Webhook delivery failed")
+		return
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		logger.Error().Int("status", resp.StatusCode).Int64("subscription", subscription.ID).Str("event", eventType).Msg("Webhook delivery was rejected")
+	}
+}
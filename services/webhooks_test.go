@@ -0,0 +1,127 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package services
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samyak-jain/agora_backend/pkg/models"
+)
+
+func TestSignWebhookPayload(t *testing.T) {
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		body      string
+		want      string
+	}{
+		{name: "event", secret: "secret", timestamp: "1700000000", body: `{"type":"channel.created"}`, want: "0b543c9978c500c916d1d9783b7e02bdaace81eca95da13f0c90c84c868def2d"},
+		{name: "replayed at another time", secret: "secret", timestamp: "1700000001", body: `{"type":"channel.created"}`, want: "8025ac4abf536a80f7f98b50e7942010f9d5cff8aa5fe9ecca416e0eaa5e1afa"},
+		{name: "empty body", secret: "other", timestamp: "1700000000", body: "", want: "0eaddda63fe194e9945e7d364f142d9269b757e14bfcfc330d1bb0e85e0e6543"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SignWebhookPayload(tt.secret, tt.timestamp, []byte(tt.body)); got != tt.want {
+				t.Errorf("SignWebhookPayload() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhookSubscriptionMatches(t *testing.T) {
+	tests := []struct {
+		name       string
+		eventTypes string
+		eventType  string
+		want       bool
+	}{
+		{name: "every event", eventTypes: "", eventType: models.ChannelCreatedEvent, want: true},
+		{name: "subscribed event", eventTypes: models.ChannelCreatedEvent, eventType: models.ChannelCreatedEvent, want: true},
+		{name: "one of several", eventTypes: "recording.started,recording.stopped", eventType: models.RecordingStoppedEvent, want: true},
+		{name: "other event", eventTypes: "recording.started,recording.stopped", eventType: models.ChannelCreatedEvent, want: false},
+		{name: "prefix is not a match", eventTypes: "recording", eventType: models.RecordingStartedEvent, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subscription := models.WebhookSubscription{EventTypes: tt.eventTypes}
+			if got := subscription.Matches(tt.eventType); got != tt.want {
+				t.Errorf("Matches(%q) = %v, want %v", tt.eventType, got, tt.want)
+			}
+		})
+	}
+}
+
+type webhookDelivery struct {
+	path      string
+	event     string
+	timestamp string
+	signature string
+	body      []byte
+}
+
+func TestDispatchWebhookEvent(t *testing.T) {
+	deliveries := make(chan webhookDelivery, 3)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		deliveries <- webhookDelivery{
+			path:      r.URL.Path,
+			event:     r.Header.Get(WebhookEventHeader),
+			timestamp: r.Header.Get(WebhookTimestampHeader),
+			signature: r.Header.Get(WebhookSignatureHeader),
+			body:      body,
+		}
+	}))
+	defer server.Close()
+
+	router, mock := testRouter(t)
+	mock.ExpectQuery(`FROM webhook_subscriptions WHERE active`).WillReturnRows([]string{"id", "url", "event_types", "secret", "active"},
+		[]interface{}{1, server.URL + "/all", "", "secret-all", true},
+		[]interface{}{2, server.URL + "/created", models.ChannelCreatedEvent, "secret-created", true},
+		[]interface{}{3, server.URL + "/recordings", models.RecordingStartedEvent, "secret-recordings", true},
+	)
+
+	dispatchWebhookEvent(router.DB, router.Logger, models.ChannelCreatedEvent, map[string]string{"channel": "abc"})
+
+	secrets := map[string]string{"/all": "secret-all", "/created": "secret-created"}
+	for i := 0; i < len(secrets); i++ {
+		select {
+		case delivery := <-deliveries:
+			secret, ok := secrets[delivery.path]
+			if !ok {
+				t.Fatalf("event was delivered to %s, which did not subscribe to it", delivery.path)
+			}
+
+			if delivery.event != models.ChannelCreatedEvent || !strings.Contains(string(delivery.body), `"channel":"abc"`) {
+				t.Errorf("delivery to %s = %s %s, want the channel.created event", delivery.path, delivery.event, delivery.body)
+			}
+
+			if want := "sha256=" + SignWebhookPayload(secret, delivery.timestamp, delivery.body); delivery.signature != want {
+				t.Errorf("delivery to %s is signed %s, want %s", delivery.path, delivery.signature, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for webhook deliveries")
+		}
+	}
+
+	select {
+	case delivery := <-deliveries:
+		t.Errorf("event was delivered to %s, which did not subscribe to it", delivery.path)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
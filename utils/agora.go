@@ -0,0 +1,231 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/spf13/viper"
+)
+
+// AgoraAPIURL is the base URL of the Agora RESTful API
+var AgoraAPIURL = "https://api.agora.io"
+
+// ErrRESTCredentialsMissing is returned when calling the Agora RESTful API without CUSTOMER_ID and CUSTOMER_CERTIFICATE
+var ErrRESTCredentialsMissing = errors.New("Agora REST credentials CUSTOMER_ID and CUSTOMER_CERTIFICATE are not set")
+
+// restCredentials returns the customer ID and secret of the Agora RESTful API. They are distinct from the APP_ID and
+// APP_CERTIFICATE which sign SDK tokens, and the secret is loaded through the SECRET_PROVIDER like the certificate.
+func restCredentials() (string, string, error) {
+	customerID := viper.GetString("CUSTOMER_ID")
+	secret, err := GetSecret("CUSTOMER_CERTIFICATE")
+	if err != nil || customerID == "" || secret == "" {
+		return "", "", ErrRESTCredentialsMissing
+	}
+
+	return customerID, secret, nil
+}
+
+// SetRESTAuth authenticates a request to the Agora RESTful API with basic auth using the customer credentials
+func SetRESTAuth(req *http.Request) error {
+	customerID, secret, err := restCredentials()
+	if err != nil {
+		return err
+	}
+
+	req.SetBasicAuth(customerID, secret)
+	return nil
+}
+
+// CheckRESTCredentials makes sure the customer credentials are set and are not the SDK credentials by mistake
+func CheckRESTCredentials() error {
+	customerID, _, err := restCredentials()
+	if err != nil {
+		return err
+	}
+
+	if customerID == viper.GetString("APP_ID") {
+		return errors.New("CUSTOMER_ID is the APP_ID, the Agora RESTful API needs the customer ID and secret of the console")
+	}
+
+	return nil
+}
+
+type channelUsersData struct {
+	ChannelExist  bool    `json:"channel_exist"`
+	Mode          int     `json:"mode"`
+	Total         int     `json:"total"`
+	Users         []int64 `json:"users"`
+	Broadcasters  []int64 `json:"broadcasters"`
+	Audience      []int64 `json:"audience"`
+	AudienceTotal int     `json:"audience_total"`
+}
+
+type channelUsersResponse struct {
+	Success bool             `json:"success"`
+	Data    channelUsersData `json:"data"`
+}
+
+// getChannelUsers asks Agora which users are currently in the channel
+func getChannelUsers(channel string) (*channelUsersData, error) {
+	req, err := http.NewRequest("GET", AgoraAPIURL+"/dev/v1/channel/user/"+viper.GetString("APP_ID")+"/"+url.PathEscape(channel), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = SetRESTAuth(req)
+	if err != nil {
+		return nil, err
+	}
+
+	client := BreakerClient(AgoraCircuit)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Channel user query failed with status %d", resp.StatusCode)
+	}
+
+	var result channelUsersResponse
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+
+	if !result.Success {
+		return nil, fmt.Errorf("Channel user query was not successful")
+	}
+
+	return &result.Data, nil
+}
+
+// GetChannelUserCount asks Agora how many users are currently in the channel
+func GetChannelUserCount(channel string) (int, error) {
+	// Channels are never considered empty in test mode, so that they are not closed behind the tests' back
+	if TestModeEnabled() {
+		return 1, nil
+	}
+
+	data, err := getChannelUsers(channel)
+	if err != nil {
+		return 0, err
+	}
+
+	if !data.ChannelExist {
+		return 0, nil
+	}
+
+	// Communication channels report every user in total while live broadcast channels split broadcasters and audience
+	if data.Mode == 2 {
+		return len(data.Broadcasters) + data.AudienceTotal, nil
+	}
+
+	return data.Total, nil
+}
+
+// GetChannelUIDs asks Agora for the uids which are currently in the channel.
+// Agora may leave out part of the audience of large live broadcast channels.
+func GetChannelUIDs(channel string) ([]int64, error) {
+	if TestModeEnabled() {
+		return []int64{}, nil
+	}
+
+	data, err := getChannelUsers(channel)
+	if err != nil {
+		return nil, err
+	}
+
+	if !data.ChannelExist {
+		return []int64{}, nil
+	}
+
+	if data.Mode == 2 {
+		return append(append([]int64{}, data.Broadcasters...), data.Audience...), nil
+	}
+
+	return data.Users, nil
+}
+
+type kickingRuleRequest struct {
+	AppID      string   `json:"appid"`
+	Cname      string   `json:"cname"`
+	UID        int      `json:"uid"`
+	Time       int      `json:"time"`
+	Privileges []string `json:"privileges"`
+}
+
+type kickingRuleResponse struct {
+	Status string `json:"status"`
+	ID     int64  `json:"id"`
+}
+
+// KickUser creates an Agora kicking rule which removes the uid from the channel and bans it from rejoining for the given minutes.
+// Agora tokens cannot be revoked, so this is how the holder of a leaked token is ejected before the token expires.
+func KickUser(channel string, uid int, minutes int) (int64, error) {
+	if TestModeEnabled() {
+		return 1, nil
+	}
+
+	requestBody, err := json.Marshal(&kickingRuleRequest{
+		AppID:      viper.GetString("APP_ID"),
+		Cname:      channel,
+		UID:        uid,
+		Time:       minutes,
+		Privileges: []string{"join_channel"},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequest("POST", AgoraAPIURL+"/dev/v1/kicking-rule", bytes.NewBuffer(requestBody))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	err = SetRESTAuth(req)
+	if err != nil {
+		return 0, err
+	}
+
+	client := BreakerClient(AgoraCircuit)
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("Kicking rule request failed with status %d", resp.StatusCode)
+	}
+
+	var result kickingRuleResponse
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return 0, err
+	}
+
+	if result.Status != "success" {
+		return 0, fmt.Errorf("Kicking rule request was not successful: %s", result.Status)
+	}
+
+	return result.ID, nil
+}
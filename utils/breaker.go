@@ -0,0 +1,173 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package utils
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// ErrCircuitOpen is returned without calling the dependency while its circuit breaker is open
+var ErrCircuitOpen = errors.New("Service is temporarily unavailable")
+
+// States of a circuit breaker
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+// AgoraCircuit is the name of the circuit breaker guarding the Agora RESTful API
+const AgoraCircuit = "agora"
+
+// CircuitBreaker stops calling a dependency after Threshold consecutive failures.
+// Once Cooldown has passed a single probe call is let through, which closes the breaker again on success.
+// A threshold of 0 or less disables the breaker.
+type CircuitBreaker struct {
+	Name      string
+	Threshold int
+	Cooldown  time.Duration
+
+	mutex    sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	now      func() time.Time
+}
+
+// NewCircuitBreaker creates a closed circuit breaker
+func NewCircuitBreaker(name string, threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		Name:      name,
+		Threshold: threshold,
+		Cooldown:  cooldown,
+		state:     CircuitClosed,
+		now:       time.Now,
+	}
+}
+
+// State returns the current state of the breaker
+func (b *CircuitBreaker) State() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.state == CircuitOpen && b.now().Sub(b.openedAt) >= b.Cooldown {
+		return CircuitHalfOpen
+	}
+
+	return b.state
+}
+
+// Check reports whether a call would be let through, without being counted as the half-open probe
+func (b *CircuitBreaker) Check() error {
+	if b == nil || b.Threshold <= 0 || b.State() != CircuitOpen {
+		return nil
+	}
+
+	return ErrCircuitOpen
+}
+
+// Allow reports whether the dependency may be called. Only one call is let through while half-open.
+func (b *CircuitBreaker) Allow() error {
+	if b == nil || b.Threshold <= 0 {
+		return nil
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		if b.now().Sub(b.openedAt) < b.Cooldown {
+			return ErrCircuitOpen
+		}
+
+		b.state = CircuitHalfOpen
+		return nil
+	case CircuitHalfOpen:
+		return ErrCircuitOpen
+	}
+
+	return nil
+}
+
+// Record updates the breaker with the outcome of a call which was allowed
+func (b *CircuitBreaker) Record(success bool) {
+	if b == nil || b.Threshold <= 0 {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if success {
+		b.state = CircuitClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == CircuitHalfOpen || b.failures >= b.Threshold {
+		b.state = CircuitOpen
+		b.openedAt = b.now()
+	}
+}
+
+var (
+	circuitBreakersMutex sync.Mutex
+	circuitBreakers      = map[string]*CircuitBreaker{}
+)
+
+// GetCircuitBreaker returns the shared breaker of the dependency, configured with CIRCUIT_BREAKER_THRESHOLD and CIRCUIT_BREAKER_COOLDOWN
+func GetCircuitBreaker(name string) *CircuitBreaker {
+	circuitBreakersMutex.Lock()
+	defer circuitBreakersMutex.Unlock()
+
+	breaker, ok := circuitBreakers[name]
+	if !ok {
+		breaker = NewCircuitBreaker(name, viper.GetInt("CIRCUIT_BREAKER_THRESHOLD"), time.Duration(viper.GetInt("CIRCUIT_BREAKER_COOLDOWN"))*time.Second)
+		circuitBreakers[name] = breaker
+	}
+
+	return breaker
+}
+
+// BreakerTransport is a http.RoundTripper which guards every request with a circuit breaker.
+// Network errors and 5xx or 429 responses count as failures.
+type BreakerTransport struct {
+	Breaker *CircuitBreaker
+	Base    http.RoundTripper
+}
+
+// RoundTrip fails fast with ErrCircuitOpen while the breaker is open
+func (t *BreakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.Breaker.Allow(); err != nil {
+		return nil, err
+	}
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	resp, err := base.RoundTrip(req)
+	t.Breaker.Record(err == nil && resp.StatusCode < http.StatusInternalServerError && resp.StatusCode != http.StatusTooManyRequests)
+	return resp, err
+}
+
+// BreakerClient returns a http client whose requests go through the named circuit breaker, logging the slow ones
+func BreakerClient(name string) *http.Client {
+	return &http.Client{Transport: &BreakerTransport{Breaker: GetCircuitBreaker(name), Base: &SlowCallTransport{Service: name}}}
+}
@@ -0,0 +1,92 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	breaker := NewCircuitBreaker("test", 2, time.Minute)
+	breaker.now = func() time.Time { return now }
+
+	steps := []struct {
+		name      string
+		advance   time.Duration
+		record    *bool
+		wantState string
+		wantAllow error
+	}{
+		{name: "starts closed", wantState: CircuitClosed},
+		{name: "first failure stays closed", record: boolPtr(false), wantState: CircuitClosed},
+		{name: "threshold opens", record: boolPtr(false), wantState: CircuitOpen, wantAllow: ErrCircuitOpen},
+		{name: "open during cool-down", advance: 59 * time.Second, wantState: CircuitOpen, wantAllow: ErrCircuitOpen},
+		{name: "half-open after cool-down", advance: time.Second, wantState: CircuitHalfOpen},
+		{name: "failed probe opens again", record: boolPtr(false), wantState: CircuitOpen, wantAllow: ErrCircuitOpen},
+		{name: "cool-down restarts", advance: 30 * time.Second, wantState: CircuitOpen, wantAllow: ErrCircuitOpen},
+		{name: "half-open again", advance: 30 * time.Second, wantState: CircuitHalfOpen},
+		{name: "successful probe closes", record: boolPtr(true), wantState: CircuitClosed},
+		{name: "failures were reset", record: boolPtr(false), wantState: CircuitClosed},
+	}
+
+	for _, step := range steps {
+		now = now.Add(step.advance)
+
+		if step.record != nil {
+			if err := breaker.Allow(); err != nil {
+				t.Fatalf("%s: Allow() = %v before recording", step.name, err)
+			}
+			breaker.Record(*step.record)
+		}
+
+		if state := breaker.State(); state != step.wantState {
+			t.Fatalf("%s: State() = %q, want %q", step.name, state, step.wantState)
+		}
+
+		if err := breaker.Check(); err != step.wantAllow {
+			t.Fatalf("%s: Check() = %v, want %v", step.name, err, step.wantAllow)
+		}
+	}
+}
+
+func TestCircuitBreakerSingleProbe(t *testing.T) {
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	breaker := NewCircuitBreaker("test", 1, time.Minute)
+	breaker.now = func() time.Time { return now }
+
+	breaker.Record(false)
+	now = now.Add(time.Minute)
+
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("first Allow() after cool-down = %v, want the probe to be let through", err)
+	}
+
+	if err := breaker.Allow(); err != ErrCircuitOpen {
+		t.Errorf("second Allow() while half-open = %v, want %v", err, ErrCircuitOpen)
+	}
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	breaker := NewCircuitBreaker("test", 0, time.Minute)
+	for i := 0; i < 5; i++ {
+		breaker.Record(false)
+	}
+
+	if err := breaker.Allow(); err != nil {
+		t.Errorf("Allow() = %v, want a disabled breaker to let every call through", err)
+	}
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
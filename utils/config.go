@@ -38,10 +38,127 @@ func SetDefaults() {
 	viper.SetDefault("ENABLE_FILE_LOGGING", true)
 	viper.SetDefault("LOG_LEVEL", "DEBUG")
 	viper.SetDefault("ALLOW_LIST", []string{"*"})
+	viper.SetDefault("ADMIN_LIST", []string{})
 	viper.SetDefault("RECORDING_VENDOR", 1)
 	viper.SetDefault("RECORDING_REGION", 0)
 	viper.SetDefault("RUN_MIGRATION", false)
 	viper.SetDefault("PSTN_NUMBER", "(800) 309-2350")
+	viper.SetDefault("CREATE_DEFAULT_CHANNEL", false)
+	viper.SetDefault("DEFAULT_CHANNEL_TITLE", "Personal Room")
+	viper.SetDefault("SECRET_PROVIDER", "env")
+	viper.SetDefault("SECRETS_DIR", "/run/secrets")
+	viper.SetDefault("RTC_TOKEN_TTL", 86400)
+	viper.SetDefault("RTC_TOKEN_MAX_TTL", 86400)
+	viper.SetDefault("RTM_TOKEN_TTL", 86400)
+	viper.SetDefault("RTM_TOKEN_MAX_TTL", 86400)
+	viper.SetDefault("SESSION_TOKEN_TTL", 2592000)
+	viper.SetDefault("SESSION_TOKEN_MAX_TTL", 7776000)
+	viper.SetDefault("TRUSTED_PROXIES", []string{})
+	viper.SetDefault("REASSOCIATE_PROVIDER_ID", false)
+	viper.SetDefault("ENABLE_CHANNEL_AUTO_CLOSE", false)
+	viper.SetDefault("CHANNEL_IDLE_TIMEOUT", 3600)
+	viper.SetDefault("CHANNEL_IDLE_CHECK_INTERVAL", 300)
+	viper.SetDefault("TOKEN_RATE_LIMIT", 30)
+	viper.SetDefault("TOKEN_RATE_LIMIT_WINDOW", 60)
+	viper.SetDefault("VERIFY_ID_TOKEN", false)
+	viper.SetDefault("REQUIRE_ID_TOKEN_NONCE", false)
+	viper.SetDefault("LOGIN_NONCE_TTL", 600)
+	viper.SetDefault("UID_STRATEGY", "random")
+	viper.SetDefault("KICK_DURATION", 60)
+	viper.SetDefault("BATCH_CREATE_USERS_LIMIT", 500)
+	viper.SetDefault("ALLOW_UNVERIFIED_EMAIL", false)
+	viper.SetDefault("UNVERIFIED_EMAIL_COLLISION", "reject")
+	viper.SetDefault("ADOPT_REQUEST_ID", true)
+	viper.SetDefault("ENABLE_TRACING", false)
+	viper.SetDefault("NATIVE_CLIENT_IDS", []string{})
+	viper.SetDefault("MAX_USER_NAME_LENGTH", 100)
+	viper.SetDefault("SESSION_TOKEN_BYTES", 0)
+	viper.SetDefault("ROTATE_TOKEN_ON_ROLE_CHANGE", false)
+	viper.SetDefault("DEFAULT_OAUTH_SITE", "google")
+	viper.SetDefault("CIRCUIT_BREAKER_THRESHOLD", 5)
+	viper.SetDefault("CIRCUIT_BREAKER_COOLDOWN", 30)
+	viper.SetDefault("CASE_INSENSITIVE_EMAIL", true)
+	viper.SetDefault("MAX_CONCURRENT_RECORDINGS", 0)
+	viper.SetDefault("RECORDING_SLOT_TTL", 86400)
+	viper.SetDefault("ENVIRONMENT", "production")
+	viper.SetDefault("TEST_MODE", false)
+	viper.SetDefault("TEST_MODE_USER_ID", "test-user")
+	viper.SetDefault("TEST_MODE_USER_NAME", "Test User")
+	viper.SetDefault("TEST_MODE_USER_EMAIL", "test@example.com")
+	viper.SetDefault("ACCOUNT_LINKING_POLICY", "auto")
+	viper.SetDefault("DB_QUERY_TIMEOUT", 5)
+	viper.SetDefault("WEBHOOK_TIMEOUT", 10)
+	viper.SetDefault("REDIRECT_STRIP_PARAMS", []string{})
+	viper.SetDefault("SERVICE_TOKEN_TTL", 3600)
+	viper.SetDefault("SERVICE_TOKEN_MAX_TTL", 7776000)
+	viper.SetDefault("EMAIL_DOMAIN_TENANTS", []string{})
+	viper.SetDefault("DEFAULT_TENANT", "")
+	viper.SetDefault("SESSION_TOKEN_RENEW_WINDOW", 0)
+	viper.SetDefault("ENABLE_TOKEN_PAGE_PREVIEW", false)
+	viper.SetDefault("TOKEN_PAGE_PREVIEW_ENVIRONMENTS", []string{"development"})
+	viper.SetDefault("AUDIT_RETENTION_DAYS", 0)
+	viper.SetDefault("AUDIT_PURGE_INTERVAL", 3600)
+	viper.SetDefault("AUDIT_PURGE_BATCH_SIZE", 1000)
+	viper.SetDefault("AUDIT_EXPORT_FILE", "")
+	viper.SetDefault("REJECT_INVALID_TOKENS", false)
+	viper.SetDefault("PROTECTED_PATHS", []string{})
+	viper.SetDefault("SLOW_CALL_THRESHOLD", 2000)
+	viper.SetDefault("ALLOW_LIST_EXISTING_USERS", "strict")
+	viper.SetDefault("BATCH_TOKEN_BUNDLE_LIMIT", 20)
+	viper.SetDefault("TLS_CERT_FILE", "")
+	viper.SetDefault("TLS_KEY_FILE", "")
+	viper.SetDefault("TLS_MIN_VERSION", "1.2")
+	viper.SetDefault("TLS_CIPHER_SUITES", []string{})
+	viper.SetDefault("SCHEDULE_EARLY_JOIN", 600)
+	viper.SetDefault("SCHEDULE_LATE_JOIN", 0)
+	viper.SetDefault("ALLOW_LIST_SOURCES", []string{"config"})
+	viper.SetDefault("ALLOW_LIST_FILE", "")
+	viper.SetDefault("DENY_LIST", []string{})
+	viper.SetDefault("DOWNSCOPED_TOKEN_TTL", 300)
+	viper.SetDefault("CHANNEL_SLUG_CONFLICT", "conflict")
+	viper.SetDefault("FEATURE_FLAGS", []string{})
+	viper.SetDefault("AUDIT_SINK", "")
+	viper.SetDefault("AUDIT_SINK_FORMAT", "json")
+	viper.SetDefault("AUDIT_SINK_URL", "")
+	viper.SetDefault("AUDIT_SINK_NETWORK", "udp")
+	viper.SetDefault("AUDIT_SINK_ADDRESS", "")
+	viper.SetDefault("AUDIT_SINK_BUFFER", 1000)
+	viper.SetDefault("NAME_UNICODE_POLICY", "strip")
+	viper.SetDefault("MOBILE_LOGIN_RETRY_TTL", 300)
+	viper.SetDefault("ENABLE_RECORDING", true)
+	viper.SetDefault("TENANT_CONFIG_CACHE_TTL", 60)
+	viper.SetDefault("EVENT_END", "")
+	viper.SetDefault("VALIDATE_EMAILS_LIMIT", 500)
+	viper.SetDefault("MAX_REQUESTED_SCOPES", 10)
+	viper.SetDefault("JOIN_LINK_BASE_URL", "")
+	viper.SetDefault("JOIN_LINK_TTL", 86400)
+	viper.SetDefault("JOIN_LINK_MAX_TTL", 604800)
+	viper.SetDefault("UNIQUE_DEVICE_NAMES", false)
+	viper.SetDefault("MAINTENANCE_MODE", false)
+	viper.SetDefault("MAINTENANCE_MESSAGE", "We are down for maintenance, please try again in a few minutes")
+	viper.SetDefault("MAINTENANCE_BLOCK_TOKENS", false)
+	viper.SetDefault("OAUTH_STRICT_TOKEN_TYPE", false)
+	viper.SetDefault("MY_CHANNELS_PAGE_LIMIT", 100)
+	viper.SetDefault("SESSION_EXPIRED_URL", "")
+	viper.SetDefault("BUCKET_REGION", "us-east-1")
+	viper.SetDefault("RECORDING_URL_TTL", 300)
+	viper.SetDefault("EMAIL_VERIFIED_CACHE_PROVIDERS", []string{})
+	viper.SetDefault("BREAK_GLASS_EMAIL", "")
+	viper.SetDefault("BREAK_GLASS_PROVIDER", "")
+	viper.SetDefault("BREAK_GLASS_SUBJECT", "")
+	viper.SetDefault("CHANNEL_NAME_BLOCKLIST", []string{})
+	viper.SetDefault("HYBRID_FALLBACK_URL", "")
+	viper.SetDefault("HYBRID_FALLBACK_DELAY", 1500)
+	viper.SetDefault("ENABLE_LOGIN_HINT", true)
+	viper.SetDefault("TOKEN_CACHE_TTL", 0)
+	viper.SetDefault("TOKEN_CACHE_MAX_ENTRIES", 10000)
+	viper.SetDefault("PROVIDER_SELF_TEST", "warn")
+	viper.SetDefault("PROVIDER_SELF_TEST_BUILD_CONFIG", false)
+	viper.SetDefault("OAUTH_REDIRECT_URIS", []string{})
+	viper.SetDefault("REDACT_ACCESS_LOG", true)
+	viper.SetDefault("ACCESS_LOG_REDACTED_PARAMS", []string{"token", "code", "state", "flow", "signature"})
+	viper.SetDefault("ACCESS_LOG_HEADERS", []string{})
+	viper.SetDefault("LOGIN_CHECK_ORDER", "allow_list_first")
 
 	if viper.GetString("RUN_MIGRATION") == "true" {
 		viper.SetDefault("RUN_MIGRATION", true)
@@ -105,7 +222,11 @@ func SetupConfig(configDir *string) error {
 
 // CheckRequired checks if all the required environment is set
 func CheckRequired() error {
-	if !viper.IsSet("APP_ID") || !viper.IsSet("APP_CERTIFICATE") || !viper.IsSet("SCHEME") {
+	if !viper.IsSet("APP_ID") || !viper.IsSet("SCHEME") {
+		return errors.New("Please Make sure APP_ID,APP_CERTIFICATE and SCHEME are set")
+	}
+
+	if _, err := GetSecret("APP_CERTIFICATE"); err != nil {
 		return errors.New("Please Make sure APP_ID,APP_CERTIFICATE and SCHEME are set")
 	}
 
@@ -0,0 +1,63 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// ErrQueryTimeout is returned when database queries take longer than DB_QUERY_TIMEOUT
+var ErrQueryTimeout = errors.New("Database query timed out")
+
+// QueryContext bounds the database queries run with the returned context to DB_QUERY_TIMEOUT seconds.
+// A timeout of 0 or less leaves the queries unbounded.
+func QueryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := viper.GetInt("DB_QUERY_TIMEOUT")
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+}
+
+// QueryError wraps the error of a query run with a context from QueryContext in ErrQueryTimeout once the timeout expired,
+// since the driver reports a cancelled query with an error of its own
+func QueryError(ctx context.Context, err error) error {
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %v", ErrQueryTimeout, err)
+	}
+
+	return err
+}
+
+// uniqueViolationCode is the SQLSTATE Postgres reports for a unique constraint violation
+const uniqueViolationCode = "23505"
+
+// IsUniqueViolation reports whether the error, or an error it wraps, is a unique constraint violation.
+// lib/pq errors expose their SQLSTATE through Get('C') and pgx errors through SQLState(), so neither driver is
+// imported here.
+func IsUniqueViolation(err error) bool {
+	for ; err != nil; err = errors.Unwrap(err) {
+		switch driverErr := err.(type) {
+		case interface{ SQLState() string }:
+			return driverErr.SQLState() == uniqueViolationCode
+		case interface{ Get(byte) string }:
+			return driverErr.Get('C') == uniqueViolationCode
+		}
+	}
+
+	return false
+}
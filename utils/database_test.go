@@ -0,0 +1,52 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// pqError stands in for a lib/pq error, which exposes its SQLSTATE through Get('C')
+type pqError map[byte]string
+
+func (e pqError) Error() string     { return e['M'] }
+func (e pqError) Get(k byte) string { return e[k] }
+
+// pgxError stands in for a pgx error, which exposes its SQLSTATE through SQLState()
+type pgxError string
+
+func (e pgxError) Error() string    { return "pgx error " + string(e) }
+func (e pgxError) SQLState() string { return string(e) }
+
+func TestIsUniqueViolation(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "lib/pq unique violation", err: pqError{'C': "23505", 'M': "duplicate key"}, want: true},
+		{name: "pgx unique violation", err: pgxError("23505"), want: true},
+		{name: "wrapped unique violation", err: fmt.Errorf("insert failed: %w", pgxError("23505")), want: true},
+		{name: "foreign key violation", err: pgxError("23503"), want: false},
+		{name: "other error", err: errors.New("connection refused"), want: false},
+		{name: "no error", err: nil, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsUniqueViolation(tt.err); got != tt.want {
+				t.Errorf("IsUniqueViolation(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
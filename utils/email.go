@@ -0,0 +1,42 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package utils
+
+import (
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// CaseInsensitiveEmails reports whether emails which only differ in case belong to the same user, set in CASE_INSENSITIVE_EMAIL
+func CaseInsensitiveEmails() bool {
+	return viper.GetBool("CASE_INSENSITIVE_EMAIL")
+}
+
+// NormalizeEmail trims the email and lower cases it when emails are case insensitive
+func NormalizeEmail(email string) string {
+	email = strings.TrimSpace(email)
+	if CaseInsensitiveEmails() {
+		return strings.ToLower(email)
+	}
+
+	return email
+}
+
+// EmailCondition returns the SQL condition comparing the email column to the placeholder.
+// Emails stored before they were normalized may still be mixed case, so the column is lower cased as well.
+func EmailCondition(placeholder string) string {
+	if CaseInsensitiveEmails() {
+		return "lower(email) = lower(" + placeholder + ")"
+	}
+
+	return "email = " + placeholder
+}
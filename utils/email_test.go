@@ -0,0 +1,48 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	defer viper.Set("CASE_INSENSITIVE_EMAIL", false)
+
+	tests := []struct {
+		name            string
+		caseInsensitive bool
+		email           string
+		want            string
+		wantCondition   string
+	}{
+		{name: "case insensitive", caseInsensitive: true, email: " John@Example.COM ", want: "john@example.com", wantCondition: "lower(email) = lower($1)"},
+		{name: "case insensitive lower case", caseInsensitive: true, email: "john@example.com", want: "john@example.com", wantCondition: "lower(email) = lower($1)"},
+		{name: "case sensitive", caseInsensitive: false, email: " John@Example.COM ", want: "John@Example.COM", wantCondition: "email = $1"},
+		{name: "empty", caseInsensitive: true, email: "  ", want: "", wantCondition: "lower(email) = lower($1)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("CASE_INSENSITIVE_EMAIL", tt.caseInsensitive)
+
+			if got := NormalizeEmail(tt.email); got != tt.want {
+				t.Errorf("NormalizeEmail(%q) = %q, want %q", tt.email, got, tt.want)
+			}
+
+			if got := EmailCondition("$1"); got != tt.wantCondition {
+				t.Errorf("EmailCondition() = %q, want %q", got, tt.wantCondition)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Roles a join link grants
+const (
+	HostJoinRole   = "host"
+	ViewerJoinRole = "viewer"
+)
+
+// ErrInvalidJoinLink is returned when the signature of a join link does not match its parameters
+var ErrInvalidJoinLink = errors.New("Invalid join link")
+
+// ErrJoinLinkExpired is returned when a join link is redeemed after its expiry
+var ErrJoinLinkExpired = errors.New("Join link has expired")
+
+// signJoinGrant returns the hex encoded HMAC-SHA256 of the grant with the JOIN_LINK_SECRET
+func signJoinGrant(channel string, role string, expires int64) (string, error) {
+	secret, err := GetSecret("JOIN_LINK_SECRET")
+	if err != nil || secret == "" {
+		return "", errors.New("JOIN_LINK_SECRET is not set")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s\n%s\n%d", channel, role, expires)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// NewJoinLink returns a link to JOIN_LINK_BASE_URL carrying a grant to join the channel with the role for ttl seconds.
+// The grant is signed, so the link can be shared in place of the passphrase of the role.
+func NewJoinLink(channel string, role string, ttl time.Duration) (string, error) {
+	baseURL, err := url.Parse(viper.GetString("JOIN_LINK_BASE_URL"))
+	if err != nil || viper.GetString("JOIN_LINK_BASE_URL") == "" {
+		return "", errors.New("JOIN_LINK_BASE_URL is not set to a valid URL")
+	}
+
+	expires := time.Now().Add(ttl).Unix()
+	signature, err := signJoinGrant(channel, role, expires)
+	if err != nil {
+		return "", err
+	}
+
+	query := baseURL.Query()
+	query.Set("channel", channel)
+	query.Set("role", role)
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	query.Set("signature", signature)
+	baseURL.RawQuery = query.Encode()
+
+	return baseURL.String(), nil
+}
+
+// VerifyJoinGrant checks the signature and the expiry of the grant of a join link
+func VerifyJoinGrant(channel string, role string, expires int64, signature string) error {
+	expected, err := signJoinGrant(channel, role, expires)
+	if err != nil {
+		return err
+	}
+
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrInvalidJoinLink
+	}
+
+	if time.Now().Unix() > expires {
+		return ErrJoinLinkExpired
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package utils
+
+import (
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestJoinLinks(t *testing.T) {
+	viper.Set("JOIN_LINK_SECRET", "join-secret")
+	viper.Set("JOIN_LINK_BASE_URL", "https://app.example.com/join?lang=en")
+	defer viper.Set("JOIN_LINK_SECRET", nil)
+	defer viper.Set("JOIN_LINK_BASE_URL", "")
+
+	tests := []struct {
+		name    string
+		ttl     time.Duration
+		tamper  func(query url.Values)
+		wantErr error
+	}{
+		{name: "valid link", ttl: time.Hour},
+		{name: "tampered role", ttl: time.Hour, tamper: func(query url.Values) { query.Set("role", HostJoinRole) }, wantErr: ErrInvalidJoinLink},
+		{name: "tampered channel", ttl: time.Hour, tamper: func(query url.Values) { query.Set("channel", "other") }, wantErr: ErrInvalidJoinLink},
+		{name: "extended expiry", ttl: time.Hour, tamper: func(query url.Values) { query.Set("expires", "9999999999") }, wantErr: ErrInvalidJoinLink},
+		{name: "forged signature", ttl: time.Hour, tamper: func(query url.Values) { query.Set("signature", "00") }, wantErr: ErrInvalidJoinLink},
+		{name: "expired link", ttl: -time.Minute, wantErr: ErrJoinLinkExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			link, err := NewJoinLink("channel", ViewerJoinRole, tt.ttl)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			parsed, err := url.Parse(link)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			query := parsed.Query()
+			if query.Get("lang") != "en" {
+				t.Errorf("NewJoinLink() = %s, want the params of JOIN_LINK_BASE_URL kept", link)
+			}
+
+			if tt.tamper != nil {
+				tt.tamper(query)
+			}
+
+			expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := VerifyJoinGrant(query.Get("channel"), query.Get("role"), expires, query.Get("signature")); err != tt.wantErr {
+				t.Errorf("VerifyJoinGrant() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestJoinLinksWithoutSecret(t *testing.T) {
+	viper.Set("JOIN_LINK_SECRET", "")
+	viper.Set("JOIN_LINK_BASE_URL", "https://app.example.com/join")
+	defer viper.Set("JOIN_LINK_SECRET", nil)
+	defer viper.Set("JOIN_LINK_BASE_URL", "")
+
+	if _, err := NewJoinLink("channel", ViewerJoinRole, time.Hour); err == nil {
+		t.Error("NewJoinLink() error = nil, want an error without JOIN_LINK_SECRET")
+	}
+
+	if err := VerifyJoinGrant("channel", ViewerJoinRole, time.Now().Add(time.Hour).Unix(), ""); err == nil {
+		t.Error("VerifyJoinGrant() error = nil, want an error without JOIN_LINK_SECRET")
+	}
+}
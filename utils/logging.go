@@ -11,6 +11,8 @@
 package utils
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"io"
 	"os"
 	"path"
@@ -48,6 +50,13 @@ type Logger struct {
 	*zerolog.Logger
 }
 
+// TokenFingerprint returns a short hash of a token, so that log lines about the same token can be matched up without
+// the token itself being logged
+func TokenFingerprint(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:6])
+}
+
 // SetLogLevel sets the level of the global logger
 func SetLogLevel() {
 	level := viper.GetString("LOG_LEVEL")
@@ -0,0 +1,41 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package utils
+
+import "testing"
+
+func TestTokenFingerprint(t *testing.T) {
+	tests := []struct {
+		name  string
+		token string
+		other string
+	}{
+		{name: "session token", token: "3f2b9c1e-5d4a-4b8e-9f7a-0c1d2e3f4a5b", other: "3f2b9c1e-5d4a-4b8e-9f7a-0c1d2e3f4a5c"},
+		{name: "empty token", token: "", other: " "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fingerprint := TokenFingerprint(tt.token)
+			if len(fingerprint) != 12 {
+				t.Errorf("TokenFingerprint(%q) = %q, want 12 characters", tt.token, fingerprint)
+			}
+
+			if fingerprint != TokenFingerprint(tt.token) {
+				t.Errorf("TokenFingerprint(%q) is not stable", tt.token)
+			}
+
+			if fingerprint == TokenFingerprint(tt.other) {
+				t.Errorf("TokenFingerprint(%q) = TokenFingerprint(%q)", tt.token, tt.other)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package utils
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+
+	"github.com/spf13/viper"
+)
+
+// Values of NAME_UNICODE_POLICY
+const (
+	// StripNamePolicy silently strips unsafe characters from names
+	StripNamePolicy = "strip"
+	// RejectNamePolicy rejects names with unsafe characters
+	RejectNamePolicy = "reject"
+)
+
+// ErrUnsafeName is returned by ValidateName for a name with unsafe characters under the reject policy
+var ErrUnsafeName = errors.New("Name contains control or invisible formatting characters")
+
+// isUnsafeNameRune reports whether the rune breaks rendering downstream, like RTL overrides and zero width characters
+func isUnsafeNameRune(r rune) bool {
+	return unicode.IsControl(r) || unicode.Is(unicode.Cf, r) || r == unicode.ReplacementChar
+}
+
+// ValidateName sanitizes a name following NAME_UNICODE_POLICY, returning ErrUnsafeName instead under the reject policy
+func ValidateName(name string) (string, error) {
+	if viper.GetString("NAME_UNICODE_POLICY") == RejectNamePolicy && strings.IndexFunc(name, isUnsafeNameRune) >= 0 {
+		return "", ErrUnsafeName
+	}
+
+	return SanitizeName(name), nil
+}
+
+// SanitizeName strips control and invisible formatting characters from a user supplied name,
+// trims it and caps it to MAX_USER_NAME_LENGTH characters
+func SanitizeName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if isUnsafeNameRune(r) {
+			return -1
+		}
+
+		return r
+	}, name)
+
+	name = strings.TrimSpace(name)
+
+	maxLength := viper.GetInt("MAX_USER_NAME_LENGTH")
+	if runes := []rune(name); maxLength > 0 && len(runes) > maxLength {
+		name = strings.TrimSpace(string(runes[:maxLength]))
+	}
+
+	return name
+}
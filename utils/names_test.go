@@ -0,0 +1,82 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestSanitizeName(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		maxLength int
+		want      string
+	}{
+		{name: "plain name", input: "Ada Lovelace", maxLength: 10, want: "Ada Lovela"},
+		{name: "no limit", input: "Ada Lovelace", maxLength: 0, want: "Ada Lovelace"},
+		{name: "trimmed", input: "  Ada  ", maxLength: 10, want: "Ada"},
+		{name: "trimmed after truncation", input: "Ada Lovelace", maxLength: 4, want: "Ada"},
+		{name: "control characters", input: "Ada\x00\x07\nLovelace", maxLength: 20, want: "AdaLovelace"},
+		{name: "invalid utf-8", input: "Ada\xffLovelace", maxLength: 20, want: "AdaLovelace"},
+		{name: "multibyte rune at the boundary", input: "Zoë Sørensen", maxLength: 3, want: "Zoë"},
+		{name: "emoji at the boundary", input: "Ada🎉🎉", maxLength: 4, want: "Ada🎉"},
+		{name: "stripped before truncation", input: "\u200bAda\u202eLovelace", maxLength: 5, want: "AdaLo"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("MAX_USER_NAME_LENGTH", tt.maxLength)
+			defer viper.Set("MAX_USER_NAME_LENGTH", 0)
+
+			if got := SanitizeName(tt.input); got != tt.want {
+				t.Errorf("SanitizeName(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateName(t *testing.T) {
+	defer viper.Set("NAME_UNICODE_POLICY", StripNamePolicy)
+
+	tests := []struct {
+		name    string
+		policy  string
+		input   string
+		want    string
+		wantErr error
+	}{
+		{name: "safe name under strip", policy: StripNamePolicy, input: "Ada Lovelace", want: "Ada Lovelace"},
+		{name: "safe name under reject", policy: RejectNamePolicy, input: "Ada Lovelace", want: "Ada Lovelace"},
+		{name: "rtl override stripped", policy: StripNamePolicy, input: "Ada‮ecalevoL", want: "AdaecalevoL"},
+		{name: "rtl override rejected", policy: RejectNamePolicy, input: "Ada‮ecalevoL", wantErr: ErrUnsafeName},
+		{name: "zero width space stripped", policy: StripNamePolicy, input: "Ada​", want: "Ada"},
+		{name: "zero width joiner rejected", policy: RejectNamePolicy, input: "Ada‍Lovelace", wantErr: ErrUnsafeName},
+		{name: "unknown policy strips", policy: "", input: "Ada​", want: "Ada"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("NAME_UNICODE_POLICY", tt.policy)
+
+			got, err := ValidateName(tt.input)
+			if err != tt.wantErr {
+				t.Fatalf("ValidateName(%q) error = %v, want %v", tt.input, err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("ValidateName(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
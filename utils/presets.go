@@ -0,0 +1,74 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package utils
+
+import (
+	"fmt"
+
+	"github.com/samyak-jain/agora_backend/pkg/models"
+	"github.com/samyak-jain/agora_backend/utils/rtctoken"
+	"github.com/spf13/viper"
+)
+
+// TokenPreset is a named set of RTC privileges for a kind of meeting, so that clients do not assemble them manually
+type TokenPreset struct {
+	// Role decides whether the token may publish streams or only join and subscribe
+	Role rtctoken.Role
+	// TTL is the expiry in seconds used when the client does not request one, still capped by RTC_TOKEN_MAX_TTL
+	TTL int
+	// HostOnly presets are only issued for the host passphrase
+	HostOnly bool
+}
+
+// TokenPresets are the presets which can be selected by name when generating a token bundle
+var TokenPresets = map[string]TokenPreset{
+	"webinar-host":      {Role: rtctoken.RolePublisher, TTL: 14400, HostOnly: true},
+	"webinar-attendee":  {Role: rtctoken.RoleSubscriber, TTL: 14400},
+	"one-to-one":        {Role: rtctoken.RolePublisher, TTL: 3600},
+	"attendee":          {Role: rtctoken.RoleAttendee, TTL: 3600},
+	"classroom-teacher": {Role: rtctoken.RolePublisher, TTL: 7200, HostOnly: true},
+	"classroom-student": {Role: rtctoken.RoleSubscriber, TTL: 7200},
+}
+
+// GeneratePresetTokenBundle generates an RTC token with the privileges of the preset and an RTM token for the uid.
+// A requested ttl of 0 uses the TTL of the preset.
+func GeneratePresetTokenBundle(channel string, uid int, ttl int, preset TokenPreset) (*models.TokenBundle, error) {
+	if ttl <= 0 {
+		ttl = preset.TTL
+	}
+
+	rtcExpiry := GetTokenExpiry(RtcTokenEndpoint, ttl)
+	rtmExpiry := GetTokenExpiry(RtmTokenEndpoint, ttl)
+
+	rtcToken, err := GetRtcTokenWithRole(channel, uid, preset.Role, rtcExpiry)
+	if err != nil {
+		return nil, err
+	}
+
+	rtmToken, err := GetRtmToken(fmt.Sprint(uid), rtmExpiry)
+	if err != nil {
+		return nil, err
+	}
+
+	expiry := rtcExpiry
+	if rtmExpiry < expiry {
+		expiry = rtmExpiry
+	}
+
+	return &models.TokenBundle{
+		AppID:   viper.GetString("APP_ID"),
+		Channel: channel,
+		UID:     uid,
+		Rtc:     rtcToken,
+		Rtm:     rtmToken,
+		Expiry:  int(expiry),
+	}, nil
+}
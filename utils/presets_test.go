@@ -0,0 +1,94 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/samyak-jain/agora_backend/utils/rtctoken"
+	"github.com/spf13/viper"
+)
+
+func TestTokenPresets(t *testing.T) {
+	tests := []struct {
+		name     string
+		preset   string
+		wantOK   bool
+		role     rtctoken.Role
+		hostOnly bool
+	}{
+		{name: "webinar host", preset: "webinar-host", wantOK: true, role: rtctoken.RolePublisher, hostOnly: true},
+		{name: "webinar attendee", preset: "webinar-attendee", wantOK: true, role: rtctoken.RoleSubscriber},
+		{name: "classroom student", preset: "classroom-student", wantOK: true, role: rtctoken.RoleSubscriber},
+		{name: "unknown preset", preset: "webinar", wantOK: false},
+		{name: "lookup is case sensitive", preset: "Webinar-Host", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			preset, ok := TokenPresets[tt.preset]
+			if ok != tt.wantOK {
+				t.Fatalf("TokenPresets[%q] found %v, want %v", tt.preset, ok, tt.wantOK)
+			}
+
+			if ok && (preset.Role != tt.role || preset.HostOnly != tt.hostOnly) {
+				t.Errorf("TokenPresets[%q] = %+v, want role %d and host only %v", tt.preset, preset, tt.role, tt.hostOnly)
+			}
+		})
+	}
+}
+
+func TestGeneratePresetTokenBundle(t *testing.T) {
+	viper.Set("APP_ID", "970CA35de60c44645bbae8a215061b33")
+	viper.Set("APP_CERTIFICATE", "5CFd2fd1755d40ecb72977518be15d3b")
+	viper.Set("EVENT_END", "")
+	defer func() {
+		viper.Set("APP_ID", "")
+		viper.Set("APP_CERTIFICATE", nil)
+		viper.Set("RTC_TOKEN_MAX_TTL", 0)
+		viper.Set("RTM_TOKEN_MAX_TTL", 0)
+	}()
+
+	tests := []struct {
+		name    string
+		preset  string
+		ttl     int
+		maxTTL  int
+		wantTTL int
+	}{
+		{name: "preset ttl", preset: "one-to-one", wantTTL: 3600},
+		{name: "requested ttl overrides the preset", preset: "one-to-one", ttl: 600, wantTTL: 600},
+		{name: "preset ttl capped by the maximum", preset: "webinar-attendee", maxTTL: 7200, wantTTL: 7200},
+		{name: "requested ttl capped by the maximum", preset: "one-to-one", ttl: 9000, maxTTL: 7200, wantTTL: 7200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("RTC_TOKEN_MAX_TTL", tt.maxTTL)
+			viper.Set("RTM_TOKEN_MAX_TTL", tt.maxTTL)
+
+			now := time.Now().Unix()
+			bundle, err := GeneratePresetTokenBundle("channel", 1234, tt.ttl, TokenPresets[tt.preset])
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if bundle.Rtc == "" || bundle.Rtm == "" || bundle.Channel != "channel" || bundle.UID != 1234 {
+				t.Errorf("GeneratePresetTokenBundle() = %+v, want both tokens for the channel and uid", bundle)
+			}
+
+			if ttl := int64(bundle.Expiry) - now; ttl < int64(tt.wantTTL) || ttl > int64(tt.wantTTL)+2 {
+				t.Errorf("GeneratePresetTokenBundle() expires in %d seconds, want %d", ttl, tt.wantTTL)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Cloud recording storage vendors, as numbered by the Agora cloud recording API
+const (
+	AWSStorageVendor    = 1
+	GoogleStorageVendor = 6
+)
+
+// maxPresignExpiry is the longest expiry accepted by S3 and GCS for V4 signed URLs
+const maxPresignExpiry = 7 * 24 * time.Hour
+
+// ErrUnsupportedStorageVendor is returned when recordings are stored with a vendor we cannot sign URLs for
+var ErrUnsupportedStorageVendor = errors.New("Signed URLs are not supported for the recording storage vendor")
+
+// defaultPresignExpiry is used when RECORDING_URL_TTL is not a positive number of seconds
+const defaultPresignExpiry = 300 * time.Second
+
+// RecordingURLExpiry is how long signed recording URLs stay valid, RECORDING_URL_TTL seconds at most 7 days
+func RecordingURLExpiry() time.Duration {
+	expiry := time.Duration(viper.GetInt("RECORDING_URL_TTL")) * time.Second
+	if expiry <= 0 {
+		return defaultPresignExpiry
+	}
+
+	if expiry > maxPresignExpiry {
+		return maxPresignExpiry
+	}
+
+	return expiry
+}
+
+// PresignRecordingURL returns a V4 signed GET URL for a recording file in BUCKET_NAME, along with the time it expires.
+// S3 is signed with the region in BUCKET_REGION, GCS through its S3 compatible XML API with an HMAC key.
+func PresignRecordingURL(key string, now time.Time) (string, time.Time, error) {
+	var host, path, region string
+	bucket := viper.GetString("BUCKET_NAME")
+
+	switch viper.GetInt("RECORDING_VENDOR") {
+	case AWSStorageVendor:
+		region = viper.GetString("BUCKET_REGION")
+		host = bucket + ".s3." + region + ".amazonaws.com"
+		path = "/" + escapeObjectKey(key)
+	case GoogleStorageVendor:
+		region = "auto"
+		host = "storage.googleapis.com"
+		path = "/" + bucket + "/" + escapeObjectKey(key)
+	default:
+		return "", time.Time{}, ErrUnsupportedStorageVendor
+	}
+
+	secretKey, err := GetSecret("BUCKET_ACCESS_SECRET")
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now = now.UTC()
+	expiry := RecordingURLExpiry()
+	date := now.Format("20060102")
+	scope := date + "/" + region + "/s3/aws4_request"
+
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", viper.GetString("BUCKET_ACCESS_KEY")+"/"+scope)
+	query.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expiry.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+	// url.Values encodes spaces as +, which V4 signing does not accept
+	canonicalQuery := strings.ReplaceAll(query.Encode(), "+", "%20")
+
+	canonicalRequest := strings.Join([]string{
+		"GET", path, canonicalQuery, "host:" + host + "\n", "host", "UNSIGNED-PAYLOAD",
+	}, "\n")
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256", now.Format("20060102T150405Z"), scope, sha256Hex(canonicalRequest),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+secretKey), date)
+	signingKey = hmacSHA256(signingKey, region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	return "https://" + host + path + "?" + canonicalQuery + "&X-Amz-Signature=" + signature, now.Add(expiry), nil
+}
+
+// escapeObjectKey percent encodes an object key the way V4 signing expects, leaving only unreserved characters and
+// the slashes between segments as they are
+func escapeObjectKey(key string) string {
+	var encoded strings.Builder
+	for _, b := range []byte(key) {
+		if b == '/' || b == '-' || b == '_' || b == '.' || b == '~' ||
+			(b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || (b >= '0' && b <= '9') {
+			encoded.WriteByte(b)
+		} else {
+			encoded.WriteString("%" + strings.ToUpper(hex.EncodeToString([]byte{b})))
+		}
+	}
+
+	return encoded.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
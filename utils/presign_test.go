@@ -0,0 +1,43 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestRecordingURLExpiry(t *testing.T) {
+	tests := []struct {
+		name string
+		ttl  int
+		want time.Duration
+	}{
+		{name: "default", ttl: 300, want: 5 * time.Minute},
+		{name: "one hour", ttl: 3600, want: time.Hour},
+		{name: "zero", ttl: 0, want: 5 * time.Minute},
+		{name: "negative", ttl: -1, want: 5 * time.Minute},
+		{name: "longer than a week", ttl: 30 * 24 * 3600, want: 7 * 24 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("RECORDING_URL_TTL", tt.ttl)
+			defer viper.Set("RECORDING_URL_TTL", 300)
+
+			if got := RecordingURLExpiry(); got != tt.want {
+				t.Errorf("RecordingURLExpiry() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -12,12 +12,16 @@ package utils
 
 import (
 	"crypto/rand"
+	"encoding/hex"
 	"io"
 	mrand "math/rand"
 
 	"github.com/gofrs/uuid"
+	"github.com/spf13/viper"
 )
 
+const minSessionTokenBytes = 16
+
 // GenerateDTMF generates a random string of 8 digits
 func GenerateDTMF() (*string, error) {
 	const size = 8
@@ -52,3 +56,24 @@ func GenerateUUID() (string, error) {
 
 	return uuid.String(), nil
 }
+
+// GenerateSessionToken generates a bearer token of SESSION_TOKEN_BYTES random bytes, encoded as hex.
+// A uuid is generated when the length is not configured, and shorter lengths are raised to 16 bytes.
+func GenerateSessionToken() (string, error) {
+	size := viper.GetInt("SESSION_TOKEN_BYTES")
+	if size <= 0 {
+		return GenerateUUID()
+	}
+
+	if size < minSessionTokenBytes {
+		size = minSessionTokenBytes
+	}
+
+	b := make([]byte, size)
+	_, err := io.ReadFull(rand.Reader, b)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
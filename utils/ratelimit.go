@@ -0,0 +1,81 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter allows up to Limit events per key within a sliding Window
+type RateLimiter struct {
+	Limit  int
+	Window time.Duration
+
+	mutex     sync.Mutex
+	events    map[string][]time.Time
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+// NewRateLimiter creates a rate limiter which allows limit events per key every window
+func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
+	return &RateLimiter{
+		Limit:  limit,
+		Window: window,
+		events: map[string][]time.Time{},
+		now:    time.Now,
+	}
+}
+
+// Allow records an event for the key and reports whether it is within the limit.
+// A nil limiter or a limit of 0 or less allows everything.
+func (l *RateLimiter) Allow(key string) bool {
+	if l == nil || l.Limit <= 0 {
+		return true
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	cutoff := now.Add(-l.Window)
+
+	if now.Sub(l.lastPrune) >= l.Window {
+		l.prune(cutoff)
+		l.lastPrune = now
+	}
+
+	recent := l.events[key][:0]
+	for _, event := range l.events[key] {
+		if event.After(cutoff) {
+			recent = append(recent, event)
+		}
+	}
+
+	if len(recent) >= l.Limit {
+		l.events[key] = recent
+		return false
+	}
+
+	l.events[key] = append(recent, now)
+	return true
+}
+
+// prune forgets the keys which had no event after the cutoff, so that keys which went idle do not stay in memory.
+// It runs at most once per window, from Allow.
+func (l *RateLimiter) prune(cutoff time.Time) {
+	for key, events := range l.events {
+		if len(events) == 0 || !events[len(events)-1].After(cutoff) {
+			delete(l.events, key)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	start := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		// offsets of the events after start, in seconds
+		offsets []int
+		limit   int
+		want    []bool
+	}{
+		{name: "within limit", offsets: []int{0, 1, 2}, limit: 3, want: []bool{true, true, true}},
+		{name: "over limit", offsets: []int{0, 1, 2}, limit: 2, want: []bool{true, true, false}},
+		{name: "window slides", offsets: []int{0, 1, 61}, limit: 2, want: []bool{true, true, true}},
+		{name: "no limit", offsets: []int{0, 0, 0}, limit: 0, want: []bool{true, true, true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := NewRateLimiter(tt.limit, time.Minute)
+			for i, offset := range tt.offsets {
+				limiter.now = func() time.Time { return start.Add(time.Duration(offset) * time.Second) }
+				if got := limiter.Allow("user"); got != tt.want[i] {
+					t.Errorf("Allow() at %ds = %v, want %v", offset, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiterPrunesIdleKeys(t *testing.T) {
+	start := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		later    time.Duration
+		wantKeys int
+	}{
+		{name: "within the window", later: 30 * time.Second, wantKeys: 3},
+		{name: "after the window", later: 2 * time.Minute, wantKeys: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := NewRateLimiter(5, time.Minute)
+			limiter.now = func() time.Time { return start }
+			limiter.Allow("first")
+			limiter.Allow("second")
+
+			limiter.now = func() time.Time { return start.Add(tt.later) }
+			limiter.Allow("third")
+
+			if got := len(limiter.events); got != tt.wantKeys {
+				t.Errorf("tracked keys = %d, want %d", got, tt.wantKeys)
+			}
+		})
+	}
+}
@@ -88,7 +88,7 @@ type StartRecordRequest struct {
 
 // Acquire runs the acquire endpoint for Cloud Recording
 func (rec *Recorder) Acquire() error {
-	creds, err := GenerateUserCredentials(rec.Channel, false, false)
+	creds, err := GenerateUserCredentials(rec.Channel, GenerateUID(false), false, 0)
 	if err != nil {
 		return err
 	}
@@ -96,6 +96,11 @@ func (rec *Recorder) Acquire() error {
 	rec.UID = int32(creds.UID)
 	rec.Token = creds.Rtc
 
+	if TestModeEnabled() {
+		rec.RID = "test-resource-" + rec.Channel
+		return nil
+	}
+
 	requestBody, err := json.Marshal(&AcquireRequest{
 		Cname: rec.Channel,
 		UID:   strconv.Itoa(int(rec.UID)),
@@ -104,14 +109,17 @@ func (rec *Recorder) Acquire() error {
 		},
 	})
 
-	req, err := http.NewRequest("POST", "https://api.agora.io/v1/apps/"+viper.GetString("APP_ID")+"/cloud_recording/acquire",
+	req, err := http.NewRequest("POST", AgoraAPIURL+"/v1/apps/"+viper.GetString("APP_ID")+"/cloud_recording/acquire",
 		bytes.NewBuffer(requestBody))
 	if err != nil {
 		return err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.SetBasicAuth(viper.GetString("CUSTOMER_ID"), viper.GetString("CUSTOMER_CERTIFICATE"))
+	err = SetRESTAuth(req)
+	if err != nil {
+		return err
+	}
 
 	resp, err := rec.Do(req)
 	if err != nil {
@@ -132,6 +140,11 @@ func (rec *Recorder) Acquire() error {
 
 // Start starts the recording
 func (rec *Recorder) Start(channelTitle string, secret *string) error {
+	if TestModeEnabled() {
+		rec.SID = "test-sid-" + rec.Channel
+		return nil
+	}
+
 	// currentTime := strconv.FormatInt(time.Now().Unix(), 10)
 	location, err := time.LoadLocation("America/Los_Angeles")
 	if err != nil {
@@ -198,14 +211,17 @@ func (rec *Recorder) Start(channelTitle string, secret *string) error {
 		return err
 	}
 
-	req, err := http.NewRequest("POST", "https://api.agora.io/v1/apps/"+viper.GetString("APP_ID")+"/cloud_recording/resourceid/"+rec.RID+"/mode/mix/start",
+	req, err := http.NewRequest("POST", AgoraAPIURL+"/v1/apps/"+viper.GetString("APP_ID")+"/cloud_recording/resourceid/"+rec.RID+"/mode/mix/start",
 		bytes.NewBuffer(requestBody))
 	if err != nil {
 		return err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.SetBasicAuth(viper.GetString("CUSTOMER_ID"), viper.GetString("CUSTOMER_CERTIFICATE"))
+	err = SetRESTAuth(req)
+	if err != nil {
+		return err
+	}
 
 	resp, err := rec.Do(req)
 	if err != nil {
@@ -230,6 +246,10 @@ type UpdateRecordRequest struct {
 }
 
 func ChangeRecordingMode(channel string, uid int, rid string, sid string, mode int, maxUID string, logger *Logger) error {
+	if TestModeEnabled() {
+		return nil
+	}
+
 	recordingRequest := UpdateRecordRequest{
 		Cname: channel,
 		UID:   strconv.Itoa(uid),
@@ -247,16 +267,19 @@ func ChangeRecordingMode(channel string, uid int, rid string, sid string, mode i
 		return err
 	}
 
-	req, err := http.NewRequest("POST", "https://api.agora.io/v1/apps/"+viper.GetString("APP_ID")+"/cloud_recording/resourceid/"+rid+"/sid/"+sid+"/mode/mix/update",
+	req, err := http.NewRequest("POST", AgoraAPIURL+"/v1/apps/"+viper.GetString("APP_ID")+"/cloud_recording/resourceid/"+rid+"/sid/"+sid+"/mode/mix/update",
 		bytes.NewBuffer(requestBody))
 	if err != nil {
 		return err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.SetBasicAuth(viper.GetString("CUSTOMER_ID"), viper.GetString("CUSTOMER_CERTIFICATE"))
+	err = SetRESTAuth(req)
+	if err != nil {
+		return err
+	}
 
-	client := &http.Client{}
+	client := BreakerClient(AgoraCircuit)
 	resp, err := client.Do(req)
 	if err != nil {
 		return err
@@ -273,8 +296,48 @@ func ChangeRecordingMode(channel string, uid int, rid string, sid string, mode i
 
 }
 
-// Stop stops the cloud recording
-func Stop(channel string, uid int, rid string, sid string, logger *Logger) error {
+// StopResponse is the response of the stop endpoint for Cloud Recording
+type StopResponse struct {
+	ResourceID     string `json:"resourceId"`
+	SID            string `json:"sid"`
+	ServerResponse struct {
+		FileListMode string          `json:"fileListMode"`
+		FileList     json.RawMessage `json:"fileList"`
+	} `json:"serverResponse"`
+}
+
+// FileNames lists the files uploaded by the recording. Agora sends a single file name in the string mode and a list
+// of files in the json mode.
+func (resp *StopResponse) FileNames() []string {
+	var fileName string
+	if json.Unmarshal(resp.ServerResponse.FileList, &fileName) == nil {
+		if fileName == "" {
+			return nil
+		}
+		return []string{fileName}
+	}
+
+	var files []struct {
+		FileName string `json:"fileName"`
+	}
+	json.Unmarshal(resp.ServerResponse.FileList, &files)
+
+	var fileNames []string
+	for _, file := range files {
+		if file.FileName != "" {
+			fileNames = append(fileNames, file.FileName)
+		}
+	}
+
+	return fileNames
+}
+
+// Stop stops the cloud recording and returns the names of the files it uploaded
+func Stop(channel string, uid int, rid string, sid string, logger *Logger) ([]string, error) {
+	if TestModeEnabled() {
+		return nil, nil
+	}
+
 	recordingRequest := AcquireRequest{
 		Cname:         channel,
 		UID:           strconv.Itoa(uid),
@@ -285,29 +348,32 @@ func Stop(channel string, uid int, rid string, sid string, logger *Logger) error
 
 	requestBody, err := json.Marshal(&recordingRequest)
 
-	req, err := http.NewRequest("POST", "https://api.agora.io/v1/apps/"+viper.GetString("APP_ID")+"/cloud_recording/resourceid/"+rid+"/sid/"+sid+"/mode/mix/stop",
+	req, err := http.NewRequest("POST", AgoraAPIURL+"/v1/apps/"+viper.GetString("APP_ID")+"/cloud_recording/resourceid/"+rid+"/sid/"+sid+"/mode/mix/stop",
 		bytes.NewBuffer([]byte(requestBody)))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.SetBasicAuth(viper.GetString("CUSTOMER_ID"), viper.GetString("CUSTOMER_CERTIFICATE"))
+	err = SetRESTAuth(req)
+	if err != nil {
+		return nil, err
+	}
 
-	client := &http.Client{}
+	client := BreakerClient(AgoraCircuit)
 	resp, err := client.Do(req)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	defer resp.Body.Close()
 
-	var result map[string]string
+	var result StopResponse
 	json.NewDecoder(resp.Body).Decode(&result)
 
 	logger.Info().Interface("response", result).Msg("Stop Cloud Recording Response")
 
-	return nil
+	return result.FileNames(), nil
 }
 
 // FirstN is to return the first N characters of a string
@@ -0,0 +1,99 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package utils
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+func TestRecordingRESTAuth(t *testing.T) {
+	nop := zerolog.Nop()
+	logger := &Logger{Logger: &nop}
+
+	type request struct {
+		path       string
+		customerID string
+		secret     string
+	}
+
+	var requests []request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		customerID, secret, _ := r.BasicAuth()
+		requests = append(requests, request{path: r.URL.Path, customerID: customerID, secret: secret})
+		json.NewEncoder(w).Encode(map[string]interface{}{"resourceId": "rid", "sid": "sid", "serverResponse": map[string]interface{}{"fileList": "recording.m3u8"}})
+	}))
+	defer server.Close()
+
+	agoraAPIURL := AgoraAPIURL
+	AgoraAPIURL = server.URL
+	defer func() { AgoraAPIURL = agoraAPIURL }()
+
+	viper.Set("APP_ID", "970CA35de60c44645bbae8a215061b33")
+	viper.Set("APP_CERTIFICATE", "5CFd2fd1755d40ecb72977518be15d3b")
+	defer viper.Set("APP_ID", "")
+	defer viper.Set("APP_CERTIFICATE", nil)
+	defer viper.Set("CUSTOMER_ID", "")
+	defer viper.Set("CUSTOMER_CERTIFICATE", nil)
+
+	prefix := "/v1/apps/970CA35de60c44645bbae8a215061b33/cloud_recording"
+	tests := []struct {
+		name     string
+		call     func() error
+		wantPath string
+	}{
+		{name: "acquire", call: func() error {
+			return (&Recorder{Channel: "channel", Logger: logger}).Acquire()
+		}, wantPath: prefix + "/acquire"},
+		{name: "start", call: func() error {
+			return (&Recorder{Channel: "channel", RID: "rid", UID: 1, Logger: logger}).Start("Title", nil)
+		}, wantPath: prefix + "/resourceid/rid/mode/mix/start"},
+		{name: "update", call: func() error {
+			return ChangeRecordingMode("channel", 1, "rid", "sid", 1, "", logger)
+		}, wantPath: prefix + "/resourceid/rid/sid/sid/mode/mix/update"},
+		{name: "stop", call: func() error {
+			_, err := Stop("channel", 1, "rid", "sid", logger)
+			return err
+		}, wantPath: prefix + "/resourceid/rid/sid/sid/mode/mix/stop"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The customer credentials authenticate the request, never the app credentials
+			viper.Set("CUSTOMER_ID", "customer-id")
+			viper.Set("CUSTOMER_CERTIFICATE", "customer-secret")
+			requests = nil
+
+			if err := tt.call(); err != nil {
+				t.Fatal(err)
+			}
+
+			want := request{path: tt.wantPath, customerID: "customer-id", secret: "customer-secret"}
+			if len(requests) != 1 || requests[0] != want {
+				t.Errorf("requests = %+v, want %+v", requests, want)
+			}
+
+			// Without the customer credentials nothing is sent
+			viper.Set("CUSTOMER_ID", "")
+			viper.Set("CUSTOMER_CERTIFICATE", nil)
+			requests = nil
+
+			if err := tt.call(); err != ErrRESTCredentialsMissing || len(requests) != 0 {
+				t.Errorf("without customer credentials = %v with %d requests, want %v", err, len(requests), ErrRESTCredentialsMissing)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package utils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+// SecretProvider loads a named secret, like APP_CERTIFICATE, from wherever the deployment stores it
+type SecretProvider interface {
+	GetSecret(name string) (string, error)
+}
+
+// EnvSecretProvider reads secrets from the environment or the config.json
+type EnvSecretProvider struct{}
+
+// GetSecret returns the value of the environment variable or config key with the given name
+func (EnvSecretProvider) GetSecret(name string) (string, error) {
+	if !viper.IsSet(name) {
+		return "", fmt.Errorf("Secret %s is not set", name)
+	}
+
+	return viper.GetString(name), nil
+}
+
+// FileSecretProvider reads every secret from a file of the same name inside Directory
+type FileSecretProvider struct {
+	Directory string
+}
+
+// GetSecret returns the contents of the secret file without the trailing newline
+func (p FileSecretProvider) GetSecret(name string) (string, error) {
+	contents, err := ioutil.ReadFile(filepath.Join(p.Directory, name))
+	if err != nil {
+		return "", fmt.Errorf("Could not read secret %s: %w", name, err)
+	}
+
+	return strings.TrimRight(string(contents), "\r\n"), nil
+}
+
+var (
+	secretProvidersMutex sync.RWMutex
+	secretProviders      = map[string]SecretProvider{}
+)
+
+// RegisterSecretProvider makes an external secret provider, like a KMS client, selectable through SECRET_PROVIDER
+func RegisterSecretProvider(name string, provider SecretProvider) {
+	secretProvidersMutex.Lock()
+	defer secretProvidersMutex.Unlock()
+
+	secretProviders[name] = provider
+}
+
+// GetSecretProvider returns the secret provider configured by SECRET_PROVIDER
+func GetSecretProvider() (SecretProvider, error) {
+	name := viper.GetString("SECRET_PROVIDER")
+
+	switch name {
+	case "", "env":
+		return EnvSecretProvider{}, nil
+	case "file":
+		return FileSecretProvider{Directory: viper.GetString("SECRETS_DIR")}, nil
+	}
+
+	secretProvidersMutex.RLock()
+	defer secretProvidersMutex.RUnlock()
+
+	provider, ok := secretProviders[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown secret provider %s", name)
+	}
+
+	return provider, nil
+}
+
+// GetSecret loads the named secret using the configured secret provider
+func GetSecret(name string) (string, error) {
+	provider, err := GetSecretProvider()
+	if err != nil {
+		return "", err
+	}
+
+	return provider.GetSecret(name)
+}
@@ -0,0 +1,76 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package utils
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+type staticSecretProvider map[string]string
+
+func (p staticSecretProvider) GetSecret(name string) (string, error) {
+	secret, ok := p[name]
+	if !ok {
+		return "", errors.New("not found")
+	}
+
+	return secret, nil
+}
+
+func TestGetSecret(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "TEST_SECRET"), []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	RegisterSecretProvider("static", staticSecretProvider{"TEST_SECRET": "from-static"})
+
+	tests := []struct {
+		name     string
+		provider string
+		secret   string
+		want     string
+		wantErr  bool
+	}{
+		{name: "default provider reads the config", secret: "TEST_SECRET", want: "from-config"},
+		{name: "env provider reads the config", provider: "env", secret: "TEST_SECRET", want: "from-config"},
+		{name: "env provider with a missing secret", provider: "env", secret: "MISSING_SECRET", wantErr: true},
+		{name: "file provider takes precedence over the config", provider: "file", secret: "TEST_SECRET", want: "from-file"},
+		{name: "file provider with a missing file", provider: "file", secret: "MISSING_SECRET", wantErr: true},
+		{name: "registered provider takes precedence over the config", provider: "static", secret: "TEST_SECRET", want: "from-static"},
+		{name: "unknown provider", provider: "vault", secret: "TEST_SECRET", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("TEST_SECRET", "from-config")
+			viper.Set("SECRET_PROVIDER", tt.provider)
+			viper.Set("SECRETS_DIR", dir)
+			defer viper.Set("TEST_SECRET", nil)
+			defer viper.Set("SECRET_PROVIDER", "")
+			defer viper.Set("SECRETS_DIR", "")
+
+			got, err := GetSecret(tt.secret)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetSecret(%q) error = %v, wantErr %v", tt.secret, err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("GetSecret(%q) = %q, want %q", tt.secret, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package utils
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// SlowCallTransport is a http.RoundTripper which logs a warning for every external call taking longer than
+// SLOW_CALL_THRESHOLD milliseconds. A threshold of 0 disables the warning.
+type SlowCallTransport struct {
+	Service string
+	Base    http.RoundTripper
+}
+
+// RoundTrip measures the latency of the request until the response headers arrive
+func (t *SlowCallTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	start := time.Now()
+	resp, err := base.RoundTrip(req)
+	duration := time.Since(start)
+
+	threshold := time.Duration(viper.GetInt("SLOW_CALL_THRESHOLD")) * time.Millisecond
+	if threshold > 0 && duration > threshold {
+		// The query is left out since it may carry credentials
+		event := log.Warn().Str("service", t.Service).Str("method", req.Method).Str("host", req.URL.Host).Str("path", req.URL.Path).Dur("duration", duration).Dur("threshold", threshold)
+		if err != nil {
+			event = event.Err(err)
+		} else {
+			event = event.Int("status", resp.StatusCode)
+		}
+
+		event.Msg("Slow external call")
+	}
+
+	return resp, err
+}
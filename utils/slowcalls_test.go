@@ -0,0 +1,77 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package utils
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// delayedTransport answers every request with a 200 after the delay
+type delayedTransport time.Duration
+
+func (d delayedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	time.Sleep(time.Duration(d))
+	return httptest.NewRecorder().Result(), nil
+}
+
+func TestSlowCallTransport(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.Logger
+	log.Logger = zerolog.New(&buf)
+	defer func() { log.Logger = logger }()
+	defer viper.Set("SLOW_CALL_THRESHOLD", 0)
+
+	tests := []struct {
+		name      string
+		threshold int
+		delay     time.Duration
+		wantLog   bool
+	}{
+		{name: "slow call", threshold: 20, delay: 50 * time.Millisecond, wantLog: true},
+		{name: "fast call", threshold: 200, delay: 0, wantLog: false},
+		{name: "disabled", threshold: 0, delay: 50 * time.Millisecond, wantLog: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			viper.Set("SLOW_CALL_THRESHOLD", tt.threshold)
+
+			req := httptest.NewRequest("GET", "https://api.agora.io/v1/apps?secret=credential", nil)
+			transport := &SlowCallTransport{Service: "agora", Base: delayedTransport(tt.delay)}
+			if _, err := transport.RoundTrip(req); err != nil {
+				t.Fatal(err)
+			}
+
+			logged := buf.String()
+			if strings.Contains(logged, "Slow external call") != tt.wantLog {
+				t.Fatalf("log = %q, want a slow call warning %v", logged, tt.wantLog)
+			}
+
+			if tt.wantLog && (!strings.Contains(logged, `"service":"agora"`) || !strings.Contains(logged, `"status":200`)) {
+				t.Errorf("log = %q, want the service and status", logged)
+			}
+
+			if strings.Contains(logged, "credential") {
+				t.Errorf("log = %q, want the query left out", logged)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/viper"
+)
+
+// TestEnvironment is the only ENVIRONMENT in which TEST_MODE takes effect
+const TestEnvironment = "test"
+
+// ProductionEnvironment is the default ENVIRONMENT, in which development endpoints are never served
+const ProductionEnvironment = "production"
+
+// TestModeEnabled reports whether external calls are replaced by fakes for integration tests.
+// Test mode logs in anybody as the configured fake user, so TEST_MODE alone is not enough and
+// ENVIRONMENT has to be set to test as well.
+func TestModeEnabled() bool {
+	return viper.GetBool("TEST_MODE") && viper.GetString("ENVIRONMENT") == TestEnvironment
+}
+
+// CheckTestMode refuses a TEST_MODE which was set outside of the test environment, which is most likely a mistake
+func CheckTestMode() error {
+	if viper.GetBool("TEST_MODE") && viper.GetString("ENVIRONMENT") != TestEnvironment {
+		return errors.New("TEST_MODE can only be enabled when ENVIRONMENT is " + TestEnvironment)
+	}
+
+	return nil
+}
+
+// fakeToken is handed out instead of an Agora token in test mode, it is deterministic so that tests can assert it
+func fakeToken(kind string, subject string, expireTimestamp uint32) string {
+	return fmt.Sprintf("test-%s-%s-%d", kind, subject, expireTimestamp)
+}
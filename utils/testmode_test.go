@@ -0,0 +1,65 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestTestMode(t *testing.T) {
+	tests := []struct {
+		name        string
+		testMode    interface{}
+		environment interface{}
+		wantEnabled bool
+		wantErr     bool
+	}{
+		{name: "default", testMode: nil, environment: nil, wantEnabled: false},
+		{name: "test environment without test mode", testMode: false, environment: TestEnvironment, wantEnabled: false},
+		{name: "test mode in production", testMode: true, environment: ProductionEnvironment, wantEnabled: false, wantErr: true},
+		{name: "test mode without an environment", testMode: true, environment: nil, wantEnabled: false, wantErr: true},
+		{name: "test mode in the test environment", testMode: true, environment: TestEnvironment, wantEnabled: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Start from the defaults, as a deployment without any config would
+			viper.Reset()
+			defer viper.Reset()
+			SetDefaults()
+
+			if tt.testMode != nil {
+				viper.Set("TEST_MODE", tt.testMode)
+			}
+			if tt.environment != nil {
+				viper.Set("ENVIRONMENT", tt.environment)
+			}
+
+			if got := TestModeEnabled(); got != tt.wantEnabled {
+				t.Errorf("TestModeEnabled() = %v, want %v", got, tt.wantEnabled)
+			}
+
+			if err := CheckTestMode(); (err != nil) != tt.wantErr {
+				t.Errorf("CheckTestMode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			// Tokens are only faked in test mode, elsewhere they still need the app credentials
+			token, err := GetRtcToken("channel", 42, 1000)
+			if tt.wantEnabled && (err != nil || token != "test-rtc-channel-42-1000") {
+				t.Errorf("GetRtcToken() = %q, %v, want the fake token", token, err)
+			} else if !tt.wantEnabled && token == "test-rtc-channel-42-1000" {
+				t.Errorf("GetRtcToken() = %q outside of test mode", token)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package utils
+
+import (
+	"crypto/tls"
+	"fmt"
+
+	"github.com/spf13/viper"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// TLSConfig builds the configuration of the HTTPS server from TLS_MIN_VERSION and TLS_CIPHER_SUITES.
+// The cipher suites are named as in crypto/tls, and an empty list keeps the Go defaults. Go does not allow
+// configuring the TLS 1.3 suites, so the list only applies to TLS 1.2 and below.
+func TLSConfig() (*tls.Config, error) {
+	minVersion, ok := tlsVersions[viper.GetString("TLS_MIN_VERSION")]
+	if !ok {
+		return nil, fmt.Errorf("Unsupported TLS_MIN_VERSION %s", viper.GetString("TLS_MIN_VERSION"))
+	}
+
+	config := &tls.Config{MinVersion: minVersion}
+
+	names := viper.GetStringSlice("TLS_CIPHER_SUITES")
+	if len(names) == 0 {
+		return config, nil
+	}
+
+	suites := map[string]uint16{}
+	for _, suite := range tls.CipherSuites() {
+		suites[suite.Name] = suite.ID
+	}
+
+	for _, name := range names {
+		id, ok := suites[name]
+		if !ok {
+			return nil, fmt.Errorf("Unsupported cipher suite %s", name)
+		}
+
+		config.CipherSuites = append(config.CipherSuites, id)
+	}
+
+	return config, nil
+}
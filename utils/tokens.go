@@ -11,7 +11,10 @@
 package utils
 
 import (
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"strconv"
 	"time"
 
 	"github.com/samyak-jain/agora_backend/pkg/models"
@@ -20,36 +23,242 @@ import (
 	"github.com/spf13/viper"
 )
 
-// GetRtcToken generates token for Agora RTC SDK
-func GetRtcToken(channel string, uid int) (string, error) {
-	var RtcRole rtctoken.Role = rtctoken.RolePublisher
+// Token endpoints which have their own default and maximum TTL
+const (
+	RtcTokenEndpoint     = "RTC"
+	RtmTokenEndpoint     = "RTM"
+	SessionTokenEndpoint = "SESSION"
+)
+
+// IntConfig reads integer settings, either from the global config with viper.GetViper() or from a tenant's overrides
+type IntConfig interface {
+	GetInt(key string) int
+}
+
+// GetTokenTTL returns the TTL in seconds for a token issued by the endpoint.
+// A requested TTL of 0 or less uses the endpoint default, and every TTL is clamped to the endpoint maximum and to the
+// end of the event window. A TTL of 0, which never expires, is only kept when the endpoint has no maximum either.
+func GetTokenTTL(endpoint string, requested int) int {
+	return GetTokenTTLFrom(viper.GetViper(), endpoint, requested)
+}
+
+// GetTokenTTLFrom is GetTokenTTL with the endpoint default and maximum read from the config
+func GetTokenTTLFrom(config IntConfig, endpoint string, requested int) int {
+	ttl := requested
+	if ttl <= 0 {
+		ttl = config.GetInt(endpoint + "_TOKEN_TTL")
+	}
+
+	maxTTL := config.GetInt(endpoint + "_TOKEN_MAX_TTL")
+	if maxTTL > 0 && (ttl <= 0 || ttl > maxTTL) {
+		ttl = maxTTL
+	}
+
+	return clampToEventEnd(ttl)
+}
+
+// CheckEventWindow makes sure EVENT_END is an RFC 3339 timestamp when it is set, so that a typo cannot silently
+// disable the clamping
+func CheckEventWindow() error {
+	eventEnd := viper.GetString("EVENT_END")
+	if eventEnd == "" {
+		return nil
+	}
+
+	_, err := time.Parse(time.RFC3339, eventEnd)
+	if err != nil {
+		return fmt.Errorf("EVENT_END must be an RFC 3339 timestamp: %w", err)
+	}
+
+	return nil
+}
+
+// ErrEventEnded is returned when issuing or renewing a token once EVENT_END has passed
+var ErrEventEnded = errors.New("The event has ended")
+
+// eventEnd returns EVENT_END, and false when it is not set. CheckEventWindow refuses to start with an invalid one.
+func eventEnd() (time.Time, bool) {
+	value := viper.GetString("EVENT_END")
+	if value == "" {
+		return time.Time{}, false
+	}
+
+	end, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, false
+	}
 
+	return end, true
+}
+
+// CheckEventNotEnded returns ErrEventEnded once EVENT_END has passed, so that no more tokens are issued or renewed
+func CheckEventNotEnded() error {
+	if end, ok := eventEnd(); ok && !time.Now().Before(end) {
+		return ErrEventEnded
+	}
+
+	return nil
+}
+
+// ClampExpiryToEventEnd makes an expiry no later than EVENT_END, for tokens which are issued with an expiry time
+func ClampExpiryToEventEnd(expiresAt time.Time) time.Time {
+	if end, ok := eventEnd(); ok && expiresAt.After(end) {
+		return end
+	}
+
+	return expiresAt
+}
+
+// clampToEventEnd makes a token issued now expire no later than EVENT_END, for deployments serving a single event.
+// A TTL of 0, which never expires, is clamped as well. No tokens are issued once the event ended, see
+// CheckEventNotEnded, so the TTL is at least a second since a TTL of 0 would mean no expiry.
+func clampToEventEnd(ttl int) int {
+	end, ok := eventEnd()
+	if !ok {
+		return ttl
+	}
+
+	remaining := int(time.Until(end).Seconds())
+	if remaining < 1 {
+		remaining = 1
+	}
+
+	if ttl <= 0 || ttl > remaining {
+		return remaining
+	}
+
+	return ttl
+}
+
+// GetTokenExpiry returns the unix timestamp at which a token issued now by the endpoint expires
+func GetTokenExpiry(endpoint string, requested int) uint32 {
 	currentTimestamp := uint32(time.Now().UTC().Unix())
-	expireTimestamp := currentTimestamp + 86400
+	return currentTimestamp + uint32(GetTokenTTL(endpoint, requested))
+}
 
-	return rtctoken.BuildTokenWithUID(viper.GetString("APP_ID"), viper.GetString("APP_CERTIFICATE"), channel, uint32(uid), RtcRole, expireTimestamp)
+// GetRtcToken generates token for Agora RTC SDK
+func GetRtcToken(channel string, uid int, expireTimestamp uint32) (string, error) {
+	return GetRtcTokenWithRole(channel, uid, rtctoken.RolePublisher, expireTimestamp)
+}
+
+// GetRtcTokenWithRole generates a token for Agora RTC SDK with the privileges of the role
+func GetRtcTokenWithRole(channel string, uid int, role rtctoken.Role, expireTimestamp uint32) (string, error) {
+	if err := CheckEventNotEnded(); err != nil {
+		return "", err
+	}
+
+	if TestModeEnabled() {
+		if role != rtctoken.RolePublisher {
+			return fakeToken(fmt.Sprintf("rtc%d", role), fmt.Sprintf("%s-%d", channel, uid), expireTimestamp), nil
+		}
+
+		return fakeToken("rtc", fmt.Sprintf("%s-%d", channel, uid), expireTimestamp), nil
+	}
+
+	appCertificate, err := GetSecret("APP_CERTIFICATE")
+	if err != nil {
+		return "", err
+	}
+
+	return rtctoken.BuildTokenWithUID(viper.GetString("APP_ID"), appCertificate, channel, uint32(uid), role, expireTimestamp)
 }
 
 // GetRtmToken generates a token for Agora RTM SDK
-func GetRtmToken(user string) (string, error) {
+func GetRtmToken(user string, expireTimestamp uint32) (string, error) {
+	if err := CheckEventNotEnded(); err != nil {
+		return "", err
+	}
 
-	currentTimestamp := uint32(time.Now().UTC().Unix())
-	expireTimestamp := currentTimestamp + 86400
+	if TestModeEnabled() {
+		return fakeToken("rtm", user, expireTimestamp), nil
+	}
+
+	appCertificate, err := GetSecret("APP_CERTIFICATE")
+	if err != nil {
+		return "", err
+	}
 
-	return rtmtoken.BuildToken(viper.GetString("APP_ID"), viper.GetString("APP_CERTIFICATE"), user, rtmtoken.RoleRtmUser, expireTimestamp)
+	return rtmtoken.BuildToken(viper.GetString("APP_ID"), appCertificate, user, rtmtoken.RoleRtmUser, expireTimestamp)
 }
 
-// GenerateUserCredentials generates uid, rtc and rtc token
-func GenerateUserCredentials(channel string, rtm bool, pstn bool) (*models.UserCredentials, error) {
+// GenerateUID generates a random uid in the range reserved for PSTN or regular users
+func GenerateUID(pstn bool) int {
 	initialUID := RandomRange(10000000, 99999999)
-	var uid int
 	if pstn {
-		uid = initialUID + 100000000
-	} else {
-		uid = initialUID + 200000000
+		return initialUID + 100000000
 	}
 
-	rtcToken, err := GetRtcToken(channel, uid)
+	return initialUID + 200000000
+}
+
+// UID allocation strategies which can be set in UID_STRATEGY
+const (
+	RandomUIDStrategy  = "random"
+	DerivedUIDStrategy = "derived"
+	SDKUIDStrategy     = "sdk"
+)
+
+// GenerateUID draws PSTN and regular random uids from [minRandomUID, maxRandomUID), which derived uids stay out of
+const (
+	minRandomUID = 100000000
+	maxRandomUID = 300000000
+)
+
+// derivedUIDSpace splits the 31 bit derived uids in two halves. The per-channel uids of DeriveUID are in the upper
+// half and the uids persisted on users by DeriveUserUID in the lower one, so that they never equal each other.
+const derivedUIDSpace = 1 << 30
+
+// hashUID hashes the key into the lower half of the derived uids
+func hashUID(key string) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+
+	return int(hash.Sum32() & (derivedUIDSpace - 1))
+}
+
+// DeriveUID hashes the user and channel into a stable, non zero uid.
+// The uid is kept within 31 bits so that it fits in a GraphQL Int.
+func DeriveUID(userKey string, channel string) int {
+	return derivedUIDSpace + hashUID(userKey+"/"+channel)
+}
+
+// DeriveUserUID derives the candidate uid persisted for a user.
+// Later attempts yield different candidates, which are used when an earlier one is already taken or is being replaced.
+// Candidates are never 0 and never in the range of random PSTN and regular uids, they are hashed again until they are
+// out of it.
+func DeriveUserUID(userKey string, attempt int) int {
+	key := userKey + "/#" + strconv.Itoa(attempt)
+
+	uid := hashUID(key)
+	for uid == 0 || (uid >= minRandomUID && uid < maxRandomUID) {
+		key += "#"
+		uid = hashUID(key)
+	}
+
+	return uid
+}
+
+// AllocateUID picks the uid for a user joining the channel according to UID_STRATEGY.
+// The sdk strategy returns 0 so that the Agora SDK assigns the uid, which is only possible when no RTM token is needed
+// since RTM tokens are bound to a concrete user ID. The derived strategy falls back to a random uid for anonymous users.
+func AllocateUID(userKey string, channel string, rtm bool) int {
+	strategy := viper.GetString("UID_STRATEGY")
+
+	if strategy == SDKUIDStrategy && !rtm {
+		return 0
+	}
+
+	if (strategy == DerivedUIDStrategy || strategy == SDKUIDStrategy) && userKey != "" {
+		return DeriveUID(userKey, channel)
+	}
+
+	return GenerateUID(false)
+}
+
+// GenerateUserCredentials generates rtc and optionally rtm token for the uid.
+// The requested ttl is in seconds and 0 uses the default of each token.
+func GenerateUserCredentials(channel string, uid int, rtm bool, ttl int) (*models.UserCredentials, error) {
+	rtcToken, err := GetRtcToken(channel, uid, GetTokenExpiry(RtcTokenEndpoint, ttl))
 	if err != nil {
 		return nil, err
 	}
@@ -61,7 +270,7 @@ func GenerateUserCredentials(channel string, rtm bool, pstn bool) (*models.UserC
 		}, nil
 	}
 
-	rtmToken, err := GetRtmToken(fmt.Sprint(uid))
+	rtmToken, err := GetRtmToken(fmt.Sprint(uid), GetTokenExpiry(RtmTokenEndpoint, ttl))
 	if err != nil {
 		return nil, err
 	}
@@ -72,3 +281,34 @@ func GenerateUserCredentials(channel string, rtm bool, pstn bool) (*models.UserC
 		UID: uid,
 	}, nil
 }
+
+// GenerateTokenBundle generates an RTC and an RTM token for the same uid in one go.
+// The expiry of the bundle is the earlier of the two token expiries.
+func GenerateTokenBundle(channel string, uid int, ttl int) (*models.TokenBundle, error) {
+	rtcExpiry := GetTokenExpiry(RtcTokenEndpoint, ttl)
+	rtmExpiry := GetTokenExpiry(RtmTokenEndpoint, ttl)
+
+	rtcToken, err := GetRtcToken(channel, uid, rtcExpiry)
+	if err != nil {
+		return nil, err
+	}
+
+	rtmToken, err := GetRtmToken(fmt.Sprint(uid), rtmExpiry)
+	if err != nil {
+		return nil, err
+	}
+
+	expiry := rtcExpiry
+	if rtmExpiry < expiry {
+		expiry = rtmExpiry
+	}
+
+	return &models.TokenBundle{
+		AppID:   viper.GetString("APP_ID"),
+		Channel: channel,
+		UID:     uid,
+		Rtc:     rtcToken,
+		Rtm:     rtmToken,
+		Expiry:  int(expiry),
+	}, nil
+}
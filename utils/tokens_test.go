@@ -0,0 +1,221 @@
+// ********************************************
+// Copyright © 2021 Agora Lab, Inc., all rights reserved.
+// AppBuilder and all associated components, source code, APIs, services, and documentation
+// (the “Materials”) are owned by Agora Lab, Inc. and its licensors.  The Materials may not be
+// accessed, used, modified, or distributed for any purpose without a license from Agora Lab, Inc.
+// Use without a license or in violation of any license terms and conditions (including use for
+// any purpose competitive to Agora Lab, Inc.’s business) is strictly prohibited.  For more
+// information visit https://appbuilder.agora.io.
+// *********************************************
+
+package utils
+
+import (
+	"hash/crc32"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	accesstoken "github.com/AgoraIO/Tools/DynamicKey/AgoraDynamicKey/go/src/AccessToken"
+	"github.com/spf13/viper"
+)
+
+// mapConfig is an IntConfig backed by a map, standing in for a tenant's overrides
+type mapConfig map[string]int
+
+func (config mapConfig) GetInt(key string) int {
+	return config[key]
+}
+
+func TestGetTokenTTLFrom(t *testing.T) {
+	viper.Set("EVENT_END", "")
+
+	tests := []struct {
+		name      string
+		config    mapConfig
+		requested int
+		want      int
+	}{
+		{name: "default", config: mapConfig{"SESSION_TOKEN_TTL": 3600, "SESSION_TOKEN_MAX_TTL": 7200}, requested: 0, want: 3600},
+		{name: "requested within maximum", config: mapConfig{"SESSION_TOKEN_TTL": 3600, "SESSION_TOKEN_MAX_TTL": 7200}, requested: 60, want: 60},
+		{name: "requested above maximum", config: mapConfig{"SESSION_TOKEN_TTL": 3600, "SESSION_TOKEN_MAX_TTL": 7200}, requested: 9000, want: 7200},
+		{name: "default above maximum", config: mapConfig{"SESSION_TOKEN_TTL": 9000, "SESSION_TOKEN_MAX_TTL": 7200}, requested: 0, want: 7200},
+		{name: "never expiring default is capped", config: mapConfig{"SESSION_TOKEN_TTL": 0, "SESSION_TOKEN_MAX_TTL": 7200}, requested: 0, want: 7200},
+		{name: "no maximum", config: mapConfig{"SESSION_TOKEN_TTL": 9000}, requested: 0, want: 9000},
+		{name: "never expiring without maximum", config: mapConfig{}, requested: 0, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := GetTokenTTLFrom(tt.config, SessionTokenEndpoint, tt.requested); got != tt.want {
+				t.Errorf("GetTokenTTLFrom() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDerivedUIDRanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		derive func(key string, n int) int
+		min    int
+		max    int
+	}{
+		{name: "per channel", derive: func(key string, n int) int { return DeriveUID(key, strconv.Itoa(n)) }, min: derivedUIDSpace, max: 1<<31 - 1},
+		{name: "per user", derive: DeriveUserUID, min: 1, max: derivedUIDSpace - 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for user := 0; user < 200; user++ {
+				for n := 0; n < 50; n++ {
+					uid := tt.derive(strconv.Itoa(user), n)
+					if uid < tt.min || uid > tt.max {
+						t.Fatalf("uid %d of user %d and %d is outside [%d, %d]", uid, user, n, tt.min, tt.max)
+					}
+
+					if uid >= minRandomUID && uid < maxRandomUID {
+						t.Fatalf("uid %d of user %d and %d is in the random uid range", uid, user, n)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestDeriveUserUIDAttempts(t *testing.T) {
+	tests := []struct {
+		name    string
+		userKey string
+	}{
+		{name: "first user", userKey: "1"},
+		{name: "large id", userKey: "9876543210"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if DeriveUserUID(tt.userKey, 3) != DeriveUserUID(tt.userKey, 3) {
+				t.Error("DeriveUserUID() is not stable")
+			}
+
+			seen := map[int]int{}
+			for attempt := 0; attempt < 16; attempt++ {
+				uid := DeriveUserUID(tt.userKey, attempt)
+				if previous, ok := seen[uid]; ok {
+					t.Errorf("attempts %d and %d both derive uid %d", previous, attempt, uid)
+				}
+				seen[uid] = attempt
+			}
+		})
+	}
+}
+
+func TestEventEnd(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name        string
+		eventEnd    string
+		wantErr     error
+		maxTTL      int
+		wantMaxTTL  int
+		expiresIn   time.Duration
+		wantExpires time.Duration
+	}{
+		{name: "no event", eventEnd: "", wantErr: nil, maxTTL: 7200, expiresIn: 48 * time.Hour, wantExpires: 48 * time.Hour},
+		{name: "event running", eventEnd: now.Add(time.Hour).Format(time.RFC3339), wantErr: nil, maxTTL: 3600, expiresIn: 48 * time.Hour, wantExpires: time.Hour},
+		{name: "expiry before the end", eventEnd: now.Add(time.Hour).Format(time.RFC3339), wantErr: nil, maxTTL: 3600, expiresIn: time.Minute, wantExpires: time.Minute},
+		{name: "event ended", eventEnd: now.Add(-time.Hour).Format(time.RFC3339), wantErr: ErrEventEnded, maxTTL: 1, expiresIn: time.Hour, wantExpires: -time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("EVENT_END", tt.eventEnd)
+			defer viper.Set("EVENT_END", "")
+
+			if err := CheckEventNotEnded(); err != tt.wantErr {
+				t.Errorf("CheckEventNotEnded() error = %v, want %v", err, tt.wantErr)
+			}
+
+			// The TTL is computed from the current time, so it may be a second short of the remaining time
+			if got := clampToEventEnd(7200); got > tt.maxTTL || got < tt.maxTTL-1 {
+				t.Errorf("clampToEventEnd() = %d, want %d", got, tt.maxTTL)
+			}
+
+			got := ClampExpiryToEventEnd(now.Add(tt.expiresIn)).Sub(now)
+			if got > tt.wantExpires || got < tt.wantExpires-time.Second {
+				t.Errorf("ClampExpiryToEventEnd() = now + %v, want now + %v", got, tt.wantExpires)
+			}
+
+			if _, err := GetRtmToken("1", 0); tt.wantErr != nil && err != tt.wantErr {
+				t.Errorf("GetRtmToken() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGenerateTokenBundle(t *testing.T) {
+	viper.Set("APP_ID", "970CA35de60c44645bbae8a215061b33")
+	viper.Set("APP_CERTIFICATE", "5CFd2fd1755d40ecb72977518be15d3b")
+	viper.Set("EVENT_END", "")
+	defer viper.Set("APP_ID", "")
+	defer viper.Set("APP_CERTIFICATE", nil)
+
+	tests := []struct {
+		name    string
+		channel string
+		uid     int
+		ttl     int
+	}{
+		{name: "default expiry", channel: "channel", uid: 1234, ttl: 0},
+		{name: "requested expiry", channel: "other-channel", uid: 98765432, ttl: 600},
+	}
+
+	checksum := func(value string) uint32 {
+		return crc32.Checksum([]byte(value), crc32.MakeTable(0xedb88320))
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bundle, err := GenerateTokenBundle(tt.channel, tt.uid, tt.ttl)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if bundle.AppID != viper.GetString("APP_ID") || bundle.Channel != tt.channel || bundle.UID != tt.uid {
+				t.Errorf("bundle = %+v, want app %s, channel %s and uid %d", bundle, viper.GetString("APP_ID"), tt.channel, tt.uid)
+			}
+
+			var rtc, rtm accesstoken.AccessToken
+			if !strings.HasPrefix(bundle.Rtc, "006"+bundle.AppID) || !rtc.FromString(bundle.Rtc) {
+				t.Fatalf("RTC token %q is not an access token of the app", bundle.Rtc)
+			}
+			if !strings.HasPrefix(bundle.Rtm, "006"+bundle.AppID) || !rtm.FromString(bundle.Rtm) {
+				t.Fatalf("RTM token %q is not an access token of the app", bundle.Rtm)
+			}
+
+			// The RTM token is issued to the user account, which is the uid of the RTC token
+			uid := strconv.Itoa(tt.uid)
+			if rtc.CrcChannelName != checksum(tt.channel) || rtc.CrcUid != checksum(uid) {
+				t.Errorf("RTC token is not for channel %s and uid %s", tt.channel, uid)
+			}
+			if rtm.CrcChannelName != checksum(uid) || rtm.CrcUid != checksum("") {
+				t.Errorf("RTM token is not for the user %s", uid)
+			}
+
+			rtcExpiry, rtmExpiry := rtc.Message[accesstoken.KJoinChannel], rtm.Message[accesstoken.KLoginRtm]
+			if rtcExpiry == 0 || rtmExpiry == 0 {
+				t.Fatalf("tokens expire at %d and %d, want both to grant their privilege", rtcExpiry, rtmExpiry)
+			}
+
+			wantExpiry := rtcExpiry
+			if rtmExpiry < wantExpiry {
+				wantExpiry = rtmExpiry
+			}
+			if uint32(bundle.Expiry) != wantExpiry {
+				t.Errorf("bundle expiry = %d, want the earlier token expiry %d", bundle.Expiry, wantExpiry)
+			}
+		})
+	}
+}